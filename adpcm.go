@@ -0,0 +1,384 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// imaIndexTable adjusts the step index after each IMA ADPCM nibble
+var imaIndexTable = [16]int{
+	-1, -1, -1, -1, 2, 4, 6, 8,
+	-1, -1, -1, -1, 2, 4, 6, 8,
+}
+
+// imaStepTable lists the quantizer step sizes for IMA ADPCM
+var imaStepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+// msAdaptationTable scales the MS ADPCM quantizer step after each nibble
+var msAdaptationTable = [16]int{
+	230, 230, 230, 230, 307, 409, 512, 614,
+	768, 614, 512, 409, 307, 230, 230, 230,
+}
+
+// msCoefficients are the standard MS ADPCM predictor coefficient pairs
+var msCoefficients = [][2]int{
+	{256, 0}, {512, -256}, {0, 0}, {192, 64}, {240, 0}, {460, -208}, {392, -232},
+}
+
+// clampInt16 clamps a value to the signed 16-bit range
+func clampInt16(value int) int {
+	if value > 32767 {
+		return 32767
+	}
+	if value < -32768 {
+		return -32768
+	}
+	return value
+}
+
+// imaState is the predictor state of one IMA ADPCM channel
+type imaState struct {
+	predictor int
+	index     int
+}
+
+// decode expands a single nibble and updates the state
+func (s *imaState) decode(nibble int) int {
+	step := imaStepTable[s.index]
+	diff := step >> 3
+	if nibble&4 != 0 {
+		diff += step
+	}
+	if nibble&2 != 0 {
+		diff += step >> 1
+	}
+	if nibble&1 != 0 {
+		diff += step >> 2
+	}
+	if nibble&8 != 0 {
+		s.predictor -= diff
+	} else {
+		s.predictor += diff
+	}
+	s.predictor = clampInt16(s.predictor)
+
+	s.index += imaIndexTable[nibble]
+	if s.index < 0 {
+		s.index = 0
+	} else if s.index > 88 {
+		s.index = 88
+	}
+	return s.predictor
+}
+
+// encode quantizes a sample to a nibble and updates the state exactly as the decoder will
+func (s *imaState) encode(sample int) int {
+	step := imaStepTable[s.index]
+	diff := sample - s.predictor
+	nibble := 0
+	if diff < 0 {
+		nibble = 8
+		diff = -diff
+	}
+	for mask := 4; mask > 0; mask >>= 1 {
+		if diff >= step {
+			nibble |= mask
+			diff -= step
+		}
+		step >>= 1
+	}
+	s.decode(nibble)
+	return nibble
+}
+
+// imaSamplesPerBlock returns the number of samples per channel in an IMA ADPCM block
+func imaSamplesPerBlock(blockAlign, numChannels int) int {
+	return (blockAlign-4*numChannels)*2/numChannels + 1
+}
+
+// decodeIMAADPCM decodes IMA ADPCM blocks into interleaved 16-bit samples
+func decodeIMAADPCM(data []byte, numChannels, blockAlign int) ([]int, error) {
+	if numChannels <= 0 || blockAlign <= 4*numChannels || (blockAlign-4*numChannels)%(4*numChannels) != 0 {
+		return nil, fmt.Errorf("invalid IMA ADPCM block size %d for %d channels", blockAlign, numChannels)
+	}
+
+	var samples []int
+	states := make([]imaState, numChannels)
+	for start := 0; start+4*numChannels <= len(data); start += blockAlign {
+		end := start + blockAlign
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[start:end]
+
+		// Block header: initial predictor and step index for each channel
+		for ch := 0; ch < numChannels; ch++ {
+			header := block[ch*4 : ch*4+4]
+			states[ch].predictor = int(int16(binary.LittleEndian.Uint16(header)))
+			states[ch].index = int(header[2])
+			if states[ch].index > 88 {
+				return nil, fmt.Errorf("invalid IMA ADPCM step index %d", states[ch].index)
+			}
+			samples = append(samples, states[ch].predictor)
+		}
+
+		// Each channel contributes 4 bytes (8 nibbles, low nibble first) per group
+		groups := (len(block) - 4*numChannels) / (4 * numChannels)
+		frames := make([]int, 8*numChannels)
+		for g := 0; g < groups; g++ {
+			for ch := 0; ch < numChannels; ch++ {
+				offset := 4*numChannels + (g*numChannels+ch)*4
+				for i, b := range block[offset : offset+4] {
+					frames[(2*i)*numChannels+ch] = states[ch].decode(int(b & 0x0F))
+					frames[(2*i+1)*numChannels+ch] = states[ch].decode(int(b >> 4))
+				}
+			}
+			samples = append(samples, frames...)
+		}
+	}
+
+	return samples, nil
+}
+
+// encodeIMAADPCM encodes interleaved 16-bit samples into IMA ADPCM blocks.
+// The final block is padded with silence; the true length is recorded in the fact chunk.
+func encodeIMAADPCM(samples []int, numChannels, blockAlign int) []byte {
+	samplesPerBlock := imaSamplesPerBlock(blockAlign, numChannels)
+	numFrames := len(samples) / numChannels
+	numBlocks := (numFrames + samplesPerBlock - 1) / samplesPerBlock
+
+	sampleAt := func(frame, ch int) int {
+		if frame >= numFrames {
+			return 0
+		}
+		return clampInt16(samples[frame*numChannels+ch])
+	}
+
+	out := make([]byte, 0, numBlocks*blockAlign)
+	states := make([]imaState, numChannels)
+	for b := 0; b < numBlocks; b++ {
+		first := b * samplesPerBlock
+
+		// Block header: the first sample is stored verbatim
+		for ch := 0; ch < numChannels; ch++ {
+			states[ch].predictor = sampleAt(first, ch)
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(states[ch].predictor)))
+			out = append(out, byte(states[ch].index), 0)
+		}
+
+		for g := 0; g < (samplesPerBlock-1)/8; g++ {
+			for ch := 0; ch < numChannels; ch++ {
+				for i := 0; i < 4; i++ {
+					frame := first + 1 + g*8 + 2*i
+					lo := states[ch].encode(sampleAt(frame, ch))
+					hi := states[ch].encode(sampleAt(frame+1, ch))
+					out = append(out, byte(lo|hi<<4))
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// msState is the predictor state of one MS ADPCM channel
+type msState struct {
+	coef1, coef2     int
+	delta            int
+	sample1, sample2 int
+}
+
+// predict returns the predicted next sample
+func (s *msState) predict() int {
+	return (s.sample1*s.coef1 + s.sample2*s.coef2) / 256
+}
+
+// decode expands a single nibble and updates the state
+func (s *msState) decode(nibble int) int {
+	signed := nibble
+	if signed&8 != 0 {
+		signed -= 16
+	}
+	sample := clampInt16(s.predict() + signed*s.delta)
+	s.sample2 = s.sample1
+	s.sample1 = sample
+
+	s.delta = msAdaptationTable[nibble] * s.delta >> 8
+	if s.delta < 16 {
+		s.delta = 16
+	}
+	return sample
+}
+
+// encode quantizes a sample to a nibble and updates the state exactly as the decoder will
+func (s *msState) encode(sample int) int {
+	diff := sample - s.predict()
+	bias := s.delta / 2
+	if diff < 0 {
+		bias = -bias
+	}
+	nibble := (diff + bias) / s.delta
+	if nibble > 7 {
+		nibble = 7
+	} else if nibble < -8 {
+		nibble = -8
+	}
+	nibble &= 0x0F
+	s.decode(nibble)
+	return nibble
+}
+
+// msSamplesPerBlock returns the number of samples per channel in an MS ADPCM block
+func msSamplesPerBlock(blockAlign, numChannels int) int {
+	return (blockAlign-7*numChannels)*2/numChannels + 2
+}
+
+// decodeMSADPCM decodes MS ADPCM blocks into interleaved 16-bit samples
+func decodeMSADPCM(data []byte, numChannels, blockAlign int, coefficients [][2]int) ([]int, error) {
+	if numChannels <= 0 || numChannels > 2 || blockAlign <= 7*numChannels {
+		return nil, fmt.Errorf("invalid MS ADPCM block size %d for %d channels", blockAlign, numChannels)
+	}
+	if len(coefficients) == 0 {
+		coefficients = msCoefficients
+	}
+
+	var samples []int
+	states := make([]msState, numChannels)
+	for start := 0; start+7*numChannels <= len(data); start += blockAlign {
+		end := start + blockAlign
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[start:end]
+
+		// Block header: predictor indices, then deltas, then the two most recent samples
+		for ch := 0; ch < numChannels; ch++ {
+			predictor := int(block[ch])
+			if predictor >= len(coefficients) {
+				return nil, fmt.Errorf("invalid MS ADPCM predictor %d", predictor)
+			}
+			states[ch].coef1 = coefficients[predictor][0]
+			states[ch].coef2 = coefficients[predictor][1]
+		}
+		readInt16 := func(field, ch int) int {
+			offset := numChannels + (field*numChannels+ch)*2
+			return int(int16(binary.LittleEndian.Uint16(block[offset:])))
+		}
+		for ch := 0; ch < numChannels; ch++ {
+			states[ch].delta = readInt16(0, ch)
+			states[ch].sample1 = readInt16(1, ch)
+			states[ch].sample2 = readInt16(2, ch)
+		}
+
+		// The header samples are emitted oldest first
+		for ch := 0; ch < numChannels; ch++ {
+			samples = append(samples, states[ch].sample2)
+		}
+		for ch := 0; ch < numChannels; ch++ {
+			samples = append(samples, states[ch].sample1)
+		}
+
+		// Nibbles are high nibble first and alternate between channels
+		ch := 0
+		for _, b := range block[7*numChannels:] {
+			for _, nibble := range [2]int{int(b >> 4), int(b & 0x0F)} {
+				samples = append(samples, states[ch].decode(nibble))
+				ch = (ch + 1) % numChannels
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// encodeMSADPCM encodes interleaved 16-bit samples into MS ADPCM blocks using the standard coefficients.
+// Each block uses the predictor with the smallest error; the final block is padded with silence.
+func encodeMSADPCM(samples []int, numChannels, blockAlign int) []byte {
+	samplesPerBlock := msSamplesPerBlock(blockAlign, numChannels)
+	numFrames := len(samples) / numChannels
+	numBlocks := (numFrames + samplesPerBlock - 1) / samplesPerBlock
+
+	sampleAt := func(frame, ch int) int {
+		if frame >= numFrames {
+			return 0
+		}
+		return clampInt16(samples[frame*numChannels+ch])
+	}
+
+	out := make([]byte, 0, numBlocks*blockAlign)
+	deltas := make([]int, numChannels)
+	for ch := range deltas {
+		deltas[ch] = 16
+	}
+	for b := 0; b < numBlocks; b++ {
+		first := b * samplesPerBlock
+
+		// Pick the predictor for each channel by trial encoding the block
+		states := make([]msState, numChannels)
+		predictors := make([]int, numChannels)
+		for ch := 0; ch < numChannels; ch++ {
+			bestError := -1
+			for p, coef := range msCoefficients {
+				trial := msState{coef1: coef[0], coef2: coef[1], delta: deltas[ch],
+					sample1: sampleAt(first+1, ch), sample2: sampleAt(first, ch)}
+				totalError := 0
+				for i := 2; i < samplesPerBlock; i++ {
+					sample := sampleAt(first+i, ch)
+					trial.encode(sample)
+					totalError += abs(sample - trial.sample1)
+				}
+				if bestError < 0 || totalError < bestError {
+					bestError = totalError
+					predictors[ch] = p
+				}
+			}
+			coef := msCoefficients[predictors[ch]]
+			states[ch] = msState{coef1: coef[0], coef2: coef[1], delta: deltas[ch],
+				sample1: sampleAt(first+1, ch), sample2: sampleAt(first, ch)}
+		}
+
+		// Block header
+		for ch := 0; ch < numChannels; ch++ {
+			out = append(out, byte(predictors[ch]))
+		}
+		for ch := 0; ch < numChannels; ch++ {
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(states[ch].delta)))
+		}
+		for ch := 0; ch < numChannels; ch++ {
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(states[ch].sample1)))
+		}
+		for ch := 0; ch < numChannels; ch++ {
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(states[ch].sample2)))
+		}
+
+		// Nibbles, high nibble first, alternating between channels
+		var pending []int
+		for i := 2; i < samplesPerBlock; i++ {
+			for ch := 0; ch < numChannels; ch++ {
+				pending = append(pending, states[ch].encode(sampleAt(first+i, ch)))
+			}
+		}
+		if len(pending)%2 == 1 {
+			pending = append(pending, 0)
+		}
+		for i := 0; i < len(pending); i += 2 {
+			out = append(out, byte(pending[i]<<4|pending[i+1]))
+		}
+
+		for ch := 0; ch < numChannels; ch++ {
+			deltas[ch] = states[ch].delta
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,119 @@
+package audiomorph
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIMAADPCMReferenceBlock(t *testing.T) {
+	// Reference block produced by the Intel/DVI reference encoder, seeded with the header state
+	samples := []int{1000, 1500, 2600, 4000, 2000, -3000, -8000, -12000, -100}
+	block := []byte{0xe8, 0x03, 0x00, 0x00, 0x77, 0x77, 0xff, 0x2f}
+	decoded := []int{1000, 1011, 1041, 1104, 1240, 947, 316, -1041, -71}
+
+	encoded := encodeIMAADPCM(samples, 1, len(block))
+	if !bytes.Equal(encoded, block) {
+		t.Errorf("IMA ADPCM block mismatch: expected %x, got %x", block, encoded)
+	}
+
+	result, err := decodeIMAADPCM(block, 1, len(block))
+	if err != nil {
+		t.Fatalf("Failed to decode IMA ADPCM block: %v", err)
+	}
+	if len(result) != len(decoded) {
+		t.Fatalf("Sample count mismatch: expected %d, got %d", len(decoded), len(result))
+	}
+	for i := range decoded {
+		if result[i] != decoded[i] {
+			t.Errorf("Sample mismatch at index %d: expected %d, got %d", i, decoded[i], result[i])
+		}
+	}
+}
+
+func TestMSADPCMReferenceBlock(t *testing.T) {
+	// Predictor 1, delta 20, sample1 100, sample2 50, followed by 8 nibbles
+	block := []byte{0x01, 0x14, 0x00, 0x64, 0x00, 0x32, 0x00, 0x12, 0x7f, 0x80, 0xe9}
+	decoded := []int{50, 100, 170, 274, 490, 668, 574, 480, 204, -639}
+
+	result, err := decodeMSADPCM(block, 1, len(block), nil)
+	if err != nil {
+		t.Fatalf("Failed to decode MS ADPCM block: %v", err)
+	}
+	if len(result) != len(decoded) {
+		t.Fatalf("Sample count mismatch: expected %d, got %d", len(decoded), len(result))
+	}
+	for i := range decoded {
+		if result[i] != decoded[i] {
+			t.Errorf("Sample mismatch at index %d: expected %d, got %d", i, decoded[i], result[i])
+		}
+	}
+
+	// Re-encoding the decoded samples must decode back to the same samples
+	encoded := encodeMSADPCM(decoded, 1, len(block))
+	again, err := decodeMSADPCM(encoded, 1, len(block), nil)
+	if err != nil {
+		t.Fatalf("Failed to decode re-encoded MS ADPCM block: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if again[i] != decoded[i] {
+			t.Errorf("Header sample %d mismatch: expected %d, got %d", i, decoded[i], again[i])
+		}
+	}
+}
+
+func TestEncodeWAVADPCM(t *testing.T) {
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+
+	for _, codec := range []string{"ima-adpcm", "ms-adpcm"} {
+		t.Run(codec, func(t *testing.T) {
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_output_"+codec+".wav")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, OptionWAVCodec(codec))
+			if err != nil {
+				t.Fatalf("Failed to encode %s WAV file: %v", codec, err)
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s WAV file: %v", codec, err)
+			}
+
+			if decodedAudio.NumChannels != audio.NumChannels {
+				t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+			}
+			if decodedAudio.SampleRate != audio.SampleRate {
+				t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+			}
+
+			// The fact chunk restores the exact sample count
+			if len(decodedAudio.Data[0]) != len(audio.Data[0]) {
+				t.Fatalf("Sample count mismatch: expected %d, got %d", len(audio.Data[0]), len(decodedAudio.Data[0]))
+			}
+
+			// ADPCM is lossy, but the signal to noise ratio should be well above 20 dB
+			var signal, noise float64
+			for ch := 0; ch < audio.NumChannels; ch++ {
+				for i, sample := range audio.Data[ch] {
+					diff := float64(sample - decodedAudio.Data[ch][i])
+					signal += float64(sample) * float64(sample)
+					noise += diff * diff
+				}
+			}
+			snr := 10 * math.Log10(signal/noise)
+			if snr < 20 {
+				t.Errorf("Signal to noise ratio too low: %.1f dB", snr)
+			}
+
+			t.Logf("%s round trip SNR: %.1f dB", codec, snr)
+		})
+	}
+}
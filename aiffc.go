@@ -0,0 +1,237 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// aifcVersion is the timestamp stored in the FVER chunk of AIFF-C version 1 files
+const aifcVersion = 0xA2805140
+
+// aifcCompressionNames are the human readable names written alongside each compression type
+var aifcCompressionNames = map[string]string{
+	"NONE": "not compressed",
+	"sowt": "",
+	"fl32": "32-bit floating point",
+	"ulaw": "uLaw 2:1",
+	"alaw": "aLaw 2:1",
+}
+
+// OptionAIFFCompression specifies the AIFF-C compression type used when writing AIFF files.
+// Valid types are: "NONE" (big endian PCM), "sowt" (little endian PCM), "fl32", "ulaw", "alaw".
+// Setting a compression type, or writing a .aifc file, produces an AIFF-C file.
+func OptionAIFFCompression(compression string) Option {
+	return func(a *Audio) {
+		a.aiffCompression = compression
+	}
+}
+
+// aifcCompression returns the canonical compression type configured on an Audio
+func aifcCompression(a *Audio) (string, error) {
+	if a.aiffCompression == "" {
+		return "NONE", nil
+	}
+	for compression := range aifcCompressionNames {
+		if strings.EqualFold(compression, a.aiffCompression) {
+			return compression, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported AIFF-C compression: %s", a.aiffCompression)
+}
+
+// decodeAIFC decodes the chunks of an AIFF-C file
+func decodeAIFC(chunks []riffChunk) (*Audio, error) {
+	comm := findChunk(chunks, "COMM")
+	if comm == nil || len(comm.data) < 22 {
+		return nil, fmt.Errorf("invalid AIFF-C file: missing COMM chunk")
+	}
+	numChannels := int(binary.BigEndian.Uint16(comm.data[0:2]))
+	numSamples := int(binary.BigEndian.Uint32(comm.data[2:6]))
+	sampleSize := int(binary.BigEndian.Uint16(comm.data[6:8]))
+	sampleRate := int(math.Round(extendedToFloat64(comm.data[8:18])))
+	compression := string(comm.data[18:22])
+	if numChannels <= 0 || sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid AIFF-C format: %d channels at %d Hz", numChannels, sampleRate)
+	}
+
+	ssnd := findChunk(chunks, "SSND")
+	if ssnd == nil || len(ssnd.data) < 8 {
+		return nil, fmt.Errorf("invalid AIFF-C file: missing SSND chunk")
+	}
+	offset := int(binary.BigEndian.Uint32(ssnd.data[0:4]))
+	if 8+offset > len(ssnd.data) {
+		return nil, fmt.Errorf("invalid AIFF-C SSND offset: %d", offset)
+	}
+	data := ssnd.data[8+offset:]
+
+	// Samples narrower than their container are left justified, so they decode at the container size
+	containerBits := (sampleSize + 7) / 8 * 8
+	var samples []int
+	bitDepth := containerBits
+	switch compression {
+	case "NONE", "twos", "in24", "in32":
+		if compression == "in24" {
+			containerBits = 24
+		} else if compression == "in32" {
+			containerBits = 32
+		}
+		bitDepth = containerBits
+		samples = decodeSamples(data, rawSpec{bits: containerBits, bigEndian: true})
+	case "sowt", "42ni", "23ni":
+		if compression == "42ni" {
+			containerBits = 24
+		} else if compression == "23ni" {
+			containerBits = 32
+		}
+		bitDepth = containerBits
+		samples = decodeSamples(data, rawSpec{bits: containerBits})
+	case "raw ":
+		bitDepth = 8
+		samples = decodeSamples(data, rawSpec{bits: 8, unsigned: true})
+	case "fl32", "FL32", "fl64", "FL64":
+		bits := 32
+		if strings.EqualFold(compression, "fl64") {
+			bits = 64
+		}
+		bitDepth = 32
+		samples = decodeSamples(data, rawSpec{bits: bits, float: true, bigEndian: true})
+	case "ulaw", "ULAW", "alaw", "ALAW":
+		expand := uLawToLinear
+		if strings.EqualFold(compression, "alaw") {
+			expand = aLawToLinear
+		}
+		bitDepth = 16
+		samples = make([]int, len(data))
+		for i, code := range data {
+			samples[i] = expand(code)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported AIFF-C compression: %q", compression)
+	}
+	if bitDepth != 8 && bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+		return nil, fmt.Errorf("unsupported AIFF-C sample size: %d bits", sampleSize)
+	}
+
+	if n := len(samples) / numChannels; n < numSamples {
+		numSamples = n
+	}
+
+	return &Audio{
+		NumChannels: numChannels,
+		SampleRate:  sampleRate,
+		BitDepth:    bitDepth,
+		Data:        deinterlace(samples[:numSamples*numChannels], numChannels),
+		Duration:    float64(numSamples) / float64(sampleRate),
+	}, nil
+}
+
+// encodeAIFC encodes audio data to an AIFF-C file with the compression from OptionAIFFCompression
+func encodeAIFC(audio *Audio, filename string) error {
+	compression, err := aifcCompression(audio)
+	if err != nil {
+		return err
+	}
+
+	samples, numChannels := interlace(audio)
+	numSamples := len(samples) / numChannels
+
+	var data []byte
+	sampleSize := audio.BitDepth
+	switch compression {
+	case "NONE":
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: audio.BitDepth, bigEndian: true})
+	case "sowt":
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: audio.BitDepth})
+	case "fl32":
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: 32, float: true, bigEndian: true})
+		sampleSize = 32
+	case "ulaw", "alaw":
+		compress := linearToULaw
+		if compression == "alaw" {
+			compress = linearToALaw
+		}
+		data = make([]byte, len(samples))
+		for i, sample := range samples {
+			data[i] = compress(sample)
+		}
+		sampleSize = 16
+	}
+
+	comm := make([]byte, 0, 24+len(aifcCompressionNames[compression]))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(numChannels))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(numSamples))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(sampleSize))
+	rate := float64ToExtended(float64(audio.SampleRate))
+	comm = append(comm, rate[:]...)
+	comm = append(comm, compression...)
+	comm = appendPascalString(comm, aifcCompressionNames[compression])
+
+	ssnd := make([]byte, 8, 8+len(data))
+	ssnd = append(ssnd, data...)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create AIFF-C file: %w", err)
+	}
+	defer f.Close()
+
+	chunks := []riffChunk{
+		{id: "FVER", data: binary.BigEndian.AppendUint32(nil, aifcVersion)},
+		{id: "COMM", data: comm},
+		{id: "SSND", data: ssnd},
+	}
+	if err := writeIFF(f, "AIFC", chunks); err != nil {
+		return fmt.Errorf("failed to write AIFF-C data: %w", err)
+	}
+
+	return nil
+}
+
+// appendPascalString appends a length prefixed string, padded to an even total length
+func appendPascalString(b []byte, s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b = append(b, byte(len(s)))
+	b = append(b, s...)
+	if (len(s)+1)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// extendedToFloat64 converts an 80-bit IEEE 754 extended precision number to a float64
+func extendedToFloat64(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7FFF)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
+
+// float64ToExtended converts a float64 to an 80-bit IEEE 754 extended precision number
+func float64ToExtended(value float64) [10]byte {
+	var b [10]byte
+	if value == 0 {
+		return b
+	}
+	sign := uint16(0)
+	if value < 0 {
+		sign = 0x8000
+		value = -value
+	}
+
+	// value = fraction * 2^exponent with fraction in [0.5, 1), the mantissa has an explicit integer bit
+	fraction, exponent := math.Frexp(value)
+	binary.BigEndian.PutUint16(b[0:2], sign|uint16(exponent-1+16383))
+	binary.BigEndian.PutUint64(b[2:10], uint64(math.Ldexp(fraction, 64)))
+	return b
+}
@@ -0,0 +1,119 @@
+package audiomorph
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeAIFC(t *testing.T) {
+	srcFilename := filepath.Join("data", "wilhelm.aiff")
+
+	testCases := []struct {
+		compression string
+		bitDepth    int
+	}{
+		{"NONE", 16},
+		{"sowt", 16},
+		{"fl32", 32},
+		{"ulaw", 16},
+		{"alaw", 16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.compression, func(t *testing.T) {
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_output_"+tc.compression+".aifc")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, OptionAIFFCompression(tc.compression))
+			if err != nil {
+				t.Fatalf("Failed to encode AIFF-C file: %v", err)
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode AIFF-C file: %v", err)
+			}
+
+			// Verify basic properties match
+			if decodedAudio.NumChannels != audio.NumChannels {
+				t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+			}
+			if decodedAudio.SampleRate != audio.SampleRate {
+				t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+			}
+			if decodedAudio.BitDepth != tc.bitDepth {
+				t.Errorf("BitDepth mismatch: expected %d, got %d", tc.bitDepth, decodedAudio.BitDepth)
+			}
+
+			for ch := 0; ch < audio.NumChannels; ch++ {
+				if len(decodedAudio.Data[ch]) != len(audio.Data[ch]) {
+					t.Fatalf("Sample count mismatch: expected %d, got %d", len(audio.Data[ch]), len(decodedAudio.Data[ch]))
+				}
+				for i, sample := range audio.Data[ch] {
+					expected := sample
+					switch tc.compression {
+					case "fl32":
+						expected = sample << 16
+					case "ulaw":
+						expected = uLawToLinear(linearToULaw(sample))
+					case "alaw":
+						expected = aLawToLinear(linearToALaw(sample))
+					}
+					if decodedAudio.Data[ch][i] != expected {
+						t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, expected, decodedAudio.Data[ch][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAIFCSowtIsLittleEndian(t *testing.T) {
+	audio := &Audio{
+		NumChannels: 1,
+		SampleRate:  44100,
+		BitDepth:    16,
+		Data:        [][]int{{0x1234, -2}},
+		Duration:    2.0 / 44100,
+	}
+
+	dstFilename := filepath.Join(os.TempDir(), "test_output_sowt.aiff")
+	defer os.Remove(dstFilename)
+
+	if err := EncodeFile(audio, dstFilename, OptionAIFFCompression("sowt")); err != nil {
+		t.Fatalf("Failed to encode AIFF-C file: %v", err)
+	}
+
+	raw, err := os.ReadFile(dstFilename)
+	if err != nil {
+		t.Fatalf("Failed to read AIFF-C file: %v", err)
+	}
+	if string(raw[8:12]) != "AIFC" {
+		t.Errorf("Expected AIFC form type, got %q", raw[8:12])
+	}
+	if !bytes.HasSuffix(raw, []byte{0x34, 0x12, 0xfe, 0xff}) {
+		t.Errorf("Expected little endian sample data, got %x", raw[len(raw)-4:])
+	}
+}
+
+func TestExtendedFloat(t *testing.T) {
+	// 44100 Hz as stored in the COMM chunk of CD audio AIFF files
+	expected := [10]byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}
+	if got := float64ToExtended(44100); got != expected {
+		t.Errorf("Extended encoding of 44100 mismatch: expected %x, got %x", expected, got)
+	}
+
+	for _, rate := range []float64{8000, 11025, 22050, 44100, 48000, 96000, 192000} {
+		b := float64ToExtended(rate)
+		if got := extendedToFloat64(b[:]); got != rate {
+			t.Errorf("Extended round trip of %v returned %v", rate, got)
+		}
+	}
+}
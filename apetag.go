@@ -0,0 +1,191 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// APEv2 tag flags
+const (
+	apeHasHeader = 1 << 31
+	apeIsHeader  = 1 << 29
+	apeBinary    = 1 << 1
+)
+
+// apeItems maps APEv2 item keys to metadata keys
+var apeItems = []struct {
+	item string
+	key  string
+}{
+	{"Title", "TITLE"},
+	{"Artist", "ARTIST"},
+	{"Album", "ALBUM"},
+	{"Album Artist", "ALBUMARTIST"},
+	{"Genre", "GENRE"},
+	{"Year", "DATE"},
+	{"Track", "TRACKNUMBER"},
+	{"Disc", "DISCNUMBER"},
+	{"Composer", "COMPOSER"},
+	{"Comment", "COMMENT"},
+	{"Copyright", "COPYRIGHT"},
+	{"Encoder", "ENCODER"},
+}
+
+// apeCoverArt maps picture types to APEv2 cover art items
+var apeCoverArt = map[int]string{
+	3: "Cover Art (Front)",
+	4: "Cover Art (Back)",
+}
+
+// apeTagBounds returns the start and end of the APEv2 tag at the end of a file, skipping a
+// trailing ID3v1 tag, or (-1, -1) if there is none
+func apeTagBounds(raw []byte) (int, int) {
+	end := len(raw)
+	if end >= 128 && string(raw[end-128:end-125]) == "TAG" {
+		end -= 128
+	}
+	if end < 32 || string(raw[end-32:end-24]) != "APETAGEX" {
+		return -1, -1
+	}
+	footer := raw[end-32 : end]
+	size := int(binary.LittleEndian.Uint32(footer[12:16]))
+	flags := binary.LittleEndian.Uint32(footer[20:24])
+	start := end - size
+	if flags&apeHasHeader != 0 {
+		start -= 32
+	}
+	if start < 0 || size < 32 {
+		return -1, -1
+	}
+	return start, end
+}
+
+// readAPEMetadata reads the APEv2 tag at the end of a file
+func readAPEMetadata(raw []byte) Metadata {
+	var m Metadata
+	start, end := apeTagBounds(raw)
+	if start < 0 {
+		return m
+	}
+	footer := raw[end-32 : end]
+	count := int(binary.LittleEndian.Uint32(footer[16:20]))
+	items := raw[end-int(binary.LittleEndian.Uint32(footer[12:16])) : end-32]
+
+	for i := 0; i < count && len(items) >= 8; i++ {
+		size := int(binary.LittleEndian.Uint32(items[0:4]))
+		flags := binary.LittleEndian.Uint32(items[4:8])
+		keyEnd := bytes.IndexByte(items[8:], 0)
+		if keyEnd < 0 || 8+keyEnd+1+size > len(items) || size < 0 {
+			break
+		}
+		item := string(items[8 : 8+keyEnd])
+		value := items[8+keyEnd+1 : 8+keyEnd+1+size]
+		items = items[8+keyEnd+1+size:]
+
+		if flags&(3<<1) == apeBinary {
+			// Binary cover art holds a file name followed by the picture data
+			if !strings.HasPrefix(strings.ToLower(item), "cover art") {
+				continue
+			}
+			var picture Picture
+			for pictureType, name := range apeCoverArt {
+				if strings.EqualFold(name, item) {
+					picture.Type = pictureType
+				}
+			}
+			if nameEnd := bytes.IndexByte(value, 0); nameEnd >= 0 {
+				picture.Description = string(value[:nameEnd])
+				value = value[nameEnd+1:]
+			}
+			picture.Data = append([]byte(nil), value...)
+			picture.MIMEType = sniffMIMEType(picture.Data)
+			m.Pictures = append(m.Pictures, picture)
+			continue
+		}
+
+		key := item
+		for _, entry := range apeItems {
+			if strings.EqualFold(entry.item, item) {
+				key = entry.key
+				break
+			}
+		}
+		// Multiple values are null separated
+		m.add(key, strings.Join(strings.Split(string(value), "\x00"), "; "))
+	}
+	return m
+}
+
+// buildAPETag builds an APEv2 tag with a header and a footer
+func buildAPETag(m Metadata) []byte {
+	var items []byte
+	count := 0
+	appendItem := func(item string, flags uint32, value []byte) {
+		items = binary.LittleEndian.AppendUint32(items, uint32(len(value)))
+		items = binary.LittleEndian.AppendUint32(items, flags)
+		items = append(items, item...)
+		items = append(items, 0)
+		items = append(items, value...)
+		count++
+	}
+
+	for _, field := range m.Tags() {
+		key, value := field[0], field[1]
+		switch key {
+		case "TRACKNUMBER", "TRACKTOTAL":
+			if key == "TRACKNUMBER" || m.TrackNumber == 0 {
+				appendItem("Track", 0, []byte(numberWithTotal(m.TrackNumber, m.TrackTotal)))
+			}
+			continue
+		case "DISCNUMBER", "DISCTOTAL":
+			if key == "DISCNUMBER" || m.DiscNumber == 0 {
+				appendItem("Disc", 0, []byte(numberWithTotal(m.DiscNumber, m.DiscTotal)))
+			}
+			continue
+		}
+		item := key
+		for _, entry := range apeItems {
+			if entry.key == key {
+				item = entry.item
+				break
+			}
+		}
+		appendItem(item, 0, []byte(value))
+	}
+
+	for _, picture := range m.Pictures {
+		item, ok := apeCoverArt[picture.Type]
+		if !ok {
+			item = "Cover Art (Other)"
+		}
+		value := append([]byte(picture.Description), 0)
+		appendItem(item, apeBinary, append(value, picture.Data...))
+	}
+
+	header := func(flags uint32) []byte {
+		b := []byte("APETAGEX")
+		b = binary.LittleEndian.AppendUint32(b, 2000)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(items)+32))
+		b = binary.LittleEndian.AppendUint32(b, uint32(count))
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		return append(b, make([]byte, 8)...)
+	}
+
+	tag := header(apeHasHeader | apeIsHeader)
+	tag = append(tag, items...)
+	return append(tag, header(apeHasHeader)...)
+}
+
+// updateAPEMetadata replaces the APEv2 tag at the end of a file
+func updateAPEMetadata(raw []byte, m Metadata) ([]byte, error) {
+	if start, _ := apeTagBounds(raw); start >= 0 {
+		raw = raw[:start]
+	} else if len(raw) >= 128 && string(raw[len(raw)-128:len(raw)-125]) == "TAG" {
+		raw = raw[:len(raw)-128]
+	}
+	if m.IsEmpty() {
+		return raw, nil
+	}
+	return append(raw, buildAPETag(m)...), nil
+}
@@ -0,0 +1,159 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sun/NeXT .au encodings
+const (
+	auEncodingULaw    = 1
+	auEncodingLinear8 = 2
+	auEncodingFloat   = 6
+	auEncodingDouble  = 7
+	auEncodingALaw    = 27
+)
+
+// OptionAUEncoding specifies the sample encoding used when writing .au/.snd files.
+// Valid encodings are: "pcm" (default, big endian linear PCM at the audio's bit depth), "ulaw", "alaw", "float".
+func OptionAUEncoding(encoding string) Option {
+	return func(a *Audio) {
+		a.auEncoding = encoding
+	}
+}
+
+// auEncodingName returns the canonical encoding name configured on an Audio
+func auEncodingName(a *Audio) (string, error) {
+	encoding := strings.ToLower(a.auEncoding)
+	switch encoding {
+	case "":
+		return "pcm", nil
+	case "ulaw", "alaw", "pcm", "float":
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("unsupported AU encoding: %s", a.auEncoding)
+	}
+}
+
+// auHeaderSize is the size of the header written by encodeAU, including an empty annotation
+const auHeaderSize = 32
+
+// decodeAU decodes a Sun/NeXT .au or .snd file
+func decodeAU(filename string) (*Audio, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AU file: %w", err)
+	}
+	if len(raw) < 24 || string(raw[0:4]) != ".snd" {
+		return nil, fmt.Errorf("invalid AU file")
+	}
+
+	// Header fields are big endian
+	dataOffset := int(binary.BigEndian.Uint32(raw[4:8]))
+	dataSize := int(binary.BigEndian.Uint32(raw[8:12]))
+	encoding := binary.BigEndian.Uint32(raw[12:16])
+	sampleRate := int(binary.BigEndian.Uint32(raw[16:20]))
+	numChannels := int(binary.BigEndian.Uint32(raw[20:24]))
+	if dataOffset < 24 || dataOffset > len(raw) || numChannels <= 0 || sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid AU header")
+	}
+
+	// A data size of 0xFFFFFFFF means the data runs to the end of the file
+	data := raw[dataOffset:]
+	if uint32(dataSize) != 0xFFFFFFFF && dataSize < len(data) {
+		data = data[:dataSize]
+	}
+
+	var samples []int
+	bitDepth := 16
+	switch encoding {
+	case auEncodingULaw, auEncodingALaw:
+		expand := uLawToLinear
+		if encoding == auEncodingALaw {
+			expand = aLawToLinear
+		}
+		samples = make([]int, len(data))
+		for i, code := range data {
+			samples[i] = expand(code)
+		}
+	case auEncodingLinear8, auEncodingLinear8 + 1, auEncodingLinear8 + 2, auEncodingLinear8 + 3:
+		// Linear PCM is signed big endian, 8 to 32 bits
+		bitDepth = 8 * int(encoding-auEncodingLinear8+1)
+		samples = decodeSamples(data, rawSpec{bits: bitDepth, bigEndian: true})
+	case auEncodingFloat, auEncodingDouble:
+		// Float samples are scaled to 32-bit integers
+		bits := 32
+		if encoding == auEncodingDouble {
+			bits = 64
+		}
+		bitDepth = 32
+		samples = decodeSamples(data, rawSpec{bits: bits, float: true, bigEndian: true})
+	default:
+		return nil, fmt.Errorf("unsupported AU encoding: %d", encoding)
+	}
+
+	numSamples := len(samples) / numChannels
+
+	return &Audio{
+		NumChannels: numChannels,
+		SampleRate:  sampleRate,
+		BitDepth:    bitDepth,
+		Data:        deinterlace(samples[:numSamples*numChannels], numChannels),
+		Duration:    float64(numSamples) / float64(sampleRate),
+	}, nil
+}
+
+// encodeAU encodes audio data to a .au file with the encoding from OptionAUEncoding
+func encodeAU(audio *Audio, filename string) error {
+	encodingName, err := auEncodingName(audio)
+	if err != nil {
+		return err
+	}
+
+	samples, numChannels := interlace(audio)
+
+	var data []byte
+	var encoding uint32
+	switch encodingName {
+	case "ulaw", "alaw":
+		compress := linearToULaw
+		encoding = auEncodingULaw
+		if encodingName == "alaw" {
+			compress = linearToALaw
+			encoding = auEncodingALaw
+		}
+		data = make([]byte, len(samples))
+		for i, sample := range samples {
+			data[i] = compress(sample)
+		}
+	case "pcm":
+		encoding = auEncodingLinear8 + uint32(audio.BitDepth/8-1)
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: audio.BitDepth, bigEndian: true})
+	case "float":
+		encoding = auEncodingFloat
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: 32, float: true, bigEndian: true})
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create AU file: %w", err)
+	}
+	defer f.Close()
+
+	out := make([]byte, auHeaderSize, auHeaderSize+len(data))
+	copy(out[0:4], ".snd")
+	binary.BigEndian.PutUint32(out[4:8], auHeaderSize)
+	binary.BigEndian.PutUint32(out[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(out[12:16], encoding)
+	binary.BigEndian.PutUint32(out[16:20], uint32(audio.SampleRate))
+	binary.BigEndian.PutUint32(out[20:24], uint32(numChannels))
+	out = append(out, data...)
+
+	if _, err := f.Write(out); err != nil {
+		return fmt.Errorf("failed to write AU data: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeAU(t *testing.T) {
+	// Decode an existing audio file
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+	audio, err := DecodeFile(srcFilename)
+	if err != nil {
+		t.Fatalf("Failed to decode source file: %v", err)
+	}
+
+	for _, ext := range []string{".au", ".snd"} {
+		dstFilename := filepath.Join(os.TempDir(), "test_output"+ext)
+		defer os.Remove(dstFilename)
+
+		err = EncodeFile(audio, dstFilename)
+		if err != nil {
+			t.Fatalf("Failed to encode %s file: %v", ext, err)
+		}
+
+		decodedAudio, err := DecodeFile(dstFilename)
+		if err != nil {
+			t.Fatalf("Failed to decode %s file: %v", ext, err)
+		}
+
+		// Verify basic properties match
+		if decodedAudio.NumChannels != audio.NumChannels {
+			t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+		}
+		if decodedAudio.SampleRate != audio.SampleRate {
+			t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+		}
+		if len(decodedAudio.Data[0]) != len(audio.Data[0]) {
+			t.Errorf("Sample count mismatch: expected %d, got %d", len(audio.Data[0]), len(decodedAudio.Data[0]))
+		}
+
+		// Linear PCM at the source bit depth is the default .au encoding
+		if decodedAudio.BitDepth != audio.BitDepth {
+			t.Errorf("BitDepth mismatch: expected %d, got %d", audio.BitDepth, decodedAudio.BitDepth)
+		}
+		assertSamplesEqual(t, audio.Data, decodedAudio.Data)
+	}
+
+	t.Logf("AU Encode/Decode test passed")
+}
+
+func TestAUEncodings(t *testing.T) {
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+
+	testCases := []struct {
+		encoding string
+		bitDepth int
+	}{
+		{"ulaw", 16},
+		{"alaw", 16},
+		{"pcm", 16},
+		{"float", 32},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.encoding, func(t *testing.T) {
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_output_"+tc.encoding+".au")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, OptionAUEncoding(tc.encoding))
+			if err != nil {
+				t.Fatalf("Failed to encode %s AU file: %v", tc.encoding, err)
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s AU file: %v", tc.encoding, err)
+			}
+			if decodedAudio.BitDepth != tc.bitDepth {
+				t.Errorf("BitDepth mismatch: expected %d, got %d", tc.bitDepth, decodedAudio.BitDepth)
+			}
+
+			for ch := 0; ch < audio.NumChannels; ch++ {
+				for i, sample := range audio.Data[ch] {
+					expected := sample
+					switch tc.encoding {
+					case "ulaw":
+						expected = uLawToLinear(linearToULaw(sample))
+					case "alaw":
+						expected = aLawToLinear(linearToALaw(sample))
+					case "float":
+						expected = sample << 16
+					}
+					if decodedAudio.Data[ch][i] != expected {
+						t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, expected, decodedAudio.Data[ch][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAU20Bit(t *testing.T) {
+	// 20-bit audio, as decoded from FLAC or WavPack, is written as 24-bit linear PCM
+	audio := &Audio{NumChannels: 2, SampleRate: 44100, BitDepth: 20, Data: testSignal(2, 1000, 20)}
+	filename := filepath.Join(os.TempDir(), "test_output_20bit.au")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode AU file: %v", err)
+	}
+
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode AU file: %v", err)
+	}
+	if decoded.BitDepth != 24 {
+		t.Errorf("BitDepth mismatch: expected 24, got %d", decoded.BitDepth)
+	}
+	expected := testSignal(2, 1000, 20)
+	for ch := range expected {
+		for i := range expected[ch] {
+			expected[ch][i] <<= 4
+		}
+	}
+	assertSamplesEqual(t, expected, decoded.Data)
+}
@@ -1,5 +1,10 @@
 package audiomorph
 
+import (
+	"github.com/schollz/audiomorph/dynamics"
+	"github.com/schollz/audiomorph/filter"
+)
+
 // Audio represents decoded audio data
 type Audio struct {
 	NumChannels         int
@@ -7,10 +12,44 @@ type Audio struct {
 	BitDepth            int
 	Data                [][]int // Data[channel][sample] - deinterlaced audio data
 	Duration            float64 // in seconds
+	Metadata            Metadata
+	Broadcast           *BroadcastExtension // bext chunk of Broadcast Wave files
+	IXML                *IXML
+	Markers             []Marker    // cue points and regions
+	Instrument          *Instrument // sampler settings and loops
+	LoopInfo            *LoopInfo   // ACID and Apple Loops tempo and key
+	History             []string    // coding history rows as in EBU R 98, oldest first
 	useChannels         []int
 	targetSampleRate    int
 	targetBitDepth      int
 	interpolationMethod string
+	rawFormat           string
+	rawEndianness       string
+	rawChannels         int
+	rawSampleRate       int
+	wavCodec            string
+	auEncoding          string
+	aiffCompression     string
+	wavpackMode         string
+	wavpackBitrate      float64
+	oggStream           int
+	normalize           *normalization
+	trim                *edges
+	pad                 *edges
+	gain                *float64 // dB
+	clipped             int      // samples clipped by the gain of the last encode
+	pan                 *float64
+	invertPolarity      []int // channels to invert, every channel if empty
+	swapChannels        []int
+	filters             []filter.Filter
+	dynamics            []dynamics.Processor
+	declip              bool
+	declipped           []int    // samples repaired on each channel by the last encode
+	removeDC            *string  // DC offset removal method
+	trimSilence         *float64 // threshold in dBFS
+	fadeIn              *fade
+	fadeOut             *fade
+	coding              string // coding of the decoded file, when its format has several
 }
 
 // Option is the type all options need to adhere to
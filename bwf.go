@@ -0,0 +1,295 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// bextSize is the size of the fixed part of a bext chunk, the coding history follows it
+const bextSize = 602
+
+// bextLoudnessUnset marks a loudness field of a bext chunk that is not used
+const bextLoudnessUnset = 0x7FFF
+
+// BroadcastExtension holds the bext chunk of a Broadcast Wave (BWF) file
+type BroadcastExtension struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	OriginationDate     string // yyyy-mm-dd
+	OriginationTime     string // hh:mm:ss
+	TimeReference       uint64 // first sample of the file, in samples since midnight
+	Version             int
+	UMID                [64]byte
+	Loudness            *BroadcastLoudness // nil if the chunk has no loudness information
+	CodingHistory       string
+}
+
+// BroadcastLoudness holds the EBU R128 loudness fields of a version 2 bext chunk.
+// Fields that are not used are NaN.
+type BroadcastLoudness struct {
+	LoudnessValue        float64 // integrated loudness in LUFS
+	LoudnessRange        float64 // in LU
+	MaxTruePeakLevel     float64 // in dBTP
+	MaxMomentaryLoudness float64 // in LUFS
+	MaxShortTermLoudness float64 // in LUFS
+}
+
+// IXML holds the production metadata of an iXML chunk
+type IXML struct {
+	Project string
+	Scene   string
+	Take    string
+	Tape    string
+	Note    string
+	Circled bool
+	Raw     string // the document as read, its other elements are preserved on write
+}
+
+// OptionBroadcastExtension sets the bext chunk written to WAV and W64 files
+func OptionBroadcastExtension(bext *BroadcastExtension) Option {
+	return func(a *Audio) {
+		a.Broadcast = bext
+	}
+}
+
+// OptionIXML sets the iXML chunk written to WAV and W64 files
+func OptionIXML(ixml *IXML) Option {
+	return func(a *Audio) {
+		a.IXML = ixml
+	}
+}
+
+// bextText decodes a fixed size, null padded ASCII field
+func bextText(b []byte) string {
+	if end := bytes.IndexByte(b, 0); end >= 0 {
+		b = b[:end]
+	}
+	return string(b)
+}
+
+// parseBext parses the body of a bext chunk
+func parseBext(data []byte) (*BroadcastExtension, error) {
+	if len(data) < 348 {
+		return nil, fmt.Errorf("bext chunk too short: %d bytes", len(data))
+	}
+	if len(data) < bextSize {
+		data = append(data, make([]byte, bextSize-len(data))...)
+	}
+
+	b := &BroadcastExtension{
+		Description:         bextText(data[0:256]),
+		Originator:          bextText(data[256:288]),
+		OriginatorReference: bextText(data[288:320]),
+		OriginationDate:     bextText(data[320:330]),
+		OriginationTime:     bextText(data[330:338]),
+		TimeReference:       binary.LittleEndian.Uint64(data[338:346]),
+		Version:             int(binary.LittleEndian.Uint16(data[346:348])),
+		CodingHistory:       bextText(data[bextSize:]),
+	}
+	copy(b.UMID[:], data[348:412])
+
+	if b.Version >= 2 {
+		field := func(offset int) float64 {
+			value := int16(binary.LittleEndian.Uint16(data[offset:]))
+			if value == bextLoudnessUnset {
+				return math.NaN()
+			}
+			return float64(value) / 100
+		}
+		loudness := &BroadcastLoudness{
+			LoudnessValue:        field(412),
+			LoudnessRange:        field(414),
+			MaxTruePeakLevel:     field(416),
+			MaxMomentaryLoudness: field(418),
+			MaxShortTermLoudness: field(420),
+		}
+		for _, value := range []float64{loudness.LoudnessValue, loudness.LoudnessRange, loudness.MaxTruePeakLevel, loudness.MaxMomentaryLoudness, loudness.MaxShortTermLoudness} {
+			if !math.IsNaN(value) {
+				b.Loudness = loudness
+			}
+		}
+	}
+	return b, nil
+}
+
+// buildBext builds the body of a bext chunk. Loudness information makes it a version 2 chunk.
+func buildBext(b *BroadcastExtension) []byte {
+	data := make([]byte, bextSize)
+	copy(data[0:256], b.Description)
+	copy(data[256:288], b.Originator)
+	copy(data[288:320], b.OriginatorReference)
+	copy(data[320:330], b.OriginationDate)
+	copy(data[330:338], b.OriginationTime)
+	binary.LittleEndian.PutUint64(data[338:346], b.TimeReference)
+	copy(data[348:412], b.UMID[:])
+
+	version := max(b.Version, 1)
+	if b.Loudness != nil {
+		version = max(version, 2)
+	}
+	// Version 1 chunks keep the loudness fields as reserved zero bytes
+	if version >= 2 {
+		for i := 412; i < 422; i += 2 {
+			binary.LittleEndian.PutUint16(data[i:], bextLoudnessUnset)
+		}
+	}
+	if b.Loudness != nil {
+		for i, value := range []float64{b.Loudness.LoudnessValue, b.Loudness.LoudnessRange, b.Loudness.MaxTruePeakLevel, b.Loudness.MaxMomentaryLoudness, b.Loudness.MaxShortTermLoudness} {
+			if !math.IsNaN(value) {
+				binary.LittleEndian.PutUint16(data[412+2*i:], uint16(int16(math.Round(value*100))))
+			}
+		}
+	}
+	binary.LittleEndian.PutUint16(data[346:348], uint16(version))
+
+	// The coding history is a list of CR/LF terminated lines
+	history := b.CodingHistory
+	if history != "" && !strings.HasSuffix(history, "\r\n") {
+		history += "\r\n"
+	}
+	return append(data, history...)
+}
+
+// parseIXML reads the production fields of an iXML document
+func parseIXML(data []byte) (*IXML, error) {
+	var doc struct {
+		Project string `xml:"PROJECT"`
+		Scene   string `xml:"SCENE"`
+		Take    string `xml:"TAKE"`
+		Tape    string `xml:"TAPE"`
+		Note    string `xml:"NOTE"`
+		Circled string `xml:"CIRCLED"`
+	}
+	raw := strings.TrimRight(string(data), "\x00")
+	if err := xml.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, fmt.Errorf("invalid iXML document: %w", err)
+	}
+	return &IXML{
+		Project: doc.Project,
+		Scene:   doc.Scene,
+		Take:    doc.Take,
+		Tape:    doc.Tape,
+		Note:    doc.Note,
+		Circled: strings.EqualFold(strings.TrimSpace(doc.Circled), "TRUE"),
+		Raw:     raw,
+	}, nil
+}
+
+// setXMLElement sets the text of the first element with the given name. A missing element is added
+// to its parent, or at the end of the root element, unless value is empty.
+func setXMLElement(doc, parent, name, value string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(value))
+	element := "<" + name + ">" + escaped.String() + "</" + name + ">"
+
+	open := strings.Index(doc, "<"+name+">")
+	if open >= 0 {
+		if end := strings.Index(doc[open:], "</"+name+">"); end >= 0 {
+			return doc[:open] + element + doc[open+end+len(name)+3:]
+		}
+	}
+	if empty := strings.Index(doc, "<"+name+"/>"); empty >= 0 {
+		return doc[:empty] + element + doc[empty+len(name)+3:]
+	}
+	if value == "" {
+		return doc
+	}
+
+	if parent != "" {
+		if end := strings.Index(doc, "</"+parent+">"); end >= 0 {
+			return doc[:end] + element + "\n" + doc[end:]
+		}
+		element = "<" + parent + ">\n" + element + "\n</" + parent + ">"
+	}
+	end := strings.LastIndex(doc, "</BWFXML>")
+	if end < 0 {
+		return doc
+	}
+	return doc[:end] + element + "\n" + doc[end:]
+}
+
+// buildIXML builds an iXML document, updating the document that was read if there is one.
+// The timestamp follows the bext time reference so both chunks agree.
+func buildIXML(ixml *IXML, bext *BroadcastExtension, sampleRate int) []byte {
+	doc := ixml.Raw
+	if !strings.Contains(doc, "</BWFXML>") {
+		doc = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<BWFXML>\n<IXML_VERSION>2.10</IXML_VERSION>\n</BWFXML>\n"
+	}
+
+	circled := ""
+	if ixml.Circled {
+		circled = "TRUE"
+	} else if strings.Contains(doc, "<CIRCLED>") {
+		circled = "FALSE"
+	}
+	doc = setXMLElement(doc, "", "PROJECT", ixml.Project)
+	doc = setXMLElement(doc, "", "SCENE", ixml.Scene)
+	doc = setXMLElement(doc, "", "TAKE", ixml.Take)
+	doc = setXMLElement(doc, "", "TAPE", ixml.Tape)
+	doc = setXMLElement(doc, "", "CIRCLED", circled)
+	doc = setXMLElement(doc, "", "NOTE", ixml.Note)
+
+	if bext != nil {
+		rate := strconv.Itoa(sampleRate)
+		doc = setXMLElement(doc, "SPEED", "FILE_SAMPLE_RATE", rate)
+		doc = setXMLElement(doc, "SPEED", "TIMESTAMP_SAMPLE_RATE", rate)
+		doc = setXMLElement(doc, "SPEED", "TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI", strconv.FormatUint(bext.TimeReference>>32, 10))
+		doc = setXMLElement(doc, "SPEED", "TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO", strconv.FormatUint(bext.TimeReference&0xFFFFFFFF, 10))
+	}
+	return []byte(doc)
+}
+
+// readBroadcastChunks fills the bext and iXML fields of decoded audio from its chunks
+func readBroadcastChunks(audio *Audio, chunks []riffChunk) {
+	if chunk := findChunk(chunks, "bext"); chunk != nil {
+		if bext, err := parseBext(chunk.data); err == nil {
+			audio.Broadcast = bext
+		}
+	}
+	if chunk := findChunk(chunks, "iXML"); chunk != nil {
+		if ixml, err := parseIXML(chunk.data); err == nil {
+			audio.IXML = ixml
+		}
+	}
+}
+
+// withBroadcastChunks replaces the bext and iXML chunks, placing them before the data chunk.
+// The coding history of the audio is written to the bext chunk, unless it has its own.
+func withBroadcastChunks(chunks []riffChunk, audio *Audio) []riffChunk {
+	bext := audio.Broadcast
+	if len(audio.History) > 0 && (bext == nil || bext.CodingHistory == "") {
+		withHistory := BroadcastExtension{}
+		if bext != nil {
+			withHistory = *bext
+		}
+		withHistory.CodingHistory = formatHistory(audio.History)
+		bext = &withHistory
+	}
+
+	var broadcast []riffChunk
+	if bext != nil {
+		broadcast = append(broadcast, riffChunk{id: "bext", data: buildBext(bext)})
+	}
+	if audio.IXML != nil {
+		broadcast = append(broadcast, riffChunk{id: "iXML", data: buildIXML(audio.IXML, audio.Broadcast, audio.SampleRate)})
+	}
+
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		switch chunk.id {
+		case "bext", "iXML":
+			continue
+		case "data":
+			updated = append(updated, broadcast...)
+			broadcast = nil
+		}
+		updated = append(updated, chunk)
+	}
+	return append(updated, broadcast...)
+}
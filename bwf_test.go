@@ -0,0 +1,242 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testBroadcastExtension returns a bext chunk using every field
+func testBroadcastExtension() *BroadcastExtension {
+	b := &BroadcastExtension{
+		Description:         "Wilhelm scream, take 3",
+		Originator:          "audiomorph",
+		OriginatorReference: "USAMO0000000001",
+		OriginationDate:     "2024-05-01",
+		OriginationTime:     "13:45:00",
+		TimeReference:       44100 * 3600 * 13,
+		Version:             2,
+		Loudness: &BroadcastLoudness{
+			LoudnessValue:        -23,
+			LoudnessRange:        5.5,
+			MaxTruePeakLevel:     -1.25,
+			MaxMomentaryLoudness: -18.5,
+			MaxShortTermLoudness: math.NaN(),
+		},
+		CodingHistory: "A=PCM,F=44100,W=16,M=mono,T=original\r\n",
+	}
+	b.UMID[0] = 0x06
+	b.UMID[63] = 0xFF
+	return b
+}
+
+// assertBroadcastEqual compares two bext chunks, treating NaN loudness fields as equal
+func assertBroadcastEqual(t *testing.T, expected, actual *BroadcastExtension) {
+	t.Helper()
+	if actual == nil {
+		t.Fatalf("Missing bext chunk")
+	}
+	e, a := *expected, *actual
+	e.Loudness, a.Loudness = nil, nil
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("bext mismatch:\nexpected %+v\ngot      %+v", e, a)
+	}
+	if (expected.Loudness == nil) != (actual.Loudness == nil) {
+		t.Fatalf("Loudness mismatch: expected %+v, got %+v", expected.Loudness, actual.Loudness)
+	}
+	if expected.Loudness != nil {
+		el := []float64{expected.Loudness.LoudnessValue, expected.Loudness.LoudnessRange, expected.Loudness.MaxTruePeakLevel, expected.Loudness.MaxMomentaryLoudness, expected.Loudness.MaxShortTermLoudness}
+		al := []float64{actual.Loudness.LoudnessValue, actual.Loudness.LoudnessRange, actual.Loudness.MaxTruePeakLevel, actual.Loudness.MaxMomentaryLoudness, actual.Loudness.MaxShortTermLoudness}
+		for i := range el {
+			if el[i] != al[i] && !(math.IsNaN(el[i]) && math.IsNaN(al[i])) {
+				t.Errorf("Loudness field %d: expected %v, got %v", i, el[i], al[i])
+			}
+		}
+	}
+}
+
+func TestBWFRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ext     string
+		options []Option
+		history string // coding history row added by the encode
+	}{
+		{"wav", ".wav", nil, ""},
+		{"wav-float", ".wav", []Option{OptionWAVCodec("float")}, "A=FLOAT,F=44100,W=32,M=stereo,T=audiomorph\r\n"},
+		{"w64", ".w64", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+			if err != nil {
+				t.Fatalf("Failed to decode WAV file: %v", err)
+			}
+			audio.Broadcast = testBroadcastExtension()
+			audio.IXML = &IXML{Project: "Distant Drums", Scene: "12A", Take: "3", Tape: "DAY01", Note: "Alligator & scream", Circled: true}
+
+			filename := filepath.Join(os.TempDir(), "test_output_bwf"+tc.ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename, tc.options...); err != nil {
+				t.Fatalf("Failed to encode BWF file: %v", err)
+			}
+
+			decoded, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode BWF file: %v", err)
+			}
+			expected := testBroadcastExtension()
+			expected.CodingHistory += tc.history
+			assertBroadcastEqual(t, expected, decoded.Broadcast)
+			if decoded.IXML == nil {
+				t.Fatalf("Missing iXML chunk")
+			}
+			ixml := *decoded.IXML
+			ixml.Raw = ""
+			expectedIXML := IXML{Project: "Distant Drums", Scene: "12A", Take: "3", Tape: "DAY01", Note: "Alligator & scream", Circled: true}
+			if ixml != expectedIXML {
+				t.Errorf("iXML mismatch: expected %+v, got %+v", expectedIXML, ixml)
+			}
+			if len(decoded.Data[0]) != len(audio.Data[0]) {
+				t.Errorf("Expected %d samples, got %d", len(audio.Data[0]), len(decoded.Data[0]))
+			}
+		})
+	}
+}
+
+func TestBWFChunkOrder(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	filename := filepath.Join(os.TempDir(), "test_output_bwf_order.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionBroadcastExtension(testBroadcastExtension())); err != nil {
+		t.Fatalf("Failed to encode BWF file: %v", err)
+	}
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read BWF file: %v", err)
+	}
+	_, chunks, err := readRIFF(raw)
+	if err != nil {
+		t.Fatalf("Failed to read chunks: %v", err)
+	}
+	var ids []string
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.id)
+	}
+	if strings.Index(strings.Join(ids, ","), "bext") > strings.Index(strings.Join(ids, ","), "data") {
+		t.Errorf("bext chunk should precede the data chunk: %v", ids)
+	}
+
+	// The time reference is a 64 bit sample count at offset 338
+	bext := findChunk(chunks, "bext")
+	if got := binary.LittleEndian.Uint64(bext.data[338:346]); got != testBroadcastExtension().TimeReference {
+		t.Errorf("Expected time reference %d, got %d", testBroadcastExtension().TimeReference, got)
+	}
+	if got := binary.LittleEndian.Uint16(bext.data[346:348]); got != 2 {
+		t.Errorf("Expected bext version 2, got %d", got)
+	}
+}
+
+func TestBWFResample(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if audio.SampleRate != 44100 {
+		t.Skipf("Expected a 44100 Hz test file, got %d Hz", audio.SampleRate)
+	}
+	original := testBroadcastExtension()
+	audio.Broadcast = original
+	audio.IXML = &IXML{Scene: "1"}
+
+	filename := filepath.Join(os.TempDir(), "test_output_bwf_resample.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionSampleRate(48000)); err != nil {
+		t.Fatalf("Failed to encode BWF file: %v", err)
+	}
+	if original.TimeReference != 44100*3600*13 {
+		t.Errorf("The caller's bext chunk was modified")
+	}
+
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode BWF file: %v", err)
+	}
+	expected := uint64(48000 * 3600 * 13)
+	if decoded.Broadcast.TimeReference != expected {
+		t.Errorf("Expected time reference %d, got %d", expected, decoded.Broadcast.TimeReference)
+	}
+
+	// The iXML timestamp agrees with the bext chunk
+	for _, element := range []string{
+		"<TIMESTAMP_SAMPLE_RATE>48000</TIMESTAMP_SAMPLE_RATE>",
+		"<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>0</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>",
+		"<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>2246400000</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>",
+	} {
+		if !strings.Contains(decoded.IXML.Raw, element) {
+			t.Errorf("iXML is missing %s:\n%s", element, decoded.IXML.Raw)
+		}
+	}
+}
+
+func TestIXMLPreservesElements(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML>
+<IXML_VERSION>1.5</IXML_VERSION>
+<SCENE>1</SCENE>
+<TAKE>2</TAKE>
+<CIRCLED>TRUE</CIRCLED>
+<SPEED><NOTE>speed note</NOTE><MASTER_SPEED>24/1</MASTER_SPEED></SPEED>
+<USER>keep me</USER>
+</BWFXML>`
+	ixml, err := parseIXML([]byte(doc + "\x00"))
+	if err != nil {
+		t.Fatalf("Failed to parse iXML: %v", err)
+	}
+	if ixml.Scene != "1" || ixml.Take != "2" || !ixml.Circled {
+		t.Errorf("Unexpected iXML fields: %+v", ixml)
+	}
+
+	ixml.Scene = "1 <pickup>"
+	ixml.Circled = false
+	written := string(buildIXML(ixml, nil, 48000))
+	for _, element := range []string{"<SCENE>1 &lt;pickup&gt;</SCENE>", "<CIRCLED>FALSE</CIRCLED>", "<USER>keep me</USER>", "<MASTER_SPEED>24/1</MASTER_SPEED>", "<TAKE>2</TAKE>"} {
+		if !strings.Contains(written, element) {
+			t.Errorf("Written iXML is missing %s:\n%s", element, written)
+		}
+	}
+	reparsed, err := parseIXML([]byte(written))
+	if err != nil {
+		t.Fatalf("Failed to parse written iXML: %v", err)
+	}
+	if reparsed.Scene != "1 <pickup>" || reparsed.Circled {
+		t.Errorf("Unexpected reparsed iXML: %+v", reparsed)
+	}
+}
+
+func TestBextVersion1(t *testing.T) {
+	b := testBroadcastExtension()
+	b.Version = 1
+	b.Loudness = nil
+	data := buildBext(b)
+	if len(data) != bextSize+len(b.CodingHistory) || !bytes.HasSuffix(data, []byte("\r\n")) {
+		t.Errorf("Unexpected bext size: %d", len(data))
+	}
+	// The loudness fields of a version 1 chunk are reserved and stay zero
+	if !bytes.Equal(data[412:422], make([]byte, 10)) {
+		t.Errorf("Expected zero reserved bytes in a version 1 bext, got % x", data[412:422])
+	}
+	parsed, err := parseBext(data)
+	if err != nil {
+		t.Fatalf("Failed to parse bext: %v", err)
+	}
+	assertBroadcastEqual(t, b, parsed)
+}
@@ -22,6 +22,7 @@ require (
 	github.com/mewkiz/flac v1.0.13 // indirect
 	github.com/mewkiz/pkg v0.0.0-20250417130911-3f050ff8c56d // indirect
 	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
+	github.com/pion/opus v0.0.0-20260504155822-67f6be33ea99 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/schollz/goflac v0.1.0 // indirect
 	github.com/schollz/interpolation v1.0.0 // indirect
@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/schollz/audiomorph"
+	"github.com/schollz/audiomorph/dynamics"
+	"github.com/schollz/audiomorph/filter"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +21,46 @@ var (
 	flagSampleRate    int
 	flagBitDepth      int
 	flagInterpolation string
+	flagRawFormat     string
+	flagRawEndianness string
+	flagRawChannels   int
+	flagRawSampleRate int
+	flagWAVCodec      string
+	flagAUEncoding    string
+	flagAIFFCompress  string
+	flagWavPackMode   string
+	flagWavPackRate   float64
+	flagOggStream     int
+	flagBPM           float64
+	flagRootNote      string
+	flagCueFormat     string
+	flagCueAudio      string
+	flagCover         string
+	flagExtractCover  string
+	flagNormalize     float64
+	flagLUFS          float64
+	flagTruePeak      float64
+	flagTrimStart     float64
+	flagTrimEnd       float64
+	flagPad           []float64
+	flagTrimSilence   float64
+	flagGain          float64
+	flagPan           float64
+	flagInvert        []int
+	flagSwapChannels  bool
+	flagDeclip        bool
+	flagRemoveDC      bool
+	flagDCMethod      string
+	flagHighpass      string
+	flagLowpass       string
+	flagEQ            []string
+	flagGate          string
+	flagExpander      string
+	flagCompressor    string
+	flagLimiter       string
+	flagFadeIn        float64
+	flagFadeOut       float64
+	flagFadeCurve     string
 )
 
 var rootCmd = &cobra.Command{
@@ -28,35 +72,177 @@ and analyzing audio file properties.
 When provided with only an input file, it displays statistics about the audio file.
 When provided with both input and output files, it transforms the audio from one format to another.
 
-Supported formats: WAV, AIFF, MP3, OGG, FLAC (for input)
-                  WAV, AIFF, MP3, OGG, FLAC (for output)`,
+Headerless PCM is read from and written to .raw/.pcm files, or stdin/stdout when the
+file is "-", using the layout given by the --raw-* flags.
+
+Supported formats: WAV, W64, AIFF, AIFF-C, MP3, OGG/OPUS (Vorbis, FLAC, Opus), FLAC, AU, WavPack, RAW (for input)
+                  WAV, W64, AIFF, AIFF-C, MP3, OGG, FLAC, AU, WavPack, RAW (for output)`,
 	Version: Version,
 	Args:    cobra.RangeArgs(1, 2),
 	RunE:    run,
 }
 
+var cueCmd = &cobra.Command{
+	Use:   "cue [cue-file] [output-dir]",
+	Short: "Split an album image into tracks using its cue sheet",
+	Long: `Split a single file album image (e.g. FLAC or WAV) into one file per track at the
+INDEX 01 positions of its cue sheet. Each track is tagged with the album, title and performer
+from the cue sheet. Tracks are written to the output directory, by default the current one.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runCue,
+}
+
 func init() {
 	rootCmd.SetVersionTemplate(`{{printf "audiomorph version %s\n" .Version}}`)
 	rootCmd.Flags().IntSliceVar(&flagChannels, "channels", nil, "List of channel indices to process (e.g. --channels 0,1)")
 	rootCmd.Flags().IntVar(&flagSampleRate, "sample-rate", 0, "Target sample rate for output audio (e.g. --sample-rate 48000)")
 	rootCmd.Flags().IntVar(&flagBitDepth, "bit-depth", 0, "Target bit depth for output audio (e.g. --bit-depth 24)")
 	rootCmd.Flags().StringVar(&flagInterpolation, "interpolation", "linear", "Interpolation method for sample rate conversion (linear, cubic, hermite, lanczos2, lanczos3, bspline3, bspline5, monotonic)")
+	rootCmd.Flags().StringVar(&flagRawFormat, "raw-format", "", "Sample format for headerless PCM (s8, u8, s16le, s16be, s24le, s32le, f32le, ...)")
+	rootCmd.Flags().StringVar(&flagRawEndianness, "raw-endian", "", "Byte order for headerless PCM when --raw-format has no suffix (le, be)")
+	rootCmd.Flags().IntVar(&flagRawChannels, "raw-channels", 0, "Number of channels in headerless PCM input (default 2)")
+	rootCmd.Flags().IntVar(&flagRawSampleRate, "raw-sample-rate", 0, "Sample rate of headerless PCM input (default 44100)")
+	rootCmd.Flags().StringVar(&flagWAVCodec, "wav-codec", "", "Sample encoding for WAV and W64 output (pcm, float, ulaw, alaw, ima-adpcm, ms-adpcm)")
+	rootCmd.Flags().StringVar(&flagAUEncoding, "au-encoding", "", "Sample encoding for AU output (pcm, ulaw, alaw, float) (default pcm)")
+	rootCmd.Flags().StringVar(&flagAIFFCompress, "aiff-compression", "", "AIFF-C compression type for AIFF output (NONE, sowt, fl32, ulaw, alaw)")
+	rootCmd.Flags().StringVar(&flagWavPackMode, "wavpack-mode", "", "WavPack output mode (lossless, float, hybrid)")
+	rootCmd.Flags().IntVar(&flagOggStream, "ogg-stream", 0, "Index of the audio stream to decode from a multiplexed or chained Ogg file")
+	rootCmd.Flags().Float64Var(&flagWavPackRate, "wavpack-bitrate", 0, "Bitrate of hybrid WavPack output in bits per sample (default 4)")
+	rootCmd.Flags().Float64Var(&flagBPM, "bpm", 0, "Tempo written to the ACID/Apple Loops chunk of WAV and AIFF output (e.g. --bpm 120)")
+	rootCmd.Flags().Float64Var(&flagTrimStart, "trim-start", 0, "Seconds removed from the beginning of the audio (e.g. --trim-start 1.5)")
+	rootCmd.Flags().Float64Var(&flagTrimEnd, "trim-end", 0, "Seconds removed from the end of the audio (e.g. --trim-end 2)")
+	rootCmd.Flags().Float64SliceVar(&flagPad, "pad", nil, "Seconds of silence added at both ends, or before,after (e.g. --pad 0.5,2)")
+	rootCmd.Flags().Float64Var(&flagTrimSilence, "trim-silence", 0, "Remove leading and trailing silence below a threshold in dBFS (e.g. --trim-silence -50)")
+	rootCmd.Flags().Float64Var(&flagFadeIn, "fade-in", 0, "Seconds to fade the audio in (e.g. --fade-in 0.01)")
+	rootCmd.Flags().Float64Var(&flagFadeOut, "fade-out", 0, "Seconds to fade the audio out (e.g. --fade-out 2)")
+	rootCmd.Flags().StringVar(&flagFadeCurve, "fade-curve", "linear", "Curve of --fade-in and --fade-out (linear, equal-power, logarithmic, s-curve)")
+	rootCmd.Flags().Float64Var(&flagGain, "gain", 0, "Change the level by a gain in dB (e.g. --gain -6)")
+	rootCmd.Flags().Float64Var(&flagPan, "pan", 0, "Pan mono into stereo, or balance stereo, from -1 (left) to 1 (right) (e.g. --pan -0.5)")
+	rootCmd.Flags().IntSliceVar(&flagInvert, "invert-polarity", nil, "List of channel indices whose polarity is inverted (e.g. --invert-polarity 1)")
+	rootCmd.Flags().BoolVar(&flagSwapChannels, "swap-channels", false, "Swap the left and right channels")
+	rootCmd.Flags().BoolVar(&flagDeclip, "declip", false, "Reconstruct clipped peaks by interpolation, after --gain (e.g. --gain -3 --declip)")
+	rootCmd.Flags().BoolVar(&flagRemoveDC, "remove-dc", false, "Remove the DC offset with the --dc-method")
+	rootCmd.Flags().StringVar(&flagDCMethod, "dc-method", "mean", "Method of --remove-dc: subtract the mean, or a 5 Hz highpass for a drifting offset (e.g. --dc-method highpass)")
+	rootCmd.Flags().StringVar(&flagHighpass, "highpass", "", "High pass cutoff in Hz, with an optional order and lr for Linkwitz-Riley (e.g. --highpass 80 or --highpass 80,order=4)")
+	rootCmd.Flags().StringVar(&flagLowpass, "lowpass", "", "Low pass cutoff in Hz, with an optional order and lr for Linkwitz-Riley (e.g. --lowpass 3400,order=8)")
+	rootCmd.Flags().StringArrayVar(&flagEQ, "eq", nil, "Filter as type:frequency with optional gain, q, order and lr settings, repeatable (e.g. --eq peaking:1000,gain=-3,q=1.4)")
+	rootCmd.Flags().StringVar(&flagGate, "gate", "", "Noise gate threshold in dBFS, with optional range, knee, attack, release and unlinked settings (e.g. --gate -50,range=-40)")
+	rootCmd.Flags().StringVar(&flagExpander, "expander", "", "Expander threshold in dBFS, with optional ratio, range, knee, attack, release and unlinked settings (e.g. --expander -40,ratio=2)")
+	rootCmd.Flags().StringVar(&flagCompressor, "compressor", "", "Compressor threshold in dBFS, with optional ratio, knee, attack, release, makeup and unlinked settings (e.g. --compressor -18,ratio=3,makeup=4)")
+	rootCmd.Flags().StringVar(&flagLimiter, "limiter", "", "Look-ahead true peak limiter ceiling in dBTP, with optional lookahead, release and unlinked settings (e.g. --limiter -1)")
+	rootCmd.Flags().Float64Var(&flagNormalize, "normalize", 0, "Normalize the sample peak to a level in dBFS (e.g. --normalize -1)")
+	rootCmd.Flags().Float64Var(&flagLUFS, "lufs", 0, "Normalize the integrated loudness to a target in LUFS (e.g. --lufs -14)")
+	rootCmd.Flags().Float64Var(&flagTruePeak, "true-peak", -1, "True peak ceiling in dBTP for --lufs")
+	rootCmd.Flags().StringVar(&flagCover, "cover", "", "JPEG or PNG image embedded as the front cover of the output (e.g. --cover cover.jpg)")
+	rootCmd.Flags().StringVar(&flagExtractCover, "extract-cover", "", "Write the front cover of the input to an image file (e.g. --extract-cover cover.jpg)")
+	rootCmd.Flags().StringVar(&flagRootNote, "root-note", "", "Key written to the ACID/Apple Loops chunk of WAV and AIFF output, as a note name or MIDI number (e.g. --root-note F#)")
+
+	rootCmd.AddCommand(cueCmd)
+	cueCmd.Flags().StringVar(&flagCueFormat, "format", "flac", "Output format of the tracks, as a file extension (e.g. wav, flac, mp3)")
+	cueCmd.Flags().StringVar(&flagCueAudio, "audio", "", "Album image to split instead of the FILE named by the cue sheet")
+}
+
+// filterFlags returns the filters of the --highpass, --eq and --lowpass flags, in that order
+func filterFlags() ([]filter.Filter, error) {
+	specs := flagEQ
+	if flagHighpass != "" {
+		specs = append([]string{"highpass:" + flagHighpass}, specs...)
+	}
+	if flagLowpass != "" {
+		specs = append(specs, "lowpass:"+flagLowpass)
+	}
+	filters := make([]filter.Filter, len(specs))
+	for i, spec := range specs {
+		f, err := filter.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = f
+	}
+	return filters, nil
+}
+
+// dynamicsFlags returns the processors of the --gate, --expander, --compressor and --limiter
+// flags, in that order
+func dynamicsFlags() ([]dynamics.Processor, error) {
+	var processors []dynamics.Processor
+	for _, flag := range []struct{ name, value string }{
+		{"gate", flagGate}, {"expander", flagExpander}, {"compressor", flagCompressor}, {"limiter", flagLimiter},
+	} {
+		if flag.value == "" {
+			continue
+		}
+		processor, err := dynamics.Parse(flag.name + ":" + flag.value)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+	return processors, nil
+}
+
+// isRaw reports whether a file argument refers to headerless PCM (including stdin/stdout)
+func isRaw(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return filename == "-" || ext == ".raw" || ext == ".pcm"
+}
+
+// rawOptions returns the options describing the headerless PCM layout from the --raw-* flags
+func rawOptions() []audiomorph.Option {
+	var options []audiomorph.Option
+	if flagRawFormat != "" {
+		options = append(options, audiomorph.OptionRawFormat(flagRawFormat))
+	}
+	if flagRawEndianness != "" {
+		options = append(options, audiomorph.OptionRawEndianness(flagRawEndianness))
+	}
+	if flagRawChannels > 0 {
+		options = append(options, audiomorph.OptionRawChannels(flagRawChannels))
+	}
+	if flagRawSampleRate > 0 {
+		options = append(options, audiomorph.OptionRawSampleRate(flagRawSampleRate))
+	}
+	return options
 }
 
 func run(cmd *cobra.Command, args []string) error {
 	inputFile := args[0]
 
 	// Check if input file exists
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", inputFile)
+	if inputFile != "-" {
+		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+			return fmt.Errorf("input file does not exist: %s", inputFile)
+		}
 	}
 
-	// Decode the input file
-	audio, err := audiomorph.DecodeFile(inputFile)
+	// Decode the input file, headerless PCM may be piped in on stdin
+	var audio *audiomorph.Audio
+	var err error
+	var decodeOptions []audiomorph.Option
+	if isRaw(inputFile) {
+		decodeOptions = rawOptions()
+	}
+	if flagOggStream > 0 {
+		decodeOptions = append(decodeOptions, audiomorph.OptionOggStream(flagOggStream))
+	}
+	if inputFile == "-" {
+		audio, err = audiomorph.DecodeRaw(os.Stdin, decodeOptions...)
+	} else {
+		audio, err = audiomorph.DecodeFile(inputFile, decodeOptions...)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to decode input file: %w", err)
 	}
 
+	if flagExtractCover != "" {
+		if err := extractCover(audio, flagExtractCover); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			return nil
+		}
+	}
+
 	// If no output file is specified, display statistics
 	if len(args) == 1 {
 		displayStatistics(inputFile, audio)
@@ -70,6 +256,36 @@ func run(cmd *cobra.Command, args []string) error {
 
 	// Prepare encoding options
 	options := []audiomorph.Option{optionChannels}
+	if flagTrimStart > 0 || flagTrimEnd > 0 {
+		options = append(options, audiomorph.OptionTrim(flagTrimStart, flagTrimEnd))
+	}
+	if len(flagPad) > 0 {
+		before, after := flagPad[0], flagPad[0]
+		if len(flagPad) > 1 {
+			after = flagPad[1]
+		}
+		options = append(options, audiomorph.OptionPad(before, after))
+	}
+	if flagSwapChannels {
+		options = append(options, audiomorph.OptionSwapChannels(0, 1))
+	}
+	if len(flagInvert) > 0 {
+		options = append(options, audiomorph.OptionInvertPolarity(flagInvert...))
+	}
+	if cmd.Flags().Changed("pan") {
+		options = append(options, audiomorph.OptionPan(flagPan))
+	}
+	if flagGain != 0 {
+		options = append(options, audiomorph.OptionGain(flagGain))
+	}
+	if flagDeclip {
+		options = append(options, audiomorph.OptionDeclip())
+	}
+	if flagRemoveDC {
+		options = append(options, audiomorph.OptionRemoveDCOffset(flagDCMethod))
+	} else if cmd.Flags().Changed("dc-method") {
+		return fmt.Errorf("--dc-method requires --remove-dc")
+	}
 	if flagSampleRate > 0 {
 		options = append(options, audiomorph.OptionSampleRate(flagSampleRate))
 		options = append(options, audiomorph.OptionInterpolationMethod(flagInterpolation))
@@ -77,17 +293,180 @@ func run(cmd *cobra.Command, args []string) error {
 	if flagBitDepth > 0 {
 		options = append(options, audiomorph.OptionBitDepth(flagBitDepth))
 	}
+	if flagWAVCodec != "" {
+		options = append(options, audiomorph.OptionWAVCodec(flagWAVCodec))
+	}
+	if flagAUEncoding != "" {
+		options = append(options, audiomorph.OptionAUEncoding(flagAUEncoding))
+	}
+	if flagAIFFCompress != "" {
+		options = append(options, audiomorph.OptionAIFFCompression(flagAIFFCompress))
+	}
+	if flagWavPackMode != "" {
+		options = append(options, audiomorph.OptionWavPackMode(flagWavPackMode))
+	}
+	if flagWavPackRate > 0 {
+		options = append(options, audiomorph.OptionWavPackBitrate(flagWavPackRate))
+	}
+	if flagBPM > 0 {
+		options = append(options, audiomorph.OptionTempo(flagBPM))
+	}
+	if flagRootNote != "" {
+		note, err := audiomorph.ParseNote(flagRootNote)
+		if err != nil {
+			return fmt.Errorf("invalid root note: %w", err)
+		}
+		options = append(options, audiomorph.OptionRootNote(note))
+	}
+	filters, err := filterFlags()
+	if err != nil {
+		return err
+	}
+	if len(filters) > 0 {
+		options = append(options, audiomorph.OptionEQ(filters...))
+	}
+	processors, err := dynamicsFlags()
+	if err != nil {
+		return err
+	}
+	if len(processors) > 0 {
+		options = append(options, audiomorph.OptionDynamics(processors...))
+	}
+	if cmd.Flags().Changed("trim-silence") {
+		options = append(options, audiomorph.OptionTrimSilence(flagTrimSilence))
+	}
+	if flagFadeIn > 0 {
+		options = append(options, audiomorph.OptionFadeIn(flagFadeIn, flagFadeCurve))
+	}
+	if flagFadeOut > 0 {
+		options = append(options, audiomorph.OptionFadeOut(flagFadeOut, flagFadeCurve))
+	}
+	switch {
+	case cmd.Flags().Changed("normalize") && cmd.Flags().Changed("lufs"):
+		return fmt.Errorf("--normalize and --lufs cannot be combined")
+	case cmd.Flags().Changed("normalize"):
+		options = append(options, audiomorph.OptionNormalize(flagNormalize))
+	case cmd.Flags().Changed("lufs"):
+		options = append(options, audiomorph.OptionNormalizeLoudness(flagLUFS, flagTruePeak))
+	}
+	if flagCover != "" {
+		picture, err := audiomorph.ReadPicture(flagCover)
+		if err != nil {
+			return err
+		}
+		options = append(options, audiomorph.OptionPicture(picture))
+	}
 
-	// Transform audio to output file
+	// Headerless PCM output uses the sample format and byte order from the --raw-* flags
 	outputFile := args[1]
+	if isRaw(outputFile) {
+		if flagRawFormat != "" {
+			options = append(options, audiomorph.OptionRawFormat(flagRawFormat))
+		}
+		if flagRawEndianness != "" {
+			options = append(options, audiomorph.OptionRawEndianness(flagRawEndianness))
+		}
+	}
+
+	// Transform audio to output file, or stream headerless PCM to stdout
+	if outputFile == "-" {
+		if err := audiomorph.EncodeRaw(audio, os.Stdout, options...); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		reportRepairs(audio, os.Stderr)
+		return nil
+	}
 	if err := audiomorph.EncodeFile(audio, outputFile, options...); err != nil {
 		return fmt.Errorf("failed to encode output file: %w", err)
 	}
+	reportRepairs(audio, os.Stdout)
 
 	fmt.Printf("Successfully transformed %s to %s\n", inputFile, outputFile)
 	return nil
 }
 
+// reportRepairs warns about samples clipped by the gain of the encode, and reports the channels
+// it declipped to w
+func reportRepairs(audio *audiomorph.Audio, w io.Writer) {
+	if clipped := audio.Clipped(); clipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d samples clipped by the %+.2f dB gain\n", clipped, flagGain)
+	}
+	for ch, count := range audio.Declipped() {
+		if count > 0 {
+			fmt.Fprintf(w, "Declipped %d samples on channel %d\n", count, ch)
+		}
+	}
+}
+
+// extractCover writes the front cover of the audio to an image file
+func extractCover(audio *audiomorph.Audio, filename string) error {
+	picture, ok := audio.Metadata.Cover()
+	if !ok {
+		return fmt.Errorf("input file has no embedded pictures")
+	}
+	if filepath.Ext(filename) == "" {
+		filename += picture.Extension()
+	}
+	if err := os.WriteFile(filename, picture.Data, 0644); err != nil {
+		return fmt.Errorf("failed to write cover: %w", err)
+	}
+	fmt.Printf("Extracted %s cover to %s\n", picture.MIMEType, filename)
+	return nil
+}
+
+// runCue splits the album image of a cue sheet into its tracks
+func runCue(cmd *cobra.Command, args []string) error {
+	sheet, err := audiomorph.ReadCueSheet(args[0])
+	if err != nil {
+		return err
+	}
+	outputDir := "."
+	if len(args) > 1 {
+		outputDir = args[1]
+	}
+
+	// The FILE of a cue sheet is relative to the cue sheet
+	audioFile := flagCueAudio
+	if audioFile == "" {
+		audioFile = filepath.Join(filepath.Dir(args[0]), sheet.Tracks[0].File)
+	}
+	audio, err := audiomorph.DecodeFile(audioFile)
+	if err != nil {
+		return fmt.Errorf("failed to decode album image: %w", err)
+	}
+	tracks, err := audiomorph.SplitByCue(audio, sheet)
+	if err != nil {
+		return fmt.Errorf("failed to split album image: %w", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	ext := "." + strings.TrimPrefix(flagCueFormat, ".")
+	for i, track := range tracks {
+		title := track.Metadata.Title
+		if title == "" {
+			title = "Track"
+		}
+		filename := filepath.Join(outputDir, fmt.Sprintf("%02d - %s%s", sheet.Tracks[i].Number, safeFilename(title), ext))
+		if err := audiomorph.EncodeFile(track, filename); err != nil {
+			return fmt.Errorf("failed to encode track %d: %w", sheet.Tracks[i].Number, err)
+		}
+		fmt.Printf("Wrote %s (%.2f seconds)\n", filename, track.Duration)
+	}
+	return nil
+}
+
+// safeFilename replaces the characters that are not allowed in file names on common systems
+func safeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
 func displayStatistics(filename string, audio *audiomorph.Audio) {
 	fmt.Printf("Audio File Statistics\n")
 	fmt.Printf("=====================\n")
@@ -98,12 +477,119 @@ func displayStatistics(filename string, audio *audiomorph.Audio) {
 	fmt.Printf("Bit Depth:    %d bits\n", audio.BitDepth)
 	fmt.Printf("Duration:     %.2f seconds\n", audio.Duration)
 	fmt.Printf("Samples:      %d per channel\n", len(audio.Data[0]))
+	loudness := audiomorph.MeasureLoudness(audio)
+	fmt.Printf("Loudness:     %.1f LUFS, %.1f LU range\n", loudness.Integrated, loudness.Range)
+	fmt.Printf("Peak:         %.2f dBTP true peak, %.2f dBFS sample peak\n", loudness.TruePeak, loudness.SamplePeak)
+	offsets := audiomorph.DCOffset(audio)
+	for i := range offsets {
+		offsets[i] *= 100
+	}
+	fmt.Printf("DC Offset:    %s %% per channel\n", strings.Trim(fmt.Sprintf("%.3f", offsets), "[]"))
+	fmt.Printf("Clipped:      %s samples per channel\n", strings.Trim(fmt.Sprint(audiomorph.DetectClipping(audio)), "[]"))
 
 	// Calculate file size
 	fileInfo, err := os.Stat(filename)
 	if err == nil {
 		fmt.Printf("File Size:    %.2f MB\n", float64(fileInfo.Size())/(1024*1024))
 	}
+
+	// List the tags and embedded pictures
+	if !audio.Metadata.IsEmpty() {
+		printTags(audio.Metadata)
+	}
+
+	// List the markers and regions with their positions
+	if len(audio.Markers) > 0 {
+		fmt.Printf("Markers:\n")
+		for _, marker := range audio.Markers {
+			position := float64(marker.Position) / float64(audio.SampleRate)
+			if marker.Length > 0 {
+				end := float64(marker.Position+marker.Length) / float64(audio.SampleRate)
+				fmt.Printf("  [%d] %8.3fs - %8.3fs  region %q", marker.ID, position, end, marker.Label)
+			} else {
+				fmt.Printf("  [%d] %8.3fs              marker %q", marker.ID, position, marker.Label)
+			}
+			if marker.Note != "" {
+				fmt.Printf(" (%s)", marker.Note)
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	// Show the sampler settings and loops
+	if inst := audio.Instrument; inst != nil {
+		fmt.Printf("Instrument:\n")
+		fmt.Printf("  Root note: %d (%+d cents), gain %d dB\n", inst.RootNote, inst.FineTune, inst.Gain)
+		fmt.Printf("  Key range: %d-%d, velocity range: %d-%d\n", inst.LowNote, inst.HighNote, inst.LowVelocity, inst.HighVelocity)
+		modes := map[audiomorph.LoopMode]string{
+			audiomorph.LoopForward:  "forward",
+			audiomorph.LoopPingPong: "ping-pong",
+			audiomorph.LoopBackward: "backward",
+		}
+		for _, loop := range inst.Loops {
+			start := float64(loop.Start) / float64(audio.SampleRate)
+			end := float64(loop.End) / float64(audio.SampleRate)
+			fmt.Printf("  Loop: %8.3fs - %8.3fs  %s", start, end, modes[loop.Mode])
+			if loop.PlayCount > 0 {
+				fmt.Printf(" x%d", loop.PlayCount)
+			}
+			fmt.Printf("\n")
+		}
+	}
+
+	// Show the ACID/Apple Loops tempo and key
+	if info := audio.LoopInfo; info != nil {
+		kind := "loop"
+		if info.OneShot {
+			kind = "one-shot"
+		}
+		fmt.Printf("Loop Info:\n")
+		fmt.Printf("  Tempo: %.2f BPM, %d beats in %d/%d (%s)\n", info.Tempo, info.Beats, info.MeterNumerator, info.MeterDenominator, kind)
+		if info.RootNote > 0 {
+			fmt.Printf("  Root note: %d\n", info.RootNote)
+		}
+	}
+
+	// Show the Broadcast Wave and iXML production metadata
+	if bext := audio.Broadcast; bext != nil {
+		seconds := float64(bext.TimeReference) / float64(audio.SampleRate)
+		fmt.Printf("Broadcast Wave:\n")
+		fmt.Printf("  Description: %s\n", bext.Description)
+		fmt.Printf("  Originator:  %s (%s)\n", bext.Originator, bext.OriginatorReference)
+		fmt.Printf("  Origination: %s %s\n", bext.OriginationDate, bext.OriginationTime)
+		fmt.Printf("  Time Ref:    %02d:%02d:%06.3f (%d samples)\n", int(seconds/3600), int(seconds/60)%60, seconds-float64(int(seconds/60)*60), bext.TimeReference)
+		if bext.Loudness != nil {
+			fmt.Printf("  Loudness:    %.2f LUFS, %.2f LU range, %.2f dBTP\n", bext.Loudness.LoudnessValue, bext.Loudness.LoudnessRange, bext.Loudness.MaxTruePeakLevel)
+		}
+	}
+	if ixml := audio.IXML; ixml != nil {
+		fmt.Printf("iXML:         project %q, scene %q, take %q, tape %q, circled %v\n", ixml.Project, ixml.Scene, ixml.Take, ixml.Tape, ixml.Circled)
+	}
+
+	// Show where the audio came from and what was done to it
+	if len(audio.History) > 0 {
+		fmt.Printf("History:\n")
+		for _, row := range audio.History {
+			fmt.Printf("  %s\n", row)
+		}
+	}
+
+	// List the logical streams of Ogg files
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ogg", ".oga", ".opus":
+		streams, err := audiomorph.InspectOgg(filename)
+		if err != nil {
+			return
+		}
+		fmt.Printf("Ogg Streams:\n")
+		for _, stream := range streams {
+			if stream.IsAudio() {
+				fmt.Printf("  [link %d] serial %08x: %s, %d channels, %d Hz, %d samples\n", stream.Link, stream.Serial, stream.Codec, stream.NumChannels, stream.SampleRate, stream.NumSamples)
+			} else {
+				fmt.Printf("  [link %d] serial %08x: %s\n", stream.Link, stream.Serial, stream.Codec)
+			}
+		}
+	}
 }
 
 func main() {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/schollz/audiomorph"
+	"github.com/spf13/cobra"
+)
+
+var flagMixGains []float64
+
+var concatCmd = &cobra.Command{
+	Use:   "concat [input-files]... [output-file]",
+	Short: "Join audio files one after the other",
+	Long: `Join the input files one after the other into the output file. Inputs are converted to the
+highest sample rate, bit depth and number of channels among them, mono inputs being copied to
+every channel. The output has the tags of the first input and the markers of all of them.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runConcat,
+}
+
+var mixCmd = &cobra.Command{
+	Use:   "mix [input-files]... [output-file]",
+	Short: "Mix audio files together",
+	Long: `Sum the input files into the output file, which is as long as the longest input. Inputs are
+converted to the highest sample rate, bit depth and number of channels among them, mono inputs
+being copied to every channel. The mix is clipped at full scale, so lower the gains of loud inputs.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runMix,
+}
+
+func init() {
+	rootCmd.AddCommand(concatCmd)
+	rootCmd.AddCommand(mixCmd)
+	mixCmd.Flags().Float64SliceVar(&flagMixGains, "gains", nil, "Gain in dB of each input, in order (e.g. --gains -6,-3)")
+}
+
+// decodeInputs decodes the input files of a subcommand whose last argument is the output file
+func decodeInputs(args []string) ([]*audiomorph.Audio, error) {
+	inputs := make([]*audiomorph.Audio, len(args)-1)
+	for i, file := range args[:len(args)-1] {
+		audio, err := audiomorph.DecodeFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		inputs[i] = audio
+	}
+	return inputs, nil
+}
+
+// runConcat joins the input files into the output file
+func runConcat(cmd *cobra.Command, args []string) error {
+	inputs, err := decodeInputs(args)
+	if err != nil {
+		return err
+	}
+	joined, err := audiomorph.Concat(inputs...)
+	if err != nil {
+		return err
+	}
+	output := args[len(args)-1]
+	if err := audiomorph.EncodeFile(joined, output); err != nil {
+		return fmt.Errorf("failed to encode output file: %w", err)
+	}
+	fmt.Printf("Wrote %s (%.2f seconds from %d files)\n", output, joined.Duration, len(inputs))
+	return nil
+}
+
+// runMix mixes the input files into the output file
+func runMix(cmd *cobra.Command, args []string) error {
+	inputs, err := decodeInputs(args)
+	if err != nil {
+		return err
+	}
+	mixed, err := audiomorph.Mix(inputs, flagMixGains)
+	if err != nil {
+		return err
+	}
+	output := args[len(args)-1]
+	if err := audiomorph.EncodeFile(mixed, output); err != nil {
+		return fmt.Errorf("failed to encode output file: %w", err)
+	}
+	fmt.Printf("Wrote %s (%.2f seconds from %d files)\n", output, mixed.Duration, len(inputs))
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schollz/audiomorph"
+	"github.com/spf13/cobra"
+)
+
+var flagReplayGainTrackOnly bool
+
+// replayGainExtensions lists the formats whose ReplayGain tags can be written
+var replayGainExtensions = map[string]bool{
+	".wav": true, ".aif": true, ".aiff": true, ".aifc": true, ".mp3": true,
+	".flac": true, ".wv": true, ".ogg": true, ".oga": true,
+}
+
+var replayGainCmd = &cobra.Command{
+	Use:   "replaygain [album-dir or files]...",
+	Short: "Compute ReplayGain 2.0 gains and write them as tags",
+	Long: `Compute ReplayGain 2.0 track and album gains and peaks, measured as EBU R128 loudness
+against a -18 LUFS reference, and write them as REPLAYGAIN_* tags without re-encoding the audio.
+
+Each directory is processed as one album. Files given directly are processed together as one album.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runReplayGain,
+}
+
+func init() {
+	rootCmd.AddCommand(replayGainCmd)
+	replayGainCmd.Flags().BoolVar(&flagReplayGainTrackOnly, "track-only", false, "Write track gains only, without album gains")
+}
+
+// runReplayGain tags each album directory, and the files given directly as one more album
+func runReplayGain(cmd *cobra.Command, args []string) error {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", arg, err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		album, err := albumFiles(arg)
+		if err != nil {
+			return err
+		}
+		if err := tagAlbum(album); err != nil {
+			return err
+		}
+	}
+	if len(files) > 0 {
+		return tagAlbum(files)
+	}
+	return nil
+}
+
+// albumFiles lists the audio files of an album directory in name order
+func albumFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read album directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && replayGainExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audio files in %s", dir)
+	}
+	return files, nil
+}
+
+// tagAlbum analyzes the files of an album and writes their ReplayGain tags
+func tagAlbum(files []string) error {
+	tracks := make([]*audiomorph.Audio, len(files))
+	for i, file := range files {
+		audio, err := audiomorph.DecodeFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		tracks[i] = audio
+	}
+
+	var gains []audiomorph.ReplayGain
+	if flagReplayGainTrackOnly {
+		for _, track := range tracks {
+			gains = append(gains, audiomorph.TrackReplayGain(track))
+		}
+	} else {
+		gains = audiomorph.AlbumReplayGain(tracks)
+	}
+
+	for i, file := range files {
+		// The tags are read again so only the ReplayGain tags change
+		metadata, err := audiomorph.ReadTags(file)
+		if err != nil {
+			return fmt.Errorf("failed to read tags of %s: %w", file, err)
+		}
+		gains[i].SetTags(&metadata)
+		if flagReplayGainTrackOnly {
+			metadata.Set("REPLAYGAIN_ALBUM_GAIN", "")
+			metadata.Set("REPLAYGAIN_ALBUM_PEAK", "")
+		}
+		if err := audiomorph.WriteTags(file, metadata); err != nil {
+			return fmt.Errorf("failed to write tags of %s: %w", file, err)
+		}
+		fmt.Printf("%-40s track %+6.2f dB, peak %.6f\n", filepath.Base(file), gains[i].TrackGain, gains[i].TrackPeak)
+	}
+	if !flagReplayGainTrackOnly && len(gains) > 0 {
+		fmt.Printf("%-40s album %+6.2f dB, peak %.6f\n", "", gains[0].AlbumGain, gains[0].AlbumPeak)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schollz/audiomorph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagSilenceThreshold   float64
+	flagSilenceMinDuration float64
+	flagSilenceHold        float64
+	flagSplitFormat        string
+	flagSplitThreshold     float64
+	flagSplitMinGap        float64
+	flagSplitMinLength     float64
+	flagSplitPadding       float64
+)
+
+var silenceCmd = &cobra.Command{
+	Use:   "silence [files]...",
+	Short: "List the silent regions of audio files",
+	Long: `List the regions of each file where every channel stays below a threshold in dBFS for at
+least a minimum duration. The hold time of silence next to the sound is not counted, so quiet
+attacks and decays are kept out of the regions.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSilence,
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split [input-file] [output-dir]",
+	Short: "Split audio into one file per sound between silences",
+	Long: `Split audio wherever every channel stays below a threshold in dBFS for at least the minimum
+gap, writing each sound to a numbered file named after the input, e.g. take_001.wav. Sounds
+shorter than the minimum length are skipped. Files are written to the output directory, by
+default the current one.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runSplit,
+}
+
+func init() {
+	rootCmd.AddCommand(silenceCmd)
+	silenceCmd.Flags().Float64Var(&flagSilenceThreshold, "threshold", -60, "Level in dBFS below which audio is silent")
+	silenceCmd.Flags().Float64Var(&flagSilenceMinDuration, "min-duration", 0.5, "Shortest silence reported, in seconds")
+	silenceCmd.Flags().Float64Var(&flagSilenceHold, "hold", 0.05, "Seconds of silence next to the sound not counted as silence")
+
+	rootCmd.AddCommand(splitCmd)
+	splitCmd.Flags().StringVar(&flagSplitFormat, "format", "", "Output format of the parts, as a file extension (default the input format)")
+	splitCmd.Flags().Float64Var(&flagSplitThreshold, "threshold", -60, "Level in dBFS below which audio is silent")
+	splitCmd.Flags().Float64Var(&flagSplitMinGap, "min-gap", 0.5, "Shortest silence that splits the audio, in seconds")
+	splitCmd.Flags().Float64Var(&flagSplitMinLength, "min-length", 0.1, "Shortest sound written, in seconds")
+	splitCmd.Flags().Float64Var(&flagSplitPadding, "padding", 0.1, "Seconds of silence kept before and after each sound")
+}
+
+// runSilence prints the silent regions of each file
+func runSilence(cmd *cobra.Command, args []string) error {
+	for _, file := range args {
+		audio, err := audiomorph.DecodeFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		regions := audiomorph.DetectSilence(audio, flagSilenceThreshold, flagSilenceMinDuration, flagSilenceHold)
+		fmt.Printf("%s: %d silent regions in %.3f seconds\n", filepath.Base(file), len(regions), audio.Duration)
+		for _, region := range regions {
+			start, end := region.Seconds(audio.SampleRate)
+			fmt.Printf("  %10.3f - %10.3f  (%.3f s)\n", start, end, end-start)
+		}
+	}
+	return nil
+}
+
+// runSplit writes each sound of a file to a numbered file
+func runSplit(cmd *cobra.Command, args []string) error {
+	audio, err := audiomorph.DecodeFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", args[0], err)
+	}
+	outputDir := "."
+	if len(args) > 1 {
+		outputDir = args[1]
+	}
+	parts, err := audiomorph.SplitOnSilence(audio, flagSplitThreshold, flagSplitMinGap, flagSplitMinLength, flagSplitPadding)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("no sound above %g dBFS in %s", flagSplitThreshold, args[0])
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	ext := filepath.Ext(args[0])
+	if flagSplitFormat != "" {
+		ext = "." + strings.TrimPrefix(flagSplitFormat, ".")
+	}
+	base := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	for i, part := range parts {
+		filename := filepath.Join(outputDir, fmt.Sprintf("%s_%03d%s", base, i+1, ext))
+		if err := audiomorph.EncodeFile(part, filename); err != nil {
+			return fmt.Errorf("failed to encode part %d: %w", i+1, err)
+		}
+		fmt.Printf("Wrote %s (%.2f seconds)\n", filename, part.Duration)
+	}
+	return nil
+}
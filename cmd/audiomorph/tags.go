@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/schollz/audiomorph"
+	"github.com/spf13/cobra"
+)
+
+var flagTagsRemoveAll bool
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags [file]",
+	Short: "List the chunks and tags of an audio file",
+	Long: `List the chunks, metadata blocks and tags of an audio file, or edit its tags with the
+set and remove subcommands. Tags are edited without re-encoding the audio: only the tag chunks
+of WAV and AIFF files, the metadata blocks of FLAC files, the ID3v2 or APEv2 tags of MP3 and
+WavPack files and the comment header of Ogg files are rewritten.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTags,
+}
+
+var tagsSetCmd = &cobra.Command{
+	Use:   "set [file] [KEY=VALUE]...",
+	Short: "Set tags of an audio file (e.g. tags set song.flac TITLE=Intro TRACKNUMBER=1/12), PICTURE=cover.jpg embeds a front cover",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  runTagsSet,
+}
+
+var tagsRemoveCmd = &cobra.Command{
+	Use:   "remove [file] [KEY]...",
+	Short: "Remove tags from an audio file, PICTURE removes the embedded pictures",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTagsRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(tagsCmd)
+	tagsCmd.AddCommand(tagsSetCmd, tagsRemoveCmd)
+	tagsRemoveCmd.Flags().BoolVar(&flagTagsRemoveAll, "all", false, "Remove every tag and picture")
+}
+
+// runTags lists the chunks and tags of a file
+func runTags(cmd *cobra.Command, args []string) error {
+	chunks, err := audiomorph.ReadChunks(args[0])
+	if err == nil {
+		fmt.Printf("Chunks:\n")
+		for _, chunk := range chunks {
+			fmt.Printf("  %-16s %10d bytes\n", chunk.ID, chunk.Size)
+		}
+	}
+	metadata, err := audiomorph.ReadTags(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+	printTags(metadata)
+	return nil
+}
+
+// runTagsSet sets the KEY=VALUE tags of a file
+func runTagsSet(cmd *cobra.Command, args []string) error {
+	metadata, err := audiomorph.ReadTags(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid tag, expected KEY=VALUE: %s", arg)
+		}
+		if strings.EqualFold(strings.TrimSpace(key), "PICTURE") {
+			picture, err := audiomorph.ReadPicture(value)
+			if err != nil {
+				return err
+			}
+			metadata.SetPicture(picture)
+			continue
+		}
+		metadata.Set(key, value)
+	}
+	if err := audiomorph.WriteTags(args[0], metadata); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	printTags(metadata)
+	return nil
+}
+
+// runTagsRemove removes tags from a file
+func runTagsRemove(cmd *cobra.Command, args []string) error {
+	if len(args) == 1 && !flagTagsRemoveAll {
+		return fmt.Errorf("no tags to remove, give their keys or --all")
+	}
+	metadata, err := audiomorph.ReadTags(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+	if flagTagsRemoveAll {
+		metadata = audiomorph.Metadata{}
+	}
+	for _, key := range args[1:] {
+		if strings.EqualFold(key, "PICTURE") {
+			metadata.Pictures = nil
+			continue
+		}
+		metadata.Set(key, "")
+	}
+	if err := audiomorph.WriteTags(args[0], metadata); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	printTags(metadata)
+	return nil
+}
+
+// printTags lists the tags and embedded pictures
+func printTags(metadata audiomorph.Metadata) {
+	if metadata.IsEmpty() {
+		fmt.Printf("No tags\n")
+		return
+	}
+	fmt.Printf("Tags:\n")
+	for _, tag := range metadata.Tags() {
+		fmt.Printf("  %-12s %s\n", tag[0]+":", tag[1])
+	}
+	for _, picture := range metadata.Pictures {
+		fmt.Printf("  Picture:     type %d, %s, %d bytes\n", picture.Type, picture.MIMEType, len(picture.Data))
+	}
+}
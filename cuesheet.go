@@ -0,0 +1,263 @@
+package audiomorph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CueFramesPerSecond is the number of CD frames per second, the unit of cue sheet positions
+const CueFramesPerSecond = 75
+
+// CueSheet is a parsed .cue file describing the tracks of an album image
+type CueSheet struct {
+	Title      string
+	Performer  string
+	Songwriter string
+	Catalog    string
+	Remarks    map[string]string // REM lines keyed by upper case name, e.g. GENRE or DATE
+	Tracks     []CueTrack        // audio tracks, data tracks are skipped
+}
+
+// CueTrack is one track of a cue sheet
+type CueTrack struct {
+	Number     int
+	File       string // the FILE the track is in, relative to the cue sheet
+	Title      string
+	Performer  string
+	Songwriter string
+	ISRC       string
+	Start      int // INDEX 01 in CD frames from the start of the file
+	Remarks    map[string]string
+}
+
+// ReadCueSheet reads and parses a .cue file
+func ReadCueSheet(filename string) (*CueSheet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cue sheet: %w", err)
+	}
+	defer f.Close()
+	return ParseCueSheet(f)
+}
+
+// ParseCueSheet parses a cue sheet
+func ParseCueSheet(r io.Reader) (*CueSheet, error) {
+	sheet := &CueSheet{}
+	var track *CueTrack
+	var file string
+	dataTrack := false
+	hasStart := false
+
+	// endTrack adds the current track once all of its lines are read
+	endTrack := func() error {
+		if track != nil && !dataTrack {
+			if !hasStart {
+				return fmt.Errorf("track %d has no INDEX 01", track.Number)
+			}
+			sheet.Tracks = append(sheet.Tracks, *track)
+		}
+		track = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		fields := cueFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		command := strings.ToUpper(fields[0])
+		args := fields[1:]
+		arg := ""
+		if len(args) > 0 {
+			arg = args[0]
+		}
+
+		switch command {
+		case "FILE":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("line %d: FILE without a file name", lineNumber)
+			}
+			file = arg
+		case "TRACK":
+			if err := endTrack(); err != nil {
+				return nil, err
+			}
+			number, err := strconv.Atoi(arg)
+			if err != nil || len(args) < 2 {
+				return nil, fmt.Errorf("line %d: invalid TRACK: %s", lineNumber, line)
+			}
+			track = &CueTrack{Number: number, File: file}
+			dataTrack = !strings.EqualFold(args[1], "AUDIO")
+			hasStart = false
+		case "INDEX":
+			if track == nil || len(args) < 2 {
+				return nil, fmt.Errorf("line %d: INDEX outside a track", lineNumber)
+			}
+			frames, err := parseCueTime(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if number, _ := strconv.Atoi(arg); number == 1 {
+				track.Start = frames
+				hasStart = true
+			}
+		case "TITLE", "PERFORMER", "SONGWRITER":
+			field := map[string]*string{"TITLE": &sheet.Title, "PERFORMER": &sheet.Performer, "SONGWRITER": &sheet.Songwriter}[command]
+			if track != nil {
+				field = map[string]*string{"TITLE": &track.Title, "PERFORMER": &track.Performer, "SONGWRITER": &track.Songwriter}[command]
+			}
+			*field = arg
+		case "ISRC":
+			if track != nil {
+				track.ISRC = arg
+			}
+		case "CATALOG":
+			sheet.Catalog = arg
+		case "REM":
+			if len(args) < 2 {
+				continue
+			}
+			remarks := &sheet.Remarks
+			if track != nil {
+				remarks = &track.Remarks
+			}
+			if *remarks == nil {
+				*remarks = make(map[string]string)
+			}
+			(*remarks)[strings.ToUpper(arg)] = strings.Join(args[1:], " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cue sheet: %w", err)
+	}
+	if err := endTrack(); err != nil {
+		return nil, err
+	}
+	if len(sheet.Tracks) == 0 {
+		return nil, fmt.Errorf("cue sheet has no audio tracks")
+	}
+	return sheet, nil
+}
+
+// cueFields splits a cue sheet line into fields, keeping double quoted strings together
+func cueFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		var field string
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				end = len(line) - 1
+			}
+			field, line = line[1:end+1], line[min(end+2, len(line)):]
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			field, line = line[:end], line[end:]
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields
+}
+
+// parseCueTime parses an mm:ss:ff cue sheet time into CD frames
+func parseCueTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid cue time: %s", s)
+	}
+	var values [3]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid cue time: %s", s)
+		}
+		values[i] = value
+	}
+	if values[1] >= 60 || values[2] >= CueFramesPerSecond {
+		return 0, fmt.Errorf("invalid cue time: %s", s)
+	}
+	return (values[0]*60+values[1])*CueFramesPerSecond + values[2], nil
+}
+
+// Metadata returns the tags of a track: its own title, performer and remarks with the album's
+func (s *CueSheet) Metadata(track CueTrack) Metadata {
+	var m Metadata
+	for key, value := range s.Remarks {
+		m.Set(key, value)
+	}
+	for key, value := range track.Remarks {
+		m.Set(key, value)
+	}
+	m.Album = s.Title
+	m.AlbumArtist = s.Performer
+	m.Artist = s.Performer
+	if track.Performer != "" {
+		m.Artist = track.Performer
+	}
+	m.Composer = s.Songwriter
+	if track.Songwriter != "" {
+		m.Composer = track.Songwriter
+	}
+	m.Title = track.Title
+	m.TrackNumber = track.Number
+	m.TrackTotal = len(s.Tracks)
+	m.Set("ISRC", track.ISRC)
+	return m
+}
+
+// SplitByCue cuts audio into one Audio per track of a single file cue sheet. Each track runs
+// from its INDEX 01 to the INDEX 01 of the next track and is tagged from the cue sheet on top
+// of the tags of the album image. Markers, loops and the broadcast time reference within a
+// track are kept, positioned from its start.
+func SplitByCue(audio *Audio, sheet *CueSheet) ([]*Audio, error) {
+	for _, track := range sheet.Tracks {
+		if track.File != sheet.Tracks[0].File {
+			return nil, fmt.Errorf("cue sheet refers to more than one file: %s and %s", sheet.Tracks[0].File, track.File)
+		}
+	}
+
+	if len(audio.Data) == 0 || audio.SampleRate <= 0 {
+		return nil, fmt.Errorf("cannot split audio without channels or sample rate")
+	}
+	numSamples := audio.numSamples()
+	position := func(frames int) int {
+		return min(numSamples, int(int64(frames)*int64(audio.SampleRate)/CueFramesPerSecond))
+	}
+
+	tracks := make([]*Audio, len(sheet.Tracks))
+	for i, track := range sheet.Tracks {
+		start, end := position(track.Start), numSamples
+		if i+1 < len(sheet.Tracks) {
+			end = position(sheet.Tracks[i+1].Start)
+		}
+		if end <= start {
+			return nil, fmt.Errorf("track %d is empty or out of order", track.Number)
+		}
+
+		sliced, err := audio.Slice(start, end)
+		if err != nil {
+			return nil, err
+		}
+		trackTags := sheet.Metadata(track)
+		for _, field := range trackTags.Tags() {
+			sliced.Metadata.Set(field[0], field[1])
+		}
+		sliced.History = append([]string(nil), audio.History...)
+		tracks[i] = sliced
+	}
+	return tracks, nil
+}
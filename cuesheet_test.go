@@ -0,0 +1,135 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCueSheet is a cue sheet for data/wilhelm.wav with a byte order mark,
+// a data track and CRLF line endings
+const testCueSheet = "\ufeffREM GENRE \"Sound Effects\"\r\n" +
+	"REM DATE 1951\r\n" +
+	"PERFORMER \"Sheb Wooley\"\r\n" +
+	"TITLE \"Distant Drums\"\r\n" +
+	"FILE \"wilhelm.wav\" WAVE\r\n" +
+	"  TRACK 01 AUDIO\r\n" +
+	"    TITLE \"Scream One\"\r\n" +
+	"    ISRC USRC17607839\r\n" +
+	"    INDEX 01 00:00:00\r\n" +
+	"  TRACK 02 AUDIO\r\n" +
+	"    TITLE \"Scream Two\"\r\n" +
+	"    PERFORMER Wilhelm\r\n" +
+	"    INDEX 00 00:00:30\r\n" +
+	"    INDEX 01 00:00:50\r\n" +
+	"  TRACK 03 MODE1/2352\r\n" +
+	"    INDEX 01 00:01:00\r\n"
+
+func TestParseCueSheet(t *testing.T) {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+	if sheet.Title != "Distant Drums" || sheet.Performer != "Sheb Wooley" {
+		t.Errorf("Unexpected album: %q by %q", sheet.Title, sheet.Performer)
+	}
+	if !reflect.DeepEqual(sheet.Remarks, map[string]string{"GENRE": "Sound Effects", "DATE": "1951"}) {
+		t.Errorf("Unexpected remarks: %v", sheet.Remarks)
+	}
+
+	// The data track is skipped, INDEX 00 is the pregap and not the start of the track
+	expected := []CueTrack{
+		{Number: 1, File: "wilhelm.wav", Title: "Scream One", ISRC: "USRC17607839", Start: 0},
+		{Number: 2, File: "wilhelm.wav", Title: "Scream Two", Performer: "Wilhelm", Start: 50},
+	}
+	if !reflect.DeepEqual(sheet.Tracks, expected) {
+		t.Errorf("Tracks mismatch:\nexpected %+v\ngot      %+v", expected, sheet.Tracks)
+	}
+}
+
+func TestParseCueSheetErrors(t *testing.T) {
+	for _, cue := range []string{
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\n",
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 00:61:00\n",
+		"FILE a.wav WAVE\nINDEX 01 00:00:00\n",
+		"TITLE \"Nothing\"\n",
+	} {
+		if _, err := ParseCueSheet(strings.NewReader(cue)); err == nil {
+			t.Errorf("Expected an error for cue sheet %q", cue)
+		}
+	}
+}
+
+func TestSplitByCue(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+	split := 50 * audio.SampleRate / CueFramesPerSecond
+	audio.Markers = []Marker{{ID: 1, Position: split + 100, Label: "Scream"}}
+	audio.Broadcast = &BroadcastExtension{TimeReference: 1000}
+	tracks, err := SplitByCue(audio, sheet)
+	if err != nil {
+		t.Fatalf("Failed to split audio: %v", err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(tracks))
+	}
+
+	// 50 frames are 2/3 of a second
+	if len(tracks[0].Data[0]) != split || len(tracks[1].Data[0]) != len(audio.Data[0])-split {
+		t.Errorf("Unexpected track lengths: %d and %d samples", len(tracks[0].Data[0]), len(tracks[1].Data[0]))
+	}
+	if tracks[1].Data[0][0] != audio.Data[0][split] {
+		t.Errorf("The second track does not start at its INDEX 01")
+	}
+
+	// Markers and the broadcast time reference move with the tracks
+	if len(tracks[0].Markers) != 0 || len(tracks[1].Markers) != 1 || tracks[1].Markers[0].Position != 100 {
+		t.Errorf("Unexpected track markers: %+v and %+v", tracks[0].Markers, tracks[1].Markers)
+	}
+	if tracks[0].Broadcast.TimeReference != 1000 || tracks[1].Broadcast.TimeReference != uint64(1000+split) {
+		t.Errorf("Unexpected time references: %d and %d", tracks[0].Broadcast.TimeReference, tracks[1].Broadcast.TimeReference)
+	}
+
+	// Each track is tagged from the cue sheet and written with its tags
+	filename := filepath.Join(os.TempDir(), "test_output_cue_track.flac")
+	defer os.Remove(filename)
+	if err := EncodeFile(tracks[1], filename); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	m := decoded.Metadata
+	if m.Title != "Scream Two" || m.Artist != "Wilhelm" || m.Album != "Distant Drums" || m.AlbumArtist != "Sheb Wooley" ||
+		m.TrackNumber != 2 || m.TrackTotal != 2 || m.Genre != "Sound Effects" || m.Date != "1951" {
+		t.Errorf("Unexpected track tags: %v", m.Tags())
+	}
+	assertSamplesEqual(t, tracks[1].Data, decoded.Data)
+}
+
+func TestSplitByCueMultipleFiles(t *testing.T) {
+	sheet := &CueSheet{Tracks: []CueTrack{{Number: 1, File: "a.wav"}, {Number: 2, File: "b.wav"}}}
+	audio := &Audio{NumChannels: 1, SampleRate: 44100, Data: [][]int{make([]int, 44100)}}
+	if _, err := SplitByCue(audio, sheet); err == nil {
+		t.Errorf("Expected an error for a cue sheet with several files")
+	}
+}
+
+func TestSplitByCueNoChannels(t *testing.T) {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	if err != nil {
+		t.Fatalf("Failed to parse cue sheet: %v", err)
+	}
+	if _, err := SplitByCue(&Audio{SampleRate: 44100}, sheet); err == nil {
+		t.Errorf("Expected an error for audio without channels")
+	}
+}
@@ -1,6 +1,7 @@
 package audiomorph
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,41 +9,92 @@ import (
 
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/vorbis"
 	"github.com/go-audio/aiff"
 	"github.com/go-audio/wav"
 	"github.com/mewkiz/flac"
 )
 
-// DecodeFile decodes a WAV, AIF/AIFF, MP3, OGG, or FLAC file and returns an Audio struct
-func DecodeFile(filename string) (*Audio, error) {
+// DecodeFile decodes a WAV, W64, AIF/AIFF/AIFC, MP3, OGG, FLAC, AU/SND, WavPack, or headerless RAW/PCM file and returns an Audio struct.
+// Options are applied to the returned Audio; the raw options describe the layout of .raw and .pcm files.
+func DecodeFile(filename string, options ...Option) (*Audio, error) {
+	cfg := &Audio{}
+	for _, option := range options {
+		option(cfg)
+	}
+
 	ext := strings.ToLower(filepath.Ext(filename))
 
+	var audio *Audio
+	var err error
 	switch ext {
 	case ".wav":
-		return decodeWAV(filename)
-	case ".aif", ".aiff":
-		return decodeAIFF(filename)
+		audio, err = decodeWAV(filename)
+	case ".aif", ".aiff", ".aifc":
+		audio, err = decodeAIFF(filename)
 	case ".mp3":
-		return decodeMP3(filename)
-	case ".ogg":
-		return decodeOGG(filename)
+		audio, err = decodeMP3(filename)
+	case ".ogg", ".oga", ".opus":
+		audio, err = decodeOGG(filename, cfg)
 	case ".flac":
-		return decodeFLAC(filename)
+		audio, err = decodeFLAC(filename)
+	case ".w64":
+		audio, err = decodeW64(filename)
+	case ".au", ".snd":
+		audio, err = decodeAU(filename)
+	case ".wv":
+		audio, err = decodeWavPack(filename)
+	case ".raw", ".pcm":
+		audio, err = decodeRawFile(filename, cfg)
 	default:
 		return nil, fmt.Errorf("unsupported file format: %s", ext)
 	}
+	if err != nil {
+		return nil, err
+	}
+	readHistory(audio, filename)
+
+	for _, option := range options {
+		option(audio)
+	}
+
+	return audio, nil
 }
 
 // decodeWAV decodes a WAV file
 func decodeWAV(filename string) (*Audio, error) {
-	f, err := os.Open(filename)
+	raw, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open WAV file: %w", err)
 	}
-	defer f.Close()
 
-	decoder := wav.NewDecoder(f)
+	// Compressed and float formats are decoded here, PCM is left to go-audio/wav
+	formType, chunks, err := readRIFF(raw)
+	if err != nil || formType != "WAVE" {
+		return nil, fmt.Errorf("invalid WAV file")
+	}
+	fmtChunk := findChunk(chunks, "fmt ")
+	if fmtChunk == nil {
+		return nil, fmt.Errorf("invalid WAV file: missing fmt chunk")
+	}
+	wavFmt, err := parseWAVFormat(fmtChunk.data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WAV file: %w", err)
+	}
+	if wavFmt.formatTag != wavFormatPCM {
+		audio, err := decodeWAVChunks(wavFmt, chunks)
+		if err != nil {
+			return nil, err
+		}
+		audio.Metadata = riffMetadata(chunks)
+		audio.Markers = wavMarkers(chunks)
+		audio.Instrument = wavInstrument(chunks)
+		audio.LoopInfo = wavLoopInfo(chunks)
+		audio.coding = wavCodings[wavFmt.formatTag]
+		readBroadcastChunks(audio, chunks)
+		return audio, nil
+	}
+
+	decoder := wav.NewDecoder(bytes.NewReader(raw))
 	if !decoder.IsValidFile() {
 		return nil, fmt.Errorf("invalid WAV file")
 	}
@@ -78,24 +130,45 @@ func decodeWAV(filename string) (*Audio, error) {
 	// Calculate duration
 	duration := float64(numSamples) / float64(format.SampleRate)
 
-	return &Audio{
+	audio := &Audio{
 		NumChannels: int(format.NumChannels),
 		SampleRate:  int(format.SampleRate),
 		BitDepth:    int(decoder.BitDepth),
 		Data:        data,
 		Duration:    duration,
-	}, nil
+		Metadata:    riffMetadata(chunks),
+		Markers:     wavMarkers(chunks),
+		Instrument:  wavInstrument(chunks),
+		LoopInfo:    wavLoopInfo(chunks),
+	}
+	readBroadcastChunks(audio, chunks)
+	return audio, nil
 }
 
-// decodeAIFF decodes an AIFF/AIF file
+// decodeAIFF decodes an AIFF/AIF or AIFF-C file
 func decodeAIFF(filename string) (*Audio, error) {
-	f, err := os.Open(filename)
+	raw, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open AIFF file: %w", err)
 	}
-	defer f.Close()
 
-	decoder := aiff.NewDecoder(f)
+	// AIFF-C is decoded here, plain AIFF is left to go-audio/aiff
+	formType, chunks, err := readIFF(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AIFF file")
+	}
+	if formType == "AIFC" {
+		audio, err := decodeAIFC(chunks)
+		if err != nil {
+			return nil, err
+		}
+		audio.Metadata = aiffMetadata(chunks)
+		audio.Instrument, audio.Markers = aiffInstrument(chunks, aiffMarkers(chunks))
+		audio.LoopInfo = aiffLoopInfo(chunks, len(audio.Data[0]), audio.SampleRate)
+		return audio, nil
+	}
+
+	decoder := aiff.NewDecoder(bytes.NewReader(raw))
 	if !decoder.IsValidFile() {
 		return nil, fmt.Errorf("invalid AIFF file")
 	}
@@ -124,47 +197,38 @@ func decodeAIFF(filename string) (*Audio, error) {
 	// Calculate duration
 	duration := float64(numSamples) / float64(format.SampleRate)
 
-	return &Audio{
+	audio := &Audio{
 		NumChannels: int(format.NumChannels),
 		SampleRate:  int(format.SampleRate),
 		BitDepth:    int(decoder.BitDepth),
 		Data:        data,
 		Duration:    duration,
-	}, nil
+		Metadata:    aiffMetadata(chunks),
+	}
+	audio.Instrument, audio.Markers = aiffInstrument(chunks, aiffMarkers(chunks))
+	audio.LoopInfo = aiffLoopInfo(chunks, numSamples, audio.SampleRate)
+	return audio, nil
 }
 
 // decodeMP3 decodes an MP3 file
 func decodeMP3(filename string) (*Audio, error) {
-	f, err := os.Open(filename)
+	raw, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open MP3 file: %w", err)
 	}
-	defer f.Close()
 
-	streamer, format, err := mp3.Decode(f)
+	streamer, format, err := mp3.Decode(nopSeekCloser{bytes.NewReader(raw)})
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode MP3 file: %w", err)
 	}
 	defer streamer.Close()
 
-	return streamToAudio(streamer, format)
-}
-
-// decodeOGG decodes an OGG Vorbis file
-func decodeOGG(filename string) (*Audio, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open OGG file: %w", err)
-	}
-	defer f.Close()
-
-	streamer, format, err := vorbis.Decode(f)
+	audio, err := streamToAudio(streamer, format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode OGG file: %w", err)
+		return nil, err
 	}
-	defer streamer.Close()
-
-	return streamToAudio(streamer, format)
+	audio.Metadata = readMP3Metadata(raw)
+	return audio, nil
 }
 
 // decodeFLAC decodes a FLAC file
@@ -175,6 +239,11 @@ func decodeFLAC(filename string) (*Audio, error) {
 	}
 	defer stream.Close()
 
+	return flacStreamToAudio(stream)
+}
+
+// flacStreamToAudio reads every frame of a parsed FLAC stream into an Audio struct
+func flacStreamToAudio(stream *flac.Stream) (*Audio, error) {
 	// Get metadata
 	info := stream.Info
 	numChannels := int(info.NChannels)
@@ -204,16 +273,25 @@ func decodeFLAC(filename string) (*Audio, error) {
 		}
 	}
 
-	// Calculate duration
-	duration := float64(totalSamples) / float64(sampleRate)
+	// Calculate duration from the decoded samples, STREAMINFO may not know the total
+	duration := float64(len(data[0])) / float64(sampleRate)
 
-	return &Audio{
+	audio := &Audio{
 		NumChannels: numChannels,
 		SampleRate:  sampleRate,
 		BitDepth:    bitDepth,
 		Data:        data,
 		Duration:    duration,
-	}, nil
+		Metadata:    flacBlockMetadata(stream.Blocks),
+		Markers:     flacMarkers(stream.Blocks),
+		Instrument:  flacInstrument(stream.Blocks),
+	}
+
+	// Loop comments are kept for players that only read those, the APPLICATION block takes precedence
+	if instrument := loopCommentInstrument(&audio.Metadata); audio.Instrument == nil {
+		audio.Instrument = instrument
+	}
+	return audio, nil
 }
 
 // streamToAudio converts a beep.StreamSeekCloser to an Audio struct
@@ -0,0 +1,41 @@
+package audiomorph
+
+import (
+	"strings"
+
+	"github.com/schollz/audiomorph/dynamics"
+)
+
+// ApplyDynamics processes the audio with dynamics processors in order
+func (a *Audio) ApplyDynamics(processors ...dynamics.Processor) error {
+	return dynamics.Apply(a.Data, a.SampleRate, a.BitDepth, processors...)
+}
+
+// OptionDynamics processes the audio with dynamics processors in order when encoding. Gates,
+// expanders and compressors run before normalization and limiters after it, so normalization
+// sees the compressed audio and a limiter sets the final peak level.
+func OptionDynamics(processors ...dynamics.Processor) Option {
+	return func(a *Audio) {
+		a.dynamics = append([]dynamics.Processor(nil), processors...)
+	}
+}
+
+// dynamicsAudio applies the limiters or the other dynamics configured on the audio, returning
+// the coding history operation
+func dynamicsAudio(audio *Audio, limiters bool) (string, error) {
+	var processors []dynamics.Processor
+	var names []string
+	for _, d := range audio.dynamics {
+		if (d.Type == "limiter") == limiters {
+			processors = append(processors, d)
+			names = append(names, d.String())
+		}
+	}
+	if len(processors) == 0 {
+		return "", nil
+	}
+	if err := audio.ApplyDynamics(processors...); err != nil {
+		return "", err
+	}
+	return "dynamics " + strings.Join(names, " "), nil
+}
@@ -0,0 +1,353 @@
+// Package dynamics processes audio samples with compressors, look-ahead true peak limiters,
+// gates and expanders
+package dynamics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/audiomorph/filter"
+)
+
+// Processor describes a compressor, limiter, gate or expander. Zero settings take the defaults
+// of the type.
+type Processor struct {
+	Type      string  // compressor, limiter, gate or expander
+	Threshold float64 // dBFS, or the true peak ceiling in dBTP of a limiter
+	Ratio     float64 // compressor 4, expander 2, gate and limiter infinite
+	Knee      float64 // dB, width of the soft knee around the threshold, 0 for a hard knee
+	Attack    float64 // seconds for the gain to go down (compressor) or up (gate, expander)
+	Release   float64 // seconds for the gain to recover (compressor, limiter) or close (gate, expander)
+	Lookahead float64 // seconds the limiter reacts ahead of a peak, 5 ms if 0
+	Range     float64 // dB, the most a gate (-80) or expander (-40) lowers the level
+	Makeup    float64 // dB added after a compressor
+	Unlinked  bool    // each channel is detected on its own instead of all following the loudest
+}
+
+// Defaults of the processor types
+var defaults = map[string]Processor{
+	"compressor": {Ratio: 4, Attack: 0.01, Release: 0.1},
+	"limiter":    {Release: 0.05, Lookahead: 0.005},
+	"gate":       {Ratio: math.Inf(1), Attack: 0.001, Release: 0.1, Range: -80},
+	"expander":   {Ratio: 2, Attack: 0.005, Release: 0.1, Range: -40},
+}
+
+// withDefaults returns the settings with the defaults of the type filled in, checking them
+func (d Processor) withDefaults() (Processor, error) {
+	typeDefaults, ok := defaults[d.Type]
+	if !ok {
+		return d, fmt.Errorf("unsupported dynamics type: %s", d.Type)
+	}
+	if d.Ratio == 0 {
+		d.Ratio = typeDefaults.Ratio
+	}
+	if d.Attack == 0 {
+		d.Attack = typeDefaults.Attack
+	}
+	if d.Release == 0 {
+		d.Release = typeDefaults.Release
+	}
+	if d.Lookahead == 0 {
+		d.Lookahead = typeDefaults.Lookahead
+	}
+	if d.Range == 0 {
+		d.Range = typeDefaults.Range
+	}
+	switch {
+	case d.Type != "limiter" && d.Ratio < 1:
+		return d, fmt.Errorf("invalid %s ratio %g, must be at least 1", d.Type, d.Ratio)
+	case d.Knee < 0 || d.Attack < 0 || d.Release < 0 || d.Lookahead < 0:
+		return d, fmt.Errorf("invalid %s settings, knee and times must not be negative", d.Type)
+	case d.Range > 0:
+		return d, fmt.Errorf("invalid %s range %g dB, must not be positive", d.Type, d.Range)
+	}
+	return d, nil
+}
+
+// gainComputer returns the static gain in dB of a compressor, gate or expander for a level in
+// dBFS, with a quadratic soft knee
+func (d Processor) gainComputer(level float64) float64 {
+	over := level - d.Threshold
+	if d.Type == "compressor" {
+		slope := 1/d.Ratio - 1
+		switch {
+		case 2*over <= -d.Knee:
+			return 0
+		case 2*over < d.Knee:
+			return slope * (over + d.Knee/2) * (over + d.Knee/2) / (2 * d.Knee)
+		}
+		return slope * over
+	}
+
+	// Gates and expanders lower the level below the threshold, by at most their range
+	var gain float64
+	switch {
+	case 2*over >= d.Knee:
+		return 0
+	case math.IsInf(d.Ratio, 1):
+		gain = d.Range
+		if d.Knee > 0 {
+			gain = d.Range * (d.Knee/2 - over) / d.Knee
+		}
+	case 2*over > -d.Knee:
+		gain = -(d.Ratio - 1) * (over - d.Knee/2) * (over - d.Knee/2) / (2 * d.Knee)
+	default:
+		gain = (d.Ratio - 1) * over
+	}
+	return max(gain, d.Range)
+}
+
+// timeCoefficient returns the one pole smoothing coefficient of a time constant in seconds
+func timeCoefficient(seconds float64, sampleRate int) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return math.Exp(-1 / (seconds * float64(sampleRate)))
+}
+
+// detectorLevels returns the peak envelope in dBFS of each channel, or of the loudest channel
+// for every channel when linked. The envelope follows peaks at once and decays over the
+// release time, so it holds the level of a tone between its peaks.
+func detectorLevels(data [][]int, scale float64, sampleRate int, linked bool, release float64) [][]float64 {
+	decay := timeCoefficient(release, sampleRate)
+	levels := make([][]float64, len(data))
+	for ch, samples := range data {
+		levels[ch] = make([]float64, len(samples))
+		var envelope float64
+		for i, sample := range samples {
+			envelope = max(math.Abs(float64(sample))/scale, envelope*decay)
+			levels[ch][i] = envelope
+		}
+	}
+	if linked {
+		for i := range levels[0] {
+			for ch := 1; ch < len(levels); ch++ {
+				levels[0][i] = max(levels[0][i], levels[ch][i])
+			}
+		}
+		for ch := 1; ch < len(levels); ch++ {
+			levels[ch] = levels[0]
+		}
+	}
+	for ch := range levels {
+		if ch > 0 && linked {
+			break
+		}
+		for i, level := range levels[ch] {
+			levels[ch][i] = 20 * math.Log10(level)
+		}
+	}
+	return levels
+}
+
+// dynamicsGains returns the smoothed gain in dB for each sample of each channel of a
+// compressor, gate or expander
+func (d Processor) dynamicsGains(data [][]int, scale float64, sampleRate int) [][]float64 {
+	// A compressor attacks by lowering the gain, a gate or expander by raising it
+	down := timeCoefficient(d.Release, sampleRate)
+	up := timeCoefficient(d.Attack, sampleRate)
+	if d.Type == "compressor" {
+		down, up = up, down
+	}
+
+	levels := detectorLevels(data, scale, sampleRate, !d.Unlinked, d.Release)
+	gains := make([][]float64, len(levels))
+	for ch := range levels {
+		if ch > 0 && !d.Unlinked {
+			gains[ch] = gains[0]
+			continue
+		}
+		gains[ch] = make([]float64, len(levels[ch]))
+		var gain float64
+		if d.Type != "compressor" {
+			gain = d.gainComputer(levels[ch][0])
+		}
+		for i, level := range levels[ch] {
+			target := d.gainComputer(level)
+			coefficient := down
+			if target > gain {
+				coefficient = up
+			}
+			gain = target + coefficient*(gain-target)
+			gains[ch][i] = gain
+		}
+	}
+	return gains
+}
+
+// limiterGains returns the gain as a factor for each sample of each channel of a look-ahead
+// true peak limiter. Each peak is reached by a ramp over the look-ahead time, so the gain is
+// already down when the peak arrives, and the gain recovers over the release time.
+func (d Processor) limiterGains(data [][]int, scale float64, sampleRate int) [][]float64 {
+	ceiling := math.Pow(10, d.Threshold/20) * scale
+	lookahead := max(int(math.Round(d.Lookahead*float64(sampleRate))), 1)
+	release := timeCoefficient(d.Release, sampleRate)
+	phases := filter.TruePeakPhases()
+
+	// The gain each sample needs, from its own peak and the peaks between it and the next samples
+	required := make([][]float64, len(data))
+	for ch, samples := range data {
+		required[ch] = make([]float64, len(samples))
+		for i, sample := range samples {
+			peak := math.Abs(float64(sample))
+			for _, phase := range phases {
+				var y float64
+				for k, tap := range phase {
+					if j := i + filter.TruePeakTaps/2 - k; j >= 0 && j < len(samples) {
+						y += tap * float64(samples[j])
+					}
+				}
+				peak = max(peak, math.Abs(y))
+			}
+			required[ch][i] = min(1, ceiling/max(peak, 1))
+		}
+	}
+	if !d.Unlinked {
+		for i := range required[0] {
+			for ch := 1; ch < len(required); ch++ {
+				required[0][i] = min(required[0][i], required[ch][i])
+			}
+		}
+		for ch := 1; ch < len(required); ch++ {
+			required[ch] = required[0]
+		}
+	}
+
+	gains := make([][]float64, len(required))
+	for ch := range required {
+		if ch > 0 && !d.Unlinked {
+			gains[ch] = gains[0]
+			continue
+		}
+		n := len(required[ch])
+
+		// The lowest gain needed within the look-ahead, from a window of increasing needs
+		held := make([]float64, n)
+		var window []int
+		for i := n - 1; i >= 0; i-- {
+			for len(window) > 0 && required[ch][window[len(window)-1]] >= required[ch][i] {
+				window = window[:len(window)-1]
+			}
+			window = append(window, i)
+			if window[0] > i+lookahead {
+				window = window[1:]
+			}
+			held[i] = required[ch][window[0]]
+		}
+
+		// The gain recovers over the release time
+		recovered := 1.0
+		for i := range held {
+			recovered = min(held[i], held[i]+release*(recovered-held[i]))
+			held[i] = recovered
+		}
+
+		// Averaging over the look-ahead turns the steps into ramps that stay below each need
+		gains[ch] = make([]float64, n)
+		var sum float64
+		for i := 0; i < n; i++ {
+			sum += held[i]
+			if i >= lookahead {
+				sum -= held[i-lookahead]
+			}
+			gains[ch][i] = sum / float64(min(i+1, lookahead))
+		}
+	}
+	return gains
+}
+
+// Apply processes channels of samples at a sample rate and bit depth with processors in
+// order, clipping the result
+func Apply(data [][]int, sampleRate, bitDepth int, processors ...Processor) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if bitDepth <= 0 {
+		bitDepth = 16
+	}
+	scale := float64(int64(1) << uint(bitDepth-1))
+	maxValue := scale - 1
+	for _, d := range processors {
+		d, err := d.withDefaults()
+		if err != nil {
+			return err
+		}
+		if d.Type == "limiter" {
+			for ch, gains := range d.limiterGains(data, scale, sampleRate) {
+				for i, gain := range gains {
+					data[ch][i] = int(max(-maxValue-1, min(maxValue, math.Round(float64(data[ch][i])*gain))))
+				}
+			}
+			continue
+		}
+		for ch, gains := range d.dynamicsGains(data, scale, sampleRate) {
+			for i, gain := range gains {
+				factor := math.Pow(10, (gain+d.Makeup)/20)
+				data[ch][i] = int(max(-maxValue-1, min(maxValue, math.Round(float64(data[ch][i])*factor))))
+			}
+		}
+	}
+	return nil
+}
+
+// String formats the processor as Parse reads it
+func (d Processor) String() string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	s := d.Type + ":" + format(d.Threshold)
+	for _, setting := range []struct {
+		key   string
+		value float64
+	}{{"ratio", d.Ratio}, {"knee", d.Knee}, {"attack", d.Attack}, {"release", d.Release},
+		{"lookahead", d.Lookahead}, {"range", d.Range}, {"makeup", d.Makeup}} {
+		if setting.value != 0 {
+			s += "," + setting.key + "=" + format(setting.value)
+		}
+	}
+	if d.Unlinked {
+		s += ",unlinked"
+	}
+	return s
+}
+
+// Parse parses a processor as type:threshold followed by any of ,ratio=R ,knee=dB
+// ,attack=s ,release=s ,lookahead=s ,range=dB ,makeup=dB and ,unlinked, e.g.
+// "compressor:-18,ratio=3,attack=0.005" or "gate:-50,range=-30"
+func Parse(spec string) (Processor, error) {
+	fields := strings.Split(spec, ",")
+	dynamicsType, threshold, ok := strings.Cut(fields[0], ":")
+	if !ok {
+		return Processor{}, fmt.Errorf("invalid dynamics %q, expected type:threshold", spec)
+	}
+	d := Processor{Type: strings.ToLower(strings.TrimSpace(dynamicsType))}
+	var err error
+	if d.Threshold, err = strconv.ParseFloat(strings.TrimSpace(threshold), 64); err != nil {
+		return Processor{}, fmt.Errorf("invalid dynamics threshold %q", threshold)
+	}
+	settings := map[string]*float64{
+		"ratio": &d.Ratio, "knee": &d.Knee, "attack": &d.Attack, "release": &d.Release,
+		"lookahead": &d.Lookahead, "range": &d.Range, "makeup": &d.Makeup,
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		key = strings.ToLower(key)
+		if key == "unlinked" {
+			d.Unlinked = true
+			continue
+		}
+		setting, ok := settings[key]
+		if !ok {
+			return Processor{}, fmt.Errorf("unknown dynamics setting %q", field)
+		}
+		if *setting, err = strconv.ParseFloat(value, 64); err != nil {
+			return Processor{}, fmt.Errorf("invalid dynamics setting %q", field)
+		}
+	}
+	if _, err := d.withDefaults(); err != nil {
+		return Processor{}, err
+	}
+	return d, nil
+}
@@ -0,0 +1,73 @@
+package dynamics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGainComputer(t *testing.T) {
+	tests := []struct {
+		processor Processor
+		level     float64
+		expected  float64
+	}{
+		{Processor{Type: "compressor", Threshold: -20}, -10, -7.5},
+		{Processor{Type: "compressor", Threshold: -20}, -30, 0},
+		{Processor{Type: "compressor", Threshold: -20, Knee: 10}, -20, -0.9375},
+		{Processor{Type: "compressor", Threshold: -20, Knee: 10}, -26, 0},
+		{Processor{Type: "compressor", Threshold: -20, Knee: 10}, -10, -7.5},
+		{Processor{Type: "gate", Threshold: -50}, -60, -80},
+		{Processor{Type: "gate", Threshold: -50}, -40, 0},
+		{Processor{Type: "gate", Threshold: -50, Knee: 10}, -50, -40},
+		{Processor{Type: "expander", Threshold: -40}, -50, -10},
+		{Processor{Type: "expander", Threshold: -40}, -100, -40},
+		{Processor{Type: "expander", Threshold: -40}, math.Inf(-1), -40},
+		{Processor{Type: "expander", Threshold: -40, Ratio: 3, Knee: 4}, -40, -1},
+	}
+	for _, tt := range tests {
+		d, err := tt.processor.withDefaults()
+		if err != nil {
+			t.Fatalf("Invalid %s: %v", tt.processor, err)
+		}
+		if gain := d.gainComputer(tt.level); math.Abs(gain-tt.expected) > 1e-9 {
+			t.Errorf("Expected %s at %g dBFS to give %g dB, got %g dB", tt.processor, tt.level, tt.expected, gain)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"compressor:-18,ratio=3,knee=6,attack=0.005,release=0.2,makeup=4", "limiter:-1,lookahead=0.01", "gate:-50,range=-30,unlinked", "expander:-40"} {
+		d, err := Parse(spec)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", spec, err)
+		} else if d.String() != spec {
+			t.Errorf("Expected %q to format as itself, got %q", spec, d.String())
+		}
+	}
+	for _, spec := range []string{"squash:-10", "compressor", "compressor:x", "compressor:-10,ratio=0.5", "gate:-50,range=10", "limiter:-1,attack=-1", "limiter:-1,hold=2"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	// A hard knee compressor with an infinite ratio holds a square wave at the threshold
+	data := [][]int{make([]int, 4800)}
+	for i := range data[0] {
+		data[0][i] = 16384
+		if i/24%2 == 1 {
+			data[0][i] = -16384
+		}
+	}
+	if err := Apply(data, 48000, 16, Processor{Type: "compressor", Threshold: -12, Ratio: math.Inf(1), Attack: 0.0001}); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if level := 20 * math.Log10(math.Abs(float64(data[0][4799]))/32768); math.Abs(level+12) > 0.1 {
+		t.Errorf("Expected the square wave at -12 dBFS, got %.2f", level)
+	}
+
+	if err := Apply(data, 48000, 16, Processor{Type: "squash"}); err == nil {
+		t.Errorf("Expected an error for an unknown processor type")
+	}
+}
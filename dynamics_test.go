@@ -0,0 +1,125 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schollz/audiomorph/dynamics"
+)
+
+// levelDB returns the peak level in dBFS of 16-bit samples
+func levelDB(samples []int) float64 {
+	var peak int
+	for _, sample := range samples {
+		peak = max(peak, sample, -sample)
+	}
+	return amplitudeDB(float64(peak) / 32768)
+}
+
+func TestCompressor(t *testing.T) {
+	// A -6 dBFS sine, 14 dB over the threshold, comes out 3.5 dB over it
+	audio := sineAudio(2, 1000, 0, -6, 2)
+	audio.Data[1] = sineAudio(1, 1000, 0, -30, 2).Data[0]
+	if err := audio.ApplyDynamics(dynamics.Processor{Type: "compressor", Threshold: -20, Makeup: 2}); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if level := levelDB(audio.Data[0][48000:]); math.Abs(level-(-14.5)) > 0.5 {
+		t.Errorf("Expected a -14.5 dBFS peak, got %.2f", level)
+	}
+
+	// The quiet channel follows the loud one when linked, but not when unlinked
+	if level := levelDB(audio.Data[1][48000:]); math.Abs(level-(-38.5)) > 0.5 {
+		t.Errorf("Expected the linked channel at -38.5 dBFS, got %.2f", level)
+	}
+	audio = sineAudio(2, 1000, 0, -6, 2)
+	audio.Data[1] = sineAudio(1, 1000, 0, -30, 2).Data[0]
+	if err := audio.ApplyDynamics(dynamics.Processor{Type: "compressor", Threshold: -20, Unlinked: true}); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if level := levelDB(audio.Data[1][48000:]); math.Abs(level-(-30)) > 0.1 {
+		t.Errorf("Expected the unlinked channel at -30 dBFS, got %.2f", level)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// A quiet half second, then a full scale tone with peaks between its samples
+	quiet := sineAudio(1, 1000, 0, -20, 0.5).Data[0]
+	loud := sineAudio(1, 12000, math.Pi/4, 0, 0.5).Data[0]
+	audio := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{append(quiet, loud...)}}
+	if err := audio.ApplyDynamics(dynamics.Processor{Type: "limiter", Threshold: -1}); err != nil {
+		t.Fatalf("Failed to limit: %v", err)
+	}
+	if peak := amplitudeDB(truePeak(audio)); peak > -0.9 {
+		t.Errorf("Expected a true peak at most -1 dBTP, got %.2f", peak)
+	}
+	for i := 0; i < 23000; i++ {
+		if audio.Data[0][i] != quiet[i] {
+			t.Fatalf("Expected the quiet part before the look-ahead to be unchanged at sample %d", i)
+		}
+	}
+}
+
+func TestGate(t *testing.T) {
+	// Faint noise, then a tone, then faint noise again
+	data := make([]int, 96000)
+	for i := range data {
+		data[i] = i%7 - 3
+	}
+	copy(data[24000:], sineAudio(1, 1000, 0, -12, 0.5).Data[0])
+	audio := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{data}}
+	if err := audio.ApplyDynamics(dynamics.Processor{Type: "gate", Threshold: -50}); err != nil {
+		t.Fatalf("Failed to gate: %v", err)
+	}
+	if level := levelDB(audio.Data[0][:20000]); !math.IsInf(level, -1) {
+		t.Errorf("Expected the noise to be gated, got %.2f dBFS", level)
+	}
+	if level := levelDB(audio.Data[0][30000:48000]); math.Abs(level-(-12)) > 0.1 {
+		t.Errorf("Expected the tone to pass at -12 dBFS, got %.2f", level)
+	}
+	if level := levelDB(audio.Data[0][90000:]); !math.IsInf(level, -1) {
+		t.Errorf("Expected the gate to close after the release, got %.2f dBFS", level)
+	}
+}
+
+func TestOptionDynamics(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "test_output_dynamics.wav")
+	defer os.Remove(filename)
+
+	// The compressor runs before normalization and the limiter after it, which would otherwise
+	// leave the peak at -3 dBFS
+	options := []Option{OptionNormalize(-3), OptionDynamics(dynamics.Processor{Type: "limiter", Threshold: -6}, dynamics.Processor{Type: "compressor", Threshold: -30})}
+	if err := EncodeFile(sineAudio(1, 1000, 0, -20, 1), filename, options...); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	audio, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if peak := amplitudeDB(truePeak(audio)); peak > -5.9 || peak < -6.5 {
+		t.Errorf("Expected a -6 dBTP true peak, got %.2f", peak)
+	}
+	if history := audio.History[len(audio.History)-1]; !strings.Contains(history, "dynamics compressor:-30; normalize peak to -3.0 dBFS") || !strings.HasSuffix(history, "; dynamics limiter:-6") {
+		t.Errorf("Expected the compressor before and the limiter after normalization in the coding history, got %q", history)
+	}
+
+	// A later OptionDynamics replaces the processors of an earlier one, and a second encode does
+	// not process the audio again
+	source := sineAudio(1, 1000, 0, -20, 1)
+	if err := EncodeFile(source, filename, OptionDynamics(dynamics.Processor{Type: "squash"}), OptionDynamics(dynamics.Processor{Type: "limiter", Threshold: -30})); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	rows := len(source.History)
+	if err := EncodeFile(source, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if len(source.History) != rows {
+		t.Errorf("Expected no dynamics by a second encode, got history %q", source.History[rows:])
+	}
+
+	if err := EncodeFile(sineAudio(1, 1000, 0, -20, 1), filename, OptionDynamics(dynamics.Processor{Type: "squash"})); err == nil {
+		t.Errorf("Expected an error for an unknown dynamics type")
+	}
+}
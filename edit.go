@@ -0,0 +1,143 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// Slice returns a copy of the audio from sample start up to sample end. Markers and loops
+// are moved with the audio, those outside the slice are dropped, and the BWF time reference
+// is moved to the start of the slice.
+func (a *Audio) Slice(start, end int) (*Audio, error) {
+	numSamples := a.numSamples()
+	if start < 0 || end > numSamples || start > end {
+		return nil, fmt.Errorf("invalid slice %d to %d of %d samples", start, end, numSamples)
+	}
+	data := make([][]int, len(a.Data))
+	for ch := range a.Data {
+		data[ch] = append([]int(nil), a.Data[ch][start:end]...)
+	}
+	return a.withData(data, -start), nil
+}
+
+// SliceSeconds returns a copy of the audio from start up to end, in seconds
+func (a *Audio) SliceSeconds(start, end float64) (*Audio, error) {
+	return a.Slice(a.sampleAt(start), a.sampleAt(end))
+}
+
+// Trim removes start seconds from the beginning and end seconds from the end of the audio
+func (a *Audio) Trim(start, end float64) error {
+	if start < 0 || end < 0 {
+		return fmt.Errorf("invalid trim of %g and %g seconds", start, end)
+	}
+	first, last := a.sampleAt(start), a.numSamples()-a.sampleAt(end)
+	if first > last {
+		return fmt.Errorf("cannot trim %g and %g seconds from %.2f seconds of audio", start, end, float64(a.numSamples())/float64(a.SampleRate))
+	}
+	trimmed, err := a.Slice(first, last)
+	if err != nil {
+		return err
+	}
+	*a = *trimmed
+	return nil
+}
+
+// Pad adds before seconds of silence at the beginning and after seconds at the end of the audio
+func (a *Audio) Pad(before, after float64) error {
+	if before < 0 || after < 0 {
+		return fmt.Errorf("invalid padding of %g and %g seconds", before, after)
+	}
+	head, tail := a.sampleAt(before), a.sampleAt(after)
+	data := make([][]int, len(a.Data))
+	for ch := range a.Data {
+		data[ch] = make([]int, head+len(a.Data[ch])+tail)
+		copy(data[ch][head:], a.Data[ch])
+	}
+	*a = *a.withData(data, head)
+	return nil
+}
+
+// edges holds the seconds trimmed or padded at both ends, configured by OptionTrim or OptionPad
+type edges struct {
+	start, end float64
+}
+
+// OptionTrim removes start seconds from the beginning and end seconds from the end of the audio
+// when encoding
+func OptionTrim(start, end float64) Option {
+	return func(a *Audio) {
+		a.trim = &edges{start, end}
+	}
+}
+
+// OptionPad adds before seconds of silence at the beginning and after seconds at the end of the
+// audio when encoding, after any trim
+func OptionPad(before, after float64) Option {
+	return func(a *Audio) {
+		a.pad = &edges{before, after}
+	}
+}
+
+// editAudio trims, then pads the audio as configured, returning the coding history operations
+func editAudio(audio *Audio) ([]string, error) {
+	var operations []string
+	if trim := audio.trim; trim != nil {
+		if err := audio.Trim(trim.start, trim.end); err != nil {
+			return nil, err
+		}
+		operations = append(operations, fmt.Sprintf("trim %.3f s and %.3f s", trim.start, trim.end))
+	}
+	if pad := audio.pad; pad != nil {
+		if err := audio.Pad(pad.start, pad.end); err != nil {
+			return nil, err
+		}
+		operations = append(operations, fmt.Sprintf("pad %.3f s and %.3f s", pad.start, pad.end))
+	}
+	return operations, nil
+}
+
+// numSamples returns the number of samples per channel
+func (a *Audio) numSamples() int {
+	if len(a.Data) == 0 {
+		return 0
+	}
+	return len(a.Data[0])
+}
+
+// sampleAt converts a time in seconds to a sample position
+func (a *Audio) sampleAt(seconds float64) int {
+	return int(math.Round(seconds * float64(a.SampleRate)))
+}
+
+// withData returns a copy of the audio holding new samples, which start offset samples after
+// the samples of the audio. Everything positioned in samples is moved with them.
+func (a *Audio) withData(data [][]int, offset int) *Audio {
+	edited := *a
+	edited.Data = data
+	edited.Duration = 0
+	if a.SampleRate > 0 && len(data) > 0 {
+		edited.Duration = float64(len(data[0])) / float64(a.SampleRate)
+	}
+	if a.Metadata.Extra != nil {
+		edited.Metadata.Extra = make(map[string]string, len(a.Metadata.Extra))
+		for key, value := range a.Metadata.Extra {
+			edited.Metadata.Extra[key] = value
+		}
+	}
+
+	length := edited.numSamples()
+	edited.Markers = shiftMarkers(a.Markers, offset, length)
+	edited.Instrument = shiftInstrument(a.Instrument, offset, length)
+	if a.Broadcast != nil {
+		bext := *a.Broadcast
+		bext.TimeReference = uint64(max(0, int64(bext.TimeReference)-int64(offset)))
+		edited.Broadcast = &bext
+	}
+	if a.LoopInfo != nil && a.LoopInfo.Beats > 0 {
+		// The beat count no longer matches, it is derived from the tempo again
+		info := *a.LoopInfo
+		info.Beats = 0
+		edited.LoopInfo = &info
+	}
+	return &edited
+}
@@ -0,0 +1,142 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rampAudio returns mono 44.1 kHz audio whose samples count up from 0
+func rampAudio(numSamples int) *Audio {
+	data := make([]int, numSamples)
+	for i := range data {
+		data[i] = i % 30000
+	}
+	return &Audio{NumChannels: 1, SampleRate: 44100, BitDepth: 16, Data: [][]int{data}, Duration: float64(numSamples) / 44100}
+}
+
+func TestSlice(t *testing.T) {
+	audio := rampAudio(44100)
+	audio.Markers = testMarkers()
+	audio.Instrument = testInstrument()
+	audio.Broadcast = &BroadcastExtension{TimeReference: 1000}
+	audio.LoopInfo = &LoopInfo{Tempo: 120, Beats: 2}
+
+	sliced, err := audio.Slice(11025, 26460)
+	if err != nil {
+		t.Fatalf("Failed to slice audio: %v", err)
+	}
+	if len(sliced.Data[0]) != 15435 || sliced.Data[0][0] != 11025 || math.Abs(sliced.Duration-0.35) > 1e-9 {
+		t.Errorf("Unexpected slice: %d samples starting at %d, %.3f seconds", len(sliced.Data[0]), sliced.Data[0][0], sliced.Duration)
+	}
+
+	// The first marker is cut off, the region is cut at the end of the slice
+	expected := []Marker{
+		{ID: 2, Position: 0, Label: "Scream", Note: "the loud part"},
+		{ID: 5, Position: 11025, Length: 4410, Label: "Tail"},
+	}
+	if !reflect.DeepEqual(sliced.Markers, expected) {
+		t.Errorf("Expected markers %+v, got %+v", expected, sliced.Markers)
+	}
+	if len(sliced.Instrument.Loops) != 0 || len(audio.Instrument.Loops) != 2 {
+		t.Errorf("Expected the loops outside the slice to be dropped, got %+v", sliced.Instrument.Loops)
+	}
+	if sliced.Broadcast.TimeReference != 12025 || audio.Broadcast.TimeReference != 1000 {
+		t.Errorf("Expected the time reference 12025, got %d", sliced.Broadcast.TimeReference)
+	}
+	if sliced.LoopInfo.Beats != 0 || sliced.LoopInfo.Tempo != 120 {
+		t.Errorf("Expected the beat count to be derived again, got %+v", sliced.LoopInfo)
+	}
+
+	if _, err := audio.Slice(100, 50); err == nil {
+		t.Errorf("Expected an error for a reversed slice")
+	}
+	if _, err := audio.SliceSeconds(0.5, 1.5); err == nil {
+		t.Errorf("Expected an error for a slice past the end")
+	}
+}
+
+func TestTrimAndPad(t *testing.T) {
+	audio := rampAudio(44100)
+	audio.Instrument = testInstrument()
+	audio.Broadcast = &BroadcastExtension{TimeReference: 1000}
+
+	if err := audio.Trim(0.05, 0.25); err != nil {
+		t.Fatalf("Failed to trim audio: %v", err)
+	}
+	if len(audio.Data[0]) != 30870 || audio.Data[0][0] != 2205 {
+		t.Errorf("Unexpected trimmed audio: %d samples starting at %d", len(audio.Data[0]), audio.Data[0][0])
+	}
+	if err := audio.Pad(0.1, 0.5); err != nil {
+		t.Fatalf("Failed to pad audio: %v", err)
+	}
+	if len(audio.Data[0]) != 57330 || audio.Data[0][4409] != 0 || audio.Data[0][4410] != 2205 || audio.Data[0][57329] != 0 {
+		t.Errorf("Unexpected padded audio of %d samples", len(audio.Data[0]))
+	}
+	if math.Abs(audio.Duration-1.3) > 1e-9 {
+		t.Errorf("Expected 1.3 seconds, got %.3f", audio.Duration)
+	}
+
+	// Loops and the time reference follow the audio
+	expected := []Loop{
+		{Start: 6615, End: 11025, Mode: LoopForward},
+		{Start: 24255, End: 33075, Mode: LoopPingPong},
+	}
+	if !reflect.DeepEqual(audio.Instrument.Loops, expected) {
+		t.Errorf("Expected loops %+v, got %+v", expected, audio.Instrument.Loops)
+	}
+	if audio.Broadcast.TimeReference != 0 {
+		t.Errorf("Expected the time reference to stop at 0, got %d", audio.Broadcast.TimeReference)
+	}
+
+	if err := audio.Trim(1, 1); err == nil {
+		t.Errorf("Expected an error trimming more than the audio")
+	}
+	if err := audio.Pad(-1, 0); err == nil {
+		t.Errorf("Expected an error for negative padding")
+	}
+
+	// The edited audio encodes with its loops
+	filename := filepath.Join(os.TempDir(), "test_output_trim.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if len(decoded.Data[0]) != 57330 || decoded.Instrument == nil || !reflect.DeepEqual(decoded.Instrument.Loops, expected) {
+		t.Errorf("Unexpected decoded audio: %d samples, %+v", len(decoded.Data[0]), decoded.Instrument)
+	}
+}
+
+func TestTrimAndPadOptions(t *testing.T) {
+	audio := rampAudio(44100)
+	filename := filepath.Join(os.TempDir(), "test_output_trim_options.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionTrim(0.05, 0.25), OptionPad(0.1, 0.5)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if len(decoded.Data[0]) != 57330 || decoded.Data[0][4410] != 2205 {
+		t.Errorf("Unexpected edited audio: %d samples", len(decoded.Data[0]))
+	}
+	if row := decoded.History[len(decoded.History)-1]; !strings.HasSuffix(row, "T=audiomorph: trim 0.050 s and 0.250 s; pad 0.100 s and 0.500 s") {
+		t.Errorf("Unexpected coding history row: %s", row)
+	}
+
+	// The edits are not repeated by a second encode
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if len(audio.Data[0]) != 57330 {
+		t.Errorf("Expected the second encode to keep 57330 samples, got %d", len(audio.Data[0]))
+	}
+}
@@ -1,7 +1,9 @@
 package audiomorph
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -107,6 +109,15 @@ func convertSampleRate(audio *Audio, targetSampleRate int, method string) error
 		}
 	}
 
+	// Markers, loops and the BWF time reference count samples, so they are rescaled to the new rate
+	audio.Markers = rescaleMarkers(audio.Markers, ratio)
+	audio.Instrument = rescaleInstrument(audio.Instrument, ratio)
+	if audio.Broadcast != nil {
+		bext := *audio.Broadcast
+		bext.TimeReference = uint64(math.Round(float64(bext.TimeReference) * ratio))
+		audio.Broadcast = &bext
+	}
+
 	// Update the audio struct with resampled data
 	audio.Data = newData
 	audio.SampleRate = targetSampleRate
@@ -170,12 +181,147 @@ func convertBitDepth(audio *Audio, targetBitDepth int) error {
 
 // EncodeFile encodes an Audio struct to a file based on the filename extension
 func EncodeFile(audio *Audio, filename string, options ...Option) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	row, err := prepareEncode(audio, ext, options)
+	if err != nil {
+		return err
+	}
+
+	switch ext {
+	case ".wav":
+		err = encodeWAV(audio, filename)
+	case ".aif", ".aiff", ".aifc":
+		err = encodeAIFF(audio, filename)
+	case ".mp3":
+		err = encodeMP3(audio, filename)
+	case ".flac":
+		err = encodeFLAC(audio, filename)
+	case ".w64":
+		err = encodeW64(audio, filename)
+	case ".au", ".snd":
+		err = encodeAU(audio, filename)
+	case ".wv":
+		err = encodeWavPack(audio, filename)
+	case ".raw", ".pcm":
+		err = encodeRawFile(audio, filename)
+	default:
+		return fmt.Errorf("unsupported file format: %s", ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The history row of the encode is only added to the audio once the file is written
+	written := withHistoryRow(audio, row)
+	if ext != ".raw" && ext != ".pcm" {
+		if err := writeFileMetadata(filename, written, ext, row != ""); err != nil {
+			return err
+		}
+	}
+	audio.History, audio.Broadcast = written.History, written.Broadcast
+	return nil
+}
+
+// writeFileMetadata writes the Broadcast Wave chunks, markers, loops and tags of the audio into
+// the container of an encoded file. A WAV or W64 file gets a bext chunk for the coding history
+// when the encode added a row to it.
+func writeFileMetadata(filename string, audio *Audio, ext string, newRow bool) error {
+	wavHistory := newRow && (ext == ".wav" || ext == ".w64")
+	if audio.Broadcast != nil || audio.IXML != nil || len(audio.Markers) > 0 || audio.Instrument != nil || audio.LoopInfo != nil || wavHistory {
+		if err := writeChunks(filename, audio); err != nil {
+			return err
+		}
+	}
+	metadata := withHistoryTag(audio.Metadata, audio.History, ext)
+	if ext == ".flac" {
+		metadata = withLoopComments(metadata, audio.Instrument)
+	}
+	if metadata.IsEmpty() {
+		return nil
+	}
+	return writeMetadata(filename, metadata)
+}
+
+// writeChunks adds the Broadcast Wave chunks, markers, loops and tempo of the audio to an encoded file
+func writeChunks(filename string, audio *Audio) error {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded file: %w", err)
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".wav":
+		formType, chunks, err := readRIFF(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read WAV chunks: %w", err)
+		}
+		chunks = withWAVMarkers(withBroadcastChunks(chunks, audio), audio.Markers)
+		chunks = withWAVInstrument(chunks, audio.Instrument, audio.SampleRate)
+		chunks = withWAVLoopInfo(chunks, audio.LoopInfo, len(audio.Data[0]), audio.SampleRate)
+		if err := writeRIFF(&buf, formType, chunks); err != nil {
+			return fmt.Errorf("failed to write WAV chunks: %w", err)
+		}
+	case ".w64":
+		chunks, err := readW64(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read W64 chunks: %w", err)
+		}
+		chunks = withWAVMarkers(withBroadcastChunks(chunks, audio), audio.Markers)
+		chunks = withWAVInstrument(chunks, audio.Instrument, audio.SampleRate)
+		chunks = withWAVLoopInfo(chunks, audio.LoopInfo, len(audio.Data[0]), audio.SampleRate)
+		if err := writeW64(&buf, chunks); err != nil {
+			return fmt.Errorf("failed to write W64 chunks: %w", err)
+		}
+	case ".aif", ".aiff", ".aifc":
+		formType, chunks, err := readIFF(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read AIFF chunks: %w", err)
+		}
+		chunks = withAIFFMarkers(chunks, audio.Markers, audio.Instrument)
+		chunks = withAIFFLoopInfo(chunks, audio.LoopInfo, len(audio.Data[0]), audio.SampleRate)
+		if err := writeIFF(&buf, formType, chunks); err != nil {
+			return fmt.Errorf("failed to write AIFF chunks: %w", err)
+		}
+	case ".flac":
+		blocks, frameStart, err := readFLACBlocks(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read FLAC metadata: %w", err)
+		}
+		var updated []flacBlock
+		for _, block := range blocks {
+			if block.blockType != flacBlockCueSheet && !isFLACRIFFBlock(block) {
+				updated = append(updated, block)
+			}
+		}
+		if len(audio.Markers) > 0 {
+			updated = append(updated, flacBlock{blockType: flacBlockCueSheet, data: buildFLACCueSheet(audio.Markers, len(audio.Data[0]))})
+		}
+		if audio.Instrument != nil {
+			updated = append(updated, flacBlock{blockType: flacBlockApplication, data: buildFLACInstrument(audio.Instrument, audio.SampleRate)})
+		}
+		buf.Write(writeFLACBlocks(updated, raw[frameStart:]))
+	default:
+		return nil
+	}
+
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write encoded file: %w", err)
+	}
+	return nil
+}
+
+// prepareEncode applies the options to the audio and performs the conversions they request
+// for the output format identified by ext, returning the coding history row of the encode.
+// Processing options such as normalization are applied once: they are cleared from the audio,
+// so a later encode does not repeat them.
+func prepareEncode(audio *Audio, ext string, options []Option) (string, error) {
 	// Apply options
 	for _, option := range options {
 		option(audio)
 	}
-
-	ext := strings.ToLower(filepath.Ext(filename))
+	defer clearOperations(audio)
 
 	// For MP3 files, ensure the sample rate is supported
 	if ext == ".mp3" {
@@ -191,36 +337,173 @@ func EncodeFile(audio *Audio, filename string, options ...Option) error {
 		}
 	}
 
+	// G.711 and ADPCM codecs encode 16-bit samples
+	switch ext {
+	case ".wav", ".w64":
+		tag, err := wavCodecTag(audio)
+		if err != nil {
+			return "", err
+		}
+		if tag != wavFormatPCM && tag != wavFormatIEEEFloat {
+			audio.targetBitDepth = 16
+		}
+	case ".au", ".snd":
+		encoding, err := auEncodingName(audio)
+		if err != nil {
+			return "", err
+		}
+		if encoding == "ulaw" || encoding == "alaw" {
+			audio.targetBitDepth = 16
+		}
+		// Linear PCM has encodings for whole bytes only
+		if encoding == "pcm" && audio.targetBitDepth == 0 && audio.BitDepth%8 != 0 {
+			audio.targetBitDepth = (audio.BitDepth + 7) / 8 * 8
+		}
+	case ".aif", ".aiff", ".aifc":
+		compression, err := aifcCompression(audio)
+		if err != nil {
+			return "", err
+		}
+		if compression == "ulaw" || compression == "alaw" {
+			audio.targetBitDepth = 16
+		}
+	case ".wv":
+		if _, err := wavpackModeName(audio); err != nil {
+			return "", err
+		}
+	}
+
+	// For raw integer output, the sample format determines the bit depth
+	if ext == ".raw" || ext == ".pcm" {
+		spec, err := rawOutputSpec(audio)
+		if err != nil {
+			return "", err
+		}
+		if !spec.float {
+			audio.targetBitDepth = spec.bits
+		}
+	}
+
+	// The operations are recorded in the coding history
+	var operations []string
+	if len(audio.useChannels) > 0 {
+		operations = append(operations, fmt.Sprintf("channels %s", strings.Trim(fmt.Sprint(audio.useChannels), "[]")))
+	}
+
+	// Trimming and padding come first, so the later operations see the kept audio
+	edits, err := editAudio(audio)
+	if err != nil {
+		return "", err
+	}
+	operations = append(operations, edits...)
+
+	// Channel changes and gain come next, so the later operations see the adjusted audio
+	adjustments, err := adjustChannels(audio)
+	if err != nil {
+		return "", err
+	}
+	operations = append(operations, adjustments...)
+
+	// Repair clipping after the gain, which can leave headroom for the reconstructed peaks
+	repairs, err := restoreAudio(audio)
+	if err != nil {
+		return "", fmt.Errorf("failed to restore audio: %w", err)
+	}
+	operations = append(operations, repairs...)
+
+	// Filter before resampling, so a low pass can remove what a lower rate would alias
+	operation, err := filterAudio(audio)
+	if err != nil {
+		return "", err
+	}
+	if operation != "" {
+		operations = append(operations, operation)
+	}
+
+	// Trim the leading and trailing silence before fading the new ends
+	if operation, err = trimAudioSilence(audio); err != nil {
+		return "", err
+	}
+	if operation != "" {
+		operations = append(operations, operation)
+	}
+
+	// Fade after trimming, so the fades end at the edges of the kept audio
+	fades, err := fadeAudio(audio)
+	if err != nil {
+		return "", err
+	}
+	operations = append(operations, fades...)
+
 	// Apply sample rate conversion if specified
 	if audio.targetSampleRate > 0 && audio.targetSampleRate != audio.SampleRate {
+		method := audio.interpolationMethod
+		if method == "" {
+			method = "linear"
+		}
+		operations = append(operations, fmt.Sprintf("resample %d to %d Hz (%s)", audio.SampleRate, audio.targetSampleRate, method))
 		if err := convertSampleRate(audio, audio.targetSampleRate, audio.interpolationMethod); err != nil {
-			return fmt.Errorf("failed to convert sample rate: %w", err)
+			return "", fmt.Errorf("failed to convert sample rate: %w", err)
+		}
+	}
+
+	// Gates, expanders and compressors come before normalization, which measures their result
+	if operation, err = dynamicsAudio(audio, false); err != nil {
+		return "", err
+	}
+	if operation != "" {
+		operations = append(operations, operation)
+	}
+
+	// Normalize at the source bit depth, so a lower target bit depth quantizes the result
+	if audio.normalize != nil {
+		if operation := normalizeAudio(audio); operation != "" {
+			operations = append(operations, operation)
 		}
 	}
 
+	// Limiters follow normalization, so they set the final peak level
+	if operation, err = dynamicsAudio(audio, true); err != nil {
+		return "", err
+	}
+	if operation != "" {
+		operations = append(operations, operation)
+	}
+
 	// Apply bit depth conversion if specified
 	if audio.targetBitDepth > 0 && audio.targetBitDepth != audio.BitDepth {
+		operations = append(operations, fmt.Sprintf("bit depth %d to %d", audio.BitDepth, audio.targetBitDepth))
 		if err := convertBitDepth(audio, audio.targetBitDepth); err != nil {
-			return fmt.Errorf("failed to convert bit depth: %w", err)
+			return "", fmt.Errorf("failed to convert bit depth: %w", err)
 		}
 	}
 
-	switch ext {
-	case ".wav":
-		return encodeWAV(audio, filename)
-	case ".aif", ".aiff":
-		return encodeAIFF(audio, filename)
-	case ".mp3":
-		return encodeMP3(audio, filename)
-	case ".flac":
-		return encodeFLAC(audio, filename)
-	default:
-		return fmt.Errorf("unsupported file format: %s", ext)
-	}
+	return encodeHistoryRow(audio, ext, operations), nil
+}
+
+// clearOperations removes the processing options from the audio once an encode has applied them
+func clearOperations(audio *Audio) {
+	audio.trim, audio.pad = nil, nil
+	audio.swapChannels, audio.invertPolarity, audio.pan, audio.gain = nil, nil, nil, nil
+	audio.declip, audio.removeDC = false, nil
+	audio.filters = nil
+	audio.trimSilence = nil
+	audio.fadeIn, audio.fadeOut = nil, nil
+	audio.dynamics = nil
+	audio.normalize = nil
 }
 
 // encodeWAV encodes audio data to a WAV file
 func encodeWAV(audio *Audio, filename string) error {
+	// Non-PCM codecs are written by encodeWAVCodec
+	tag, err := wavCodecTag(audio)
+	if err != nil {
+		return err
+	}
+	if tag != wavFormatPCM {
+		return encodeWAVCodec(audio, filename, tag)
+	}
+
 	f, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create WAV file: %w", err)
@@ -276,6 +559,11 @@ func encodeWAV(audio *Audio, filename string) error {
 
 // encodeAIFF encodes audio data to an AIFF file
 func encodeAIFF(audio *Audio, filename string) error {
+	// AIFF-C files are written by encodeAIFC
+	if audio.aiffCompression != "" || strings.ToLower(filepath.Ext(filename)) == ".aifc" {
+		return encodeAIFC(audio, filename)
+	}
+
 	f, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create AIFF file: %w", err)
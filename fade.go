@@ -0,0 +1,178 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// fadeCurves maps the fade curve names to the gain of a fade in at a position from 0 to 1. A
+// fade out uses the same curve backwards.
+var fadeCurves = map[string]func(x float64) float64{
+	// Amplitude rises evenly
+	"linear": func(x float64) float64 {
+		return x
+	},
+	// Power rises evenly, so crossfading uncorrelated audio keeps its loudness
+	"equal-power": func(x float64) float64 {
+		return math.Sin(x * math.Pi / 2)
+	},
+	// Level rises evenly in dB from -60 dB, which sounds even
+	"logarithmic": func(x float64) float64 {
+		return (math.Pow(1000, x) - 1) / 999
+	},
+	// Gain starts and ends smoothly
+	"s-curve": func(x float64) float64 {
+		return 0.5 - 0.5*math.Cos(x*math.Pi)
+	},
+}
+
+// fade is a fade in or out configured by OptionFadeIn or OptionFadeOut
+type fade struct {
+	seconds float64
+	curve   string
+}
+
+// OptionFadeIn fades the audio in over a number of seconds when encoding, with a curve of
+// linear, equal-power, logarithmic or s-curve (default linear)
+func OptionFadeIn(seconds float64, curve string) Option {
+	return func(a *Audio) {
+		a.fadeIn = &fade{seconds: seconds, curve: curve}
+	}
+}
+
+// OptionFadeOut fades the audio out over a number of seconds when encoding, with a curve of
+// linear, equal-power, logarithmic or s-curve (default linear)
+func OptionFadeOut(seconds float64, curve string) Option {
+	return func(a *Audio) {
+		a.fadeOut = &fade{seconds: seconds, curve: curve}
+	}
+}
+
+// fadeCurve returns the gain function of a fade curve name, linear if empty
+func fadeCurve(name string) (func(float64) float64, error) {
+	if name == "" {
+		name = "linear"
+	}
+	curve, ok := fadeCurves[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported fade curve: %s", name)
+	}
+	return curve, nil
+}
+
+// FadeIn fades the beginning of the audio in over a number of seconds, at most the whole audio
+func (a *Audio) FadeIn(seconds float64, curve string) error {
+	return a.applyFade(seconds, curve, true)
+}
+
+// FadeOut fades the end of the audio out over a number of seconds, at most the whole audio
+func (a *Audio) FadeOut(seconds float64, curve string) error {
+	return a.applyFade(seconds, curve, false)
+}
+
+// applyFade fades the beginning of the audio in or its end out
+func (a *Audio) applyFade(seconds float64, curve string, in bool) error {
+	gain, err := fadeCurve(curve)
+	if err != nil {
+		return err
+	}
+	if seconds < 0 {
+		return fmt.Errorf("invalid fade of %g seconds", seconds)
+	}
+	length := min(a.sampleAt(seconds), a.numSamples())
+	for _, samples := range a.Data {
+		if in {
+			fadeSamples(samples, 0, length, gain, true)
+		} else {
+			fadeSamples(samples, len(samples)-length, length, gain, false)
+		}
+	}
+	return nil
+}
+
+// fadeSamples applies a fade in or out to length samples from start
+func fadeSamples(samples []int, start, length int, gain func(float64) float64, in bool) {
+	start = max(start, 0)
+	length = min(length, len(samples)-start)
+	for i := 0; i < length; i++ {
+		x := (float64(i) + 0.5) / float64(length)
+		if !in {
+			x = 1 - x
+		}
+		samples[start+i] = int(math.Round(float64(samples[start+i]) * gain(x)))
+	}
+}
+
+// fadeAudio applies the fades configured on the audio, returning the coding history operations
+func fadeAudio(audio *Audio) ([]string, error) {
+	var operations []string
+	for _, f := range []struct {
+		fade *fade
+		in   bool
+		name string
+	}{{audio.fadeIn, true, "fade in"}, {audio.fadeOut, false, "fade out"}} {
+		if f.fade == nil {
+			continue
+		}
+		if err := audio.applyFade(f.fade.seconds, f.fade.curve, f.in); err != nil {
+			return nil, fmt.Errorf("failed to %s: %w", f.name, err)
+		}
+		curve := f.fade.curve
+		if curve == "" {
+			curve = "linear"
+		}
+		operations = append(operations, fmt.Sprintf("%s %.3f s (%s)", f.name, f.fade.seconds, curve))
+	}
+	return operations, nil
+}
+
+// Crossfade joins two audio values, fading the end of a out while the beginning of b fades in
+// over a number of seconds. Both must have the same sample rate and number of channels, b is
+// converted to the bit depth of a. The result has the tags of a and the markers of both.
+func Crossfade(a, b *Audio, seconds float64, curve string) (*Audio, error) {
+	gain, err := fadeCurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	if a.SampleRate != b.SampleRate || len(a.Data) != len(b.Data) {
+		return nil, fmt.Errorf("cannot crossfade %d channels at %d Hz with %d channels at %d Hz", len(a.Data), a.SampleRate, len(b.Data), b.SampleRate)
+	}
+	length := a.sampleAt(seconds)
+	if seconds < 0 || length > a.numSamples() || length > b.numSamples() {
+		return nil, fmt.Errorf("invalid crossfade of %g seconds between %.2f and %.2f seconds of audio", seconds, a.Duration, b.Duration)
+	}
+	if b.BitDepth != a.BitDepth {
+		converted := b.withData(copyData(b.Data), 0)
+		if err := convertBitDepth(converted, a.BitDepth); err != nil {
+			return nil, fmt.Errorf("failed to convert bit depth: %w", err)
+		}
+		b = converted
+	}
+
+	offset := a.numSamples() - length
+	maxValue := fullScale(a.BitDepth) - 1
+	data := make([][]int, len(a.Data))
+	for ch := range a.Data {
+		data[ch] = make([]int, offset+b.numSamples())
+		copy(data[ch], a.Data[ch][:offset])
+		copy(data[ch][a.numSamples():], b.Data[ch][length:])
+		for i := 0; i < length; i++ {
+			x := (float64(i) + 0.5) / float64(length)
+			mixed := float64(a.Data[ch][offset+i])*gain(1-x) + float64(b.Data[ch][i])*gain(x)
+			data[ch][offset+i] = int(max(-maxValue-1, min(maxValue, math.Round(mixed))))
+		}
+	}
+
+	joined := a.withData(data, 0)
+	joined.Markers = appendMarkers(joined.Markers, b.Markers, offset, joined.numSamples())
+	return joined, nil
+}
+
+// copyData returns a copy of the samples of each channel
+func copyData(data [][]int) [][]int {
+	copied := make([][]int, len(data))
+	for ch := range data {
+		copied[ch] = append([]int(nil), data[ch]...)
+	}
+	return copied
+}
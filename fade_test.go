@@ -0,0 +1,176 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// constantAudio returns stereo 48 kHz audio whose samples all have one value
+func constantAudio(value, numSamples int) *Audio {
+	data := make([][]int, 2)
+	for ch := range data {
+		data[ch] = make([]int, numSamples)
+		for i := range data[ch] {
+			data[ch][i] = value
+		}
+	}
+	return &Audio{NumChannels: 2, SampleRate: 48000, BitDepth: 16, Data: data, Duration: float64(numSamples) / 48000}
+}
+
+func TestFadeCurves(t *testing.T) {
+	for name, curve := range fadeCurves {
+		if curve(0) != 0 || math.Abs(curve(1)-1) > 1e-12 {
+			t.Errorf("Expected the %s curve to run from 0 to 1, got %g to %g", name, curve(0), curve(1))
+		}
+		for x := 0.1; x < 1; x += 0.1 {
+			if curve(x) <= curve(x-0.1) {
+				t.Errorf("Expected the %s curve to rise at %.1f", name, x)
+			}
+		}
+	}
+	expected := map[string]float64{"linear": 0.5, "equal-power": math.Sqrt(0.5), "logarithmic": 30.62 / 999, "s-curve": 0.5}
+	for name, gain := range expected {
+		if math.Abs(fadeCurves[name](0.5)-gain) > 1e-3 {
+			t.Errorf("Expected the %s curve to be %.4f halfway, got %.4f", name, gain, fadeCurves[name](0.5))
+		}
+	}
+}
+
+func TestFadeInOut(t *testing.T) {
+	audio := constantAudio(10000, 4800)
+	if err := audio.FadeIn(0.01, "linear"); err != nil {
+		t.Fatalf("Failed to fade in: %v", err)
+	}
+	if err := audio.FadeOut(0.02, "s-curve"); err != nil {
+		t.Fatalf("Failed to fade out: %v", err)
+	}
+	for _, samples := range audio.Data {
+		if samples[0] != 10 || samples[240] != 5010 || samples[480] != 10000 || samples[3840] != 10000 {
+			t.Errorf("Unexpected fade in: %d, %d, %d", samples[0], samples[240], samples[480])
+		}
+		if samples[4799] != 0 || math.Abs(float64(samples[3840+480]-5000)) > 40 {
+			t.Errorf("Unexpected fade out: %d halfway, %d at the end", samples[4320], samples[4799])
+		}
+	}
+
+	// A fade longer than the audio fades all of it
+	short := constantAudio(10000, 100)
+	if err := short.FadeOut(1, "linear"); err != nil {
+		t.Fatalf("Failed to fade out: %v", err)
+	}
+	if short.Data[0][0] != 9950 || short.Data[0][99] != 50 {
+		t.Errorf("Expected the whole audio to fade, got %d to %d", short.Data[0][0], short.Data[0][99])
+	}
+	if err := short.FadeIn(0.01, "exponential"); err == nil {
+		t.Errorf("Expected an error for an unknown curve")
+	}
+	if err := short.FadeIn(-1, "linear"); err == nil {
+		t.Errorf("Expected an error for a negative fade")
+	}
+}
+
+func TestOptionFade(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "test_output_fade.flac")
+	defer os.Remove(filename)
+	if err := EncodeFile(constantAudio(10000, 48000), filename, OptionFadeIn(0.5, "equal-power"), OptionFadeOut(0.1, "")); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	audio, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	samples := audio.Data[1]
+	if samples[0] > 20 || math.Abs(float64(samples[12000]-7071)) > 5 || samples[30000] != 10000 || samples[47999] > 10 {
+		t.Errorf("Unexpected fades: %d, %d, %d, %d", samples[0], samples[12000], samples[30000], samples[47999])
+	}
+	history := audio.History[len(audio.History)-1]
+	if !strings.Contains(history, "fade in 0.500 s (equal-power); fade out 0.100 s (linear)") {
+		t.Errorf("Expected the fades in the coding history, got %q", history)
+	}
+
+	// A second encode does not fade again
+	faded := constantAudio(10000, 48000)
+	if err := EncodeFile(faded, filename, OptionFadeIn(0.5, "linear")); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	if err := EncodeFile(faded, filename); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	if faded.Data[0][12000] != 5000 {
+		t.Errorf("Expected a single fade to 5000 a quarter second in, got %d", faded.Data[0][12000])
+	}
+
+	if err := EncodeFile(constantAudio(10000, 4800), filename, OptionFadeIn(0.5, "exponential")); err == nil {
+		t.Errorf("Expected an error for an unknown curve")
+	}
+}
+
+func TestCrossfade(t *testing.T) {
+	a := constantAudio(10000, 48000)
+	a.Markers = []Marker{{ID: 1, Position: 100, Label: "A"}}
+	a.Metadata.Title = "Joined"
+	b := constantAudio(-20000<<8, 24000)
+	b.BitDepth = 24
+	b.Markers = []Marker{{ID: 1, Position: 0, Label: "B"}, {ID: 2, Position: 12000, Label: "B2"}}
+
+	joined, err := Crossfade(a, b, 0.25, "linear")
+	if err != nil {
+		t.Fatalf("Failed to crossfade: %v", err)
+	}
+	if n := len(joined.Data[0]); n != 60000 || math.Abs(joined.Duration-1.25) > 1e-9 || joined.BitDepth != 16 {
+		t.Fatalf("Expected 60000 samples at 16 bits, got %d at %d bits", n, joined.BitDepth)
+	}
+	samples := joined.Data[0]
+	if samples[35999] != 10000 || math.Abs(float64(samples[42000]+5000)) > 1 || samples[48000] != -20000 || samples[59999] != -20000 {
+		t.Errorf("Unexpected crossfade: %d, %d, %d, %d", samples[35999], samples[42000], samples[48000], samples[59999])
+	}
+	expected := []Marker{{ID: 1, Position: 100, Label: "A"}, {ID: 2, Position: 36000, Label: "B"}, {ID: 3, Position: 48000, Label: "B2"}}
+	if len(joined.Markers) != len(expected) {
+		t.Fatalf("Expected markers %+v, got %+v", expected, joined.Markers)
+	}
+	for i := range expected {
+		if joined.Markers[i] != expected[i] {
+			t.Errorf("Expected marker %+v, got %+v", expected[i], joined.Markers[i])
+		}
+	}
+	if joined.Metadata.Title != "Joined" || b.BitDepth != 24 || b.Data[0][0] != -20000<<8 {
+		t.Errorf("Expected the tags of a and b to be left unchanged")
+	}
+
+	// Equal power keeps the level of uncorrelated audio, linear dips to 2/3 of the power
+	noise := func(seed int) *Audio {
+		audio := constantAudio(0, 48000)
+		for ch := range audio.Data {
+			for i := range audio.Data[ch] {
+				seed = (seed*1103515245 + 12345) & 0x7fffffff
+				audio.Data[ch][i] = seed%20001 - 10000
+			}
+		}
+		return audio
+	}
+	for curve, level := range map[string]float64{"equal-power": 0, "linear": -1.76} {
+		joined, err := Crossfade(noise(1), noise(2), 1, curve)
+		if err != nil {
+			t.Fatalf("Failed to crossfade: %v", err)
+		}
+		var before, during float64
+		for i, sample := range noise(1).Data[0] {
+			before += math.Pow(float64(sample), 2)
+			during += math.Pow(float64(joined.Data[0][i]), 2)
+		}
+		if ratio := 10 * math.Log10(during/before); math.Abs(ratio-level) > 0.2 {
+			t.Errorf("Expected a %s crossfade at %.2f dB, got %.2f dB", curve, level, ratio)
+		}
+	}
+
+	if _, err := Crossfade(a, b, 1, "linear"); err == nil {
+		t.Errorf("Expected an error for a crossfade longer than b")
+	}
+	b.SampleRate = 44100
+	if _, err := Crossfade(a, b, 0.1, "linear"); err == nil {
+		t.Errorf("Expected an error for different sample rates")
+	}
+}
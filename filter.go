@@ -0,0 +1,50 @@
+package audiomorph
+
+import (
+	"math"
+	"strings"
+
+	"github.com/schollz/audiomorph/filter"
+)
+
+// OptionEQ filters the audio when encoding, applying the filters in order before any sample
+// rate conversion, so a low pass can keep a lower rate free of aliasing
+func OptionEQ(filters ...filter.Filter) Option {
+	return func(a *Audio) {
+		a.filters = append([]filter.Filter(nil), filters...)
+	}
+}
+
+// Filter applies filters in order to every channel of the audio, clipping the result
+func (a *Audio) Filter(filters ...filter.Filter) error {
+	chain, err := filter.NewChain(a.SampleRate, filters...)
+	if err != nil {
+		return err
+	}
+
+	maxValue := fullScale(a.BitDepth) - 1
+	for _, samples := range a.Data {
+		// Every channel starts with a clear filter state
+		chain.Reset()
+		for i, sample := range samples {
+			y := chain.Process(float64(sample))
+			samples[i] = int(max(-maxValue-1, min(maxValue, math.Round(y))))
+		}
+	}
+	return nil
+}
+
+// filterAudio applies the filters configured on the audio, returning the coding history operation
+func filterAudio(audio *Audio) (string, error) {
+	if len(audio.filters) == 0 {
+		return "", nil
+	}
+	if err := audio.Filter(audio.filters...); err != nil {
+		return "", err
+	}
+	names := make([]string, len(audio.filters))
+	for i, f := range audio.filters {
+		names[i] = f.String()
+	}
+	return "eq " + strings.Join(names, " "), nil
+}
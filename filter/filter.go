@@ -0,0 +1,244 @@
+// Package filter designs RBJ cookbook biquads, and Butterworth and Linkwitz-Riley cascades of
+// them, and runs them over audio samples
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// butterworthQ is the Q of a second order Butterworth filter
+const butterworthQ = math.Sqrt2 / 2
+
+// Filter describes a filter: an RBJ cookbook biquad, or a Butterworth or Linkwitz-Riley cascade
+// of them for low and high passes of a higher order
+type Filter struct {
+	Type          string  // lowpass, highpass, bandpass, notch, peaking, lowshelf or highshelf
+	Frequency     float64 // Hz, the cutoff, center or shelf midpoint frequency
+	Gain          float64 // dB, for peaking and shelf filters
+	Q             float64 // 0.7071 if 0, ignored by low and high passes of another order than 2
+	Order         int     // of low and high passes, 2 if 0
+	LinkwitzRiley bool    // low and high passes are Linkwitz-Riley instead of Butterworth
+}
+
+// Biquad is a second order IIR filter in direct form I, with its coefficients divided by a0
+type Biquad struct {
+	B0, B1, B2, A1, A2 float64
+	x1, x2, y1, y2     float64
+}
+
+// Process filters one sample
+func (f *Biquad) Process(x float64) float64 {
+	y := f.B0*x + f.B1*f.x1 + f.B2*f.x2 - f.A1*f.y1 - f.A2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// rbjBiquad returns the RBJ Audio EQ Cookbook biquad of a filter type
+func rbjBiquad(filterType string, frequency, gain, q float64, sampleRate int) (Biquad, error) {
+	w0 := 2 * math.Pi * frequency / float64(sampleRate)
+	cos := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * q)
+	a := math.Pow(10, gain/40)
+	shelf := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch filterType {
+	case "lowpass":
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case "highpass":
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case "bandpass":
+		// Constant 0 dB peak gain
+		b0, b1, b2 = alpha, 0, -alpha
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case "notch":
+		b0, b1, b2 = 1, -2*cos, 1
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case "peaking":
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	case "lowshelf":
+		b0 = a * ((a + 1) - (a-1)*cos + shelf)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - shelf)
+		a0 = (a + 1) + (a-1)*cos + shelf
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - shelf
+	case "highshelf":
+		b0 = a * ((a + 1) + (a-1)*cos + shelf)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - shelf)
+		a0 = (a + 1) - (a-1)*cos + shelf
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - shelf
+	default:
+		return Biquad{}, fmt.Errorf("unsupported filter type: %s", filterType)
+	}
+	return Biquad{B0: b0 / a0, B1: b1 / a0, B2: b2 / a0, A1: a1 / a0, A2: a2 / a0}, nil
+}
+
+// firstOrder returns a first order low or high pass as a biquad, by the bilinear transform
+func firstOrder(highPass bool, frequency float64, sampleRate int) Biquad {
+	k := math.Tan(math.Pi * frequency / float64(sampleRate))
+	f := Biquad{B0: k / (1 + k), B1: k / (1 + k), A1: (k - 1) / (k + 1)}
+	if highPass {
+		f.B0, f.B1 = 1/(1+k), -1/(1+k)
+	}
+	return f
+}
+
+// butterworth returns the sections of a Butterworth low or high pass of an order: biquads with
+// the Q of each pole pair, and a first order section for an odd order
+func butterworth(filterType string, frequency float64, order, sampleRate int) []Biquad {
+	var sections []Biquad
+	for k := 0; k < order/2; k++ {
+		// The pole pairs lie at these angles from the real axis, an odd order also has a real pole
+		angle := math.Pi * float64(2*k+1) / float64(2*order)
+		if order%2 == 1 {
+			angle = math.Pi * float64(k+1) / float64(order)
+		}
+		q := 1 / (2 * math.Cos(angle))
+		section, _ := rbjBiquad(filterType, frequency, 0, q, sampleRate)
+		sections = append(sections, section)
+	}
+	if order%2 == 1 {
+		sections = append(sections, firstOrder(filterType == "highpass", frequency, sampleRate))
+	}
+	return sections
+}
+
+// sections returns the biquads that make up the filter at a sample rate
+func (f Filter) sections(sampleRate int) ([]Biquad, error) {
+	if f.Frequency <= 0 || f.Frequency >= float64(sampleRate)/2 {
+		return nil, fmt.Errorf("filter frequency %g Hz must be between 0 and %d Hz", f.Frequency, sampleRate/2)
+	}
+	q := f.Q
+	if q == 0 {
+		q = butterworthQ
+	}
+	if q < 0 {
+		return nil, fmt.Errorf("invalid filter Q %g", f.Q)
+	}
+	order := f.Order
+	if order == 0 {
+		order = 2
+	}
+
+	pass := f.Type == "lowpass" || f.Type == "highpass"
+	switch {
+	case (f.Order != 0 || f.LinkwitzRiley) && !pass:
+		return nil, fmt.Errorf("only lowpass and highpass filters have an order")
+	case order < 1 || order > 16:
+		return nil, fmt.Errorf("invalid filter order %d, must be from 1 to 16", order)
+	case f.LinkwitzRiley && order%2 != 0:
+		return nil, fmt.Errorf("invalid Linkwitz-Riley order %d, must be even", order)
+	case f.LinkwitzRiley:
+		// Two Butterworth filters of half the order
+		half := butterworth(f.Type, f.Frequency, order/2, sampleRate)
+		return append(half, half...), nil
+	case pass && order != 2:
+		return butterworth(f.Type, f.Frequency, order, sampleRate), nil
+	}
+	section, err := rbjBiquad(f.Type, f.Frequency, f.Gain, q, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return []Biquad{section}, nil
+}
+
+// String formats the filter as Parse reads it
+func (f Filter) String() string {
+	s := f.Type + ":" + strconv.FormatFloat(f.Frequency, 'f', -1, 64)
+	if f.Gain != 0 {
+		s += ",gain=" + strconv.FormatFloat(f.Gain, 'f', -1, 64)
+	}
+	if f.Q != 0 {
+		s += ",q=" + strconv.FormatFloat(f.Q, 'f', -1, 64)
+	}
+	if f.Order != 0 {
+		s += ",order=" + strconv.Itoa(f.Order)
+	}
+	if f.LinkwitzRiley {
+		s += ",lr"
+	}
+	return s
+}
+
+// Parse parses a filter as type:frequency followed by any of ,gain=dB ,q=Q ,order=N and
+// ,lr for Linkwitz-Riley, e.g. "peaking:1000,gain=-3,q=1.4" or "highpass:80,order=4,lr"
+func Parse(spec string) (Filter, error) {
+	fields := strings.Split(spec, ",")
+	filterType, frequency, ok := strings.Cut(fields[0], ":")
+	if !ok {
+		return Filter{}, fmt.Errorf("invalid filter %q, expected type:frequency", spec)
+	}
+	f := Filter{Type: strings.ToLower(strings.TrimSpace(filterType))}
+	var err error
+	if f.Frequency, err = strconv.ParseFloat(strings.TrimSpace(frequency), 64); err != nil {
+		return Filter{}, fmt.Errorf("invalid filter frequency %q", frequency)
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch strings.ToLower(key) {
+		case "gain":
+			f.Gain, err = strconv.ParseFloat(value, 64)
+		case "q":
+			f.Q, err = strconv.ParseFloat(value, 64)
+		case "order":
+			f.Order, err = strconv.Atoi(value)
+		case "lr":
+			f.LinkwitzRiley = true
+		default:
+			return Filter{}, fmt.Errorf("unknown filter setting %q", field)
+		}
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid filter setting %q", field)
+		}
+	}
+
+	// The settings are checked at a rate high enough for any frequency
+	if _, err := f.sections(int(max(f.Frequency*4, 48000))); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+// Chain runs filters in order over the samples of one channel
+type Chain struct {
+	sections []Biquad
+}
+
+// NewChain designs the filters at a sample rate
+func NewChain(sampleRate int, filters ...Filter) (*Chain, error) {
+	c := &Chain{}
+	for _, f := range filters {
+		s, err := f.sections(sampleRate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s filter: %w", f.Type, err)
+		}
+		c.sections = append(c.sections, s...)
+	}
+	return c, nil
+}
+
+// Process filters one sample
+func (c *Chain) Process(x float64) float64 {
+	for i := range c.sections {
+		x = c.sections[i].Process(x)
+	}
+	return x
+}
+
+// Reset clears the filter state, so the next sample starts a new signal
+func (c *Chain) Reset() {
+	for i := range c.sections {
+		f := &c.sections[i]
+		f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+	}
+}
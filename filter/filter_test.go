@@ -0,0 +1,122 @@
+package filter
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// filterResponse returns the gain in dB of a filter at a frequency
+func filterResponse(t *testing.T, f Filter, frequency float64) float64 {
+	sections, err := f.sections(48000)
+	if err != nil {
+		t.Fatalf("Failed to design %s: %v", f, err)
+	}
+	z := cmplx.Exp(complex(0, -2*math.Pi*frequency/48000))
+	h := complex(1, 0)
+	for _, s := range sections {
+		h *= (complex(s.B0, 0) + complex(s.B1, 0)*z + complex(s.B2, 0)*z*z) / (1 + complex(s.A1, 0)*z + complex(s.A2, 0)*z*z)
+	}
+	return 20 * math.Log10(cmplx.Abs(h))
+}
+
+func TestFilterResponse(t *testing.T) {
+	tests := []struct {
+		filter    Filter
+		frequency float64
+		expected  float64
+	}{
+		{Filter{Type: "lowpass", Frequency: 1000}, 1000, -3.01},
+		{Filter{Type: "lowpass", Frequency: 1000}, 100, 0},
+		{Filter{Type: "lowpass", Frequency: 1000}, 4000, -24.5},
+		{Filter{Type: "highpass", Frequency: 1000}, 1000, -3.01},
+		{Filter{Type: "highpass", Frequency: 1000}, 10000, 0},
+		{Filter{Type: "lowpass", Frequency: 1000, Order: 1}, 1000, -3.01},
+		{Filter{Type: "lowpass", Frequency: 1000, Order: 4}, 1000, -3.01},
+		{Filter{Type: "lowpass", Frequency: 1000, Order: 4}, 2000, -24.2},
+		{Filter{Type: "highpass", Frequency: 1000, Order: 5}, 1000, -3.01},
+		{Filter{Type: "highpass", Frequency: 1000, Order: 5}, 500, -30.1},
+		{Filter{Type: "lowpass", Frequency: 1000, Order: 4, LinkwitzRiley: true}, 1000, -6.02},
+		{Filter{Type: "highpass", Frequency: 1000, Order: 4, LinkwitzRiley: true}, 1000, -6.02},
+		{Filter{Type: "bandpass", Frequency: 1000, Q: 2}, 1000, 0},
+		{Filter{Type: "notch", Frequency: 1000, Q: 2}, 1000, -300},
+		{Filter{Type: "notch", Frequency: 1000, Q: 2}, 100, 0},
+		{Filter{Type: "peaking", Frequency: 1000, Gain: 6, Q: 1}, 1000, 6},
+		{Filter{Type: "peaking", Frequency: 1000, Gain: -6, Q: 1}, 1000, -6},
+		{Filter{Type: "lowshelf", Frequency: 200, Gain: 6}, 20, 6},
+		{Filter{Type: "lowshelf", Frequency: 200, Gain: 6}, 200, 3},
+		{Filter{Type: "highshelf", Frequency: 5000, Gain: -6}, 20000, -6},
+		{Filter{Type: "highshelf", Frequency: 5000, Gain: -6}, 100, 0},
+	}
+	for _, tt := range tests {
+		gain := filterResponse(t, tt.filter, tt.frequency)
+		if tt.expected < -200 {
+			if gain > -60 {
+				t.Errorf("Expected %s to remove %g Hz, got %.2f dB", tt.filter, tt.frequency, gain)
+			}
+		} else if math.Abs(gain-tt.expected) > 0.2 {
+			t.Errorf("Expected %s at %g Hz to be %.2f dB, got %.2f dB", tt.filter, tt.frequency, tt.expected, gain)
+		}
+	}
+
+	// Linkwitz-Riley low and high passes sum flat
+	low, _ := Filter{Type: "lowpass", Frequency: 1000, Order: 4, LinkwitzRiley: true}.sections(48000)
+	high, _ := Filter{Type: "highpass", Frequency: 1000, Order: 4, LinkwitzRiley: true}.sections(48000)
+	for _, frequency := range []float64{100, 700, 1000, 1500, 8000} {
+		z := cmplx.Exp(complex(0, -2*math.Pi*frequency/48000))
+		sum := complex(0, 0)
+		for _, sections := range [][]Biquad{low, high} {
+			h := complex(1, 0)
+			for _, s := range sections {
+				h *= (complex(s.B0, 0) + complex(s.B1, 0)*z + complex(s.B2, 0)*z*z) / (1 + complex(s.A1, 0)*z + complex(s.A2, 0)*z*z)
+			}
+			sum += h
+		}
+		if gain := 20 * math.Log10(cmplx.Abs(sum)); math.Abs(gain) > 0.01 {
+			t.Errorf("Expected the Linkwitz-Riley crossover to sum flat at %g Hz, got %.3f dB", frequency, gain)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, spec := range []string{"peaking:1000,gain=-3,q=1.4", "highpass:80,order=4,lr", "lowpass:3400", "highshelf:8000,gain=2.5"} {
+		f, err := Parse(spec)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", spec, err)
+		} else if f.String() != spec {
+			t.Errorf("Expected %q to format as itself, got %q", spec, f.String())
+		}
+	}
+	if f, err := Parse("LowPass: 500"); err != nil || f.Type != "lowpass" || f.Frequency != 500 {
+		t.Errorf("Expected a 500 Hz lowpass, got %+v, %v", f, err)
+	}
+	for _, spec := range []string{"peak:1000", "lowpass", "lowpass:x", "lowpass:100,slope=2", "notch:100,order=4", "lowpass:100,order=3,lr", "lowpass:100,q=-1", "lowpass:0"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	// A low pass passes a constant signal, and starts again from rest after a reset
+	chain, err := NewChain(48000, Filter{Type: "lowpass", Frequency: 1000}, Filter{Type: "lowshelf", Frequency: 200, Gain: -6})
+	if err != nil {
+		t.Fatalf("Failed to design the filters: %v", err)
+	}
+	first := chain.Process(1)
+	var y float64
+	for i := 0; i < 48000; i++ {
+		y = chain.Process(1)
+	}
+	if math.Abs(y-0.5) > 0.01 {
+		t.Errorf("Expected the chain to settle at half the input, got %.4f", y)
+	}
+	chain.Reset()
+	if y := chain.Process(1); y != first {
+		t.Errorf("Expected %.6f after a reset, got %.6f", first, y)
+	}
+
+	if _, err := NewChain(8000, Filter{Type: "lowpass", Frequency: 5000}); err == nil {
+		t.Errorf("Expected an error for a cutoff above the Nyquist frequency")
+	}
+}
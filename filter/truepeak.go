@@ -0,0 +1,38 @@
+package filter
+
+import "math"
+
+// True peak interpolator constants
+const (
+	TruePeakOversampling = 4  // samples interpolated for each sample
+	TruePeakTaps         = 12 // per phase of the interpolator
+)
+
+// TruePeakPhases returns the phases of the windowed sinc filter that interpolates the samples
+// between each pair of samples for the ITU-R BS.1770 true peak measurement
+func TruePeakPhases() [TruePeakOversampling][TruePeakTaps]float64 {
+	var phases [TruePeakOversampling][TruePeakTaps]float64
+	length := TruePeakOversampling * TruePeakTaps
+	center := float64(length-1) / 2
+	for n := 0; n < length; n++ {
+		x := (float64(n) - center) / TruePeakOversampling
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(n)+0.5)/float64(length))
+		phases[n%TruePeakOversampling][n/TruePeakOversampling] = sinc * window
+	}
+
+	// Each phase passes DC unchanged
+	for p := range phases {
+		var sum float64
+		for _, tap := range phases[p] {
+			sum += tap
+		}
+		for i := range phases[p] {
+			phases[p][i] /= sum
+		}
+	}
+	return phases
+}
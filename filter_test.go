@@ -0,0 +1,61 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schollz/audiomorph/filter"
+)
+
+func TestOptionEQ(t *testing.T) {
+	// A 100 Hz and a 5 kHz tone, of which a high pass keeps the 5 kHz tone
+	low, high := sineAudio(1, 100, 0, -12, 1).Data[0], sineAudio(1, 5000, 0, -12, 1).Data[0]
+	data := make([]int, len(low))
+	for i := range data {
+		data[i] = low[i] + high[i]
+	}
+	audio := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{data}}
+	filename := filepath.Join(os.TempDir(), "test_output_eq.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionEQ(filter.Filter{Type: "highpass", Frequency: 1000, Order: 8})); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	// The filter shifts the phase of the 5 kHz tone, so it is compared by level. Had the 100 Hz
+	// tone passed, the level would be 3 dB higher.
+	var sum, outSum float64
+	for i := 4800; i < len(high); i++ {
+		sum += math.Pow(float64(high[i]), 2)
+		outSum += math.Pow(float64(decoded.Data[0][i]), 2)
+	}
+	if ratio := 10 * math.Log10(outSum/sum); math.Abs(ratio) > 0.1 {
+		t.Errorf("Expected the 5 kHz tone at its level, got %.2f dB", ratio)
+	}
+	if history := decoded.History[len(decoded.History)-1]; !strings.Contains(history, "eq highpass:1000,order=8") {
+		t.Errorf("Expected the filter in the coding history, got %q", history)
+	}
+
+	// A second encode does not filter again
+	rows := len(audio.History)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if len(audio.History) != rows {
+		t.Errorf("Expected no filtering by a second encode, got history %q", audio.History[rows:])
+	}
+
+	// A later OptionEQ replaces the filters of an earlier one
+	if err := EncodeFile(audio, filename, OptionEQ(filter.Filter{Type: "lowpass", Frequency: 30000}), OptionEQ(filter.Filter{Type: "highpass", Frequency: 1000})); err != nil {
+		t.Errorf("Expected the invalid filter to be replaced, got %v", err)
+	}
+
+	if err := EncodeFile(audio, filename, OptionEQ(filter.Filter{Type: "lowpass", Frequency: 30000})); err == nil {
+		t.Errorf("Expected an error for a cutoff above the Nyquist frequency")
+	}
+}
@@ -0,0 +1,98 @@
+package audiomorph
+
+// G.711 companding as implemented by the CCITT reference code (Sun Microsystems g711.c).
+// Both laws expand to 16-bit linear samples.
+
+const (
+	ulawBias = 0x84
+	ulawClip = 8159
+)
+
+var (
+	ulawSegmentEnds = [8]int{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+	alawSegmentEnds = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+)
+
+// g711Segment returns the index of the first segment end that is >= value, or 8 if there is none
+func g711Segment(value int, segmentEnds [8]int) int {
+	for i, end := range segmentEnds {
+		if value <= end {
+			return i
+		}
+	}
+	return 8
+}
+
+// linearToULaw compresses a 16-bit linear sample to an 8-bit mu-law code
+func linearToULaw(sample int) byte {
+	pcm := sample >> 2
+	mask := 0xFF
+	if pcm < 0 {
+		pcm = -pcm
+		mask = 0x7F
+	}
+	if pcm > ulawClip {
+		pcm = ulawClip
+	}
+	pcm += ulawBias >> 2
+
+	seg := g711Segment(pcm, ulawSegmentEnds)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	code := seg<<4 | (pcm>>uint(seg+1))&0x0F
+	return byte(code ^ mask)
+}
+
+// uLawToLinear expands an 8-bit mu-law code to a 16-bit linear sample
+func uLawToLinear(code byte) int {
+	u := int(^code)
+	t := (u&0x0F)<<3 + ulawBias
+	t <<= uint(u&0x70) >> 4
+	if u&0x80 != 0 {
+		return ulawBias - t
+	}
+	return t - ulawBias
+}
+
+// linearToALaw compresses a 16-bit linear sample to an 8-bit A-law code
+func linearToALaw(sample int) byte {
+	pcm := sample >> 3
+	mask := 0xD5
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	seg := g711Segment(pcm, alawSegmentEnds)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	code := seg << 4
+	if seg < 2 {
+		code |= (pcm >> 1) & 0x0F
+	} else {
+		code |= (pcm >> uint(seg)) & 0x0F
+	}
+	return byte(code ^ mask)
+}
+
+// aLawToLinear expands an 8-bit A-law code to a 16-bit linear sample
+func aLawToLinear(code byte) int {
+	a := int(code ^ 0x55)
+	t := (a & 0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= uint(seg - 1)
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
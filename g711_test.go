@@ -0,0 +1,151 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Reference vectors produced by the CCITT/Sun g711.c reference implementation
+var (
+	g711Linear   = []int{0, 1, -1, 8, -8, 100, -100, 1000, -1000, 5000, -5000, 12345, -12345, 32767, -32768, 32124, -32124}
+	g711ULawCode = []byte{0xff, 0xff, 0x7e, 0xfe, 0x7e, 0xf2, 0x72, 0xce, 0x4e, 0xab, 0x2b, 0x97, 0x17, 0x80, 0x00, 0x80, 0x00}
+	g711ALawCode = []byte{0xd5, 0xd5, 0x55, 0xd5, 0x55, 0xd3, 0x53, 0xfa, 0x7a, 0x86, 0x06, 0xbd, 0x3d, 0xaa, 0x2a, 0xaa, 0x2a}
+
+	g711Codes        = []byte{0x00, 0x0f, 0x3c, 0x7f, 0x80, 0x8f, 0xbc, 0xff, 0x55, 0xd5, 0x2a, 0xaa}
+	g711ULawExpanded = []int{-32124, -16764, -2364, 0, 32124, 16764, 2364, 0, -716, 716, -5372, 5372}
+	g711ALawExpanded = []int{-5504, -6784, -13056, -848, 5504, 6784, 13056, 848, -8, 8, -32256, 32256}
+)
+
+func TestG711ReferenceVectors(t *testing.T) {
+	for i, sample := range g711Linear {
+		if code := linearToULaw(sample); code != g711ULawCode[i] {
+			t.Errorf("mu-law compress %d: expected %#02x, got %#02x", sample, g711ULawCode[i], code)
+		}
+		if code := linearToALaw(sample); code != g711ALawCode[i] {
+			t.Errorf("A-law compress %d: expected %#02x, got %#02x", sample, g711ALawCode[i], code)
+		}
+	}
+
+	for i, code := range g711Codes {
+		if sample := uLawToLinear(code); sample != g711ULawExpanded[i] {
+			t.Errorf("mu-law expand %#02x: expected %d, got %d", code, g711ULawExpanded[i], sample)
+		}
+		if sample := aLawToLinear(code); sample != g711ALawExpanded[i] {
+			t.Errorf("A-law expand %#02x: expected %d, got %d", code, g711ALawExpanded[i], sample)
+		}
+	}
+
+	// Every code must survive an expand/compress round trip
+	for code := 0; code < 256; code++ {
+		if got := linearToULaw(uLawToLinear(byte(code))); got != byte(code) && uLawToLinear(got) != uLawToLinear(byte(code)) {
+			t.Errorf("mu-law code %#02x round tripped to %#02x", code, got)
+		}
+		if got := linearToALaw(aLawToLinear(byte(code))); got != byte(code) {
+			t.Errorf("A-law code %#02x round tripped to %#02x", code, got)
+		}
+	}
+}
+
+func TestEncodeWAVG711(t *testing.T) {
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+
+	for _, codec := range []string{"ulaw", "alaw"} {
+		t.Run(codec, func(t *testing.T) {
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_output_"+codec+".wav")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, OptionWAVCodec(codec))
+			if err != nil {
+				t.Fatalf("Failed to encode %s WAV file: %v", codec, err)
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s WAV file: %v", codec, err)
+			}
+
+			if decodedAudio.NumChannels != audio.NumChannels {
+				t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+			}
+			if decodedAudio.SampleRate != audio.SampleRate {
+				t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+			}
+			if decodedAudio.BitDepth != 16 {
+				t.Errorf("BitDepth mismatch: expected 16, got %d", decodedAudio.BitDepth)
+			}
+
+			// The decoded samples must be exactly the companded source samples
+			compress, expand := linearToULaw, uLawToLinear
+			if codec == "alaw" {
+				compress, expand = linearToALaw, aLawToLinear
+			}
+			for ch := 0; ch < audio.NumChannels; ch++ {
+				if len(decodedAudio.Data[ch]) != len(audio.Data[ch]) {
+					t.Fatalf("Sample count mismatch: expected %d, got %d", len(audio.Data[ch]), len(decodedAudio.Data[ch]))
+				}
+				for i, sample := range audio.Data[ch] {
+					if expected := expand(compress(sample)); decodedAudio.Data[ch][i] != expected {
+						t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, expected, decodedAudio.Data[ch][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWAVFloat(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode source file: %v", err)
+	}
+
+	dstFilename := filepath.Join(os.TempDir(), "test_output_float.wav")
+	defer os.Remove(dstFilename)
+
+	if err := EncodeFile(audio, dstFilename, OptionWAVCodec("float")); err != nil {
+		t.Fatalf("Failed to encode float WAV file: %v", err)
+	}
+
+	decodedAudio, err := DecodeFile(dstFilename)
+	if err != nil {
+		t.Fatalf("Failed to decode float WAV file: %v", err)
+	}
+	if decodedAudio.BitDepth != 32 {
+		t.Errorf("BitDepth mismatch: expected 32, got %d", decodedAudio.BitDepth)
+	}
+
+	// 16-bit samples are exactly representable as floats
+	for ch := 0; ch < audio.NumChannels; ch++ {
+		for i, sample := range audio.Data[ch] {
+			if decodedAudio.Data[ch][i] != sample<<16 {
+				t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, sample<<16, decodedAudio.Data[ch][i])
+			}
+		}
+	}
+}
+
+func TestInvalidWAVCodec(t *testing.T) {
+	audio := &Audio{
+		NumChannels: 1,
+		SampleRate:  8000,
+		BitDepth:    16,
+		Data:        [][]int{{0, 100, 200, 300, 400}},
+		Duration:    0.000625,
+	}
+
+	dstFilename := filepath.Join(os.TempDir(), "test_output_invalid_codec.wav")
+	defer os.Remove(dstFilename)
+
+	err := EncodeFile(audio, dstFilename, OptionWAVCodec("mp3"))
+	if err == nil {
+		t.Fatal("Expected error for invalid WAV codec, got nil")
+	}
+
+	t.Logf("Invalid WAV codec correctly returns error: %v", err)
+}
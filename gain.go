@@ -0,0 +1,165 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// OptionGain changes the level of the audio by a gain in dB when encoding, clipping samples
+// beyond full scale
+func OptionGain(gain float64) Option {
+	return func(a *Audio) {
+		a.gain = &gain
+	}
+}
+
+// OptionPan pans mono audio into stereo, or balances stereo audio, at a position from -1 (left)
+// to 1 (right) when encoding
+func OptionPan(position float64) Option {
+	return func(a *Audio) {
+		a.pan = &position
+	}
+}
+
+// OptionInvertPolarity inverts the polarity of channels when encoding, every channel if none
+// are given
+func OptionInvertPolarity(channels ...int) Option {
+	return func(a *Audio) {
+		a.invertPolarity = append([]int{}, channels...)
+	}
+}
+
+// OptionSwapChannels swaps two channels when encoding, e.g. 0 and 1 for left and right
+func OptionSwapChannels(first, second int) Option {
+	return func(a *Audio) {
+		a.swapChannels = []int{first, second}
+	}
+}
+
+// Gain changes the level of the audio by a gain in dB, returning the number of samples clipped
+// at full scale
+func (a *Audio) Gain(gain float64) int {
+	return applyGain(a, gain)
+}
+
+// Pan pans mono audio into stereo, or balances stereo audio, at a position from -1 (left) to 1
+// (right). Mono audio is panned with constant power, 3 dB down on both channels in the center.
+// Stereo audio keeps its level in the center and lowers the far channel with the same law.
+func (a *Audio) Pan(position float64) error {
+	if position < -1 || position > 1 || math.IsNaN(position) {
+		return fmt.Errorf("invalid pan position %g, must be from -1 to 1", position)
+	}
+	angle := (position + 1) * math.Pi / 4
+	left, right := math.Cos(angle), math.Sin(angle)
+
+	switch len(a.Data) {
+	case 1:
+		a.Data = [][]int{a.Data[0], append([]int(nil), a.Data[0]...)}
+		a.NumChannels = 2
+	case 2:
+		left, right = min(1, left*math.Sqrt2), min(1, right*math.Sqrt2)
+	default:
+		return fmt.Errorf("cannot pan %d channels, only mono or stereo", len(a.Data))
+	}
+	for i := range a.Data[0] {
+		a.Data[0][i] = int(math.Round(float64(a.Data[0][i]) * left))
+		a.Data[1][i] = int(math.Round(float64(a.Data[1][i]) * right))
+	}
+	return nil
+}
+
+// InvertPolarity inverts the polarity of channels, every channel if none are given
+func (a *Audio) InvertPolarity(channels ...int) error {
+	if len(channels) == 0 {
+		for ch := range a.Data {
+			channels = append(channels, ch)
+		}
+	}
+	maxValue := int(fullScale(a.BitDepth)) - 1
+	for _, ch := range channels {
+		if ch < 0 || ch >= len(a.Data) {
+			return fmt.Errorf("channel %d does not exist, the audio has %d", ch, len(a.Data))
+		}
+	}
+	for _, ch := range channels {
+		for i, sample := range a.Data[ch] {
+			// The most negative sample has no positive counterpart
+			a.Data[ch][i] = min(-sample, maxValue)
+		}
+	}
+	return nil
+}
+
+// SwapChannels swaps two channels, e.g. 0 and 1 for left and right
+func (a *Audio) SwapChannels(first, second int) error {
+	for _, ch := range []int{first, second} {
+		if ch < 0 || ch >= len(a.Data) {
+			return fmt.Errorf("channel %d does not exist, the audio has %d", ch, len(a.Data))
+		}
+	}
+	a.Data[first], a.Data[second] = a.Data[second], a.Data[first]
+	return nil
+}
+
+// Clipped returns the number of samples clipped by the gain of the last encode
+func (a *Audio) Clipped() int {
+	return a.clipped
+}
+
+// applyGain scales the samples by a gain in dB, clipping them to the range of the bit depth,
+// and returns the number of samples clipped
+func applyGain(audio *Audio, gain float64) int {
+	factor := math.Pow(10, gain/20)
+	maxValue := fullScale(audio.BitDepth) - 1
+	clipped := 0
+	for _, samples := range audio.Data {
+		for i, sample := range samples {
+			value := math.Round(float64(sample) * factor)
+			if value > maxValue || value < -maxValue-1 {
+				clipped++
+			}
+			samples[i] = int(max(-maxValue-1, min(maxValue, value)))
+		}
+	}
+	return clipped
+}
+
+// adjustChannels applies the channel swap, polarity inversion, pan and gain configured on the
+// audio, returning the coding history operations
+func adjustChannels(audio *Audio) ([]string, error) {
+	swap, invert, pan, gain := audio.swapChannels, audio.invertPolarity, audio.pan, audio.gain
+	audio.clipped = 0
+
+	var operations []string
+	if swap != nil {
+		if err := audio.SwapChannels(swap[0], swap[1]); err != nil {
+			return nil, fmt.Errorf("failed to swap channels: %w", err)
+		}
+		operations = append(operations, fmt.Sprintf("swap channels %d and %d", swap[0], swap[1]))
+	}
+	if invert != nil {
+		if err := audio.InvertPolarity(invert...); err != nil {
+			return nil, fmt.Errorf("failed to invert polarity: %w", err)
+		}
+		operation := "invert polarity"
+		if len(invert) > 0 {
+			operation += " of channels " + strings.Trim(fmt.Sprint(invert), "[]")
+		}
+		operations = append(operations, operation)
+	}
+	if pan != nil {
+		if err := audio.Pan(*pan); err != nil {
+			return nil, fmt.Errorf("failed to pan: %w", err)
+		}
+		operations = append(operations, fmt.Sprintf("pan %+.2f", *pan))
+	}
+	if gain != nil {
+		operation := fmt.Sprintf("gain %+.2f dB", *gain)
+		if audio.clipped = audio.Gain(*gain); audio.clipped > 0 {
+			operation += fmt.Sprintf(" (%d samples clipped)", audio.clipped)
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
@@ -0,0 +1,121 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGain(t *testing.T) {
+	audio := constantAudio(10000, 100)
+	audio.Data[1][0] = -20000
+	if clipped := audio.Gain(-6.0206); clipped != 0 || audio.Data[0][0] != 5000 || audio.Data[1][0] != -10000 {
+		t.Errorf("Expected half the level without clipping, got %d and %d with %d clipped", audio.Data[0][0], audio.Data[1][0], clipped)
+	}
+	if clipped := audio.Gain(12.0412); clipped != 1 || audio.Data[1][0] != -32768 || audio.Data[0][0] != 20000 {
+		t.Errorf("Expected one sample to clip at -32768, got %d with %d clipped", audio.Data[1][0], clipped)
+	}
+}
+
+func TestPan(t *testing.T) {
+	// Mono is panned with constant power
+	mono := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{{10000, -10000}}}
+	if err := mono.Pan(0); err != nil {
+		t.Fatalf("Failed to pan: %v", err)
+	}
+	if mono.NumChannels != 2 || mono.Data[0][0] != 7071 || mono.Data[1][1] != -7071 {
+		t.Errorf("Expected both channels 3 dB down, got %+v", mono.Data)
+	}
+	mono = &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{{10000}}}
+	if err := mono.Pan(-1); err != nil {
+		t.Fatalf("Failed to pan: %v", err)
+	}
+	if mono.Data[0][0] != 10000 || mono.Data[1][0] != 0 {
+		t.Errorf("Expected a hard left pan, got %+v", mono.Data)
+	}
+
+	// Stereo keeps its level in the center and lowers the far channel
+	stereo := constantAudio(10000, 10)
+	if err := stereo.Pan(0); err != nil || stereo.Data[0][0] != 10000 || stereo.Data[1][0] != 10000 {
+		t.Errorf("Expected a centered balance to keep the level, got %d and %d", stereo.Data[0][0], stereo.Data[1][0])
+	}
+	if err := stereo.Pan(0.5); err != nil || stereo.Data[0][0] != 5412 || stereo.Data[1][0] != 10000 {
+		t.Errorf("Expected the left channel lowered to 5412, got %d and %d", stereo.Data[0][0], stereo.Data[1][0])
+	}
+
+	if err := stereo.Pan(1.5); err == nil {
+		t.Errorf("Expected an error for a position beyond 1")
+	}
+	surround := &Audio{NumChannels: 3, Data: [][]int{{0}, {0}, {0}}}
+	if err := surround.Pan(0); err == nil {
+		t.Errorf("Expected an error for 3 channels")
+	}
+}
+
+func TestInvertPolarityAndSwap(t *testing.T) {
+	audio := constantAudio(1000, 3)
+	audio.Data[1] = []int{-32768, 5, 0}
+	if err := audio.InvertPolarity(1); err != nil {
+		t.Fatalf("Failed to invert polarity: %v", err)
+	}
+	if audio.Data[0][0] != 1000 || audio.Data[1][0] != 32767 || audio.Data[1][1] != -5 {
+		t.Errorf("Expected only channel 1 inverted, got %+v", audio.Data)
+	}
+	if err := audio.InvertPolarity(); err != nil || audio.Data[0][0] != -1000 || audio.Data[1][1] != 5 {
+		t.Errorf("Expected every channel inverted, got %+v", audio.Data)
+	}
+	if err := audio.SwapChannels(0, 1); err != nil || audio.Data[0][1] != 5 || audio.Data[1][1] != -1000 {
+		t.Errorf("Expected the channels swapped, got %+v", audio.Data)
+	}
+	if err := audio.InvertPolarity(2); err == nil {
+		t.Errorf("Expected an error for a missing channel")
+	}
+	if err := audio.SwapChannels(0, 2); err == nil {
+		t.Errorf("Expected an error for a missing channel")
+	}
+}
+
+func TestChannelOptions(t *testing.T) {
+	audio := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{make([]int, 4800)}}
+	for i := range audio.Data[0] {
+		audio.Data[0][i] = 20000
+	}
+	filename := filepath.Join(os.TempDir(), "test_output_gain.wav")
+	defer os.Remove(filename)
+	options := []Option{OptionPan(1), OptionSwapChannels(0, 0), OptionInvertPolarity(), OptionGain(6.0206)}
+	if err := EncodeFile(audio, filename, options...); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+
+	// The mono audio is inverted, panned right and clipped
+	if decoded.NumChannels != 2 || decoded.Data[0][0] != 0 || decoded.Data[1][0] != -32768 {
+		t.Errorf("Expected silence on the left and -32768 on the right, got %d and %d", decoded.Data[0][0], decoded.Data[1][0])
+	}
+	history := decoded.History[len(decoded.History)-1]
+	expected := "swap channels 0 and 0; invert polarity; pan +1.00; gain +6.02 dB (4800 samples clipped)"
+	if !strings.Contains(history, expected) {
+		t.Errorf("Expected %q in the coding history, got %q", expected, history)
+	}
+
+	if audio.Clipped() != 4800 {
+		t.Errorf("Expected 4800 samples clipped by the encode, got %d", audio.Clipped())
+	}
+
+	// A second encode does not repeat the adjustments
+	rows := len(audio.History)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if audio.NumChannels != 2 || audio.Data[1][0] != -32768 || audio.Clipped() != 0 || len(audio.History) != rows {
+		t.Errorf("Unexpected second encode: %d channels, %d on the right, %d clipped, history %q", audio.NumChannels, audio.Data[1][0], audio.Clipped(), audio.History)
+	}
+
+	if err := EncodeFile(audio, filename, OptionSwapChannels(0, 3)); err == nil {
+		t.Errorf("Expected an error for a missing channel")
+	}
+}
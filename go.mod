@@ -9,6 +9,7 @@ require (
 	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.1.0
 	github.com/mewkiz/flac v1.0.13
+	github.com/pion/opus v0.0.0-20260504155822-67f6be33ea99
 	github.com/schollz/goflac v0.1.0
 	github.com/schollz/interpolation v1.0.0
 )
@@ -0,0 +1,226 @@
+package audiomorph
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// historyTag is the tag that holds the coding history in formats without a bext chunk
+const historyTag = "CODING_HISTORY"
+
+// wavCodings names the WAV format tags in coding history rows
+var wavCodings = map[uint16]string{
+	wavFormatPCM:       "PCM",
+	wavFormatIEEEFloat: "FLOAT",
+	wavFormatULaw:      "ULAW",
+	wavFormatALaw:      "ALAW",
+	wavFormatIMAADPCM:  "IMA-ADPCM",
+	wavFormatMSADPCM:   "MS-ADPCM",
+}
+
+// historyRow formats a coding history row as in EBU R 98, e.g. "A=PCM,F=48000,W=24,M=stereo,T=text"
+func historyRow(coding string, sampleRate, bitDepth, channels int, text string) string {
+	mode := strconv.Itoa(channels) + "-channel"
+	switch channels {
+	case 1:
+		mode = "mono"
+	case 2:
+		mode = "stereo"
+	}
+	row := fmt.Sprintf("A=%s,F=%d,W=%d,M=%s", coding, sampleRate, bitDepth, mode)
+	if text != "" {
+		row += ",T=" + text
+	}
+	return row
+}
+
+// parseHistory splits a coding history into its rows
+func parseHistory(history string) []string {
+	var rows []string
+	for _, line := range strings.Split(strings.ReplaceAll(history, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return rows
+}
+
+// formatHistory joins coding history rows into CR/LF terminated lines, as bext chunks store them
+func formatHistory(rows []string) string {
+	var b strings.Builder
+	for _, row := range rows {
+		b.WriteString(row + "\r\n")
+	}
+	return b.String()
+}
+
+// readHistory fills the coding history of decoded audio from its bext chunk or tag, removing
+// the tag. A file without a history starts one with a row describing the file itself.
+func readHistory(audio *Audio, filename string) {
+	if audio.Broadcast != nil {
+		audio.History = parseHistory(audio.Broadcast.CodingHistory)
+	}
+	if len(audio.History) == 0 {
+		audio.History = parseHistory(audio.Metadata.Get(historyTag))
+	}
+	audio.Metadata.Set(historyTag, "")
+	if len(audio.History) == 0 {
+		coding := audio.coding
+		if coding == "" {
+			coding = fileCoding(strings.ToLower(filepath.Ext(filename)), audio.SampleRate)
+		}
+		audio.History = []string{historyRow(coding, audio.SampleRate, audio.BitDepth, audio.NumChannels, filepath.Base(filename))}
+	}
+}
+
+// fileCoding names the coding of a file format, for formats with a single coding
+func fileCoding(ext string, sampleRate int) string {
+	switch ext {
+	case ".mp3":
+		switch {
+		case sampleRate >= 32000:
+			return "MPEG1L3"
+		case sampleRate >= 16000:
+			return "MPEG2L3"
+		}
+		return "MPEG25L3"
+	case ".flac":
+		return "FLAC"
+	case ".ogg", ".oga":
+		return "VORBIS"
+	case ".opus":
+		return "OPUS"
+	case ".wv":
+		return "WAVPACK"
+	}
+	return "PCM"
+}
+
+// encodeCoding names the coding an encoder writes with the configured codec
+func encodeCoding(audio *Audio, ext string) string {
+	switch ext {
+	case ".wav", ".w64":
+		if tag, err := wavCodecTag(audio); err == nil {
+			return wavCodings[tag]
+		}
+	case ".aif", ".aiff", ".aifc":
+		switch compression, _ := aifcCompression(audio); compression {
+		case "fl32":
+			return "FLOAT"
+		case "ulaw", "alaw":
+			return strings.ToUpper(compression)
+		}
+	case ".au", ".snd":
+		if encoding, err := auEncodingName(audio); err == nil && encoding != "pcm" {
+			return strings.ToUpper(encoding)
+		}
+	case ".wv":
+		if mode, _ := wavpackModeName(audio); mode == "hybrid" {
+			return "WAVPACK-HYBRID"
+		}
+	}
+	return fileCoding(ext, audio.SampleRate)
+}
+
+// encodeWordLength returns the bits per sample an encoder writes with the configured codec, which
+// differs from the bit depth of the audio for float, G.711 and ADPCM codecs
+func encodeWordLength(audio *Audio, ext string) int {
+	switch ext {
+	case ".wav", ".w64":
+		switch tag, _ := wavCodecTag(audio); tag {
+		case wavFormatIEEEFloat:
+			return 32
+		case wavFormatULaw, wavFormatALaw:
+			return 8
+		case wavFormatIMAADPCM, wavFormatMSADPCM:
+			return 4
+		}
+	case ".aif", ".aiff", ".aifc":
+		switch compression, _ := aifcCompression(audio); compression {
+		case "fl32":
+			return 32
+		case "ulaw", "alaw":
+			return 8
+		}
+	case ".au", ".snd":
+		switch encoding, _ := auEncodingName(audio); encoding {
+		case "float":
+			return 32
+		case "ulaw", "alaw":
+			return 8
+		}
+	case ".wv":
+		if mode, _ := wavpackModeName(audio); mode == "float" {
+			return 32
+		}
+	case ".raw", ".pcm":
+		if spec, err := rawOutputSpec(audio); err == nil {
+			return spec.bits
+		}
+	}
+	return audio.BitDepth
+}
+
+// encodeHistoryRow returns the coding history row of an encode, or "" if it performed no
+// operations and kept the coding, rate and word length of audio with a history
+func encodeHistoryRow(audio *Audio, ext string, operations []string) string {
+	coding := encodeCoding(audio, ext)
+	wordLength := encodeWordLength(audio, ext)
+	if len(operations) == 0 {
+		if len(audio.History) == 0 {
+			return ""
+		}
+		unchanged := fmt.Sprintf("A=%s,F=%d,W=%d,", coding, audio.SampleRate, wordLength)
+		if strings.HasPrefix(audio.History[len(audio.History)-1], unchanged) {
+			return ""
+		}
+	}
+
+	channels := audio.NumChannels
+	if len(audio.useChannels) > 0 {
+		channels = len(audio.useChannels)
+	}
+	text := "audiomorph"
+	if len(operations) > 0 {
+		text += ": " + strings.Join(operations, "; ")
+	}
+	return historyRow(coding, audio.SampleRate, wordLength, channels, text)
+}
+
+// withHistoryRow returns a copy of the audio with a row added to its coding history, and to a
+// bext chunk that has its own coding history
+func withHistoryRow(audio *Audio, row string) *Audio {
+	written := *audio
+	if row == "" {
+		return &written
+	}
+	written.History = append(append([]string(nil), audio.History...), row)
+	if audio.Broadcast != nil && audio.Broadcast.CodingHistory != "" {
+		bext := *audio.Broadcast
+		bext.CodingHistory = formatHistory(append(parseHistory(bext.CodingHistory), row))
+		written.Broadcast = &bext
+	}
+	return &written
+}
+
+// withHistoryTag sets the coding history tag of formats that keep the history in their tags
+func withHistoryTag(m Metadata, history []string, ext string) Metadata {
+	if len(history) == 0 {
+		return m
+	}
+	if m.Extra != nil {
+		extra := make(map[string]string, len(m.Extra)+1)
+		for key, value := range m.Extra {
+			extra[key] = value
+		}
+		m.Extra = extra
+	}
+	if ext == ".wav" || ext == ".w64" {
+		m.Set(historyTag, "") // kept in the bext chunk
+	} else {
+		m.Set(historyTag, strings.Join(history, "\n"))
+	}
+	return m
+}
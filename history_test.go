@@ -0,0 +1,155 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.mp3"))
+	if err != nil {
+		t.Fatalf("Failed to decode MP3 file: %v", err)
+	}
+	expected := []string{"A=MPEG1L3,F=44100,W=16,M=stereo,T=wilhelm.mp3"}
+	if !reflect.DeepEqual(audio.History, expected) {
+		t.Fatalf("Expected history %q, got %q", expected, audio.History)
+	}
+
+	flacFile := filepath.Join(os.TempDir(), "test_output_history.flac")
+	defer os.Remove(flacFile)
+	if err := EncodeFile(audio, flacFile, OptionSampleRate(48000), OptionBitDepth(24)); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	expected = append(expected, "A=FLAC,F=48000,W=24,M=stereo,T=audiomorph: resample 44100 to 48000 Hz (linear); bit depth 16 to 24")
+	decoded, err := DecodeFile(flacFile)
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.History, expected) {
+		t.Errorf("Expected history %q, got %q", expected, decoded.History)
+	}
+	if decoded.Metadata.Get(historyTag) != "" {
+		t.Errorf("The coding history tag should not be left in the metadata")
+	}
+
+	// Editing the tags keeps the history
+	if err := WriteTags(flacFile, Metadata{Title: "Edited"}); err != nil {
+		t.Fatalf("Failed to write tags: %v", err)
+	}
+	if decoded, err = DecodeFile(flacFile); err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.History, expected) || decoded.Metadata.Title != "Edited" {
+		t.Errorf("Expected history %q after tagging, got %q", expected, decoded.History)
+	}
+
+	// WAV files keep the history in their bext chunk
+	wavFile := filepath.Join(os.TempDir(), "test_output_history.wav")
+	defer os.Remove(wavFile)
+	if err := EncodeFile(decoded, wavFile, OptionUseChannels([]int{1})); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	expected = append(expected, "A=PCM,F=48000,W=24,M=mono,T=audiomorph: channels 1")
+	wav, err := DecodeFile(wavFile)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if !reflect.DeepEqual(wav.History, expected) {
+		t.Errorf("Expected history %q, got %q", expected, wav.History)
+	}
+	if wav.Broadcast == nil || wav.Broadcast.CodingHistory != strings.Join(expected, "\r\n")+"\r\n" {
+		t.Errorf("Unexpected bext coding history: %+v", wav.Broadcast)
+	}
+}
+
+func TestHistoryUnchanged(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	history := append([]string(nil), audio.History...)
+
+	// Re-encoding without operations in the same coding adds no row
+	filename := filepath.Join(os.TempDir(), "test_output_history_same.flac")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	if !reflect.DeepEqual(audio.History, history) {
+		t.Errorf("Expected history %q, got %q", history, audio.History)
+	}
+
+	// Audio without a history gets one only for operations
+	fresh := &Audio{NumChannels: 1, SampleRate: 8000, BitDepth: 16, Data: [][]int{make([]int, 80)}}
+	if row := encodeHistoryRow(fresh, ".wav", nil); row != "" {
+		t.Errorf("Expected no history row, got %q", row)
+	}
+	if row := encodeHistoryRow(fresh, ".wav", []string{"bit depth 8 to 16"}); row != "A=PCM,F=8000,W=16,M=mono,T=audiomorph: bit depth 8 to 16" {
+		t.Errorf("Unexpected history row: %q", row)
+	}
+}
+
+func TestHistoryAfterWrite(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	history := append([]string(nil), audio.History...)
+
+	// An encode that fails to write its file leaves the history as it was
+	filename := filepath.Join(os.TempDir(), "audiomorph_missing_directory", "test_output_history.wav")
+	if err := EncodeFile(audio, filename, OptionGain(-6)); err == nil {
+		t.Fatalf("Expected an error writing into a missing directory")
+	}
+	if !reflect.DeepEqual(audio.History, history) {
+		t.Errorf("Expected history %q after a failed encode, got %q", history, audio.History)
+	}
+
+	// A copy of a plain WAV file in the same coding adds no row, and so no bext chunk
+	filename = filepath.Join(os.TempDir(), "test_output_history_plain.wav")
+	defer os.Remove(filename)
+	plain := &Audio{NumChannels: 1, SampleRate: 8000, BitDepth: 16, Data: testSignal(1, 800, 16)}
+	if err := EncodeFile(plain, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if plain, err = DecodeFile(filename); err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if err := EncodeFile(plain, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if decoded.Broadcast != nil {
+		t.Errorf("Expected no bext chunk, got %+v", decoded.Broadcast)
+	}
+}
+
+func TestHistoryWordLength(t *testing.T) {
+	// The row holds the word length written, not the bit depth of the samples
+	for _, tc := range []struct {
+		ext      string
+		options  []Option
+		expected string
+	}{
+		{".wav", nil, "A=PCM,F=8000,W=16,"},
+		{".wav", []Option{OptionWAVCodec("float")}, "A=FLOAT,F=8000,W=32,"},
+		{".wav", []Option{OptionWAVCodec("ima-adpcm")}, "A=IMA-ADPCM,F=8000,W=4,"},
+		{".aiff", []Option{OptionAIFFCompression("ulaw")}, "A=ULAW,F=8000,W=8,"},
+		{".au", []Option{OptionAUEncoding("float")}, "A=FLOAT,F=8000,W=32,"},
+		{".wv", []Option{OptionWavPackMode("float")}, "A=WAVPACK,F=8000,W=32,"},
+	} {
+		audio := &Audio{NumChannels: 1, SampleRate: 8000, BitDepth: 16, Data: [][]int{make([]int, 80)}}
+		for _, option := range tc.options {
+			option(audio)
+		}
+		if row := encodeHistoryRow(audio, tc.ext, []string{"gain 1.0 dB"}); !strings.HasPrefix(row, tc.expected) {
+			t.Errorf("Expected a %s row starting %q, got %q", tc.ext, tc.expected, row)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Frames maps ID3v2 text frames to metadata keys. The first frame of a key is the one written.
+var id3Frames = []struct {
+	frame string
+	key   string
+}{
+	{"TIT2", "TITLE"},
+	{"TPE1", "ARTIST"},
+	{"TALB", "ALBUM"},
+	{"TPE2", "ALBUMARTIST"},
+	{"TCON", "GENRE"},
+	{"TDRC", "DATE"},
+	{"TYER", "DATE"},
+	{"TRCK", "TRACKNUMBER"},
+	{"TPOS", "DISCNUMBER"},
+	{"TCOM", "COMPOSER"},
+	{"TCOP", "COPYRIGHT"},
+	{"TSSE", "ENCODER"},
+	{"TBPM", "BPM"},
+	{"TSRC", "ISRC"},
+	{"TPUB", "LABEL"},
+	{"TLAN", "LANGUAGE"},
+	{"TEXT", "LYRICIST"},
+	{"TPE3", "CONDUCTOR"},
+	{"TIT1", "GROUPING"},
+	{"TIT3", "SUBTITLE"},
+	{"TMOO", "MOOD"},
+}
+
+// id3v22Frames maps ID3v2.2 three character frame ids to their ID3v2.3 equivalents
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2", "TP1": "TPE1", "TAL": "TALB", "TP2": "TPE2", "TCO": "TCON",
+	"TYE": "TYER", "TRK": "TRCK", "TPA": "TPOS", "TCM": "TCOM", "TCR": "TCOP",
+	"TSS": "TSSE", "TBP": "TBPM", "TRC": "TSRC", "TPB": "TPUB", "TLA": "TLAN",
+	"TXT": "TEXT", "TP3": "TPE3", "TT1": "TIT1", "TT3": "TIT3", "TXX": "TXXX",
+	"COM": "COMM", "PIC": "APIC",
+}
+
+// syncsafe decodes a 28 bit ID3v2 syncsafe integer
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// appendSyncsafe appends a 28 bit ID3v2 syncsafe integer
+func appendSyncsafe(b []byte, n int) []byte {
+	return append(b, byte(n>>21&0x7F), byte(n>>14&0x7F), byte(n>>7&0x7F), byte(n&0x7F))
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the start of raw, or 0 if there is none
+func id3v2Size(raw []byte) int {
+	if len(raw) < 10 || string(raw[0:3]) != "ID3" {
+		return 0
+	}
+	size := 10 + syncsafe(raw[6:10])
+	if raw[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return min(size, len(raw))
+}
+
+// removeUnsync reverses ID3v2 unsynchronisation, which inserts a zero after every 0xFF
+func removeUnsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// parseID3v2 reads the tags of an ID3v2.2, 2.3 or 2.4 tag
+func parseID3v2(tag []byte) (Metadata, error) {
+	var m Metadata
+	if len(tag) < 10 || string(tag[0:3]) != "ID3" {
+		return m, fmt.Errorf("missing ID3v2 header")
+	}
+	version := tag[3]
+	flags := tag[5]
+	if version < 2 || version > 4 {
+		return m, fmt.Errorf("unsupported ID3v2 version: 2.%d", version)
+	}
+	body := tag[10:min(len(tag), 10+syncsafe(tag[6:10]))]
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && version > 2 && len(body) >= 4 {
+		size := int(binary.BigEndian.Uint32(body[0:4])) + 4
+		if version == 4 {
+			size = syncsafe(body[0:4])
+		}
+		body = body[min(size, len(body)):]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(body) >= headerSize && body[0] != 0 {
+		id := string(body[0:idSize])
+		var size int
+		var frameFlags byte
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = body[9]
+		case 4:
+			size = syncsafe(body[4:8])
+			frameFlags = body[9]
+		}
+		if size > len(body)-headerSize {
+			break
+		}
+		data := body[headerSize : headerSize+size]
+		body = body[headerSize+size:]
+
+		if version == 2 {
+			id = id3v22Frames[id]
+		}
+
+		// Compressed and encrypted frames are skipped
+		if version == 3 {
+			if frameFlags&0xC0 != 0 {
+				continue
+			}
+			if frameFlags&0x20 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+		}
+		if version == 4 {
+			if frameFlags&0x0C != 0 {
+				continue
+			}
+			if frameFlags&0x40 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+			if frameFlags&0x01 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+			if frameFlags&0x02 != 0 || flags&0x80 != 0 {
+				data = removeUnsync(data)
+			}
+		}
+
+		parseID3Frame(&m, id, data, version)
+	}
+
+	return m, nil
+}
+
+// parseID3Frame adds the tag held by one ID3v2 frame
+func parseID3Frame(m *Metadata, id string, data []byte, version byte) {
+	if len(data) == 0 || id == "" {
+		return
+	}
+	encoding := data[0]
+	switch {
+	case id == "TXXX":
+		description, value := splitID3String(data[1:], encoding)
+		m.add(description, decodeID3Text(value, encoding))
+	case id == "COMM":
+		if len(data) < 4 {
+			return
+		}
+		// Only the plain comment is kept, comments with a description are player data
+		description, value := splitID3String(data[4:], encoding)
+		if description == "" {
+			m.add("COMMENT", decodeID3Text(value, encoding))
+		}
+	case id == "APIC":
+		var picture Picture
+		rest := data[1:]
+		if version == 2 {
+			if len(rest) < 4 {
+				return
+			}
+			switch strings.ToUpper(string(rest[0:3])) {
+			case "JPG":
+				picture.MIMEType = "image/jpeg"
+			case "PNG":
+				picture.MIMEType = "image/png"
+			}
+			rest = rest[3:]
+		} else {
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return
+			}
+			picture.MIMEType = string(rest[:end])
+			rest = rest[end+1:]
+		}
+		if len(rest) < 1 {
+			return
+		}
+		picture.Type = int(rest[0])
+		picture.Description, picture.Data = splitID3String(rest[1:], encoding)
+		picture.Data = append([]byte(nil), picture.Data...)
+		if picture.MIMEType == "" || picture.MIMEType == "image/" {
+			picture.MIMEType = sniffMIMEType(picture.Data)
+		}
+		m.Pictures = append(m.Pictures, picture)
+	case id == "RVA2":
+		// RVA2 gains fill in ReplayGain tags that have no TXXX frame
+		identification, gain, peak, ok := rva2Gain(data)
+		scope := strings.ToUpper(identification)
+		if !ok || (scope != "TRACK" && scope != "ALBUM") || m.Get("REPLAYGAIN_"+scope+"_GAIN") != "" {
+			return
+		}
+		m.Set("REPLAYGAIN_"+scope+"_GAIN", formatReplayGain(gain))
+		if peak > 0 {
+			m.Set("REPLAYGAIN_"+scope+"_PEAK", strconv.FormatFloat(peak, 'f', 6, 64))
+		}
+	case id[0] == 'T':
+		value := decodeID3Text(data[1:], encoding)
+		for _, frame := range id3Frames {
+			if frame.frame == id {
+				m.add(frame.key, value)
+				return
+			}
+		}
+		m.add(id, value)
+	}
+}
+
+// splitID3String splits a terminated string in the given text encoding from the data that follows it
+func splitID3String(data []byte, encoding byte) (string, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return decodeID3Text(data[:i], encoding), data[i+2:]
+			}
+		}
+		return decodeID3Text(data, encoding), nil
+	}
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		return decodeID3Text(data[:end], encoding), data[end+1:]
+	}
+	return decodeID3Text(data, encoding), nil
+}
+
+// decodeID3Text decodes ID3v2 text, joining multiple null separated values with "; "
+func decodeID3Text(data []byte, encoding byte) string {
+	var text string
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case 1, 2:
+		bigEndian := encoding == 2
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			unit := binary.LittleEndian.Uint16(data[i:])
+			if bigEndian {
+				unit = binary.BigEndian.Uint16(data[i:])
+			}
+			// A byte order mark selects the byte order of the following text
+			switch unit {
+			case 0xFEFF:
+				continue
+			case 0xFFFE:
+				bigEndian = !bigEndian
+				continue
+			}
+			units = append(units, unit)
+		}
+		text = string(utf16.Decode(units))
+	default:
+		text = string(data)
+	}
+
+	var values []string
+	for _, value := range strings.Split(text, "\x00") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, "; ")
+}
+
+// buildID3v2 builds an ID3v2.4 tag with UTF-8 text
+func buildID3v2(m Metadata) []byte {
+	var frames []byte
+	appendFrame := func(id string, data []byte) {
+		frames = append(frames, id...)
+		frames = appendSyncsafe(frames, len(data))
+		frames = append(frames, 0, 0)
+		frames = append(frames, data...)
+	}
+	appendText := func(id, value string) {
+		appendFrame(id, append([]byte{3}, value...))
+	}
+
+	for _, field := range m.Tags() {
+		key, value := field[0], field[1]
+		switch key {
+		case "TRACKNUMBER", "TRACKTOTAL":
+			if key == "TRACKNUMBER" || m.TrackNumber == 0 {
+				appendText("TRCK", numberWithTotal(m.TrackNumber, m.TrackTotal))
+			}
+			continue
+		case "DISCNUMBER", "DISCTOTAL":
+			if key == "DISCNUMBER" || m.DiscNumber == 0 {
+				appendText("TPOS", numberWithTotal(m.DiscNumber, m.DiscTotal))
+			}
+			continue
+		case "COMMENT":
+			appendFrame("COMM", append([]byte{3, 'e', 'n', 'g', 0}, value...))
+			continue
+		}
+
+		frame := ""
+		for _, f := range id3Frames {
+			if f.key == key {
+				frame = f.frame
+				break
+			}
+		}
+		if frame != "" {
+			appendText(frame, value)
+		} else {
+			appendFrame("TXXX", append(append([]byte{3}, key...), append([]byte{0}, value...)...))
+		}
+	}
+
+	// ReplayGain players that ignore TXXX frames read the gains from RVA2 frames
+	if rg, ok := ReadReplayGain(&m); ok {
+		appendFrame("RVA2", buildRVA2("track", rg.TrackGain, rg.TrackPeak))
+		if m.Get("REPLAYGAIN_ALBUM_GAIN") != "" {
+			appendFrame("RVA2", buildRVA2("album", rg.AlbumGain, rg.AlbumPeak))
+		}
+	}
+
+	for _, picture := range m.Pictures {
+		data := []byte{3}
+		data = append(data, picture.MIMEType...)
+		data = append(data, 0, byte(picture.Type))
+		data = append(data, picture.Description...)
+		data = append(data, 0)
+		data = append(data, picture.Data...)
+		appendFrame("APIC", data)
+	}
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = appendSyncsafe(tag, len(frames))
+	return append(tag, frames...)
+}
+
+// readMP3Metadata reads the ID3v2 tag at the start of an MP3 file
+func readMP3Metadata(raw []byte) Metadata {
+	size := id3v2Size(raw)
+	if size == 0 {
+		return Metadata{}
+	}
+	m, _ := parseID3v2(raw[:size])
+	return m
+}
+
+// updateMP3Metadata replaces the ID3v2 tag at the start of an MP3 file
+func updateMP3Metadata(raw []byte, m Metadata) ([]byte, error) {
+	audio := raw[id3v2Size(raw):]
+	if m.IsEmpty() {
+		return audio, nil
+	}
+	return append(buildID3v2(m), audio...), nil
+}
@@ -0,0 +1,114 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16Text encodes text as UTF-16 with a little endian byte order mark
+func utf16Text(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, unit)
+	}
+	return b
+}
+
+// id3Tag wraps frames in an ID3v2 tag header
+func id3Tag(version byte, flags byte, frames []byte) []byte {
+	tag := []byte{'I', 'D', '3', version, 0, flags}
+	return append(appendSyncsafe(tag, len(frames)), frames...)
+}
+
+func TestID3v23(t *testing.T) {
+	var frames []byte
+	frame := func(id string, data []byte) {
+		frames = append(frames, id...)
+		frames = binary.BigEndian.AppendUint32(frames, uint32(len(data)))
+		frames = append(frames, 0, 0)
+		frames = append(frames, data...)
+	}
+	frame("TIT2", append([]byte{1}, utf16Text("Schrei ✓")...))
+	frame("TPE1", []byte("\x00M\xfcller"))
+	frame("TRCK", []byte("\x003/12"))
+	frame("TYER", []byte("\x001951"))
+	frame("COMM", append([]byte{1, 'e', 'n', 'g', 0xFF, 0xFE, 0, 0}, utf16Text("Comment")...))
+	frame("COMM", []byte("\x00engiTunNORM\x00 0000"))
+	frame("TXXX", append(append([]byte{1}, utf16Text("REPLAYGAIN_TRACK_GAIN")...), append([]byte{0, 0}, utf16Text("-6.5 dB")...)...))
+	frame("APIC", []byte("\x00image/png\x00\x03cover\x00\x89PNG"))
+	frame("TPUB", []byte("\x00Label"))
+	frame("TXYZ", []byte("\x00Unknown"))
+
+	m, err := parseID3v2(id3Tag(3, 0, frames))
+	if err != nil {
+		t.Fatalf("Failed to parse ID3v2.3 tag: %v", err)
+	}
+	if m.Title != "Schrei ✓" || m.Artist != "Müller" || m.TrackNumber != 3 || m.TrackTotal != 12 || m.Date != "1951" || m.Comment != "Comment" {
+		t.Errorf("Unexpected tags: %v", m.Tags())
+	}
+	if m.Get("REPLAYGAIN_TRACK_GAIN") != "-6.5 dB" || m.Get("LABEL") != "Label" || m.Get("TXYZ") != "Unknown" {
+		t.Errorf("Unexpected extra tags: %v", m.Tags())
+	}
+	if len(m.Pictures) != 1 || m.Pictures[0].Type != PictureFrontCover || m.Pictures[0].Description != "cover" || string(m.Pictures[0].Data) != "\x89PNG" {
+		t.Errorf("Unexpected pictures: %+v", m.Pictures)
+	}
+}
+
+func TestID3v22(t *testing.T) {
+	var frames []byte
+	frame := func(id string, data []byte) {
+		frames = append(frames, id...)
+		frames = append(frames, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+		frames = append(frames, data...)
+	}
+	frame("TT2", []byte("\x00Title"))
+	frame("TP1", []byte("\x00Artist"))
+	frame("PIC", []byte("\x00JPG\x03\x00\xFF\xD8\xFF"))
+
+	m, err := parseID3v2(id3Tag(2, 0, frames))
+	if err != nil {
+		t.Fatalf("Failed to parse ID3v2.2 tag: %v", err)
+	}
+	if m.Title != "Title" || m.Artist != "Artist" {
+		t.Errorf("Unexpected tags: %v", m.Tags())
+	}
+	if len(m.Pictures) != 1 || m.Pictures[0].MIMEType != "image/jpeg" {
+		t.Errorf("Unexpected pictures: %+v", m.Pictures)
+	}
+}
+
+func TestID3v24FrameFlags(t *testing.T) {
+	// An unsynchronised frame with a data length indicator, and multiple null separated values
+	data := []byte{0, 0, 0, 8, 0, 'A', 0xFF, 0x00, 0xE9}
+	var frames []byte
+	frames = append(frames, "TIT2"...)
+	frames = appendSyncsafe(frames, len(data))
+	frames = append(frames, 0, 0x03)
+	frames = append(frames, data...)
+	frames = append(frames, "TPE1"...)
+	frames = appendSyncsafe(frames, 8)
+	frames = append(frames, 0, 0)
+	frames = append(frames, "\x03One\x00Two"...)
+
+	m, err := parseID3v2(id3Tag(4, 0, frames))
+	if err != nil {
+		t.Fatalf("Failed to parse ID3v2.4 tag: %v", err)
+	}
+	if m.Title != "Aÿé" {
+		t.Errorf("Expected an unsynchronised title, got %q", m.Title)
+	}
+	if m.Artist != "One; Two" {
+		t.Errorf("Expected multiple artists, got %q", m.Artist)
+	}
+
+	// The writer produces a tag the reader understands
+	written, err := parseID3v2(buildID3v2(testMetadata()))
+	if err != nil {
+		t.Fatalf("Failed to parse written tag: %v", err)
+	}
+	expected := testMetadata()
+	if len(written.Tags()) != len(expected.Tags()) {
+		t.Errorf("Tag mismatch:\nexpected %v\ngot      %v", expected.Tags(), written.Tags())
+	}
+}
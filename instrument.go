@@ -0,0 +1,372 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+// Instrument holds the sampler settings of a sample: its root note, tuning, key and velocity
+// ranges and loops
+type Instrument struct {
+	RootNote     int // MIDI note number, 60 is middle C
+	FineTune     int // in cents, -50 to 50
+	Gain         int // in dB
+	LowNote      int
+	HighNote     int
+	LowVelocity  int
+	HighVelocity int
+	Loops        []Loop
+}
+
+// Loop is a sustain or release loop of a sample, with positions in samples
+type Loop struct {
+	Start     int // first sample of the loop
+	End       int // sample after the last sample of the loop
+	Mode      LoopMode
+	PlayCount int // 0 loops forever
+}
+
+// LoopMode is the playback direction of a loop
+type LoopMode int
+
+// Loop modes, numbered as in the WAV smpl chunk
+const (
+	LoopForward LoopMode = iota
+	LoopPingPong
+	LoopBackward
+)
+
+// flacApplicationRIFF is the FLAC APPLICATION id of blocks holding RIFF chunks
+const flacApplicationRIFF = 0x72696666 // "riff"
+
+// OptionInstrument replaces the sampler settings written with the audio
+func OptionInstrument(instrument *Instrument) Option {
+	return func(a *Audio) {
+		a.Instrument = instrument
+	}
+}
+
+// newInstrument returns an instrument playing a sample across the whole keyboard at its root note
+func newInstrument(rootNote int) *Instrument {
+	return &Instrument{
+		RootNote:     rootNote,
+		HighNote:     127,
+		LowVelocity:  1,
+		HighVelocity: 127,
+	}
+}
+
+// rescaleInstrument returns a copy of an instrument with its loop positions scaled by ratio
+func rescaleInstrument(instrument *Instrument, ratio float64) *Instrument {
+	if instrument == nil {
+		return nil
+	}
+	rescaled := *instrument
+	rescaled.Loops = make([]Loop, len(instrument.Loops))
+	for i, loop := range instrument.Loops {
+		loop.Start = int(math.Round(float64(loop.Start) * ratio))
+		loop.End = int(math.Round(float64(loop.End) * ratio))
+		rescaled.Loops[i] = loop
+	}
+	return &rescaled
+}
+
+// shiftInstrument returns a copy of an instrument with its loops moved by offset samples,
+// keeping the loops that lie within audio of the given length
+func shiftInstrument(instrument *Instrument, offset, length int) *Instrument {
+	if instrument == nil {
+		return nil
+	}
+	shifted := *instrument
+	shifted.Loops = nil
+	for _, loop := range instrument.Loops {
+		loop.Start += offset
+		loop.End += offset
+		if loop.Start >= 0 && loop.End <= length {
+			shifted.Loops = append(shifted.Loops, loop)
+		}
+	}
+	return &shifted
+}
+
+// wavInstrument reads the sampler settings of a WAV or W64 file from its smpl and inst chunks
+func wavInstrument(chunks []riffChunk) *Instrument {
+	var instrument *Instrument
+	if smpl := findChunk(chunks, "smpl"); smpl != nil && len(smpl.data) >= 36 {
+		data := smpl.data
+		instrument = newInstrument(int(binary.LittleEndian.Uint32(data[12:16])))
+
+		// The pitch fraction raises the unity note by a fraction of a semitone
+		fraction := float64(binary.LittleEndian.Uint32(data[16:20])) / (1 << 32)
+		instrument.FineTune = int(math.Round(fraction * 100))
+		if instrument.FineTune > 50 {
+			instrument.RootNote++
+			instrument.FineTune -= 100
+		}
+
+		count := int(binary.LittleEndian.Uint32(data[28:32]))
+		for i := 0; i < count && 36+24*(i+1) <= len(data); i++ {
+			loop := data[36+24*i:]
+			instrument.Loops = append(instrument.Loops, Loop{
+				Start:     int(binary.LittleEndian.Uint32(loop[8:12])),
+				End:       int(binary.LittleEndian.Uint32(loop[12:16])) + 1,
+				Mode:      LoopMode(binary.LittleEndian.Uint32(loop[4:8])),
+				PlayCount: int(binary.LittleEndian.Uint32(loop[20:24])),
+			})
+		}
+	}
+
+	if inst := findChunk(chunks, "inst"); inst != nil && len(inst.data) >= 7 {
+		data := inst.data
+		if instrument == nil {
+			instrument = newInstrument(int(data[0]))
+		}
+		instrument.RootNote = int(data[0])
+		instrument.FineTune = int(int8(data[1]))
+		instrument.Gain = int(int8(data[2]))
+		instrument.LowNote = int(data[3])
+		instrument.HighNote = int(data[4])
+		instrument.LowVelocity = int(data[5])
+		instrument.HighVelocity = int(data[6])
+	}
+	return instrument
+}
+
+// buildSmpl builds the body of a smpl chunk
+func buildSmpl(instrument *Instrument, sampleRate int) []byte {
+	// A negative fine tune is stored as a fraction above the note below
+	unityNote, fineTune := instrument.RootNote, instrument.FineTune
+	if fineTune < 0 {
+		unityNote--
+		fineTune += 100
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, 0) // manufacturer
+	data = binary.LittleEndian.AppendUint32(data, 0) // product
+	data = binary.LittleEndian.AppendUint32(data, uint32(math.Round(1e9/float64(sampleRate))))
+	data = binary.LittleEndian.AppendUint32(data, uint32(unityNote))
+	data = binary.LittleEndian.AppendUint32(data, uint32(float64(fineTune)/100*(1<<32)))
+	data = binary.LittleEndian.AppendUint32(data, 0) // SMPTE format
+	data = binary.LittleEndian.AppendUint32(data, 0) // SMPTE offset
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(instrument.Loops)))
+	data = binary.LittleEndian.AppendUint32(data, 0) // sampler data
+	for i, loop := range instrument.Loops {
+		data = binary.LittleEndian.AppendUint32(data, uint32(i))
+		data = binary.LittleEndian.AppendUint32(data, uint32(loop.Mode))
+		data = binary.LittleEndian.AppendUint32(data, uint32(loop.Start))
+		data = binary.LittleEndian.AppendUint32(data, uint32(max(loop.End-1, loop.Start)))
+		data = binary.LittleEndian.AppendUint32(data, 0) // fraction
+		data = binary.LittleEndian.AppendUint32(data, uint32(loop.PlayCount))
+	}
+	return data
+}
+
+// buildInst builds the body of a WAV inst chunk
+func buildInst(instrument *Instrument) []byte {
+	return []byte{
+		byte(instrument.RootNote),
+		byte(int8(instrument.FineTune)),
+		byte(int8(instrument.Gain)),
+		byte(instrument.LowNote),
+		byte(instrument.HighNote),
+		byte(instrument.LowVelocity),
+		byte(instrument.HighVelocity),
+	}
+}
+
+// withWAVInstrument replaces the smpl and inst chunks with those of the instrument,
+// placing them after the data chunk
+func withWAVInstrument(chunks []riffChunk, instrument *Instrument, sampleRate int) []riffChunk {
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if chunk.id != "smpl" && chunk.id != "inst" {
+			updated = append(updated, chunk)
+		}
+	}
+	if instrument == nil {
+		return updated
+	}
+	return append(updated,
+		riffChunk{id: "smpl", data: buildSmpl(instrument, sampleRate)},
+		riffChunk{id: "inst", data: buildInst(instrument)},
+	)
+}
+
+// aiffLoopModes maps AIFF loop play modes to loop modes. AIFF has no backward loops.
+var aiffLoopModes = map[int]LoopMode{
+	1: LoopForward,
+	2: LoopPingPong,
+}
+
+// aiffInstrument reads the sampler settings of an AIFF file from its INST chunk. The markers that
+// delimit its loops are removed from the returned markers.
+func aiffInstrument(chunks []riffChunk, markers []Marker) (*Instrument, []Marker) {
+	inst := findChunk(chunks, "INST")
+	if inst == nil || len(inst.data) < 20 {
+		return nil, markers
+	}
+	data := inst.data
+	instrument := &Instrument{
+		RootNote:     int(int8(data[0])),
+		FineTune:     int(int8(data[1])),
+		LowNote:      int(int8(data[2])),
+		HighNote:     int(int8(data[3])),
+		LowVelocity:  int(int8(data[4])),
+		HighVelocity: int(int8(data[5])),
+		Gain:         int(int16(binary.BigEndian.Uint16(data[6:8]))),
+	}
+
+	positions := make(map[int]int)
+	for _, marker := range markers {
+		positions[marker.ID] = marker.Position
+	}
+	loopMarkers := make(map[int]bool)
+
+	// The sustain loop is followed by the release loop
+	for _, offset := range []int{8, 14} {
+		mode, ok := aiffLoopModes[int(int16(binary.BigEndian.Uint16(data[offset:])))]
+		begin := int(int16(binary.BigEndian.Uint16(data[offset+2:])))
+		end := int(int16(binary.BigEndian.Uint16(data[offset+4:])))
+		_, hasBegin := positions[begin]
+		_, hasEnd := positions[end]
+		if !ok || !hasBegin || !hasEnd {
+			continue
+		}
+		instrument.Loops = append(instrument.Loops, Loop{Start: positions[begin], End: positions[end], Mode: mode})
+		loopMarkers[begin] = true
+		loopMarkers[end] = true
+	}
+
+	var remaining []Marker
+	for _, marker := range markers {
+		if !loopMarkers[marker.ID] {
+			remaining = append(remaining, marker)
+		}
+	}
+	return instrument, remaining
+}
+
+// aiffLoopMarkers adds the markers delimiting the first two loops of an instrument to the markers,
+// and returns the INST chunk body that refers to them
+func aiffLoopMarkers(markers []Marker, instrument *Instrument) ([]Marker, []byte) {
+	// Number the markers so the loop markers can follow them
+	ids := markerIDs(markers, math.MaxInt16)
+	numbered := make([]Marker, len(markers))
+	nextID := 1
+	for i, marker := range markers {
+		marker.ID = ids[i]
+		numbered[i] = marker
+		nextID = max(nextID, ids[i]+1)
+	}
+
+	data := []byte{
+		byte(int8(instrument.RootNote)),
+		byte(int8(instrument.FineTune)),
+		byte(int8(instrument.LowNote)),
+		byte(int8(instrument.HighNote)),
+		byte(int8(instrument.LowVelocity)),
+		byte(int8(instrument.HighVelocity)),
+	}
+	data = binary.BigEndian.AppendUint16(data, uint16(int16(instrument.Gain)))
+
+	names := [][2]string{{"Sustain Begin", "Sustain End"}, {"Release Begin", "Release End"}}
+	for i := 0; i < 2; i++ {
+		if i >= len(instrument.Loops) || nextID+1 > math.MaxInt16 {
+			data = append(data, make([]byte, 6)...) // no looping
+			continue
+		}
+		loop := instrument.Loops[i]
+		mode := 1
+		if loop.Mode == LoopPingPong {
+			mode = 2
+		}
+		numbered = append(numbered,
+			Marker{ID: nextID, Position: loop.Start, Label: names[i][0]},
+			Marker{ID: nextID + 1, Position: loop.End, Label: names[i][1]},
+		)
+		data = binary.BigEndian.AppendUint16(data, uint16(mode))
+		data = binary.BigEndian.AppendUint16(data, uint16(nextID))
+		data = binary.BigEndian.AppendUint16(data, uint16(nextID+1))
+		nextID += 2
+	}
+	return numbered, data
+}
+
+// flacInstrument reads the sampler settings of a FLAC file from the smpl and inst chunks of its
+// APPLICATION "riff" blocks
+func flacInstrument(blocks []*meta.Block) *Instrument {
+	var chunks []riffChunk
+	for _, block := range blocks {
+		if app, ok := block.Body.(*meta.Application); ok && app.ID == flacApplicationRIFF {
+			chunks = append(chunks, readChunkList(app.Data)...)
+		}
+	}
+	return wavInstrument(chunks)
+}
+
+// isFLACRIFFBlock reports whether a FLAC metadata block is an APPLICATION "riff" block
+func isFLACRIFFBlock(block flacBlock) bool {
+	return block.blockType == flacBlockApplication && len(block.data) >= 4 &&
+		binary.BigEndian.Uint32(block.data[0:4]) == flacApplicationRIFF
+}
+
+// buildFLACInstrument builds the body of an APPLICATION "riff" block holding smpl and inst chunks
+func buildFLACInstrument(instrument *Instrument, sampleRate int) []byte {
+	data := binary.BigEndian.AppendUint32(nil, flacApplicationRIFF)
+	for _, chunk := range withWAVInstrument(nil, instrument, sampleRate) {
+		data = append(data, chunk.id...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(chunk.data)))
+		data = append(data, chunk.data...)
+		if len(chunk.data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	return data
+}
+
+// loopCommentInstrument reads the LOOPSTART, LOOPLENGTH and LOOPEND comments used by game engines
+// for looping Vorbis and FLAC files, removing them from the tags
+func loopCommentInstrument(m *Metadata) *Instrument {
+	start, err := strconv.Atoi(m.Get("LOOPSTART"))
+	length, lengthErr := strconv.Atoi(m.Get("LOOPLENGTH"))
+	end, endErr := strconv.Atoi(m.Get("LOOPEND"))
+	for _, key := range []string{"LOOPSTART", "LOOPLENGTH", "LOOPEND"} {
+		m.Set(key, "")
+	}
+	if err != nil {
+		return nil
+	}
+
+	// LOOPEND is the last sample of the loop
+	loop := Loop{Start: start}
+	switch {
+	case lengthErr == nil:
+		loop.End = start + length
+	case endErr == nil:
+		loop.End = end + 1
+	default:
+		return nil
+	}
+	instrument := newInstrument(60)
+	instrument.Loops = []Loop{loop}
+	return instrument
+}
+
+// withLoopComments returns the tags with LOOPSTART and LOOPLENGTH comments for the first loop
+func withLoopComments(m Metadata, instrument *Instrument) Metadata {
+	if instrument == nil || len(instrument.Loops) == 0 {
+		return m
+	}
+	extra := make(map[string]string, len(m.Extra)+2)
+	for key, value := range m.Extra {
+		extra[key] = value
+	}
+	m.Extra = extra
+	loop := instrument.Loops[0]
+	m.Set("LOOPSTART", strconv.Itoa(loop.Start))
+	m.Set("LOOPLENGTH", strconv.Itoa(loop.End-loop.Start))
+	return m
+}
@@ -0,0 +1,147 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testInstrument returns an instrument with a sustain and a release loop
+func testInstrument() *Instrument {
+	return &Instrument{
+		RootNote:     57,
+		FineTune:     -12,
+		Gain:         -3,
+		LowNote:      48,
+		HighNote:     72,
+		LowVelocity:  1,
+		HighVelocity: 127,
+		Loops: []Loop{
+			{Start: 4410, End: 8820, Mode: LoopForward},
+			{Start: 22050, End: 30870, Mode: LoopPingPong},
+		},
+	}
+}
+
+func TestInstrumentRoundTrip(t *testing.T) {
+	for _, ext := range []string{".wav", ".w64", ".aiff", ".flac"} {
+		t.Run(ext, func(t *testing.T) {
+			audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+			if err != nil {
+				t.Fatalf("Failed to decode WAV file: %v", err)
+			}
+			audio.Instrument = testInstrument()
+			audio.Markers = testMarkers()
+
+			filename := filepath.Join(os.TempDir(), "test_output_instrument"+ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename); err != nil {
+				t.Fatalf("Failed to encode %s: %v", ext, err)
+			}
+			decoded, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", ext, err)
+			}
+			if !reflect.DeepEqual(decoded.Instrument, testInstrument()) {
+				t.Errorf("Instrument mismatch:\nexpected %+v\ngot      %+v", testInstrument(), decoded.Instrument)
+			}
+
+			// The markers delimiting AIFF loops are not reported as markers
+			if len(decoded.Markers) != len(testMarkers()) {
+				t.Errorf("Expected %d markers, got %+v", len(testMarkers()), decoded.Markers)
+			}
+			if decoded.Metadata.Get("LOOPSTART") != "" {
+				t.Errorf("Loop comments were reported as tags: %v", decoded.Metadata.Tags())
+			}
+			assertSamplesEqual(t, audio.Data, decoded.Data)
+		})
+	}
+}
+
+func TestInstrumentResample(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if audio.SampleRate != 44100 {
+		t.Skipf("Expected a 44100 Hz test file, got %d Hz", audio.SampleRate)
+	}
+	instrument := testInstrument()
+	audio.Instrument = instrument
+
+	filename := filepath.Join(os.TempDir(), "test_output_instrument_resample.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionSampleRate(22050)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if instrument.Loops[0].Start != 4410 {
+		t.Errorf("The caller's loops were modified")
+	}
+
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	expected := []Loop{
+		{Start: 2205, End: 4410, Mode: LoopForward},
+		{Start: 11025, End: 15435, Mode: LoopPingPong},
+	}
+	if decoded.Instrument == nil || !reflect.DeepEqual(decoded.Instrument.Loops, expected) {
+		t.Errorf("Loops mismatch:\nexpected %+v\ngot      %+v", expected, decoded.Instrument)
+	}
+}
+
+func TestSmplChunk(t *testing.T) {
+	data := buildSmpl(&Instrument{RootNote: 60, FineTune: -25, Loops: []Loop{{Start: 100, End: 200, PlayCount: 3}}}, 44100)
+	if len(data) != 36+24 {
+		t.Fatalf("Expected a 60 byte smpl chunk, got %d bytes", len(data))
+	}
+
+	// A negative fine tune is stored as a fraction above the note below, the loop end is inclusive
+	if note := binary.LittleEndian.Uint32(data[12:16]); note != 59 {
+		t.Errorf("Expected unity note 59, got %d", note)
+	}
+	if fraction := binary.LittleEndian.Uint32(data[16:20]); fraction != 3<<30 {
+		t.Errorf("Expected pitch fraction %d, got %d", uint32(3<<30), fraction)
+	}
+	if end := binary.LittleEndian.Uint32(data[36+12:]); end != 199 {
+		t.Errorf("Expected loop end 199, got %d", end)
+	}
+
+	instrument := wavInstrument([]riffChunk{{id: "smpl", data: data}})
+	if instrument.RootNote != 60 || instrument.FineTune != -25 {
+		t.Errorf("Expected note 60 tuned -25 cents, got %d tuned %d cents", instrument.RootNote, instrument.FineTune)
+	}
+	if !reflect.DeepEqual(instrument.Loops, []Loop{{Start: 100, End: 200, PlayCount: 3}}) {
+		t.Errorf("Unexpected loops: %+v", instrument.Loops)
+	}
+}
+
+func TestLoopComments(t *testing.T) {
+	for _, tc := range []struct {
+		tags     map[string]string
+		expected []Loop
+	}{
+		{map[string]string{"LOOPSTART": "1000", "LOOPLENGTH": "500"}, []Loop{{Start: 1000, End: 1500}}},
+		{map[string]string{"LOOPSTART": "1000", "LOOPEND": "1499"}, []Loop{{Start: 1000, End: 1500}}},
+		{map[string]string{"LOOPSTART": "1000"}, nil},
+	} {
+		m := Metadata{Title: "Loop"}
+		for key, value := range tc.tags {
+			m.Set(key, value)
+		}
+		instrument := loopCommentInstrument(&m)
+		if tc.expected == nil {
+			if instrument != nil {
+				t.Errorf("Expected no instrument for %v, got %+v", tc.tags, instrument)
+			}
+		} else if instrument == nil || !reflect.DeepEqual(instrument.Loops, tc.expected) {
+			t.Errorf("Loops mismatch for %v: %+v", tc.tags, instrument)
+		}
+		if !reflect.DeepEqual(m.Tags(), [][2]string{{"TITLE", "Loop"}}) {
+			t.Errorf("Loop comments were not removed: %v", m.Tags())
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LoopInfo holds the tempo and key of a loop as stored by ACID (WAV acid chunk) and
+// Apple Loops (AIFF basc chunk), which DAWs use to stretch loops to the session tempo
+type LoopInfo struct {
+	OneShot          bool    // plays once instead of looping, and is not stretched
+	Tempo            float64 // in beats per minute
+	Beats            int     // length in beats, 0 to derive it from the tempo
+	MeterNumerator   int
+	MeterDenominator int
+	RootNote         int // MIDI note number, 0 if the loop has no key
+}
+
+// acidFlags are the bits of the flags field of an acid chunk
+const (
+	acidOneShot  = 0x01
+	acidRootNote = 0x02
+	acidStretch  = 0x04
+)
+
+// bascSize is the size of a basc chunk, most of which is reserved
+const bascSize = 84
+
+// noteNames maps note names to their offset from C
+var noteNames = map[string]int{"C": 0, "D": 2, "E": 4, "F": 5, "G": 7, "A": 9, "B": 11}
+
+// OptionLoopInfo replaces the tempo and key written with the audio
+func OptionLoopInfo(info *LoopInfo) Option {
+	return func(a *Audio) {
+		a.LoopInfo = info
+	}
+}
+
+// OptionTempo sets the tempo written with the audio, in beats per minute.
+// The length in beats is derived from the duration of the audio.
+func OptionTempo(bpm float64) Option {
+	return func(a *Audio) {
+		info := copyLoopInfo(a)
+		info.Tempo = bpm
+		info.Beats = 0
+	}
+}
+
+// OptionRootNote sets the key written with the audio as a MIDI note number
+func OptionRootNote(note int) Option {
+	return func(a *Audio) {
+		copyLoopInfo(a).RootNote = note
+	}
+}
+
+// copyLoopInfo replaces the loop information of the audio with a copy that options may change,
+// so the loop information of the decoded audio is left untouched
+func copyLoopInfo(a *Audio) *LoopInfo {
+	info := &LoopInfo{MeterNumerator: 4, MeterDenominator: 4}
+	if a.LoopInfo != nil {
+		*info = *a.LoopInfo
+	}
+	a.LoopInfo = info
+	return info
+}
+
+// ParseNote parses a MIDI note number or a note name such as "C", "F#3" or "Bb2".
+// Names without an octave are in octave 3, where C3 is note 60.
+func ParseNote(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if note, err := strconv.Atoi(name); err == nil {
+		if note < 0 || note > 127 {
+			return 0, fmt.Errorf("note out of range: %d", note)
+		}
+		return note, nil
+	}
+	if name == "" {
+		return 0, fmt.Errorf("empty note name")
+	}
+
+	offset, ok := noteNames[strings.ToUpper(name[:1])]
+	if !ok {
+		return 0, fmt.Errorf("invalid note name: %s", name)
+	}
+	rest := name[1:]
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		offset++
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "b"):
+		offset--
+		rest = rest[1:]
+	}
+
+	octave := 3
+	if rest != "" {
+		var err error
+		if octave, err = strconv.Atoi(rest); err != nil {
+			return 0, fmt.Errorf("invalid note name: %s", name)
+		}
+	}
+	note := 60 + (octave-3)*12 + offset
+	if note < 0 || note > 127 {
+		return 0, fmt.Errorf("note out of range: %s", name)
+	}
+	return note, nil
+}
+
+// loopBeats returns the length of the audio in beats, counting the beats from the tempo
+// if they are not set
+func loopBeats(info *LoopInfo, numSamples, sampleRate int) int {
+	if info.Beats > 0 || info.Tempo <= 0 || sampleRate <= 0 {
+		return info.Beats
+	}
+	seconds := float64(numSamples) / float64(sampleRate)
+	return max(1, int(math.Round(seconds*info.Tempo/60)))
+}
+
+// wavLoopInfo reads the tempo and key of a WAV or W64 file from its acid chunk
+func wavLoopInfo(chunks []riffChunk) *LoopInfo {
+	acid := findChunk(chunks, "acid")
+	if acid == nil || len(acid.data) < 24 {
+		return nil
+	}
+	data := acid.data
+	flags := binary.LittleEndian.Uint32(data[0:4])
+	info := &LoopInfo{
+		OneShot:          flags&acidOneShot != 0,
+		Beats:            int(binary.LittleEndian.Uint32(data[12:16])),
+		MeterDenominator: int(binary.LittleEndian.Uint16(data[16:18])),
+		MeterNumerator:   int(binary.LittleEndian.Uint16(data[18:20])),
+		Tempo:            float64(math.Float32frombits(binary.LittleEndian.Uint32(data[20:24]))),
+	}
+	if flags&acidRootNote != 0 {
+		info.RootNote = int(binary.LittleEndian.Uint16(data[4:6]))
+	}
+	return info
+}
+
+// buildAcid builds the body of an acid chunk
+func buildAcid(info *LoopInfo, numSamples, sampleRate int) []byte {
+	var flags uint32
+	if info.OneShot {
+		flags |= acidOneShot
+	} else {
+		flags |= acidStretch
+	}
+	if info.RootNote > 0 {
+		flags |= acidRootNote
+	}
+
+	data := binary.LittleEndian.AppendUint32(nil, flags)
+	data = binary.LittleEndian.AppendUint16(data, uint16(info.RootNote))
+	data = binary.LittleEndian.AppendUint16(data, 0x8000) // unknown, as written by ACID
+	data = binary.LittleEndian.AppendUint32(data, 0)      // unknown
+	data = binary.LittleEndian.AppendUint32(data, uint32(loopBeats(info, numSamples, sampleRate)))
+	data = binary.LittleEndian.AppendUint16(data, uint16(info.MeterDenominator))
+	data = binary.LittleEndian.AppendUint16(data, uint16(info.MeterNumerator))
+	return binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(info.Tempo)))
+}
+
+// withWAVLoopInfo replaces the acid chunk with that of the loop information, placing it after
+// the data chunk
+func withWAVLoopInfo(chunks []riffChunk, info *LoopInfo, numSamples, sampleRate int) []riffChunk {
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if chunk.id != "acid" {
+			updated = append(updated, chunk)
+		}
+	}
+	if info == nil {
+		return updated
+	}
+	return append(updated, riffChunk{id: "acid", data: buildAcid(info, numSamples, sampleRate)})
+}
+
+// aiffLoopInfo reads the tempo and key of an AIFF file from its basc chunk. The chunk has no
+// tempo, so it is worked out from the number of beats and the duration of the audio.
+func aiffLoopInfo(chunks []riffChunk, numSamples, sampleRate int) *LoopInfo {
+	basc := findChunk(chunks, "basc")
+	if basc == nil || len(basc.data) < 18 {
+		return nil
+	}
+	data := basc.data
+	info := &LoopInfo{
+		Beats:            int(binary.BigEndian.Uint32(data[4:8])),
+		RootNote:         int(binary.BigEndian.Uint16(data[8:10])),
+		MeterNumerator:   int(binary.BigEndian.Uint16(data[12:14])),
+		MeterDenominator: int(binary.BigEndian.Uint16(data[14:16])),
+		OneShot:          binary.BigEndian.Uint16(data[16:18]) == 1,
+	}
+	if numSamples > 0 && info.MeterDenominator > 0 {
+		// Beats are counted in the meter's note value, the tempo in quarter notes
+		seconds := float64(numSamples) / float64(sampleRate)
+		info.Tempo = float64(info.Beats) * 4 / float64(info.MeterDenominator) * 60 / seconds
+	}
+	return info
+}
+
+// buildBasc builds the body of a basc chunk
+func buildBasc(info *LoopInfo, numSamples, sampleRate int) []byte {
+	loopType := uint16(0)
+	if info.OneShot {
+		loopType = 1
+	}
+	data := binary.BigEndian.AppendUint32(nil, 1) // version
+	data = binary.BigEndian.AppendUint32(data, uint32(loopBeats(info, numSamples, sampleRate)))
+	data = binary.BigEndian.AppendUint16(data, uint16(info.RootNote))
+	data = binary.BigEndian.AppendUint16(data, 3) // scale type, neither major nor minor
+	data = binary.BigEndian.AppendUint16(data, uint16(info.MeterNumerator))
+	data = binary.BigEndian.AppendUint16(data, uint16(info.MeterDenominator))
+	data = binary.BigEndian.AppendUint16(data, loopType)
+	return append(data, make([]byte, bascSize-len(data))...)
+}
+
+// withAIFFLoopInfo replaces the basc chunk with that of the loop information, placing it before
+// the SSND chunk
+func withAIFFLoopInfo(chunks []riffChunk, info *LoopInfo, numSamples, sampleRate int) []riffChunk {
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if chunk.id == "basc" {
+			continue
+		}
+		if chunk.id == "SSND" && info != nil {
+			updated = append(updated, riffChunk{id: "basc", data: buildBasc(info, numSamples, sampleRate)})
+		}
+		updated = append(updated, chunk)
+	}
+	return updated
+}
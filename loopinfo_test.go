@@ -0,0 +1,122 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoopInfoRoundTrip(t *testing.T) {
+	for _, ext := range []string{".wav", ".w64", ".aiff", ".aifc"} {
+		t.Run(ext, func(t *testing.T) {
+			audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+			if err != nil {
+				t.Fatalf("Failed to decode WAV file: %v", err)
+			}
+			seconds := float64(len(audio.Data[0])) / float64(audio.SampleRate)
+			expected := LoopInfo{
+				Tempo:            60 * 4 / seconds, // four beats long
+				Beats:            4,
+				MeterNumerator:   3,
+				MeterDenominator: 4,
+				RootNote:         62,
+			}
+			info := expected
+			audio.LoopInfo = &info
+
+			filename := filepath.Join(os.TempDir(), "test_output_loopinfo"+ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename); err != nil {
+				t.Fatalf("Failed to encode %s: %v", ext, err)
+			}
+			decoded, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", ext, err)
+			}
+			got := decoded.LoopInfo
+			if got == nil {
+				t.Fatalf("Expected loop info, got none")
+			}
+			if math.Abs(got.Tempo-expected.Tempo) > 0.01 {
+				t.Errorf("Expected tempo %.3f, got %.3f", expected.Tempo, got.Tempo)
+			}
+			got.Tempo = expected.Tempo
+			if *got != expected {
+				t.Errorf("Loop info mismatch:\nexpected %+v\ngot      %+v", expected, *got)
+			}
+			assertSamplesEqual(t, audio.Data, decoded.Data)
+		})
+	}
+}
+
+func TestOptionTempo(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	filename := filepath.Join(os.TempDir(), "test_output_tempo.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionTempo(120), OptionRootNote(66)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	info := decoded.LoopInfo
+	if info == nil || info.Tempo != 120 || info.RootNote != 66 || info.MeterNumerator != 4 || info.MeterDenominator != 4 {
+		t.Fatalf("Unexpected loop info: %+v", info)
+	}
+
+	// The beats are counted from the tempo and the duration
+	beats := int(math.Round(audio.Duration * 2))
+	if info.Beats != max(beats, 1) {
+		t.Errorf("Expected %d beats, got %d", beats, info.Beats)
+	}
+}
+
+func TestAcidChunk(t *testing.T) {
+	data := buildAcid(&LoopInfo{OneShot: true, Tempo: 90, Beats: 8, MeterNumerator: 4, MeterDenominator: 4}, 0, 44100)
+	if len(data) != 24 {
+		t.Fatalf("Expected a 24 byte acid chunk, got %d bytes", len(data))
+	}
+
+	// Without a root note only the one-shot flag is set
+	if flags := binary.LittleEndian.Uint32(data[0:4]); flags != acidOneShot {
+		t.Errorf("Expected flags %#x, got %#x", acidOneShot, flags)
+	}
+	if tempo := math.Float32frombits(binary.LittleEndian.Uint32(data[20:24])); tempo != 90 {
+		t.Errorf("Expected tempo 90, got %v", tempo)
+	}
+
+	basc := buildBasc(&LoopInfo{Beats: 8, RootNote: 60, MeterNumerator: 4, MeterDenominator: 4}, 0, 44100)
+	if len(basc) != bascSize {
+		t.Errorf("Expected a %d byte basc chunk, got %d bytes", bascSize, len(basc))
+	}
+}
+
+func TestParseNote(t *testing.T) {
+	for name, expected := range map[string]int{
+		"C":   60,
+		"c3":  60,
+		"F#":  66,
+		"Bb2": 58,
+		"A-2": 9,
+		"69":  69,
+	} {
+		note, err := ParseNote(name)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", name, err)
+		} else if note != expected {
+			t.Errorf("Expected %q to be note %d, got %d", name, expected, note)
+		}
+	}
+	for _, name := range []string{"", "H", "C#x", "128", "G9"} {
+		if _, err := ParseNote(name); err == nil {
+			t.Errorf("Expected an error for %q", name)
+		}
+	}
+}
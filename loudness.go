@@ -0,0 +1,288 @@
+package audiomorph
+
+import (
+	"math"
+	"sort"
+
+	"github.com/schollz/audiomorph/filter"
+)
+
+// ITU-R BS.1770 and EBU Tech 3342 measurement constants
+const (
+	loudnessBlockSeconds      = 0.4 // gating block length, also the momentary loudness window
+	loudnessStepSeconds       = 0.1 // gating block step, 75% overlap
+	loudnessShortTermSeconds  = 3.0 // short-term loudness window
+	loudnessOffset            = -0.691
+	loudnessAbsoluteGate      = -70.0 // LUFS
+	loudnessRelativeGate      = -10.0 // LU below the ungated loudness
+	loudnessRangeRelativeGate = -20.0 // LU below the ungated short-term loudness
+)
+
+// Loudness holds the ITU-R BS.1770 and EBU R128 measurements of audio
+type Loudness struct {
+	Integrated   float64 // LUFS, -Inf for silent audio or audio shorter than 400 ms
+	Range        float64 // LU, the EBU Tech 3342 loudness range
+	TruePeak     float64 // dBTP, measured 4 times oversampled
+	SamplePeak   float64 // dBFS
+	MaxMomentary float64 // LUFS, the loudest 400 ms
+	MaxShortTerm float64 // LUFS, the loudest 3 s, -Inf for audio shorter than 3 s
+}
+
+// MeasureLoudness measures the integrated loudness, loudness range and peaks of audio
+func MeasureLoudness(audio *Audio) Loudness {
+	sums := weightedSums(audio)
+	momentary := sumBlocks(sums, audio.SampleRate, loudnessBlockSeconds, loudnessStepSeconds)
+	shortTerm := sumBlocks(sums, audio.SampleRate, loudnessShortTermSeconds, loudnessStepSeconds)
+	return Loudness{
+		Integrated:   gatedLoudness(momentary),
+		Range:        loudnessRange(shortTerm),
+		TruePeak:     amplitudeDB(truePeak(audio)),
+		SamplePeak:   amplitudeDB(samplePeak(audio)),
+		MaxMomentary: maxLoudness(momentary),
+		MaxShortTerm: maxLoudness(shortTerm),
+	}
+}
+
+// BroadcastLoudness returns the measurements as the loudness fields of a bext chunk, where
+// values that could not be measured are NaN
+func (l Loudness) BroadcastLoudness() *BroadcastLoudness {
+	value := func(v float64) float64 {
+		if math.IsInf(v, 0) {
+			return math.NaN()
+		}
+		return v
+	}
+	return &BroadcastLoudness{
+		LoudnessValue:        value(l.Integrated),
+		LoudnessRange:        l.Range,
+		MaxTruePeakLevel:     value(l.TruePeak),
+		MaxMomentaryLoudness: value(l.MaxMomentary),
+		MaxShortTermLoudness: value(l.MaxShortTerm),
+	}
+}
+
+// amplitudeDB converts an amplitude, 1 being full scale, to dB
+func amplitudeDB(amplitude float64) float64 {
+	return 20 * math.Log10(amplitude)
+}
+
+// kWeighting returns the two BS.1770 K-weighting filter stages for a sample rate: a high shelf
+// modelling the head and a high pass. The coefficients are derived for any rate from the
+// analog prototypes, giving the 48 kHz coefficients of the standard at 48 kHz.
+func kWeighting(sampleRate int) (filter.Biquad, filter.Biquad) {
+	rate := float64(sampleRate)
+
+	// High shelf, +4 dB above about 1.7 kHz
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := filter.Biquad{
+		B0: (vh + vb*k/q + k*k) / a0,
+		B1: 2 * (k*k - vh) / a0,
+		B2: (vh - vb*k/q + k*k) / a0,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+
+	// High pass at about 38 Hz
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := filter.Biquad{
+		B0: 1,
+		B1: -2,
+		B2: 1,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// channelWeights returns the BS.1770 weight of each channel: surround channels of 5 and
+// 5.1 channel audio count 1.41 times, the LFE channel is ignored
+func channelWeights(numChannels int) []float64 {
+	weights := make([]float64, numChannels)
+	for i := range weights {
+		weights[i] = 1
+	}
+	switch numChannels {
+	case 5:
+		weights[3], weights[4] = 1.41, 1.41
+	case 6:
+		weights[3], weights[4], weights[5] = 0, 1.41, 1.41
+	}
+	return weights
+}
+
+// fullScale returns the magnitude of a full scale sample at a bit depth
+func fullScale(bitDepth int) float64 {
+	if bitDepth <= 0 {
+		bitDepth = 16
+	}
+	return float64(int64(1) << uint(bitDepth-1))
+}
+
+// kWeightedSquares returns the K-weighted and squared samples of each channel, scaled so a
+// full scale sample is 1
+func kWeightedSquares(audio *Audio) [][]float64 {
+	scale := fullScale(audio.BitDepth)
+	squares := make([][]float64, len(audio.Data))
+	for ch, samples := range audio.Data {
+		shelf, highPass := kWeighting(audio.SampleRate)
+		squares[ch] = make([]float64, len(samples))
+		for i, sample := range samples {
+			y := highPass.Process(shelf.Process(float64(sample) / scale))
+			squares[ch][i] = y * y
+		}
+	}
+	return squares
+}
+
+// gatingBlocks returns the weighted mean square power of each 400 ms gating block of the
+// audio, stepping by 100 ms
+func gatingBlocks(audio *Audio) []float64 {
+	return sumBlocks(weightedSums(audio), audio.SampleRate, loudnessBlockSeconds, loudnessStepSeconds)
+}
+
+// weightedSums returns the running sums of the channel weighted squares of the K-weighted
+// audio, which make the power of every block a subtraction
+func weightedSums(audio *Audio) []float64 {
+	if len(audio.Data) == 0 || audio.SampleRate <= 0 {
+		return nil
+	}
+	weights := channelWeights(len(audio.Data))
+	sums := make([]float64, len(audio.Data[0])+1)
+	for ch, squares := range kWeightedSquares(audio) {
+		if weights[ch] == 0 {
+			continue
+		}
+		var sum float64
+		for i, square := range squares {
+			sum += square
+			sums[i+1] += weights[ch] * sum
+		}
+	}
+	return sums
+}
+
+// sumBlocks returns the mean square power of the blocks of the given length and step
+func sumBlocks(sums []float64, sampleRate int, blockSeconds, stepSeconds float64) []float64 {
+	blockSize := int(math.Round(blockSeconds * float64(sampleRate)))
+	step := int(math.Round(stepSeconds * float64(sampleRate)))
+	numSamples := len(sums) - 1
+	if blockSize <= 0 || numSamples < blockSize {
+		return nil
+	}
+
+	var blocks []float64
+	for start := 0; start+blockSize <= numSamples; start += step {
+		blocks = append(blocks, (sums[start+blockSize]-sums[start])/float64(blockSize))
+	}
+	return blocks
+}
+
+// powerLoudness converts a weighted mean square power to loudness in LUFS
+func powerLoudness(power float64) float64 {
+	return loudnessOffset + 10*math.Log10(power)
+}
+
+// gatedLoudness returns the integrated loudness of gating blocks in LUFS, applying the
+// absolute and relative gates, or -Inf if no block passes them
+func gatedLoudness(blocks []float64) float64 {
+	absoluteGate := math.Pow(10, (loudnessAbsoluteGate-loudnessOffset)/10)
+	var sum float64
+	var count int
+	for _, power := range blocks {
+		if power > absoluteGate {
+			sum += power
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+
+	relativeGate := sum / float64(count) * math.Pow(10, loudnessRelativeGate/10)
+	sum, count = 0, 0
+	for _, power := range blocks {
+		if power > absoluteGate && power > relativeGate {
+			sum += power
+			count++
+		}
+	}
+	return powerLoudness(sum / float64(count))
+}
+
+// maxLoudness returns the loudness of the loudest block, or -Inf if there are no blocks
+func maxLoudness(blocks []float64) float64 {
+	loudest := math.Inf(-1)
+	for _, power := range blocks {
+		loudest = max(loudest, powerLoudness(power))
+	}
+	return loudest
+}
+
+// loudnessRange returns the EBU Tech 3342 loudness range of short-term blocks: the spread
+// between the 10th and 95th percentiles of the gated short-term loudness
+func loudnessRange(blocks []float64) float64 {
+	absoluteGate := math.Pow(10, (loudnessAbsoluteGate-loudnessOffset)/10)
+	var gated []float64
+	var sum float64
+	for _, power := range blocks {
+		if power > absoluteGate {
+			gated = append(gated, power)
+			sum += power
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+
+	relativeGate := sum / float64(len(gated)) * math.Pow(10, loudnessRangeRelativeGate/10)
+	var loudness []float64
+	for _, power := range gated {
+		if power > relativeGate {
+			loudness = append(loudness, powerLoudness(power))
+		}
+	}
+	sort.Float64s(loudness)
+	percentile := func(p float64) float64 {
+		return loudness[int(math.Round(p*float64(len(loudness)-1)))]
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+// truePeak returns the largest magnitude of the 4 times oversampled audio, or of its samples
+// if larger, 1 being full scale
+func truePeak(audio *Audio) float64 {
+	phases := filter.TruePeakPhases()
+	scale := fullScale(audio.BitDepth)
+	peak := samplePeak(audio)
+	for _, samples := range audio.Data {
+		for i := range samples {
+			for _, phase := range phases {
+				var y float64
+				for k, tap := range phase {
+					if j := i - k; j >= 0 {
+						y += tap * float64(samples[j])
+					}
+				}
+				peak = max(peak, math.Abs(y)/scale)
+			}
+		}
+	}
+	return peak
+}
+
+// samplePeak returns the largest sample magnitude, 1 being full scale
+func samplePeak(audio *Audio) float64 {
+	var peak int
+	for _, samples := range audio.Data {
+		for _, sample := range samples {
+			peak = max(peak, sample, -sample)
+		}
+	}
+	return float64(peak) / fullScale(audio.BitDepth)
+}
@@ -0,0 +1,40 @@
+package audiomorph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTruePeak(t *testing.T) {
+	// A quarter sample rate sine sampled 45 degrees off its peaks is 3 dB louder between samples
+	audio := sineAudio(1, 12000, math.Pi/4, -6, 1)
+	loudness := MeasureLoudness(audio)
+	if math.Abs(loudness.SamplePeak+9.03) > 0.05 {
+		t.Errorf("Expected a sample peak of -9.03 dBFS, got %.2f", loudness.SamplePeak)
+	}
+	if math.Abs(loudness.TruePeak+6) > 0.5 {
+		t.Errorf("Expected a true peak of about -6 dBTP, got %.2f", loudness.TruePeak)
+	}
+}
+
+func TestLoudnessRange(t *testing.T) {
+	// EBU Tech 3342 test signal: 20 s at -20 LUFS followed by 20 s at -30 LUFS has a range of 10 LU
+	data := append(sineAudio(1, 1000, 0, -20, 20).Data[0], sineAudio(1, 1000, 0, -30, 20).Data[0]...)
+	audio := &Audio{NumChannels: 2, SampleRate: 48000, BitDepth: 16, Data: [][]int{data, data}}
+	loudness := MeasureLoudness(audio)
+	if math.Abs(loudness.Range-10) > 1 {
+		t.Errorf("Expected a loudness range of 10 LU, got %.2f", loudness.Range)
+	}
+	if math.Abs(loudness.MaxShortTerm+20) > 0.1 || math.Abs(loudness.MaxMomentary+20) > 0.1 {
+		t.Errorf("Expected a maximum loudness of -20 LUFS, got %.2f short-term and %.2f momentary", loudness.MaxShortTerm, loudness.MaxMomentary)
+	}
+
+	bext := loudness.BroadcastLoudness()
+	if bext.LoudnessValue != loudness.Integrated || bext.LoudnessRange != loudness.Range {
+		t.Errorf("Unexpected bext loudness: %+v", bext)
+	}
+	short := MeasureLoudness(sineAudio(1, 1000, 0, -20, 1))
+	if !math.IsInf(short.MaxShortTerm, -1) || !math.IsNaN(short.BroadcastLoudness().MaxShortTermLoudness) {
+		t.Errorf("Expected no short-term loudness for 1 s of audio, got %.2f", short.MaxShortTerm)
+	}
+}
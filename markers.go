@@ -0,0 +1,324 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+// Marker is a named position in the audio, such as a cue point placed in a DAW.
+// A marker with a length is a region.
+type Marker struct {
+	ID       int
+	Position int // in samples
+	Length   int // in samples, 0 for a plain marker
+	Label    string
+	Note     string
+}
+
+// flacLeadOutTrack is the track number of the lead-out track of a non CD-DA FLAC cue sheet
+const flacLeadOutTrack = 255
+
+// OptionMarkers replaces the markers written with the audio
+func OptionMarkers(markers []Marker) Option {
+	return func(a *Audio) {
+		a.Markers = markers
+	}
+}
+
+// markerIDs returns the ID of each marker, numbering them from 1 unless their own IDs are
+// positive, unique and no larger than maxID
+func markerIDs(markers []Marker, maxID int) []int {
+	ids := make([]int, len(markers))
+	seen := make(map[int]bool)
+	valid := true
+	for i, marker := range markers {
+		ids[i] = marker.ID
+		if marker.ID <= 0 || marker.ID > maxID || seen[marker.ID] {
+			valid = false
+		}
+		seen[marker.ID] = true
+	}
+	if !valid {
+		for i := range ids {
+			ids[i] = i + 1
+		}
+	}
+	return ids
+}
+
+// rescaleMarkers returns a copy of the markers with their positions scaled by ratio
+func rescaleMarkers(markers []Marker, ratio float64) []Marker {
+	if markers == nil {
+		return nil
+	}
+	rescaled := make([]Marker, len(markers))
+	for i, marker := range markers {
+		marker.Position = int(math.Round(float64(marker.Position) * ratio))
+		marker.Length = int(math.Round(float64(marker.Length) * ratio))
+		rescaled[i] = marker
+	}
+	return rescaled
+}
+
+// shiftMarkers returns a copy of the markers moved by offset samples, keeping those within
+// audio of the given length and cutting regions at its ends
+func shiftMarkers(markers []Marker, offset, length int) []Marker {
+	if markers == nil {
+		return nil
+	}
+	shifted := []Marker{}
+	for _, marker := range markers {
+		marker.Position += offset
+		if marker.Length > 0 {
+			end := min(marker.Position+marker.Length, length)
+			marker.Position = max(marker.Position, 0)
+			if end <= marker.Position {
+				continue
+			}
+			marker.Length = end - marker.Position
+		}
+		if marker.Position < 0 || marker.Position >= length {
+			continue
+		}
+		shifted = append(shifted, marker)
+	}
+	return shifted
+}
+
+// appendMarkers adds markers moved by offset samples to audio of a length, numbering them on
+// from the markers they are added to
+func appendMarkers(markers, added []Marker, offset, length int) []Marker {
+	lastID := 0
+	for _, marker := range markers {
+		lastID = max(lastID, marker.ID)
+	}
+	for _, marker := range shiftMarkers(added, offset, length) {
+		marker.ID += lastID
+		markers = append(markers, marker)
+	}
+	return markers
+}
+
+// wavMarkers reads the markers of a WAV or W64 file from its cue chunk and the labels,
+// notes and region lengths of its LIST/adtl chunk
+func wavMarkers(chunks []riffChunk) []Marker {
+	cue := findChunk(chunks, "cue ")
+	if cue == nil || len(cue.data) < 4 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(cue.data[0:4]))
+
+	var markers []Marker
+	index := make(map[int]int)
+	for i := 0; i < count && 4+24*(i+1) <= len(cue.data); i++ {
+		point := cue.data[4+24*i:]
+		id := int(binary.LittleEndian.Uint32(point[0:4]))
+		index[id] = len(markers)
+		markers = append(markers, Marker{
+			ID:       id,
+			Position: int(binary.LittleEndian.Uint32(point[20:24])),
+		})
+	}
+
+	for _, chunk := range chunks {
+		if !isListChunk(chunk, "adtl") {
+			continue
+		}
+		for _, sub := range listChunks(chunk) {
+			if len(sub.data) < 4 {
+				continue
+			}
+			i, ok := index[int(binary.LittleEndian.Uint32(sub.data[0:4]))]
+			if !ok {
+				continue
+			}
+			switch sub.id {
+			case "labl":
+				markers[i].Label = infoText(sub.data[4:])
+			case "note":
+				markers[i].Note = infoText(sub.data[4:])
+			case "ltxt":
+				if len(sub.data) >= 20 {
+					markers[i].Length = int(binary.LittleEndian.Uint32(sub.data[4:8]))
+					if text := infoText(sub.data[20:]); text != "" && markers[i].Label == "" {
+						markers[i].Label = text
+					}
+				}
+			}
+		}
+	}
+	return markers
+}
+
+// appendZString appends a null terminated string
+func appendZString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+// withWAVMarkers replaces the cue and LIST/adtl chunks with those of the markers,
+// placing them after the data chunk
+func withWAVMarkers(chunks []riffChunk, markers []Marker) []riffChunk {
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if chunk.id == "cue " || isListChunk(chunk, "adtl") {
+			continue
+		}
+		updated = append(updated, chunk)
+	}
+	if len(markers) == 0 {
+		return updated
+	}
+
+	ids := markerIDs(markers, math.MaxUint32)
+	cue := binary.LittleEndian.AppendUint32(nil, uint32(len(markers)))
+	var adtl []riffChunk
+	for i, marker := range markers {
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(ids[i]))
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(marker.Position))
+		cue = append(cue, "data"...)
+		cue = binary.LittleEndian.AppendUint32(cue, 0)
+		cue = binary.LittleEndian.AppendUint32(cue, 0)
+		cue = binary.LittleEndian.AppendUint32(cue, uint32(marker.Position))
+
+		id := binary.LittleEndian.AppendUint32(nil, uint32(ids[i]))
+		if marker.Label != "" {
+			adtl = append(adtl, riffChunk{id: "labl", data: appendZString(id, marker.Label)})
+		}
+		if marker.Note != "" {
+			adtl = append(adtl, riffChunk{id: "note", data: appendZString(id, marker.Note)})
+		}
+		if marker.Length > 0 {
+			ltxt := binary.LittleEndian.AppendUint32(id, uint32(marker.Length))
+			ltxt = append(ltxt, "rgn "...)
+			ltxt = append(ltxt, make([]byte, 8)...) // country, language, dialect and code page
+			adtl = append(adtl, riffChunk{id: "ltxt", data: ltxt})
+		}
+	}
+
+	updated = append(updated, riffChunk{id: "cue ", data: cue})
+	if len(adtl) > 0 {
+		updated = append(updated, riffChunk{id: "LIST", data: buildListChunk("adtl", adtl)})
+	}
+	return updated
+}
+
+// aiffMarkers reads the markers of an AIFF file from its MARK chunk
+func aiffMarkers(chunks []riffChunk) []Marker {
+	mark := findChunk(chunks, "MARK")
+	if mark == nil || len(mark.data) < 2 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(mark.data[0:2]))
+	data := mark.data[2:]
+
+	var markers []Marker
+	for i := 0; i < count && len(data) >= 7; i++ {
+		size := int(data[6])
+		if 7+size > len(data) {
+			break
+		}
+		markers = append(markers, Marker{
+			ID:       int(int16(binary.BigEndian.Uint16(data[0:2]))),
+			Position: int(binary.BigEndian.Uint32(data[2:6])),
+			Label:    string(data[7 : 7+size]),
+		})
+		// The Pascal string is padded to an even length
+		data = data[min(len(data), 7+size+(size+1)%2):]
+	}
+	return markers
+}
+
+// buildAIFFMarkers builds the body of a MARK chunk. AIFF has no regions, so regions are
+// written as a marker at their start.
+func buildAIFFMarkers(markers []Marker) []byte {
+	ids := markerIDs(markers, math.MaxInt16)
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(markers)))
+	for i, marker := range markers {
+		data = binary.BigEndian.AppendUint16(data, uint16(ids[i]))
+		data = binary.BigEndian.AppendUint32(data, uint32(marker.Position))
+		data = appendPascalString(data, marker.Label)
+	}
+	return data
+}
+
+// withAIFFMarkers replaces the MARK and INST chunks with those of the markers and the instrument,
+// placing them before the SSND chunk. The loops of the instrument are delimited by markers.
+func withAIFFMarkers(chunks []riffChunk, markers []Marker, instrument *Instrument) []riffChunk {
+	var inst []byte
+	if instrument != nil {
+		markers, inst = aiffLoopMarkers(markers, instrument)
+	}
+
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if chunk.id == "MARK" || chunk.id == "INST" {
+			continue
+		}
+		if chunk.id == "SSND" && len(markers) > 0 {
+			updated = append(updated, riffChunk{id: "MARK", data: buildAIFFMarkers(markers)})
+		}
+		if chunk.id == "SSND" && inst != nil {
+			updated = append(updated, riffChunk{id: "INST", data: inst})
+		}
+		updated = append(updated, chunk)
+	}
+	return updated
+}
+
+// flacMarkers reads the markers of a FLAC file from its CUESHEET block, one per track.
+// Cue sheets have no labels, so the markers are unnamed.
+func flacMarkers(blocks []*meta.Block) []Marker {
+	var markers []Marker
+	for _, block := range blocks {
+		cueSheet, ok := block.Body.(*meta.CueSheet)
+		if !ok {
+			continue
+		}
+		for _, track := range cueSheet.Tracks {
+			if track.Num == flacLeadOutTrack || (cueSheet.IsCompactDisc && track.Num == 170) {
+				continue
+			}
+			// The track starts at index 1, index 0 is its pregap
+			position := track.Offset
+			for _, index := range track.Indicies {
+				if index.Num == 1 {
+					position += index.Offset
+					break
+				}
+			}
+			markers = append(markers, Marker{ID: int(track.Num), Position: int(position)})
+		}
+	}
+	return markers
+}
+
+// buildFLACCueSheet builds the body of a non CD-DA CUESHEET block with a track for each marker
+func buildFLACCueSheet(markers []Marker, numSamples int) []byte {
+	sorted := append([]Marker(nil), markers...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Position < sorted[j].Position })
+	if len(sorted) > flacLeadOutTrack-1 {
+		sorted = sorted[:flacLeadOutTrack-1]
+	}
+	ids := markerIDs(sorted, flacLeadOutTrack-1)
+
+	data := make([]byte, 128+8+259) // catalog number, lead-in and the CD-DA flag with reserved bytes
+	data = append(data, byte(len(sorted)+1))
+	appendTrack := func(offset, number int, indices int) {
+		data = binary.BigEndian.AppendUint64(data, uint64(offset))
+		data = append(data, byte(number))
+		data = append(data, make([]byte, 12+14)...) // ISRC, audio track flags and reserved bytes
+		data = append(data, byte(indices))
+		if indices > 0 {
+			data = binary.BigEndian.AppendUint64(data, 0)
+			data = append(data, 1, 0, 0, 0)
+		}
+	}
+	for i, marker := range sorted {
+		appendTrack(marker.Position, ids[i], 1)
+	}
+	appendTrack(numSamples, flacLeadOutTrack, 0)
+	return data
+}
@@ -0,0 +1,155 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testMarkers returns two markers and a region
+func testMarkers() []Marker {
+	return []Marker{
+		{ID: 1, Position: 0, Label: "Start"},
+		{ID: 2, Position: 11025, Label: "Scream", Note: "the loud part"},
+		{ID: 5, Position: 22050, Length: 8820, Label: "Tail"},
+	}
+}
+
+func TestMarkersRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		ext      string
+		expected func() []Marker
+	}{
+		{".wav", testMarkers},
+		{".w64", testMarkers},
+		{".aiff", func() []Marker {
+			// AIFF markers have no notes or regions
+			markers := testMarkers()
+			for i := range markers {
+				markers[i].Note = ""
+				markers[i].Length = 0
+			}
+			return markers
+		}},
+		{".flac", func() []Marker {
+			// FLAC cue sheets have track positions only
+			markers := testMarkers()
+			for i := range markers {
+				markers[i] = Marker{ID: markers[i].ID, Position: markers[i].Position}
+			}
+			return markers
+		}},
+	} {
+		t.Run(tc.ext, func(t *testing.T) {
+			audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+			if err != nil {
+				t.Fatalf("Failed to decode WAV file: %v", err)
+			}
+			audio.Markers = testMarkers()
+
+			filename := filepath.Join(os.TempDir(), "test_output_markers"+tc.ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename); err != nil {
+				t.Fatalf("Failed to encode %s: %v", tc.ext, err)
+			}
+			decoded, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", tc.ext, err)
+			}
+			if !reflect.DeepEqual(decoded.Markers, tc.expected()) {
+				t.Errorf("Markers mismatch:\nexpected %+v\ngot      %+v", tc.expected(), decoded.Markers)
+			}
+			assertSamplesEqual(t, audio.Data, decoded.Data)
+		})
+	}
+}
+
+func TestMarkersResample(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if audio.SampleRate != 44100 {
+		t.Skipf("Expected a 44100 Hz test file, got %d Hz", audio.SampleRate)
+	}
+	markers := testMarkers()
+	audio.Markers = markers
+
+	filename := filepath.Join(os.TempDir(), "test_output_markers_resample.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionSampleRate(22050)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if markers[1].Position != 11025 {
+		t.Errorf("The caller's markers were modified")
+	}
+
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	expected := testMarkers()
+	for i := range expected {
+		expected[i].Position = int(math.Round(float64(expected[i].Position) / 2))
+		expected[i].Length = int(math.Round(float64(expected[i].Length) / 2))
+	}
+	if !reflect.DeepEqual(decoded.Markers, expected) {
+		t.Errorf("Markers mismatch:\nexpected %+v\ngot      %+v", expected, decoded.Markers)
+	}
+}
+
+func TestMarkersConversion(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	wavFile := filepath.Join(os.TempDir(), "test_output_markers_source.wav")
+	defer os.Remove(wavFile)
+	if err := EncodeFile(audio, wavFile, OptionMarkers(testMarkers())); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+
+	// Markers follow the audio from WAV to AIFF-C and back
+	audio, err = DecodeFile(wavFile)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	aifcFile := filepath.Join(os.TempDir(), "test_output_markers.aifc")
+	defer os.Remove(aifcFile)
+	if err := EncodeFile(audio, aifcFile, OptionAIFFCompression("sowt")); err != nil {
+		t.Fatalf("Failed to encode AIFF-C file: %v", err)
+	}
+	decoded, err := DecodeFile(aifcFile)
+	if err != nil {
+		t.Fatalf("Failed to decode AIFF-C file: %v", err)
+	}
+	if len(decoded.Markers) != 3 || decoded.Markers[1].Label != "Scream" || decoded.Markers[2].Position != 22050 {
+		t.Errorf("Unexpected markers: %+v", decoded.Markers)
+	}
+}
+
+func TestWAVCueChunk(t *testing.T) {
+	chunks := withWAVMarkers(nil, []Marker{{ID: 7, Position: 1000, Length: 500, Label: "Region"}, {ID: 7, Position: 2000}})
+	cue := findChunk(chunks, "cue ")
+	if cue == nil || len(cue.data) != 4+2*24 {
+		t.Fatalf("Unexpected cue chunk: %+v", cue)
+	}
+
+	// Duplicate IDs are renumbered, positions are stored in the sample offset field
+	point := cue.data[4+24:]
+	if id := binary.LittleEndian.Uint32(point[0:4]); id != 2 {
+		t.Errorf("Expected renumbered ID 2, got %d", id)
+	}
+	if string(point[8:12]) != "data" || binary.LittleEndian.Uint32(point[20:24]) != 2000 {
+		t.Errorf("Unexpected cue point: %v", point[:24])
+	}
+
+	markers := wavMarkers(chunks)
+	expected := []Marker{{ID: 1, Position: 1000, Length: 500, Label: "Region"}, {ID: 2, Position: 2000}}
+	if !reflect.DeepEqual(markers, expected) {
+		t.Errorf("Markers mismatch:\nexpected %+v\ngot      %+v", expected, markers)
+	}
+}
@@ -0,0 +1,285 @@
+package audiomorph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata holds the tags of an audio file: the common fields, any other tag as a key/value pair
+// and embedded pictures. Keys use Vorbis comment names (e.g. "TITLE", "ALBUMARTIST"), which are
+// mapped to ID3v2 frames, RIFF INFO ids, AIFF text chunks and APEv2 items when written.
+type Metadata struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Date        string
+	Comment     string
+	Composer    string
+	Copyright   string
+	Encoder     string
+	TrackNumber int
+	TrackTotal  int
+	DiscNumber  int
+	DiscTotal   int
+	Extra       map[string]string // Tags without a field, keyed by upper case name
+	Pictures    []Picture
+}
+
+// Picture is an embedded image such as album art
+type Picture struct {
+	Type        int // ID3v2 APIC picture type, 3 is the front cover
+	MIMEType    string
+	Description string
+	Data        []byte
+}
+
+// PictureFrontCover is the picture type of front cover art
+const PictureFrontCover = 3
+
+// metadataKeys lists the keys of the common fields in the order they are written
+var metadataKeys = []string{
+	"TITLE", "ARTIST", "ALBUM", "ALBUMARTIST", "GENRE", "DATE",
+	"TRACKNUMBER", "TRACKTOTAL", "DISCNUMBER", "DISCTOTAL",
+	"COMPOSER", "COMMENT", "COPYRIGHT", "ENCODER",
+}
+
+// metadataAliases maps alternative key spellings to their metadata key
+var metadataAliases = map[string]string{
+	"ALBUM ARTIST": "ALBUMARTIST",
+	"YEAR":         "DATE",
+	"DESCRIPTION":  "COMMENT",
+	"TOTALTRACKS":  "TRACKTOTAL",
+	"TOTALDISCS":   "DISCTOTAL",
+	"ENCODED-BY":   "ENCODER",
+}
+
+// OptionMetadata replaces the tags written with the audio
+func OptionMetadata(metadata Metadata) Option {
+	return func(a *Audio) {
+		a.Metadata = metadata
+	}
+}
+
+// canonicalKey returns the upper case metadata key for a tag name
+func canonicalKey(key string) string {
+	key = strings.ToUpper(strings.TrimSpace(key))
+	if alias, ok := metadataAliases[key]; ok {
+		return alias
+	}
+	return key
+}
+
+// Get returns the value of a tag, or "" if it is not set
+func (m *Metadata) Get(key string) string {
+	key = canonicalKey(key)
+	if field := m.stringField(key); field != nil {
+		return *field
+	}
+	if field := m.intField(key); field != nil {
+		if *field == 0 {
+			return ""
+		}
+		return strconv.Itoa(*field)
+	}
+	return m.Extra[key]
+}
+
+// Set sets the value of a tag, an empty value removes it.
+// Track and disc numbers may include their total, as in "3/12".
+func (m *Metadata) Set(key, value string) {
+	key = canonicalKey(key)
+	value = strings.TrimSpace(value)
+	if field := m.stringField(key); field != nil {
+		*field = value
+		return
+	}
+	if field := m.intField(key); field != nil {
+		number, total, hasTotal := strings.Cut(value, "/")
+		*field, _ = strconv.Atoi(strings.TrimSpace(number))
+		if hasTotal {
+			switch key {
+			case "TRACKNUMBER":
+				m.TrackTotal, _ = strconv.Atoi(strings.TrimSpace(total))
+			case "DISCNUMBER":
+				m.DiscTotal, _ = strconv.Atoi(strings.TrimSpace(total))
+			}
+		}
+		return
+	}
+	if key == "" {
+		return
+	}
+	if value == "" {
+		delete(m.Extra, key)
+		return
+	}
+	if m.Extra == nil {
+		m.Extra = make(map[string]string)
+	}
+	m.Extra[key] = value
+}
+
+// add sets a tag, joining repeated values of the same text tag with "; "
+func (m *Metadata) add(key, value string) {
+	if m.intField(canonicalKey(key)) == nil {
+		if existing := m.Get(key); existing != "" && strings.TrimSpace(value) != "" {
+			value = existing + "; " + value
+		}
+	}
+	m.Set(key, value)
+}
+
+// merge fills the tags missing from m with those of other
+func (m *Metadata) merge(other Metadata) {
+	for _, field := range other.Tags() {
+		if m.Get(field[0]) == "" {
+			m.Set(field[0], field[1])
+		}
+	}
+	if len(m.Pictures) == 0 {
+		m.Pictures = other.Pictures
+	}
+}
+
+// stringField returns the text field stored under a metadata key
+func (m *Metadata) stringField(key string) *string {
+	switch key {
+	case "TITLE":
+		return &m.Title
+	case "ARTIST":
+		return &m.Artist
+	case "ALBUM":
+		return &m.Album
+	case "ALBUMARTIST":
+		return &m.AlbumArtist
+	case "GENRE":
+		return &m.Genre
+	case "DATE":
+		return &m.Date
+	case "COMMENT":
+		return &m.Comment
+	case "COMPOSER":
+		return &m.Composer
+	case "COPYRIGHT":
+		return &m.Copyright
+	case "ENCODER":
+		return &m.Encoder
+	}
+	return nil
+}
+
+// intField returns the numeric field stored under a metadata key
+func (m *Metadata) intField(key string) *int {
+	switch key {
+	case "TRACKNUMBER":
+		return &m.TrackNumber
+	case "TRACKTOTAL":
+		return &m.TrackTotal
+	case "DISCNUMBER":
+		return &m.DiscNumber
+	case "DISCTOTAL":
+		return &m.DiscTotal
+	}
+	return nil
+}
+
+// Tags returns every tag that is set as key/value pairs, the common fields first
+func (m *Metadata) Tags() [][2]string {
+	var fields [][2]string
+	for _, key := range metadataKeys {
+		if value := m.Get(key); value != "" {
+			fields = append(fields, [2]string{key, value})
+		}
+	}
+
+	keys := make([]string, 0, len(m.Extra))
+	for key := range m.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if m.Extra[key] != "" {
+			fields = append(fields, [2]string{key, m.Extra[key]})
+		}
+	}
+	return fields
+}
+
+// IsEmpty reports whether no tag or picture is set
+func (m *Metadata) IsEmpty() bool {
+	return len(m.Tags()) == 0 && len(m.Pictures) == 0
+}
+
+// numberWithTotal formats a track or disc number as "n" or "n/total"
+func numberWithTotal(number, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("%d/%d", number, total)
+	}
+	if number > 0 {
+		return strconv.Itoa(number)
+	}
+	return ""
+}
+
+// writeMetadata replaces the tags of an existing file without touching its audio.
+// Formats without a tag container (W64, AU, raw) are left unchanged.
+func writeMetadata(filename string, metadata Metadata) error {
+	update := metadataUpdater(strings.ToLower(filepath.Ext(filename)))
+	if update == nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file for tagging: %w", err)
+	}
+	raw, err = update(raw, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	if err := os.WriteFile(filename, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write tagged file: %w", err)
+	}
+	return nil
+}
+
+// metadataUpdater returns the function that replaces the tags of a file with the given
+// extension, or nil if the format has no tag container
+func metadataUpdater(ext string) func(raw []byte, metadata Metadata) ([]byte, error) {
+	switch ext {
+	case ".wav":
+		return updateWAVMetadata
+	case ".aif", ".aiff", ".aifc":
+		return updateAIFFMetadata
+	case ".mp3":
+		return updateMP3Metadata
+	case ".flac":
+		return updateFLACMetadata
+	case ".wv":
+		return updateAPEMetadata
+	case ".ogg", ".oga", ".opus":
+		return updateOggMetadata
+	}
+	return nil
+}
+
+// sniffMIMEType guesses the MIME type of picture data from its signature
+func sniffMIMEType(data []byte) string {
+	switch {
+	case len(data) >= 8 && string(data[1:4]) == "PNG":
+		return "image/png"
+	case len(data) >= 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return "image/jpeg"
+	case len(data) >= 6 && string(data[0:3]) == "GIF":
+		return "image/gif"
+	case len(data) >= 2 && string(data[0:2]) == "BM":
+		return "image/bmp"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,237 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testMetadata returns tags using every field, extra keys and two pictures
+func testMetadata() Metadata {
+	m := Metadata{
+		Title:       "Wilhelm Scream",
+		Artist:      "Sheb Wooley",
+		Album:       "Distant Drums",
+		AlbumArtist: "Various Artists",
+		Genre:       "Soundtrack",
+		Date:        "1951",
+		Comment:     "Männer schreien ✓",
+		Composer:    "Max Steiner",
+		Copyright:   "(c) 1951 Warner Bros.",
+		Encoder:     "audiomorph",
+		TrackNumber: 3,
+		TrackTotal:  12,
+		DiscNumber:  1,
+		DiscTotal:   2,
+		Pictures: []Picture{
+			{Type: PictureFrontCover, MIMEType: "image/png", Description: "front", Data: []byte("\x89PNG\r\n\x1a\nfront cover")},
+			{Type: 4, MIMEType: "image/jpeg", Description: "back", Data: []byte("\xFF\xD8\xFF\xE0back cover")},
+		},
+	}
+	m.Set("BPM", "120")
+	m.Set("MY CUSTOM TAG", "custom value")
+	return m
+}
+
+func TestMetadataSetGet(t *testing.T) {
+	var m Metadata
+	m.Set("title", "Title")
+	m.Set("Album Artist", "Album Artist")
+	m.Set("tracknumber", "3/12")
+	m.Set("YEAR", "2024")
+	m.Set("mood", "calm")
+
+	if m.Title != "Title" || m.AlbumArtist != "Album Artist" || m.Date != "2024" {
+		t.Errorf("Unexpected text fields: %+v", m)
+	}
+	if m.TrackNumber != 3 || m.TrackTotal != 12 {
+		t.Errorf("Expected track 3/12, got %d/%d", m.TrackNumber, m.TrackTotal)
+	}
+	if m.Get("MOOD") != "calm" || m.Get("TrackTotal") != "12" {
+		t.Errorf("Unexpected tags: %v", m.Tags())
+	}
+
+	m.Set("mood", "")
+	m.Set("title", "")
+	if m.Get("MOOD") != "" || m.Title != "" || m.IsEmpty() {
+		t.Errorf("Failed to remove tags: %v", m.Tags())
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	expected := testMetadata()
+	for _, ext := range []string{".wav", ".aiff", ".aifc", ".mp3", ".flac", ".wv"} {
+		t.Run(ext, func(t *testing.T) {
+			audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+			if err != nil {
+				t.Fatalf("Failed to decode WAV file: %v", err)
+			}
+			audio.Metadata = testMetadata()
+
+			filename := filepath.Join(os.TempDir(), "test_output_tags"+ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename); err != nil {
+				t.Fatalf("Failed to encode %s: %v", ext, err)
+			}
+
+			decoded, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", ext, err)
+			}
+			if !reflect.DeepEqual(decoded.Metadata.Tags(), expected.Tags()) {
+				t.Errorf("Tags mismatch:\nexpected %v\ngot      %v", expected.Tags(), decoded.Metadata.Tags())
+			}
+			if !reflect.DeepEqual(decoded.Metadata.Pictures, expected.Pictures) {
+				t.Errorf("Pictures mismatch: got %d pictures", len(decoded.Metadata.Pictures))
+			}
+			if len(decoded.Data[0]) == 0 {
+				t.Errorf("Tagged file has no audio")
+			}
+		})
+	}
+}
+
+func TestMetadataConversion(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	flacFile := filepath.Join(os.TempDir(), "test_output_tagged.flac")
+	defer os.Remove(flacFile)
+	if err := EncodeFile(audio, flacFile, OptionMetadata(testMetadata())); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+
+	// Tags follow the audio from FLAC to MP3
+	audio, err = DecodeFile(flacFile)
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	mp3File := filepath.Join(os.TempDir(), "test_output_tagged.mp3")
+	defer os.Remove(mp3File)
+	if err := EncodeFile(audio, mp3File); err != nil {
+		t.Fatalf("Failed to encode MP3 file: %v", err)
+	}
+	decoded, err := DecodeFile(mp3File)
+	if err != nil {
+		t.Fatalf("Failed to decode MP3 file: %v", err)
+	}
+	if decoded.Metadata.Title != "Wilhelm Scream" || len(decoded.Metadata.Pictures) != 2 {
+		t.Errorf("Tags lost in conversion: %v", decoded.Metadata.Tags())
+	}
+
+	// Untagged files keep their audio unchanged when tags are removed
+	if err := writeMetadata(mp3File, Metadata{}); err != nil {
+		t.Fatalf("Failed to remove tags: %v", err)
+	}
+	raw, err := os.ReadFile(mp3File)
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+	if id3v2Size(raw) != 0 {
+		t.Errorf("ID3 tag was not removed")
+	}
+}
+
+func TestRIFFInfo(t *testing.T) {
+	info := []byte("INFO")
+	for _, item := range [][2]string{{"INAM", "Title"}, {"IART", "Artist"}, {"ITRK", "7"}, {"ICMT", "Comment"}, {"IXYZ", "Unknown"}} {
+		chunk := append([]byte(item[1]), 0)
+		info = append(info, item[0]...)
+		info = append(info, byte(len(chunk)), 0, 0, 0)
+		info = append(info, chunk...)
+		if len(chunk)%2 == 1 {
+			info = append(info, 0)
+		}
+	}
+
+	m := riffMetadata([]riffChunk{{id: "LIST", data: info}})
+	if m.Title != "Title" || m.Artist != "Artist" || m.TrackNumber != 7 || m.Comment != "Comment" || m.Get("IXYZ") != "Unknown" {
+		t.Errorf("Unexpected INFO tags: %v", m.Tags())
+	}
+
+	// The written INFO chunk holds the tags INFO can represent
+	written := riffMetadata([]riffChunk{{id: "LIST", data: buildRIFFInfo(testMetadata())}})
+	if written.Title != "Wilhelm Scream" || written.Date != "1951" || written.TrackNumber != 3 || written.AlbumArtist != "" {
+		t.Errorf("Unexpected INFO round trip: %v", written.Tags())
+	}
+}
+
+func TestAIFFTextChunks(t *testing.T) {
+	chunks := []riffChunk{
+		{id: "NAME", data: []byte("Title")},
+		{id: "AUTH", data: []byte("Author")},
+		{id: "ANNO", data: []byte("First")},
+		{id: "ANNO", data: []byte("Second")},
+		{id: "(c) ", data: []byte("Copyright")},
+	}
+	m := aiffMetadata(chunks)
+	if m.Title != "Title" || m.Artist != "Author" || m.Comment != "First; Second" || m.Copyright != "Copyright" {
+		t.Errorf("Unexpected AIFF tags: %v", m.Tags())
+	}
+}
+
+func TestVorbisComment(t *testing.T) {
+	expected := testMetadata()
+	comments, err := parseVorbisComment(buildVorbisComment(expected))
+	if err != nil {
+		t.Fatalf("Failed to parse Vorbis comment: %v", err)
+	}
+	for _, picture := range expected.Pictures {
+		comments = append(comments, [2]string{"METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(buildFLACPicture(picture))})
+	}
+
+	m := vorbisCommentMetadata(comments)
+	if !reflect.DeepEqual(m.Tags(), expected.Tags()) || !reflect.DeepEqual(m.Pictures, expected.Pictures) {
+		t.Errorf("Vorbis comment mismatch: %v", m.Tags())
+	}
+}
+
+func TestOggFLACMetadata(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	flacFile := filepath.Join(os.TempDir(), "test_output_ogg_tags.flac")
+	defer os.Remove(flacFile)
+	if err := EncodeFile(audio, flacFile, OptionMetadata(testMetadata())); err != nil {
+		t.Fatalf("Failed to encode FLAC file: %v", err)
+	}
+	native, err := os.ReadFile(flacFile)
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+
+	filename := writeTestFile(t, "test_output_tags.oga", writeOggPages(1, oggFLACPackets(t, native)))
+	defer os.Remove(filename)
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode Ogg FLAC file: %v", err)
+	}
+	if decoded.Metadata.Title != "Wilhelm Scream" || len(decoded.Metadata.Pictures) != 2 {
+		t.Errorf("Unexpected Ogg FLAC tags: %v", decoded.Metadata.Tags())
+	}
+}
+
+func TestUntaggedFileUnchanged(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	audio.Metadata = Metadata{}
+	filename := filepath.Join(os.TempDir(), "test_output_untagged.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read WAV file: %v", err)
+	}
+	if bytes.Contains(raw, []byte("id3 ")) || bytes.Contains(raw, []byte("LIST")) {
+		t.Errorf("Untagged WAV file contains tag chunks")
+	}
+}
@@ -0,0 +1,119 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// reconcile returns copies of audio values converted to a common format: the highest sample
+// rate, bit depth and number of channels among them. Mono audio is copied to every channel,
+// other audio leaves the channels it lacks silent.
+func reconcile(audios []*Audio) ([]*Audio, error) {
+	if len(audios) == 0 {
+		return nil, fmt.Errorf("no audio given")
+	}
+	var sampleRate, bitDepth, numChannels int
+	for _, audio := range audios {
+		if len(audio.Data) == 0 {
+			return nil, fmt.Errorf("audio has no channels")
+		}
+		sampleRate = max(sampleRate, audio.SampleRate)
+		bitDepth = max(bitDepth, audio.BitDepth)
+		numChannels = max(numChannels, len(audio.Data))
+	}
+
+	reconciled := make([]*Audio, len(audios))
+	for i, audio := range audios {
+		converted := audio.withData(copyData(audio.Data), 0)
+		converted.NumChannels = len(converted.Data)
+		if err := convertSampleRate(converted, sampleRate, converted.interpolationMethod); err != nil {
+			return nil, fmt.Errorf("failed to convert sample rate: %w", err)
+		}
+		if err := convertBitDepth(converted, bitDepth); err != nil {
+			return nil, fmt.Errorf("failed to convert bit depth: %w", err)
+		}
+		for ch := len(converted.Data); ch < numChannels; ch++ {
+			if len(audio.Data) == 1 {
+				converted.Data = append(converted.Data, append([]int(nil), converted.Data[0]...))
+			} else {
+				converted.Data = append(converted.Data, make([]int, converted.numSamples()))
+			}
+		}
+		converted.NumChannels = numChannels
+		reconciled[i] = converted
+	}
+	return reconciled, nil
+}
+
+// Concat joins audio values one after the other, converted to the highest sample rate, bit
+// depth and number of channels among them. The result has the tags of the first and the
+// markers of all of them.
+func Concat(audios ...*Audio) (*Audio, error) {
+	reconciled, err := reconcile(audios)
+	if err != nil {
+		return nil, fmt.Errorf("failed to concatenate: %w", err)
+	}
+
+	total := 0
+	for _, audio := range reconciled {
+		total += audio.numSamples()
+	}
+	data := make([][]int, len(reconciled[0].Data))
+	for ch := range data {
+		data[ch] = make([]int, 0, total)
+		for _, audio := range reconciled {
+			data[ch] = append(data[ch], audio.Data[ch]...)
+		}
+	}
+
+	joined := reconciled[0].withData(data, 0)
+	offset := reconciled[0].numSamples()
+	for _, audio := range reconciled[1:] {
+		joined.Markers = appendMarkers(joined.Markers, audio.Markers, offset, total)
+		offset += audio.numSamples()
+	}
+	return joined, nil
+}
+
+// Mix sums audio values with a gain in dB for each, 0 dB for those without one, clipping the
+// result. They are converted to the highest sample rate, bit depth and number of channels among
+// them, and the result is as long as the longest, with the tags and markers of the first.
+func Mix(audios []*Audio, gains []float64) (*Audio, error) {
+	if len(gains) > len(audios) {
+		return nil, fmt.Errorf("%d gains given for %d audio values", len(gains), len(audios))
+	}
+	reconciled, err := reconcile(audios)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mix: %w", err)
+	}
+
+	length := 0
+	for _, audio := range reconciled {
+		length = max(length, audio.numSamples())
+	}
+	sums := make([][]float64, len(reconciled[0].Data))
+	for ch := range sums {
+		sums[ch] = make([]float64, length)
+	}
+	for i, audio := range reconciled {
+		factor := 1.0
+		if i < len(gains) {
+			factor = math.Pow(10, gains[i]/20)
+		}
+		for ch, samples := range audio.Data {
+			for j, sample := range samples {
+				sums[ch][j] += float64(sample) * factor
+			}
+		}
+	}
+
+	maxValue := fullScale(reconciled[0].BitDepth) - 1
+	data := make([][]int, len(sums))
+	for ch := range sums {
+		data[ch] = make([]int, length)
+		for j, sum := range sums[ch] {
+			data[ch][j] = int(max(-maxValue-1, min(maxValue, math.Round(sum))))
+		}
+	}
+	return reconciled[0].withData(data, 0), nil
+}
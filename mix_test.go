@@ -0,0 +1,78 @@
+package audiomorph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	mono := &Audio{NumChannels: 1, SampleRate: 22050, BitDepth: 16, Data: [][]int{make([]int, 22050)}, Duration: 1}
+	for i := range mono.Data[0] {
+		mono.Data[0][i] = 1000
+	}
+	mono.Markers = []Marker{{ID: 1, Position: 11025, Label: "Mono"}}
+	mono.Metadata.Title = "First"
+	stereo := constantAudio(-2000<<8, 48000)
+	stereo.SampleRate, stereo.BitDepth = 44100, 24
+	stereo.Markers = []Marker{{ID: 1, Position: 100, Label: "Stereo"}}
+	stereo.Metadata.Title = "Second"
+
+	joined, err := Concat(mono, stereo)
+	if err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+	if joined.SampleRate != 44100 || joined.BitDepth != 24 || joined.NumChannels != 2 || len(joined.Data) != 2 {
+		t.Fatalf("Expected 2 channels at 44100 Hz and 24 bits, got %d at %d Hz and %d bits", len(joined.Data), joined.SampleRate, joined.BitDepth)
+	}
+	if n := len(joined.Data[1]); n != 92100 || math.Abs(joined.Duration-92100.0/44100) > 1e-9 {
+		t.Errorf("Expected 92100 samples, got %d", n)
+	}
+	for ch := range joined.Data {
+		if joined.Data[ch][1000] != 1000<<8 || joined.Data[ch][44100] != -2000<<8 {
+			t.Errorf("Unexpected samples on channel %d: %d and %d", ch, joined.Data[ch][1000], joined.Data[ch][44100])
+		}
+	}
+	expected := []Marker{{ID: 1, Position: 22050, Label: "Mono"}, {ID: 2, Position: 44200, Label: "Stereo"}}
+	for i, marker := range joined.Markers {
+		if i >= len(expected) || marker != expected[i] {
+			t.Errorf("Expected markers %+v, got %+v", expected, joined.Markers)
+			break
+		}
+	}
+	if joined.Metadata.Title != "First" || mono.SampleRate != 22050 || len(mono.Data) != 1 || mono.Markers[0].Position != 11025 {
+		t.Errorf("Expected the tags of the first input and the inputs to be left unchanged")
+	}
+
+	if _, err := Concat(); err == nil {
+		t.Errorf("Expected an error for no audio")
+	}
+}
+
+func TestMix(t *testing.T) {
+	a := constantAudio(10000, 4800)
+	b := constantAudio(10000, 9600)
+	b.Data[1] = make([]int, 9600)
+
+	mixed, err := Mix([]*Audio{a, b}, []float64{-6.0206})
+	if err != nil {
+		t.Fatalf("Failed to mix: %v", err)
+	}
+	if len(mixed.Data[0]) != 9600 {
+		t.Fatalf("Expected the mix to be 9600 samples long, got %d", len(mixed.Data[0]))
+	}
+	if mixed.Data[0][0] != 15000 || mixed.Data[1][0] != 5000 || mixed.Data[0][4800] != 10000 || mixed.Data[1][4800] != 0 {
+		t.Errorf("Unexpected mix: %d, %d, %d, %d", mixed.Data[0][0], mixed.Data[1][0], mixed.Data[0][4800], mixed.Data[1][4800])
+	}
+
+	// The sum is clipped at full scale
+	if mixed, err = Mix([]*Audio{constantAudio(30000, 10), constantAudio(30000, 10)}, nil); err != nil {
+		t.Fatalf("Failed to mix: %v", err)
+	}
+	if mixed.Data[0][0] != 32767 {
+		t.Errorf("Expected the mix to clip at 32767, got %d", mixed.Data[0][0])
+	}
+
+	if _, err := Mix([]*Audio{a}, []float64{0, 0}); err == nil {
+		t.Errorf("Expected an error for more gains than audio")
+	}
+}
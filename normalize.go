@@ -0,0 +1,70 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// normalization holds the target of OptionNormalize or OptionNormalizeLoudness
+type normalization struct {
+	loudness bool    // normalize the integrated loudness instead of the sample peak
+	target   float64 // dBFS or LUFS
+	ceiling  float64 // dBTP, for loudness normalization
+}
+
+// OptionNormalize normalizes the sample peak of the audio to a level in dBFS when encoding
+// (e.g. -1), before any bit depth conversion
+func OptionNormalize(peak float64) Option {
+	return func(a *Audio) {
+		a.normalize = &normalization{target: peak}
+	}
+}
+
+// OptionNormalizeLoudness normalizes the integrated loudness of the audio to a target in LUFS
+// when encoding (e.g. -14), before any bit depth conversion. The gain is lowered where needed
+// to keep the true peak at or below the ceiling in dBTP (e.g. -1).
+func OptionNormalizeLoudness(lufs, ceiling float64) Option {
+	return func(a *Audio) {
+		a.normalize = &normalization{loudness: true, target: lufs, ceiling: ceiling}
+	}
+}
+
+// normalizeGain returns the gain in dB that normalizes the audio, and a description of it for
+// the coding history. Silent audio gets no gain.
+func normalizeGain(audio *Audio, n *normalization) (float64, string) {
+	if !n.loudness {
+		peak := amplitudeDB(samplePeak(audio))
+		if math.IsInf(peak, -1) {
+			return 0, ""
+		}
+		return n.target - peak, fmt.Sprintf("normalize peak to %.1f dBFS", n.target)
+	}
+
+	loudness := MeasureLoudness(audio)
+	if math.IsInf(loudness.Integrated, -1) {
+		return 0, ""
+	}
+	gain := n.target - loudness.Integrated
+	description := fmt.Sprintf("normalize to %.1f LUFS", n.target)
+	if limit := n.ceiling - loudness.TruePeak; limit < gain {
+		gain = limit
+		description = fmt.Sprintf("normalize to %.1f LUFS, limited by a %.1f dBTP ceiling", n.target, n.ceiling)
+	}
+	return gain, description
+}
+
+// normalizeAudio applies the normalization configured on the audio, returning the coding
+// history operation. The loudness of a bext chunk is measured again after the gain.
+func normalizeAudio(audio *Audio) string {
+	gain, description := normalizeGain(audio, audio.normalize)
+	if description == "" {
+		return ""
+	}
+	applyGain(audio, gain)
+	if audio.Broadcast != nil {
+		bext := *audio.Broadcast
+		bext.Loudness = MeasureLoudness(audio).BroadcastLoudness()
+		audio.Broadcast = &bext
+	}
+	return fmt.Sprintf("%s (gain %+.2f dB)", description, gain)
+}
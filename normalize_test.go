@@ -0,0 +1,76 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOptionNormalizeLoudness(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "test_output_normalize.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(sineAudio(2, 1000, 0, -20, 5), filename, OptionNormalizeLoudness(-14, -1), OptionBitDepth(24)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	audio, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if loudness := MeasureLoudness(audio); math.Abs(loudness.Integrated+14) > 0.05 || audio.BitDepth != 24 {
+		t.Errorf("Expected -14 LUFS at 24 bits, got %.2f LUFS at %d bits", loudness.Integrated, audio.BitDepth)
+	}
+
+	// The true peak ceiling limits the gain: the peak of a stereo sine is at its loudness
+	if err := EncodeFile(sineAudio(2, 1000, 0, -20, 5), filename, OptionNormalizeLoudness(-5, -6)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if audio, err = DecodeFile(filename); err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	loudness := MeasureLoudness(audio)
+	if loudness.TruePeak > -5.95 || math.Abs(loudness.Integrated+6) > 0.1 {
+		t.Errorf("Expected a -6 dBTP true peak at -6 LUFS, got %.2f dBTP at %.2f LUFS", loudness.TruePeak, loudness.Integrated)
+	}
+}
+
+func TestOptionNormalize(t *testing.T) {
+	audio := sineAudio(1, 1000, 0, -12, 1)
+	audio.Broadcast = &BroadcastExtension{Description: "tone"}
+	filename := filepath.Join(os.TempDir(), "test_output_normalize_peak.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionNormalize(-1)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if peak := amplitudeDB(samplePeak(decoded)); math.Abs(peak+1) > 0.01 {
+		t.Errorf("Expected a -1 dBFS peak, got %.2f", peak)
+	}
+	// The bext loudness is measured after normalizing
+	if decoded.Broadcast == nil || decoded.Broadcast.Loudness == nil || math.Abs(decoded.Broadcast.Loudness.LoudnessValue+4.01) > 0.05 {
+		t.Errorf("Unexpected bext loudness: %+v", decoded.Broadcast)
+	}
+
+	// A second encode does not normalize again, so halved samples stay halved
+	for i := range audio.Data[0] {
+		audio.Data[0][i] /= 2
+	}
+	data := append([]int(nil), audio.Data[0]...)
+	history := append([]string(nil), audio.History...)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if !reflect.DeepEqual(audio.Data[0], data) || !reflect.DeepEqual(audio.History, history) {
+		t.Errorf("Expected no normalization by a second encode, got history %q", audio.History[len(history):])
+	}
+
+	// Silence is left alone
+	silence := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{make([]int, 48000)}}
+	if gain, _ := normalizeGain(silence, &normalization{target: -1}); gain != 0 {
+		t.Errorf("Expected no gain for silence, got %.2f", gain)
+	}
+}
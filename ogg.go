@@ -0,0 +1,331 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/faiface/beep/vorbis"
+	"github.com/mewkiz/flac"
+)
+
+// oggPage is a single page of an Ogg bitstream
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+	body       []byte
+	raw        []byte
+}
+
+// Ogg page header types
+const (
+	oggContinued = 0x1
+	oggBOS       = 0x2
+	oggEOS       = 0x4
+)
+
+// OggStream describes one logical bitstream of an Ogg file
+type OggStream struct {
+	Serial      uint32 // serial number of the logical bitstream
+	Link        int    // index of the chain link the stream belongs to
+	Codec       string // vorbis, flac, opus, speex, theora, skeleton, or unknown
+	NumChannels int    // number of audio channels, 0 for non-audio streams
+	SampleRate  int    // sample rate of audio streams
+	NumSamples  int64  // number of samples per channel, from the last granule position
+}
+
+// IsAudio reports whether the stream holds audio
+func (s OggStream) IsAudio() bool {
+	switch s.Codec {
+	case "vorbis", "flac", "opus", "speex":
+		return true
+	}
+	return false
+}
+
+// OptionOggStream selects which audio stream of a multiplexed or chained Ogg file is decoded,
+// counting audio streams from 0 in the order they begin (default 0).
+func OptionOggStream(index int) Option {
+	return func(a *Audio) {
+		a.oggStream = index
+	}
+}
+
+// readOggPages reads every page of an Ogg file, resynchronizing on the capture pattern after damaged data
+func readOggPages(raw []byte) ([]oggPage, error) {
+	var pages []oggPage
+	pos := 0
+	for {
+		next := bytes.Index(raw[pos:], []byte("OggS"))
+		if next < 0 {
+			break
+		}
+		pos += next
+		if pos+27 > len(raw) {
+			break
+		}
+		header := raw[pos : pos+27]
+		numSegments := int(header[26])
+		if pos+27+numSegments > len(raw) {
+			break
+		}
+		segments := raw[pos+27 : pos+27+numSegments]
+		bodySize := 0
+		for _, size := range segments {
+			bodySize += int(size)
+		}
+		end := pos + 27 + numSegments + bodySize
+		if header[4] != 0 || end > len(raw) {
+			pos++
+			continue
+		}
+		pages = append(pages, oggPage{
+			headerType: header[5],
+			granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+			serial:     binary.LittleEndian.Uint32(header[14:18]),
+			segments:   segments,
+			body:       raw[pos+27+numSegments : end],
+			raw:        raw[pos:end],
+		})
+		pos = end
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("missing Ogg page header")
+	}
+	return pages, nil
+}
+
+// oggPackets joins the segments of a logical stream's pages into packets
+func oggPackets(pages []oggPage, serial uint32) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, page := range pages {
+		if page.serial != serial {
+			continue
+		}
+		if page.headerType&oggContinued == 0 {
+			packet = nil
+		}
+		pos := 0
+		for _, size := range page.segments {
+			packet = append(packet, page.body[pos:pos+int(size)]...)
+			pos += int(size)
+			// A segment shorter than 255 bytes ends the packet
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets
+}
+
+// oggIdentify returns the stream description from the first packet of a logical stream
+func oggIdentify(packet []byte) OggStream {
+	s := OggStream{Codec: "unknown"}
+	switch {
+	case len(packet) >= 30 && string(packet[0:7]) == "\x01vorbis":
+		s.Codec = "vorbis"
+		s.NumChannels = int(packet[11])
+		s.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 51 && string(packet[0:5]) == "\x7fFLAC" && string(packet[9:13]) == "fLaC":
+		// The STREAMINFO block follows the mapping header
+		s.Codec = "flac"
+		info := packet[17:]
+		s.SampleRate = int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+		s.NumChannels = int(info[12]>>1&0x7) + 1
+	case len(packet) >= 19 && string(packet[0:8]) == "OpusHead":
+		// Opus always decodes at 48 kHz
+		s.Codec = "opus"
+		s.NumChannels = int(packet[9])
+		s.SampleRate = 48000
+	case len(packet) >= 52 && string(packet[0:8]) == "Speex   ":
+		s.Codec = "speex"
+		s.SampleRate = int(binary.LittleEndian.Uint32(packet[36:40]))
+		s.NumChannels = int(binary.LittleEndian.Uint32(packet[48:52]))
+	case len(packet) >= 7 && string(packet[0:7]) == "\x80theora":
+		s.Codec = "theora"
+	case len(packet) >= 8 && string(packet[0:8]) == "fishead\x00":
+		s.Codec = "skeleton"
+	}
+	return s
+}
+
+// oggStreams lists the logical streams of a paged Ogg file in the order they begin
+func oggStreams(pages []oggPage) []OggStream {
+	var streams []OggStream
+	index := map[uint32]int{}
+	link := 0
+	open := 0
+	for _, page := range pages {
+		i, ok := index[page.serial]
+		if !ok {
+			// A stream beginning after every earlier stream ended starts a new chain link
+			if len(streams) > 0 && open == 0 {
+				link++
+			}
+			stream := OggStream{Codec: "unknown"}
+			if packets := oggPackets([]oggPage{page}, page.serial); len(packets) > 0 {
+				stream = oggIdentify(packets[0])
+			}
+			stream.Serial = page.serial
+			stream.Link = link
+			streams = append(streams, stream)
+			i = len(streams) - 1
+			index[page.serial] = i
+			open++
+		}
+		if page.granule >= 0 {
+			streams[i].NumSamples = page.granule
+		}
+		if page.headerType&oggEOS != 0 {
+			open--
+		}
+	}
+	return streams
+}
+
+// InspectOgg lists the logical streams of an Ogg file
+func InspectOgg(filename string) ([]OggStream, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OGG file: %w", err)
+	}
+	pages, err := readOggPages(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OGG file: %w", err)
+	}
+	return oggStreams(pages), nil
+}
+
+// decodeOGG decodes the selected audio stream of an Ogg file
+func decodeOGG(filename string, cfg *Audio) (*Audio, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OGG file: %w", err)
+	}
+	pages, err := readOggPages(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OGG file: %w", err)
+	}
+
+	var audioStreams []OggStream
+	for _, stream := range oggStreams(pages) {
+		if stream.IsAudio() {
+			audioStreams = append(audioStreams, stream)
+		}
+	}
+	if len(audioStreams) == 0 {
+		return nil, fmt.Errorf("OGG file has no audio stream")
+	}
+	if cfg.oggStream < 0 || cfg.oggStream >= len(audioStreams) {
+		return nil, fmt.Errorf("OGG audio stream %d does not exist, the file has %d", cfg.oggStream, len(audioStreams))
+	}
+	stream := audioStreams[cfg.oggStream]
+
+	var audio *Audio
+	switch stream.Codec {
+	case "vorbis":
+		audio, err = decodeOggVorbis(pages, stream.Serial)
+	case "flac":
+		audio, err = decodeOggFLAC(pages, stream.Serial)
+	case "opus":
+		audio, err = decodeOggOpus(pages, stream.Serial)
+	default:
+		return nil, fmt.Errorf("unsupported OGG codec: %s", stream.Codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	audio.coding = strings.ToUpper(stream.Codec)
+	return audio, nil
+}
+
+// nopSeekCloser adds a no-op Close to a bytes.Reader, keeping it seekable
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+// Close does nothing
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// decodeOggVorbis decodes one Vorbis stream, passing only its pages to the Vorbis decoder
+func decodeOggVorbis(pages []oggPage, serial uint32) (*Audio, error) {
+	var buf bytes.Buffer
+	for _, page := range pages {
+		if page.serial == serial {
+			buf.Write(page.raw)
+		}
+	}
+
+	streamer, format, err := vorbis.Decode(nopSeekCloser{bytes.NewReader(buf.Bytes())})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode OGG file: %w", err)
+	}
+	defer streamer.Close()
+
+	audio, err := streamToAudio(streamer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// The second header packet holds the Vorbis comments
+	packets := oggPackets(pages, serial)
+	if len(packets) > 1 && bytes.HasPrefix(packets[1], []byte("\x03vorbis")) {
+		if comments, err := parseVorbisComment(packets[1][7:]); err == nil {
+			audio.Metadata = vorbisCommentMetadata(comments)
+			audio.Instrument = loopCommentInstrument(&audio.Metadata)
+		}
+	}
+	return audio, nil
+}
+
+// decodeOggFLAC decodes one FLAC stream by rebuilding the native FLAC stream it maps
+func decodeOggFLAC(pages []oggPage, serial uint32) (*Audio, error) {
+	packets := oggPackets(pages, serial)
+	if len(packets) == 0 || len(packets[0]) < 51 {
+		return nil, fmt.Errorf("invalid Ogg FLAC stream")
+	}
+
+	// The first packet holds the signature and STREAMINFO, further header packets are metadata blocks
+	// and the remaining packets are frames, which start with the frame sync code
+	var blocks [][]byte
+	blocks = append(blocks, packets[0][13:])
+	var frames [][]byte
+	for _, packet := range packets[1:] {
+		if len(packet) >= 2 && packet[0] == 0xFF && packet[1]&0xFE == 0xF8 {
+			frames = append(frames, packet)
+		} else if len(frames) == 0 && len(packet) >= 4 {
+			blocks = append(blocks, packet)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	for i, block := range blocks {
+		// Only the last metadata block carries the last-block flag
+		header := block[0] & 0x7F
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		buf.WriteByte(header)
+		buf.Write(block[1:])
+	}
+	for _, frame := range frames {
+		buf.Write(frame)
+	}
+
+	stream, err := flac.Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Ogg FLAC stream: %w", err)
+	}
+	defer stream.Close()
+
+	return flacStreamToAudio(stream)
+}
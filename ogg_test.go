@@ -0,0 +1,270 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeOggPages packs each packet into its own pages of a logical stream
+func writeOggPages(serial uint32, packets [][]byte) [][]byte {
+	var pages [][]byte
+	sequence := uint32(0)
+	for i, packet := range packets {
+		var lacing []byte
+		for n := len(packet); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+		body := packet
+		continued := false
+		for len(lacing) > 0 {
+			count := min(len(lacing), 255)
+			size := 0
+			for _, l := range lacing[:count] {
+				size += int(l)
+			}
+
+			var headerType byte
+			if continued {
+				headerType |= oggContinued
+			}
+			if i == 0 && !continued {
+				headerType |= oggBOS
+			}
+			if i == len(packets)-1 && count == len(lacing) {
+				headerType |= oggEOS
+			}
+
+			page := []byte("OggS")
+			page = append(page, 0, headerType)
+			page = binary.LittleEndian.AppendUint64(page, uint64(i))
+			page = binary.LittleEndian.AppendUint32(page, serial)
+			page = binary.LittleEndian.AppendUint32(page, sequence)
+			page = binary.LittleEndian.AppendUint32(page, 0)
+			page = append(page, byte(count))
+			page = append(page, lacing[:count]...)
+			page = append(page, body[:size]...)
+			binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+			pages = append(pages, page)
+
+			sequence++
+			lacing = lacing[count:]
+			body = body[size:]
+			continued = true
+		}
+	}
+	return pages
+}
+
+// oggFLACPackets maps a native FLAC file to Ogg FLAC packets
+func oggFLACPackets(t *testing.T, native []byte) [][]byte {
+	t.Helper()
+	if string(native[0:4]) != "fLaC" {
+		t.Fatalf("Not a FLAC file")
+	}
+
+	// Collect the metadata blocks, STREAMINFO first
+	var blocks [][]byte
+	pos := 4
+	for {
+		size := int(native[pos+1])<<16 | int(native[pos+2])<<8 | int(native[pos+3])
+		blocks = append(blocks, native[pos:pos+4+size])
+		last := native[pos]&0x80 != 0
+		pos += 4 + size
+		if last {
+			break
+		}
+	}
+
+	first := []byte{0x7F, 'F', 'L', 'A', 'C', 1, 0}
+	first = binary.BigEndian.AppendUint16(first, uint16(len(blocks)-1))
+	first = append(first, "fLaC"...)
+	first = append(first, blocks[0]...)
+	packets := [][]byte{first}
+	packets = append(packets, blocks[1:]...)
+
+	// Split the frames at each frame sync code
+	frames := native[pos:]
+	start := 0
+	for i := 1; i+1 < len(frames); i++ {
+		if frames[i] == 0xFF && frames[i+1]&0xFE == 0xF8 {
+			packets = append(packets, frames[start:i])
+			start = i
+		}
+	}
+	return append(packets, frames[start:])
+}
+
+// writeTestFile writes pages to a temporary file
+func writeTestFile(t *testing.T, name string, pages [][]byte) string {
+	t.Helper()
+	filename := filepath.Join(os.TempDir(), name)
+	if err := os.WriteFile(filename, bytes.Join(pages, nil), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return filename
+}
+
+// splitOggPages splits an Ogg file into its pages
+func splitOggPages(t *testing.T, filename string) [][]byte {
+	t.Helper()
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", filename, err)
+	}
+	pages, err := readOggPages(raw)
+	if err != nil {
+		t.Fatalf("Failed to read Ogg pages: %v", err)
+	}
+	var out [][]byte
+	for _, page := range pages {
+		out = append(out, page.raw)
+	}
+	return out
+}
+
+func flacTestPages(t *testing.T, serial uint32) [][]byte {
+	t.Helper()
+	native, err := os.ReadFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to read FLAC file: %v", err)
+	}
+	return writeOggPages(serial, oggFLACPackets(t, native))
+}
+
+func TestOggFLAC(t *testing.T) {
+	expected, err := DecodeFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+
+	filename := writeTestFile(t, "test_output_flac.oga", flacTestPages(t, 1234))
+	defer os.Remove(filename)
+
+	audio, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode Ogg FLAC file: %v", err)
+	}
+	if audio.SampleRate != expected.SampleRate || audio.BitDepth != expected.BitDepth {
+		t.Errorf("Format mismatch: expected %d Hz %d bits, got %d Hz %d bits", expected.SampleRate, expected.BitDepth, audio.SampleRate, audio.BitDepth)
+	}
+	assertSamplesEqual(t, expected.Data, audio.Data)
+}
+
+func TestInspectOgg(t *testing.T) {
+	streams, err := InspectOgg(filepath.Join("data", "wilhelm.ogg"))
+	if err != nil {
+		t.Fatalf("Failed to inspect OGG file: %v", err)
+	}
+	if len(streams) != 1 {
+		t.Fatalf("Expected 1 stream, got %d", len(streams))
+	}
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.ogg"))
+	if err != nil {
+		t.Fatalf("Failed to decode OGG file: %v", err)
+	}
+	s := streams[0]
+	if s.Codec != "vorbis" || !s.IsAudio() || s.NumChannels != audio.NumChannels || s.SampleRate != audio.SampleRate {
+		t.Errorf("Unexpected stream: %+v", s)
+	}
+	t.Logf("Stream: %+v", s)
+}
+
+func TestOggMultiplexed(t *testing.T) {
+	vorbisPages := splitOggPages(t, filepath.Join("data", "wilhelm.ogg"))
+	flacPages := flacTestPages(t, 1234)
+
+	// Beginning of stream pages come first, the rest are interleaved
+	pages := [][]byte{flacPages[0], vorbisPages[0]}
+	for i := 1; i < len(flacPages) || i < len(vorbisPages); i++ {
+		if i < len(vorbisPages) {
+			pages = append(pages, vorbisPages[i])
+		}
+		if i < len(flacPages) {
+			pages = append(pages, flacPages[i])
+		}
+	}
+	filename := writeTestFile(t, "test_output_multiplexed.ogg", pages)
+	defer os.Remove(filename)
+
+	streams, err := InspectOgg(filename)
+	if err != nil {
+		t.Fatalf("Failed to inspect OGG file: %v", err)
+	}
+	if len(streams) != 2 || streams[0].Codec != "flac" || streams[1].Codec != "vorbis" || streams[0].Link != 0 || streams[1].Link != 0 {
+		t.Fatalf("Unexpected streams: %+v", streams)
+	}
+
+	expectedFLAC, err := DecodeFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	audio, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode first stream: %v", err)
+	}
+	assertSamplesEqual(t, expectedFLAC.Data, audio.Data)
+
+	expectedVorbis, err := DecodeFile(filepath.Join("data", "wilhelm.ogg"))
+	if err != nil {
+		t.Fatalf("Failed to decode OGG file: %v", err)
+	}
+	audio, err = DecodeFile(filename, OptionOggStream(1))
+	if err != nil {
+		t.Fatalf("Failed to decode second stream: %v", err)
+	}
+	assertSamplesEqual(t, expectedVorbis.Data, audio.Data)
+}
+
+func TestOggChained(t *testing.T) {
+	pages := splitOggPages(t, filepath.Join("data", "wilhelm.ogg"))
+	opus := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	pages = append(pages, writeOggPages(99, [][]byte{opus, []byte("OpusTags")})...)
+	pages = append(pages, flacTestPages(t, 1234)...)
+	filename := writeTestFile(t, "test_output_chained.ogg", pages)
+	defer os.Remove(filename)
+
+	streams, err := InspectOgg(filename)
+	if err != nil {
+		t.Fatalf("Failed to inspect OGG file: %v", err)
+	}
+	if len(streams) != 3 {
+		t.Fatalf("Expected 3 streams, got %d", len(streams))
+	}
+	for i, codec := range []string{"vorbis", "opus", "flac"} {
+		if streams[i].Codec != codec || streams[i].Link != i {
+			t.Errorf("Stream %d: expected %s in link %d, got %+v", i, codec, i, streams[i])
+		}
+	}
+	if streams[1].NumChannels != 2 || streams[1].SampleRate != 48000 {
+		t.Errorf("Unexpected Opus stream: %+v", streams[1])
+	}
+
+	expected, err := DecodeFile(filepath.Join("data", "wilhelm.flac"))
+	if err != nil {
+		t.Fatalf("Failed to decode FLAC file: %v", err)
+	}
+	audio, err := DecodeFile(filename, OptionOggStream(2))
+	if err != nil {
+		t.Fatalf("Failed to decode third stream: %v", err)
+	}
+	assertSamplesEqual(t, expected.Data, audio.Data)
+
+	// The Opus stream holds only its headers
+	audio, err = DecodeFile(filename, OptionOggStream(1))
+	if err != nil {
+		t.Fatalf("Failed to decode second stream: %v", err)
+	}
+	if audio.NumChannels != 2 || audio.SampleRate != 48000 || len(audio.Data[0]) != 0 {
+		t.Errorf("Expected an empty 48 kHz stereo Opus stream, got %d channels, %d Hz, %d samples", audio.NumChannels, audio.SampleRate, len(audio.Data[0]))
+	}
+	if _, err := DecodeFile(filename, OptionOggStream(3)); err == nil {
+		t.Errorf("Expected an error for a missing stream")
+	}
+}
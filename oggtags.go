@@ -0,0 +1,235 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// oggCRC computes the checksum of an Ogg page, whose checksum field is zero
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// buildOggPage builds a page of a logical stream from its lacing values and body
+func buildOggPage(headerType byte, granule int64, serial, sequence uint32, lacing, body []byte) []byte {
+	page := []byte("OggS")
+	page = append(page, 0, headerType)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = binary.LittleEndian.AppendUint32(page, sequence)
+	page = binary.LittleEndian.AppendUint32(page, 0) // checksum
+	page = append(page, byte(len(lacing)))
+	page = append(page, lacing...)
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+	return page
+}
+
+// oggHeaderPages packs header packets into pages, each packet starting a page.
+// The first page begins the stream.
+func oggHeaderPages(serial uint32, packets [][]byte) [][]byte {
+	var pages [][]byte
+	for i, packet := range packets {
+		var lacing []byte
+		for n := len(packet); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+
+		var headerType byte
+		if i == 0 {
+			headerType = oggBOS
+		}
+		for len(lacing) > 0 {
+			count := min(len(lacing), 255)
+			size := 0
+			for _, l := range lacing[:count] {
+				size += int(l)
+			}
+			pages = append(pages, buildOggPage(headerType, 0, serial, uint32(len(pages)), lacing[:count], packet[:size]))
+			lacing, packet = lacing[count:], packet[size:]
+			headerType = oggContinued
+		}
+	}
+	return pages
+}
+
+// buildOggComment builds a Vorbis comment holding the text tags and the pictures, which
+// Ogg streams store as METADATA_BLOCK_PICTURE comments
+func buildOggComment(m Metadata) []byte {
+	fields := m.Tags()
+	for _, picture := range m.Pictures {
+		fields = append(fields, [2]string{"METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(buildFLACPicture(picture))})
+	}
+	return buildVorbisCommentFields(fields)
+}
+
+// readOggMetadata reads the tags of the first logical stream of an Ogg Vorbis, Opus or FLAC file
+func readOggMetadata(raw []byte) (Metadata, error) {
+	pages, err := readOggPages(raw)
+	if err != nil {
+		return Metadata{}, err
+	}
+	packets := oggPackets(pages, pages[0].serial)
+	if len(packets) < 2 {
+		return Metadata{}, fmt.Errorf("missing Ogg header packets")
+	}
+
+	var comment []byte
+	switch packet := packets[1]; {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		comment = packet[7:]
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		comment = packet[8:]
+	case len(packet) >= 4 && packet[0]&0x7F == flacBlockVorbisComment:
+		comment = packet[4:]
+	}
+
+	var m Metadata
+	if comment != nil {
+		comments, err := parseVorbisComment(comment)
+		if err != nil {
+			return m, err
+		}
+		m = vorbisCommentMetadata(comments)
+	}
+
+	// Ogg FLAC may also hold PICTURE blocks
+	for _, packet := range packets[1:] {
+		if len(packet) < 4 || packet[0]&0x7F != flacBlockPicture || oggIdentify(packets[0]).Codec != "flac" {
+			continue
+		}
+		if picture, err := parseFLACPicture(packet[4:]); err == nil {
+			m.Pictures = append(m.Pictures, picture)
+		}
+	}
+	return m, nil
+}
+
+// oggTagHeaders returns the header packets of a logical stream with its comment replaced by
+// the tags, and the number of header packets it had
+func oggTagHeaders(packets [][]byte, m Metadata) ([][]byte, int, error) {
+	switch oggIdentify(packets[0]).Codec {
+	case "vorbis":
+		if len(packets) < 3 {
+			return nil, 0, fmt.Errorf("missing Vorbis header packets")
+		}
+		comment := append([]byte("\x03vorbis"), buildOggComment(m)...)
+		return [][]byte{packets[0], append(comment, 1), packets[2]}, 3, nil
+	case "opus":
+		if len(packets) < 2 {
+			return nil, 0, fmt.Errorf("missing Opus header packets")
+		}
+		return [][]byte{packets[0], append([]byte("OpusTags"), buildOggComment(m)...)}, 2, nil
+	case "flac":
+		// Header packets are metadata blocks, until the first frame
+		count := 1
+		for count < len(packets) && !isFLACFrame(packets[count]) {
+			count++
+		}
+		headers := [][]byte{append([]byte(nil), packets[0]...)}
+		if len(m.Tags()) > 0 {
+			headers = append(headers, oggFLACBlock(flacBlockVorbisComment, buildVorbisComment(m)))
+		}
+		for _, picture := range m.Pictures {
+			headers = append(headers, oggFLACBlock(flacBlockPicture, buildFLACPicture(picture)))
+		}
+		for _, packet := range packets[1:count] {
+			if len(packet) >= 4 && packet[0]&0x7F != flacBlockVorbisComment && packet[0]&0x7F != flacBlockPicture {
+				headers = append(headers, append([]byte(nil), packet...))
+			}
+		}
+
+		// The mapping header counts the header packets after it, and only the last metadata
+		// block, which may be STREAMINFO in the mapping header, is flagged as last
+		binary.BigEndian.PutUint16(headers[0][7:9], uint16(len(headers)-1))
+		headers[0][13] &= 0x7F
+		for _, header := range headers[1:] {
+			header[0] &= 0x7F
+		}
+		if len(headers) == 1 {
+			headers[0][13] |= 0x80
+		} else {
+			headers[len(headers)-1][0] |= 0x80
+		}
+		return headers, count, nil
+	}
+	return nil, 0, fmt.Errorf("tagging is not supported for this Ogg codec")
+}
+
+// isFLACFrame reports whether an Ogg FLAC packet is a frame, which starts with the frame sync code
+func isFLACFrame(packet []byte) bool {
+	return len(packet) >= 2 && packet[0] == 0xFF && packet[1]&0xFE == 0xF8
+}
+
+// oggFLACBlock builds an Ogg FLAC header packet holding one metadata block
+func oggFLACBlock(blockType byte, data []byte) []byte {
+	size := len(data)
+	return append([]byte{blockType, byte(size >> 16), byte(size >> 8), byte(size)}, data...)
+}
+
+// updateOggMetadata replaces the comment header of an Ogg Vorbis, Opus or FLAC file with one
+// logical stream, repaginating the headers and renumbering the audio pages that follow them
+func updateOggMetadata(raw []byte, m Metadata) ([]byte, error) {
+	pages, err := readOggPages(raw)
+	if err != nil {
+		return nil, err
+	}
+	serial := pages[0].serial
+	for _, page := range pages {
+		if page.serial != serial {
+			return nil, fmt.Errorf("tagging multiplexed or chained Ogg files is not supported")
+		}
+	}
+	headers, numHeaders, err := oggTagHeaders(oggPackets(pages, serial), m)
+	if err != nil {
+		return nil, err
+	}
+
+	// The audio starts on the page after the one that ends the last header packet
+	audioStart := -1
+	packets := 0
+	for i, page := range pages {
+		for _, size := range page.segments {
+			if size < 255 {
+				packets++
+			}
+		}
+		if packets >= numHeaders {
+			if packets > numHeaders {
+				return nil, fmt.Errorf("Ogg header packets share a page with audio")
+			}
+			audioStart = i + 1
+			break
+		}
+	}
+	if audioStart < 0 {
+		return nil, fmt.Errorf("truncated Ogg header packets")
+	}
+
+	var out bytes.Buffer
+	headerPages := oggHeaderPages(serial, headers)
+	for _, page := range headerPages {
+		out.Write(page)
+	}
+	for i, page := range pages[audioStart:] {
+		out.Write(buildOggPage(page.headerType, page.granule, serial, uint32(len(headerPages)+i), page.segments, page.body))
+	}
+	return out.Bytes(), nil
+}
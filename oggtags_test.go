@@ -0,0 +1,59 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTagsOgg(t *testing.T) {
+	vorbis, err := os.ReadFile(filepath.Join("data", "wilhelm.ogg"))
+	if err != nil {
+		t.Fatalf("Failed to read Ogg file: %v", err)
+	}
+	for _, tc := range []struct {
+		name  string
+		pages [][]byte
+	}{
+		{"test_output_tags_vorbis.ogg", [][]byte{vorbis}},
+		{"test_output_tags_flac.oga", flacTestPages(t, 99)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := writeTestFile(t, tc.name, tc.pages)
+			defer os.Remove(filename)
+			before, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", tc.name, err)
+			}
+
+			m := testMetadata()
+			m.Set("REPLAYGAIN_TRACK_GAIN", "-6.50 dB")
+			if err := WriteTags(filename, m); err != nil {
+				t.Fatalf("Failed to write tags: %v", err)
+			}
+			read, err := ReadTags(filename)
+			if err != nil {
+				t.Fatalf("Failed to read tags: %v", err)
+			}
+			if !reflect.DeepEqual(read.Tags(), m.Tags()) {
+				t.Errorf("Expected tags %v, got %v", m.Tags(), read.Tags())
+			}
+			if len(read.Pictures) != len(m.Pictures) {
+				t.Errorf("Expected %d pictures, got %d", len(m.Pictures), len(read.Pictures))
+			}
+
+			// Every page of the rewritten file has a valid checksum and sequence number
+			for i, page := range splitOggPages(t, filename) {
+				if got := uint32(page[18]) | uint32(page[19])<<8 | uint32(page[20])<<16 | uint32(page[21])<<24; got != uint32(i) {
+					t.Fatalf("Page %d has sequence number %d", i, got)
+				}
+			}
+			after, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode tagged %s: %v", tc.name, err)
+			}
+			assertSamplesEqual(t, before.Data, after.Data)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pion/opus"
+)
+
+// Opus decoding constants
+const (
+	opusSampleRate    = 48000 // Opus always decodes at 48 kHz
+	opusMaxFrameCount = 5760  // samples per channel in the longest packet, 120 ms
+)
+
+// opusWAVOrder lists, for 3 to 8 channels of mapping family 1, the Vorbis channel order index of
+// each channel in WAV order, so that for 5.1 L C R Ls Rs LFE becomes L R C LFE Ls Rs
+var opusWAVOrder = map[int][]int{
+	3: {0, 2, 1},
+	4: {0, 1, 2, 3},
+	5: {0, 2, 1, 3, 4},
+	6: {0, 2, 1, 5, 3, 4},
+	7: {0, 2, 1, 6, 5, 3, 4},
+	8: {0, 2, 1, 7, 5, 6, 3, 4},
+}
+
+// opusHeader holds the fields of an OpusHead packet (RFC 7845 section 5.1)
+type opusHeader struct {
+	numChannels   int
+	preSkip       int
+	outputGain    int // Q7.8 dB
+	numStreams    int
+	numCoupled    int
+	channelStream []int // stream channel that feeds each output channel, 255 for silence
+}
+
+// parseOpusHead parses an OpusHead packet
+func parseOpusHead(packet []byte) (*opusHeader, error) {
+	if len(packet) < 19 || string(packet[0:8]) != "OpusHead" {
+		return nil, fmt.Errorf("invalid OpusHead packet")
+	}
+	// Only the major version is incompatible
+	if packet[8]>>4 != 0 {
+		return nil, fmt.Errorf("unsupported Opus version: %d", packet[8])
+	}
+	h := &opusHeader{
+		numChannels: int(packet[9]),
+		preSkip:     int(binary.LittleEndian.Uint16(packet[10:12])),
+		outputGain:  int(int16(binary.LittleEndian.Uint16(packet[16:18]))),
+	}
+	if h.numChannels == 0 {
+		return nil, fmt.Errorf("invalid Opus channel count: 0")
+	}
+
+	family := packet[18]
+	if family == 0 {
+		// Mono or stereo in a single stream
+		if h.numChannels > 2 {
+			return nil, fmt.Errorf("invalid Opus channel count for mapping family 0: %d", h.numChannels)
+		}
+		h.numStreams = 1
+		h.numCoupled = h.numChannels - 1
+		h.channelStream = []int{0, 1}[:h.numChannels]
+		return h, nil
+	}
+	if family != 1 && family != 255 {
+		return nil, fmt.Errorf("unsupported Opus channel mapping family: %d", family)
+	}
+	if len(packet) < 21+h.numChannels {
+		return nil, fmt.Errorf("truncated OpusHead packet")
+	}
+	h.numStreams = int(packet[19])
+	h.numCoupled = int(packet[20])
+	if h.numStreams == 0 || h.numCoupled > h.numStreams {
+		return nil, fmt.Errorf("invalid Opus stream count: %d streams, %d coupled", h.numStreams, h.numCoupled)
+	}
+	for _, index := range packet[21 : 21+h.numChannels] {
+		if index != 255 && int(index) >= h.numStreams+h.numCoupled {
+			return nil, fmt.Errorf("invalid Opus channel mapping: %d", index)
+		}
+		h.channelStream = append(h.channelStream, int(index))
+	}
+	if order, ok := opusWAVOrder[h.numChannels]; ok && family == 1 {
+		mapping := h.channelStream
+		h.channelStream = make([]int, h.numChannels)
+		for ch, vorbisChannel := range order {
+			h.channelStream[ch] = mapping[vorbisChannel]
+		}
+	}
+	return h, nil
+}
+
+// opusFrameLength reads a frame length of one or two bytes (RFC 6716 section 3.2.1)
+func opusFrameLength(data []byte, pos int) (int, int, error) {
+	if pos >= len(data) {
+		return 0, 0, fmt.Errorf("truncated Opus packet")
+	}
+	if data[pos] < 252 {
+		return int(data[pos]), pos + 1, nil
+	}
+	if pos+1 >= len(data) {
+		return 0, 0, fmt.Errorf("truncated Opus packet")
+	}
+	return int(data[pos]) + 4*int(data[pos+1]), pos + 2, nil
+}
+
+// splitSelfDelimited splits a self-delimited Opus packet (RFC 6716 appendix B) from the front of
+// data, returning it in the standard framing along with the rest of the data
+func splitSelfDelimited(data []byte) ([]byte, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("truncated Opus packet")
+	}
+	pos := 1
+	frames := 1
+	var lengths, padding int
+	switch data[0] & 0x3 {
+	case 1:
+		frames = 2
+	case 2:
+		// The first frame length is part of the standard framing too
+		length, next, err := opusFrameLength(data, pos)
+		if err != nil {
+			return nil, nil, err
+		}
+		lengths, pos = length, next
+	case 3:
+		if pos >= len(data) {
+			return nil, nil, fmt.Errorf("truncated Opus packet")
+		}
+		count := data[pos]
+		pos++
+		frames = int(count & 0x3F)
+		if frames == 0 {
+			return nil, nil, fmt.Errorf("invalid Opus frame count")
+		}
+		if count&0x40 != 0 {
+			for {
+				if pos >= len(data) {
+					return nil, nil, fmt.Errorf("truncated Opus packet")
+				}
+				b := data[pos]
+				pos++
+				if b < 255 {
+					padding += int(b)
+					break
+				}
+				padding += 254
+			}
+		}
+		if count&0x80 != 0 {
+			// Variable bitrate packets list every frame length but the last
+			for i := 0; i < frames-1; i++ {
+				length, next, err := opusFrameLength(data, pos)
+				if err != nil {
+					return nil, nil, err
+				}
+				lengths += length
+				pos = next
+			}
+			frames = 1
+		}
+	}
+
+	// The self-delimiting length is of the last frame, or of every frame of a constant bitrate packet
+	last, end, err := opusFrameLength(data, pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := lengths + frames*last + padding
+	if end+size > len(data) {
+		return nil, nil, fmt.Errorf("truncated Opus packet")
+	}
+	packet := append(append([]byte(nil), data[:pos]...), data[end:end+size]...)
+	return packet, data[end+size:], nil
+}
+
+// decodeOggOpus decodes one Opus stream at 48 kHz and 16 bits, dropping the pre-skip samples and
+// applying the output gain of the header. Surround channels are put in WAV order.
+func decodeOggOpus(pages []oggPage, serial uint32) (*Audio, error) {
+	packets := oggPackets(pages, serial)
+	if len(packets) < 2 {
+		return nil, fmt.Errorf("invalid Ogg Opus stream")
+	}
+	header, err := parseOpusHead(packets[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Coupled streams decode to stereo, the others to mono
+	decoders := make([]opus.Decoder, header.numStreams)
+	buffers := make([][]float32, header.numStreams)
+	for s := range decoders {
+		channels := 1
+		if s < header.numCoupled {
+			channels = 2
+		}
+		if decoders[s], err = opus.NewDecoderWithOutput(opusSampleRate, channels); err != nil {
+			return nil, fmt.Errorf("failed to create Opus decoder: %w", err)
+		}
+		buffers[s] = make([]float32, opusMaxFrameCount*channels)
+	}
+
+	gain := math.Pow(10, float64(header.outputGain)/(20*256))
+	data := make([][]int, header.numChannels)
+	for _, packet := range packets[2:] {
+		count := 0
+		for s := range decoders {
+			streamPacket := packet
+			if s < header.numStreams-1 {
+				if streamPacket, packet, err = splitSelfDelimited(packet); err != nil {
+					return nil, fmt.Errorf("failed to decode Opus packet: %w", err)
+				}
+			}
+			n, err := decoders[s].DecodeToFloat32(streamPacket, buffers[s])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode Opus packet: %w", err)
+			}
+			if s > 0 && n != count {
+				return nil, fmt.Errorf("failed to decode Opus packet: streams differ in length")
+			}
+			count = n
+		}
+
+		for ch, index := range header.channelStream {
+			for i := 0; i < count; i++ {
+				var value float32
+				switch {
+				case index == 255:
+				case index < 2*header.numCoupled:
+					value = buffers[index/2][2*i+index%2]
+				default:
+					value = buffers[index-header.numCoupled][i]
+				}
+				data[ch] = append(data[ch], clampSample(float64(value)*gain*32768, 16))
+			}
+		}
+	}
+
+	// The last granule position counts the pre-skip and marks where the final packet ends
+	numSamples := len(data[0])
+	for _, page := range pages {
+		if page.serial == serial && page.granule >= 0 && page.headerType&oggEOS != 0 {
+			numSamples = min(numSamples, int(page.granule))
+		}
+	}
+	skip := min(header.preSkip, numSamples)
+	for ch := range data {
+		data[ch] = data[ch][skip:numSamples]
+	}
+
+	audio := &Audio{
+		NumChannels: header.numChannels,
+		SampleRate:  opusSampleRate,
+		BitDepth:    16,
+		Data:        data,
+		Duration:    float64(numSamples-skip) / opusSampleRate,
+	}
+	if bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+		if comments, err := parseVorbisComment(packets[1][8:]); err == nil {
+			audio.Metadata = vorbisCommentMetadata(comments)
+			audio.Instrument = loopCommentInstrument(&audio.Metadata)
+		}
+	}
+	return audio, nil
+}
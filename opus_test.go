@@ -0,0 +1,142 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOggOpus(t *testing.T) {
+	// The files were encoded by libopus from testSignal PCM at 48 kHz, and the WAV files hold
+	// their samples as decoded by libopus, 5.1 in WAV channel order
+	tests := []struct {
+		name        string
+		numChannels int
+		minSNR      float64
+	}{
+		{"opus_stereo", 2, 60}, // CELT at 128 kbit/s
+		{"opus_mono", 1, 45},   // SILK at 12 kbit/s
+		{"opus_51", 6, 60},     // four streams, two of them coupled
+	}
+	for _, tt := range tests {
+		decoded, err := DecodeFile(filepath.Join("data", tt.name+".opus"))
+		if err != nil {
+			t.Fatalf("Failed to decode %s.opus: %v", tt.name, err)
+		}
+		reference, err := DecodeFile(filepath.Join("data", tt.name+".wav"))
+		if err != nil {
+			t.Fatalf("Failed to decode %s.wav: %v", tt.name, err)
+		}
+		if decoded.NumChannels != tt.numChannels || decoded.SampleRate != 48000 || decoded.coding != "OPUS" {
+			t.Fatalf("Format mismatch in %s: got %d channels, %d Hz, coding %s", tt.name, decoded.NumChannels, decoded.SampleRate, decoded.coding)
+		}
+		// Pre-skip and end trimming leave the length of the source
+		if len(decoded.Data[0]) != len(reference.Data[0]) {
+			t.Fatalf("Length mismatch in %s: expected %d, got %d", tt.name, len(reference.Data[0]), len(decoded.Data[0]))
+		}
+		for ch := range reference.Data {
+			var signal, noise float64
+			for i, sample := range reference.Data[ch] {
+				diff := float64(decoded.Data[ch][i] - sample)
+				signal += float64(sample) * float64(sample)
+				noise += diff * diff
+			}
+			snr := 10 * math.Log10(signal/max(noise, 1))
+			if snr < tt.minSNR {
+				t.Errorf("%s channel %d differs from libopus: SNR %.1f dB", tt.name, ch, snr)
+			}
+		}
+	}
+}
+
+func TestOpusOutputGain(t *testing.T) {
+	filename := filepath.Join("data", "opus_stereo.opus")
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode Opus file: %v", err)
+	}
+
+	// Set the output gain of the OpusHead packet on the first page to -6.02 dB
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read Opus file: %v", err)
+	}
+	head := 27 + int(raw[26])
+	if !bytes.Equal(raw[head:head+8], []byte("OpusHead")) {
+		t.Fatalf("First page does not hold the OpusHead packet")
+	}
+	gain := int16(-1541)
+	binary.LittleEndian.PutUint16(raw[head+16:], uint16(gain))
+	binary.LittleEndian.PutUint32(raw[22:26], 0)
+	binary.LittleEndian.PutUint32(raw[22:26], oggCRC(raw[:head+int(raw[27])]))
+	gained, err := DecodeFile(writeTestFile(t, "test_output_gain.opus", [][]byte{raw}))
+	os.Remove(filepath.Join(os.TempDir(), "test_output_gain.opus"))
+	if err != nil {
+		t.Fatalf("Failed to decode Opus file with output gain: %v", err)
+	}
+
+	// -6.02 dB is a factor of 0.50013, off from half by 1 in 4000
+	for ch := range decoded.Data {
+		for i, sample := range decoded.Data[ch] {
+			if abs(2*gained.Data[ch][i]-sample) > 2+abs(sample)/2000 {
+				t.Fatalf("Sample %d of channel %d is %d, expected half of %d", i, ch, gained.Data[ch][i], sample)
+			}
+		}
+	}
+}
+
+func TestSplitSelfDelimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		packet   []byte
+		leftover []byte
+	}{
+		{
+			name:     "one frame",
+			data:     []byte{0x08, 3, 1, 2, 3, 9},
+			packet:   []byte{0x08, 1, 2, 3},
+			leftover: []byte{9},
+		},
+		{
+			name:     "two frames of equal size",
+			data:     []byte{0x09, 2, 1, 2, 3, 4},
+			packet:   []byte{0x09, 1, 2, 3, 4},
+			leftover: []byte{},
+		},
+		{
+			name:     "two frames of different sizes",
+			data:     []byte{0x0A, 1, 2, 1, 2, 3, 9, 9},
+			packet:   []byte{0x0A, 1, 1, 2, 3},
+			leftover: []byte{9, 9},
+		},
+		{
+			name:     "variable bitrate frames with padding",
+			data:     []byte{0x0B, 0xC3, 2, 1, 2, 1, 1, 2, 3, 4, 0, 0, 9},
+			packet:   []byte{0x0B, 0xC3, 2, 1, 2, 1, 2, 3, 4, 0, 0},
+			leftover: []byte{9},
+		},
+		{
+			name:     "constant bitrate frames",
+			data:     []byte{0x0B, 0x03, 2, 1, 2, 3, 4, 5, 6},
+			packet:   []byte{0x0B, 0x03, 1, 2, 3, 4, 5, 6},
+			leftover: []byte{},
+		},
+	}
+	for _, tt := range tests {
+		packet, leftover, err := splitSelfDelimited(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(packet, tt.packet) || !bytes.Equal(leftover, tt.leftover) {
+			t.Errorf("%s: got packet %v and %v left, expected %v and %v", tt.name, packet, leftover, tt.packet, tt.leftover)
+		}
+	}
+
+	if _, _, err := splitSelfDelimited([]byte{0x08, 10, 1, 2}); err == nil {
+		t.Errorf("Expected an error for a truncated packet")
+	}
+}
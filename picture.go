@@ -0,0 +1,101 @@
+package audiomorph
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// pictureExtensions maps picture MIME types to file extensions
+var pictureExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/bmp":  ".bmp",
+}
+
+// ReadPicture reads a JPEG or PNG image file as front cover art
+func ReadPicture(filename string) (Picture, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Picture{}, fmt.Errorf("failed to read picture: %w", err)
+	}
+	mimeType := sniffMIMEType(data)
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return Picture{}, fmt.Errorf("picture is not a JPEG or PNG image: %s", filename)
+	}
+	return Picture{Type: PictureFrontCover, MIMEType: mimeType, Data: data}, nil
+}
+
+// Extension returns the file extension of the picture format, e.g. ".jpg"
+func (p Picture) Extension() string {
+	if ext, ok := pictureExtensions[p.MIMEType]; ok {
+		return ext
+	}
+	if ext, ok := pictureExtensions[sniffMIMEType(p.Data)]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+// Cover returns the front cover, or the first picture if there is no front cover
+func (m *Metadata) Cover() (Picture, bool) {
+	for _, picture := range m.Pictures {
+		if picture.Type == PictureFrontCover {
+			return picture, true
+		}
+	}
+	if len(m.Pictures) > 0 {
+		return m.Pictures[0], true
+	}
+	return Picture{}, false
+}
+
+// SetPicture adds a picture, replacing the pictures of the same type
+func (m *Metadata) SetPicture(picture Picture) {
+	pictures := []Picture{picture}
+	for _, existing := range m.Pictures {
+		if existing.Type != picture.Type {
+			pictures = append(pictures, existing)
+		}
+	}
+	m.Pictures = pictures
+}
+
+// OptionPicture embeds a picture in the tags written with the audio, replacing the pictures
+// of the same type
+func OptionPicture(picture Picture) Option {
+	return func(a *Audio) {
+		a.Metadata.SetPicture(picture)
+	}
+}
+
+// pictureDimensions reads the width, height, color depth in bits per pixel and palette size of
+// a picture, which are 0 for formats that cannot be decoded
+func pictureDimensions(data []byte) (width, height, depth, colors int) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, 0, 0
+	}
+	if palette, ok := config.ColorModel.(color.Palette); ok {
+		return config.Width, config.Height, 8, len(palette)
+	}
+	switch config.ColorModel {
+	case color.GrayModel:
+		depth = 8
+	case color.Gray16Model:
+		depth = 16
+	case color.YCbCrModel:
+		depth = 24
+	case color.RGBA64Model, color.NRGBA64Model:
+		depth = 64
+	default:
+		depth = 32
+	}
+	return config.Width, config.Height, depth, 0
+}
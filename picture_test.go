@@ -0,0 +1,111 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPNG encodes a small RGBA image as PNG
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 5, 3))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadPicture(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "test_output_cover.png")
+	defer os.Remove(filename)
+	if err := os.WriteFile(filename, testPNG(t), 0644); err != nil {
+		t.Fatalf("Failed to write PNG: %v", err)
+	}
+	picture, err := ReadPicture(filename)
+	if err != nil {
+		t.Fatalf("Failed to read picture: %v", err)
+	}
+	if picture.Type != PictureFrontCover || picture.MIMEType != "image/png" || picture.Extension() != ".png" {
+		t.Errorf("Unexpected picture: type %d, %s, %s", picture.Type, picture.MIMEType, picture.Extension())
+	}
+
+	if _, err := ReadPicture(filepath.Join("data", "wilhelm.wav")); err == nil {
+		t.Errorf("Expected an error reading a WAV file as a picture")
+	}
+}
+
+func TestSetPicture(t *testing.T) {
+	m := testMetadata()
+	back := m.Pictures[1]
+	m.SetPicture(Picture{Type: PictureFrontCover, MIMEType: "image/jpeg", Data: []byte("new")})
+	if len(m.Pictures) != 2 || string(m.Pictures[0].Data) != "new" || m.Pictures[1].Description != back.Description {
+		t.Errorf("Unexpected pictures after replacing the front cover: %+v", m.Pictures)
+	}
+	if cover, ok := m.Cover(); !ok || string(cover.Data) != "new" {
+		t.Errorf("Expected the new front cover, got %+v", cover)
+	}
+
+	// Without a front cover the first picture is the cover
+	m.Pictures = []Picture{back}
+	if cover, ok := m.Cover(); !ok || cover.Description != "back" || cover.Extension() != ".jpg" {
+		t.Errorf("Expected the back cover, got %+v", cover)
+	}
+	if _, ok := (&Metadata{}).Cover(); ok {
+		t.Errorf("Expected no cover without pictures")
+	}
+}
+
+func TestFLACPictureDimensions(t *testing.T) {
+	data := buildFLACPicture(Picture{Type: PictureFrontCover, MIMEType: "image/png", Data: testPNG(t)})
+	// The dimensions follow the type, MIME type and empty description
+	offset := 4 + 4 + len("image/png") + 4
+	var fields [4]uint32
+	for i := range fields {
+		fields[i] = binary.BigEndian.Uint32(data[offset+4*i:])
+	}
+	if fields != [4]uint32{5, 3, 32, 0} {
+		t.Errorf("Expected a 5x3 32 bit picture, got %v", fields)
+	}
+	if picture, err := parseFLACPicture(data); err != nil || picture.MIMEType != "image/png" {
+		t.Errorf("Failed to parse the picture block: %v", err)
+	}
+}
+
+func TestOptionPicture(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	cover := Picture{Type: PictureFrontCover, MIMEType: "image/png", Description: "cover", Data: testPNG(t)}
+
+	// The cover art is carried through each conversion
+	source := filepath.Join("data", "wilhelm.wav")
+	for i, ext := range []string{".flac", ".mp3", ".wv", ".aiff", ".wav"} {
+		filename := filepath.Join(os.TempDir(), "test_output_picture"+ext)
+		defer os.Remove(filename)
+		options := []Option{}
+		if i == 0 {
+			options = append(options, OptionPicture(cover))
+		} else if audio, err = DecodeFile(source); err != nil {
+			t.Fatalf("Failed to decode %s: %v", source, err)
+		}
+		if err := EncodeFile(audio, filename, options...); err != nil {
+			t.Fatalf("Failed to encode %s: %v", ext, err)
+		}
+		source = filename
+
+		m, err := ReadTags(filename)
+		if err != nil {
+			t.Fatalf("Failed to read tags of %s: %v", ext, err)
+		}
+		picture, ok := m.Cover()
+		if !ok || len(m.Pictures) != 1 || picture.Type != PictureFrontCover || picture.MIMEType != "image/png" || !bytes.Equal(picture.Data, cover.Data) {
+			t.Errorf("Cover art lost converting to %s: %+v", ext, m.Pictures)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Default raw PCM layout used when no raw options are given (CD audio)
+const (
+	defaultRawFormat     = "s16le"
+	defaultRawChannels   = 2
+	defaultRawSampleRate = 44100
+)
+
+// OptionRawFormat specifies the sample format of headerless PCM data.
+// Valid formats are: "s8", "u8", "s16", "u16", "s24", "u24", "s32", "u32", "f32", "f64",
+// optionally suffixed with the byte order, e.g. "s16le", "s16be" or "f32le".
+// Formats without a suffix use the byte order from OptionRawEndianness (little endian by default).
+func OptionRawFormat(format string) Option {
+	return func(a *Audio) {
+		a.rawFormat = format
+	}
+}
+
+// OptionRawEndianness specifies the byte order of headerless PCM data ("le" or "be").
+func OptionRawEndianness(endianness string) Option {
+	return func(a *Audio) {
+		a.rawEndianness = endianness
+	}
+}
+
+// OptionRawChannels specifies the number of interleaved channels when decoding headerless PCM data.
+func OptionRawChannels(channels int) Option {
+	return func(a *Audio) {
+		a.rawChannels = channels
+	}
+}
+
+// OptionRawSampleRate specifies the sample rate when decoding headerless PCM data.
+func OptionRawSampleRate(sampleRate int) Option {
+	return func(a *Audio) {
+		a.rawSampleRate = sampleRate
+	}
+}
+
+// rawSpec describes the layout of a single headerless PCM sample
+type rawSpec struct {
+	bits      int
+	float     bool
+	unsigned  bool
+	bigEndian bool
+}
+
+// bytesPerSample returns the size of one sample in bytes
+func (s rawSpec) bytesPerSample() int {
+	return s.bits / 8
+}
+
+// String returns the canonical name of the raw format, e.g. "s16le"
+func (s rawSpec) String() string {
+	kind := "s"
+	if s.float {
+		kind = "f"
+	} else if s.unsigned {
+		kind = "u"
+	}
+	if s.bits == 8 {
+		return fmt.Sprintf("%s%d", kind, s.bits)
+	}
+	order := "le"
+	if s.bigEndian {
+		order = "be"
+	}
+	return fmt.Sprintf("%s%d%s", kind, s.bits, order)
+}
+
+// parseRawFormat parses a raw sample format name and byte order into a rawSpec
+func parseRawFormat(format, endianness string) (rawSpec, error) {
+	var spec rawSpec
+	name := strings.ToLower(strings.TrimSpace(format))
+
+	// Resolve the byte order, a suffix on the format name must agree with the explicit option
+	order := strings.ToLower(strings.TrimSpace(endianness))
+	switch order {
+	case "", "le", "little":
+		order = "le"
+	case "be", "big":
+		order = "be"
+	default:
+		return spec, fmt.Errorf("unsupported raw endianness: %s (must be le or be)", endianness)
+	}
+	if strings.HasSuffix(name, "le") || strings.HasSuffix(name, "be") {
+		suffix := name[len(name)-2:]
+		if endianness != "" && suffix != order {
+			return spec, fmt.Errorf("raw format %s conflicts with endianness %s", format, endianness)
+		}
+		order = suffix
+		name = name[:len(name)-2]
+	}
+	spec.bigEndian = order == "be"
+
+	if len(name) < 2 {
+		return spec, fmt.Errorf("unsupported raw format: %s", format)
+	}
+	bits, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return spec, fmt.Errorf("unsupported raw format: %s", format)
+	}
+	spec.bits = bits
+
+	switch name[0] {
+	case 's', 'u':
+		spec.unsigned = name[0] == 'u'
+		if bits != 8 && bits != 16 && bits != 24 && bits != 32 {
+			return spec, fmt.Errorf("unsupported raw format: %s (integer samples must be 8, 16, 24, or 32 bits)", format)
+		}
+	case 'f':
+		spec.float = true
+		if bits != 32 && bits != 64 {
+			return spec, fmt.Errorf("unsupported raw format: %s (float samples must be 32 or 64 bits)", format)
+		}
+	default:
+		return spec, fmt.Errorf("unsupported raw format: %s", format)
+	}
+
+	return spec, nil
+}
+
+// rawLayout returns the raw sample format, channel count and sample rate configured on an Audio,
+// falling back to the defaults for anything that was not specified
+func rawLayout(a *Audio) (rawSpec, int, int, error) {
+	format := a.rawFormat
+	if format == "" {
+		format = defaultRawFormat
+	}
+	spec, err := parseRawFormat(format, a.rawEndianness)
+	if err != nil {
+		return spec, 0, 0, err
+	}
+
+	channels := a.rawChannels
+	if channels == 0 {
+		channels = defaultRawChannels
+	}
+	sampleRate := a.rawSampleRate
+	if sampleRate == 0 {
+		sampleRate = defaultRawSampleRate
+	}
+	if channels < 0 {
+		return spec, 0, 0, fmt.Errorf("invalid raw channel count: %d", channels)
+	}
+	if sampleRate < 0 {
+		return spec, 0, 0, fmt.Errorf("invalid raw sample rate: %d", sampleRate)
+	}
+
+	return spec, channels, sampleRate, nil
+}
+
+// DecodeRaw decodes headerless interleaved PCM data from a reader (e.g. os.Stdin).
+// The layout is described with OptionRawFormat, OptionRawEndianness, OptionRawChannels and OptionRawSampleRate.
+func DecodeRaw(r io.Reader, options ...Option) (*Audio, error) {
+	cfg := &Audio{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	audio, err := decodeRaw(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		option(audio)
+	}
+
+	return audio, nil
+}
+
+// decodeRawFile decodes a headerless PCM file
+func decodeRawFile(filename string, cfg *Audio) (*Audio, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raw file: %w", err)
+	}
+	defer f.Close()
+
+	return decodeRaw(f, cfg)
+}
+
+// decodeRaw decodes headerless PCM data using the raw layout configured on cfg
+func decodeRaw(r io.Reader, cfg *Audio) (*Audio, error) {
+	spec, numChannels, sampleRate, err := rawLayout(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw data: %w", err)
+	}
+
+	// Trailing bytes that do not make up a whole frame are dropped
+	frameSize := spec.bytesPerSample() * numChannels
+	numSamples := len(raw) / frameSize
+	if numSamples == 0 {
+		return nil, fmt.Errorf("raw data is shorter than one %s frame", spec)
+	}
+
+	// Float samples are scaled to 32-bit integers
+	bitDepth := spec.bits
+	if spec.float {
+		bitDepth = 32
+	}
+
+	// Deinterlace raw data into [][]int
+	data := deinterlace(decodeSamples(raw[:numSamples*frameSize], spec), numChannels)
+
+	// Calculate duration
+	duration := float64(numSamples) / float64(sampleRate)
+
+	return &Audio{
+		NumChannels: numChannels,
+		SampleRate:  sampleRate,
+		BitDepth:    bitDepth,
+		Data:        data,
+		Duration:    duration,
+	}, nil
+}
+
+// byteOrder returns the byte order of the sample layout
+func (s rawSpec) byteOrder() binary.ByteOrder {
+	if s.bigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// decodeSamples decodes packed samples of the given layout to signed integers.
+// Integer samples keep their bit depth; float samples are scaled to 32-bit integers.
+func decodeSamples(data []byte, spec rawSpec) []int {
+	order := spec.byteOrder()
+	size := spec.bytesPerSample()
+	fullScale := float64(int64(1) << 31)
+
+	samples := make([]int, len(data)/size)
+	for i := range samples {
+		b := data[i*size : (i+1)*size]
+		switch {
+		case spec.float && spec.bits == 32:
+			samples[i] = clampSample(float64(math.Float32frombits(order.Uint32(b)))*fullScale, 32)
+		case spec.float:
+			samples[i] = clampSample(math.Float64frombits(order.Uint64(b))*fullScale, 32)
+		default:
+			samples[i] = readRawInt(b, spec, order)
+		}
+	}
+	return samples
+}
+
+// encodeSamples packs signed integer samples at the given bit depth into the given layout.
+// Integer layouts must match the bit depth; float layouts are scaled from it.
+func encodeSamples(samples []int, bitDepth int, spec rawSpec) []byte {
+	order := spec.byteOrder()
+	size := spec.bytesPerSample()
+	fullScale := float64(int64(1) << uint(bitDepth-1))
+
+	out := make([]byte, len(samples)*size)
+	for i, sample := range samples {
+		b := out[i*size : (i+1)*size]
+		switch {
+		case spec.float && spec.bits == 32:
+			order.PutUint32(b, math.Float32bits(float32(float64(sample)/fullScale)))
+		case spec.float:
+			order.PutUint64(b, math.Float64bits(float64(sample)/fullScale))
+		default:
+			writeRawInt(b, sample, spec, order)
+		}
+	}
+	return out
+}
+
+// readRawInt reads a single signed or unsigned integer sample and returns it as a signed value
+func readRawInt(b []byte, spec rawSpec, order binary.ByteOrder) int {
+	var u uint32
+	switch spec.bits {
+	case 8:
+		u = uint32(b[0])
+	case 16:
+		u = uint32(order.Uint16(b))
+	case 24:
+		if spec.bigEndian {
+			u = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		} else {
+			u = uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+		}
+	case 32:
+		u = order.Uint32(b)
+	}
+
+	if spec.unsigned {
+		return int(int64(u) - int64(1)<<uint(spec.bits-1))
+	}
+	// Sign extend
+	shift := uint(32 - spec.bits)
+	return int(int32(u<<shift) >> shift)
+}
+
+// writeRawInt writes a signed sample as a signed or unsigned integer
+func writeRawInt(b []byte, sample int, spec rawSpec, order binary.ByteOrder) {
+	u := uint32(sample)
+	if spec.unsigned {
+		u = uint32(int64(sample) + int64(1)<<uint(spec.bits-1))
+	}
+
+	switch spec.bits {
+	case 8:
+		b[0] = byte(u)
+	case 16:
+		order.PutUint16(b, uint16(u))
+	case 24:
+		if spec.bigEndian {
+			b[0], b[1], b[2] = byte(u>>16), byte(u>>8), byte(u)
+		} else {
+			b[0], b[1], b[2] = byte(u), byte(u>>8), byte(u>>16)
+		}
+	case 32:
+		order.PutUint32(b, u)
+	}
+}
+
+// clampSample rounds a sample value and clamps it to the range of the given bit depth
+func clampSample(value float64, bitDepth int) int {
+	maxVal := float64(int64(1)<<uint(bitDepth-1) - 1)
+	minVal := -float64(int64(1) << uint(bitDepth-1))
+
+	value = math.Round(value)
+	if value > maxVal {
+		return int(maxVal)
+	}
+	if value < minVal {
+		return int(minVal)
+	}
+	return int(value)
+}
+
+// EncodeRaw encodes audio as headerless interleaved PCM data to a writer (e.g. os.Stdout).
+// Without OptionRawFormat, samples are written as signed little endian integers at the audio's bit depth.
+func EncodeRaw(audio *Audio, w io.Writer, options ...Option) error {
+	row, err := prepareEncode(audio, ".raw", options)
+	if err != nil {
+		return err
+	}
+
+	if err := encodeRaw(audio, w); err != nil {
+		return err
+	}
+	audio.History = withHistoryRow(audio, row).History
+	return nil
+}
+
+// encodeRawFile encodes audio data to a headerless PCM file
+func encodeRawFile(audio *Audio, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create raw file: %w", err)
+	}
+	defer f.Close()
+
+	return encodeRaw(audio, f)
+}
+
+// encodeRaw writes audio data as headerless interleaved PCM
+func encodeRaw(audio *Audio, w io.Writer) error {
+	spec, err := rawOutputSpec(audio)
+	if err != nil {
+		return err
+	}
+
+	samples, _ := interlace(audio)
+	if _, err := w.Write(encodeSamples(samples, audio.BitDepth, spec)); err != nil {
+		return fmt.Errorf("failed to write raw data: %w", err)
+	}
+
+	return nil
+}
+
+// rawOutputSpec returns the raw sample format to write, defaulting to signed integers at the
+// bit depth being encoded, rounded up to whole bytes
+func rawOutputSpec(audio *Audio) (rawSpec, error) {
+	format := audio.rawFormat
+	if format == "" {
+		bitDepth := audio.BitDepth
+		if audio.targetBitDepth > 0 {
+			bitDepth = audio.targetBitDepth
+		}
+		format = fmt.Sprintf("s%d", (bitDepth+7)/8*8)
+	}
+	return parseRawFormat(format, audio.rawEndianness)
+}
@@ -0,0 +1,187 @@
+package audiomorph
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRawRoundTrip(t *testing.T) {
+	// Decode an existing audio file
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+	audio, err := DecodeFile(srcFilename)
+	if err != nil {
+		t.Fatalf("Failed to decode source file: %v", err)
+	}
+
+	testCases := []struct {
+		format   string
+		bitDepth int
+	}{
+		{"s8", 8},
+		{"u8", 8},
+		{"s16le", 16},
+		{"s16be", 16},
+		{"s24le", 24},
+		{"s32le", 32},
+		{"f32le", 32},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			// Decode fresh audio for each test
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_raw_"+tc.format+".raw")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, OptionRawFormat(tc.format))
+			if err != nil {
+				t.Fatalf("Failed to encode raw file: %v", err)
+			}
+
+			// Verify the file size matches the sample format
+			info, err := os.Stat(dstFilename)
+			if err != nil {
+				t.Fatalf("Encoded raw file was not created: %v", err)
+			}
+			expectedSize := int64(len(audio.Data[0]) * audio.NumChannels * tc.bitDepth / 8)
+			if info.Size() != expectedSize {
+				t.Errorf("File size mismatch: expected %d, got %d", expectedSize, info.Size())
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename,
+				OptionRawFormat(tc.format),
+				OptionRawChannels(audio.NumChannels),
+				OptionRawSampleRate(audio.SampleRate))
+			if err != nil {
+				t.Fatalf("Failed to decode raw file: %v", err)
+			}
+
+			if decodedAudio.NumChannels != audio.NumChannels {
+				t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+			}
+			if decodedAudio.SampleRate != audio.SampleRate {
+				t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+			}
+			if decodedAudio.BitDepth != tc.bitDepth {
+				t.Errorf("BitDepth mismatch: expected %d, got %d", tc.bitDepth, decodedAudio.BitDepth)
+			}
+
+			// Float samples come back as 32-bit integers, so scale the source to compare
+			scale := 1 << uint(decodedAudio.BitDepth-audio.BitDepth)
+			for ch := 0; ch < audio.NumChannels; ch++ {
+				for i := range audio.Data[ch] {
+					if decodedAudio.Data[ch][i] != audio.Data[ch][i]*scale {
+						t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d",
+							ch, i, audio.Data[ch][i]*scale, decodedAudio.Data[ch][i])
+					}
+				}
+			}
+		})
+	}
+
+	t.Logf("Raw round trip test passed for %d channels at %d Hz", audio.NumChannels, audio.SampleRate)
+}
+
+func TestRawKnownBytes(t *testing.T) {
+	testCases := []struct {
+		format   string
+		raw      []byte
+		expected []int
+	}{
+		{"s8", []byte{0x80, 0x00, 0x7f}, []int{-128, 0, 127}},
+		{"u8", []byte{0x00, 0x80, 0xff}, []int{-128, 0, 127}},
+		{"s16le", []byte{0x00, 0x80, 0x01, 0x00, 0xff, 0x7f}, []int{-32768, 1, 32767}},
+		{"s16be", []byte{0x80, 0x00, 0x00, 0x01, 0x7f, 0xff}, []int{-32768, 1, 32767}},
+		{"s24le", []byte{0x00, 0x00, 0x80, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, []int{-8388608, -1, 8388607}},
+		{"s32le", []byte{0x00, 0x00, 0x00, 0x80, 0x02, 0x00, 0x00, 0x00}, []int{-2147483648, 2}},
+		{"f32le", []byte{0x00, 0x00, 0x80, 0xbf, 0x00, 0x00, 0x00, 0x3f}, []int{-2147483648, 1073741824}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			audio, err := DecodeRaw(bytes.NewReader(tc.raw),
+				OptionRawFormat(tc.format),
+				OptionRawChannels(1),
+				OptionRawSampleRate(8000))
+			if err != nil {
+				t.Fatalf("Failed to decode raw data: %v", err)
+			}
+
+			if len(audio.Data[0]) != len(tc.expected) {
+				t.Fatalf("Sample count mismatch: expected %d, got %d", len(tc.expected), len(audio.Data[0]))
+			}
+			for i, expected := range tc.expected {
+				if audio.Data[0][i] != expected {
+					t.Errorf("Sample mismatch at index %d: expected %d, got %d", i, expected, audio.Data[0][i])
+				}
+			}
+
+			// Encoding the decoded samples must reproduce the original bytes
+			var buf bytes.Buffer
+			if err := EncodeRaw(audio, &buf); err != nil {
+				t.Fatalf("Failed to encode raw data: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tc.raw) {
+				t.Errorf("Raw bytes mismatch: expected %x, got %x", tc.raw, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestRawEndiannessOption(t *testing.T) {
+	raw := []byte{0x12, 0x34}
+
+	audio, err := DecodeRaw(bytes.NewReader(raw),
+		OptionRawFormat("s16"),
+		OptionRawEndianness("be"),
+		OptionRawChannels(1))
+	if err != nil {
+		t.Fatalf("Failed to decode raw data: %v", err)
+	}
+	if audio.Data[0][0] != 0x1234 {
+		t.Errorf("Expected big endian sample 0x1234, got %#x", audio.Data[0][0])
+	}
+
+	// A suffix that contradicts the explicit byte order is rejected
+	_, err = DecodeRaw(bytes.NewReader(raw), OptionRawFormat("s16le"), OptionRawEndianness("be"))
+	if err == nil {
+		t.Fatal("Expected error for conflicting endianness, got nil")
+	}
+}
+
+func TestRaw20Bit(t *testing.T) {
+	// 20-bit audio, as decoded from FLAC or WavPack, is written as 24-bit samples by default
+	audio := &Audio{NumChannels: 2, SampleRate: 44100, BitDepth: 20, Data: testSignal(2, 1000, 20)}
+	filename := filepath.Join(os.TempDir(), "test_raw_20bit.raw")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode raw file: %v", err)
+	}
+
+	decoded, err := DecodeFile(filename, OptionRawFormat("s24le"), OptionRawChannels(2), OptionRawSampleRate(44100))
+	if err != nil {
+		t.Fatalf("Failed to decode raw file: %v", err)
+	}
+	expected := testSignal(2, 1000, 20)
+	for ch := range expected {
+		for i := range expected[ch] {
+			expected[ch][i] <<= 4
+		}
+	}
+	assertSamplesEqual(t, expected, decoded.Data)
+}
+
+func TestInvalidRawFormat(t *testing.T) {
+	for _, format := range []string{"s12", "f16", "x16le", "s"} {
+		_, err := DecodeRaw(bytes.NewReader([]byte{0, 0, 0, 0}), OptionRawFormat(format))
+		if err == nil {
+			t.Errorf("Expected error for raw format %q, got nil", format)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ReplayGainReference is the ReplayGain 2.0 reference loudness in LUFS
+const ReplayGainReference = -18.0
+
+// ReplayGain holds the ReplayGain 2.0 gains and peaks of a track. The gains bring the
+// integrated EBU R128 loudness of the track or its album to the reference loudness.
+type ReplayGain struct {
+	TrackGain float64 // in dB
+	TrackPeak float64 // sample peak, 1 is full scale
+	AlbumGain float64 // in dB
+	AlbumPeak float64
+}
+
+// replayGainTags lists the tag keys of the ReplayGain values
+var replayGainTags = []string{
+	"REPLAYGAIN_TRACK_GAIN",
+	"REPLAYGAIN_TRACK_PEAK",
+	"REPLAYGAIN_ALBUM_GAIN",
+	"REPLAYGAIN_ALBUM_PEAK",
+}
+
+// replayGain returns the gain that brings a loudness to the reference loudness. Audio that is
+// silent or too short to measure gets no gain.
+func replayGain(loudness float64) float64 {
+	if math.IsInf(loudness, -1) {
+		return 0
+	}
+	return ReplayGainReference - loudness
+}
+
+// TrackReplayGain analyzes a single track, whose album values are its track values
+func TrackReplayGain(audio *Audio) ReplayGain {
+	gain := replayGain(gatedLoudness(gatingBlocks(audio)))
+	peak := samplePeak(audio)
+	return ReplayGain{TrackGain: gain, TrackPeak: peak, AlbumGain: gain, AlbumPeak: peak}
+}
+
+// AlbumReplayGain analyzes the tracks of an album. The album gain is measured over the
+// gating blocks of every track together, the album peak is the largest track peak.
+func AlbumReplayGain(tracks []*Audio) []ReplayGain {
+	gains := make([]ReplayGain, len(tracks))
+	var albumBlocks []float64
+	var albumPeak float64
+	for i, track := range tracks {
+		blocks := gatingBlocks(track)
+		albumBlocks = append(albumBlocks, blocks...)
+		gains[i].TrackGain = replayGain(gatedLoudness(blocks))
+		gains[i].TrackPeak = samplePeak(track)
+		albumPeak = max(albumPeak, gains[i].TrackPeak)
+	}
+
+	albumGain := replayGain(gatedLoudness(albumBlocks))
+	for i := range gains {
+		gains[i].AlbumGain = albumGain
+		gains[i].AlbumPeak = albumPeak
+	}
+	return gains
+}
+
+// SetTags sets the REPLAYGAIN_* tags, which are written as Vorbis comments, APEv2 items,
+// and as TXXX and RVA2 frames in ID3v2 tags
+func (rg ReplayGain) SetTags(m *Metadata) {
+	m.Set("REPLAYGAIN_TRACK_GAIN", formatReplayGain(rg.TrackGain))
+	m.Set("REPLAYGAIN_TRACK_PEAK", strconv.FormatFloat(rg.TrackPeak, 'f', 6, 64))
+	m.Set("REPLAYGAIN_ALBUM_GAIN", formatReplayGain(rg.AlbumGain))
+	m.Set("REPLAYGAIN_ALBUM_PEAK", strconv.FormatFloat(rg.AlbumPeak, 'f', 6, 64))
+}
+
+// ReadReplayGain reads the REPLAYGAIN_* tags, reporting whether a track gain is set
+func ReadReplayGain(m *Metadata) (ReplayGain, bool) {
+	var rg ReplayGain
+	values := []*float64{&rg.TrackGain, &rg.TrackPeak, &rg.AlbumGain, &rg.AlbumPeak}
+	for i, key := range replayGainTags {
+		value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m.Get(key)), "dB"))
+		*values[i], _ = strconv.ParseFloat(value, 64)
+	}
+	return rg, m.Get("REPLAYGAIN_TRACK_GAIN") != ""
+}
+
+// formatReplayGain formats a gain as ReplayGain tags store it, e.g. "-6.23 dB"
+func formatReplayGain(gain float64) string {
+	return fmt.Sprintf("%+.2f dB", gain)
+}
+
+// rva2Gain reads the master volume adjustment and peak of an RVA2 frame
+func rva2Gain(data []byte) (identification string, gain, peak float64, ok bool) {
+	end := 0
+	for end < len(data) && data[end] != 0 {
+		end++
+	}
+	identification = string(data[:end])
+	data = data[min(end+1, len(data)):]
+
+	// Each channel has a type, a gain in 1/512 dB and a peak of a given number of bits
+	for len(data) >= 4 {
+		channel := data[0]
+		adjustment := int16(uint16(data[1])<<8 | uint16(data[2]))
+		bits := int(data[3])
+		size := (bits + 7) / 8
+		if 4+size > len(data) {
+			break
+		}
+		if channel == 1 {
+			var value uint64
+			for _, b := range data[4 : 4+size] {
+				value = value<<8 | uint64(b)
+			}
+			if bits > 0 {
+				peak = float64(value) / float64(uint64(1)<<uint(bits-1))
+			}
+			return identification, float64(adjustment) / 512, peak, true
+		}
+		data = data[4+size:]
+	}
+	return identification, 0, 0, false
+}
+
+// buildRVA2 builds an RVA2 frame body with the master volume adjustment and a 16 bit peak
+func buildRVA2(identification string, gain, peak float64) []byte {
+	adjustment := int16(max(math.MinInt16, min(math.MaxInt16, math.Round(gain*512))))
+	peakValue := uint16(min(math.MaxUint16, math.Round(peak*(1<<15))))
+	data := append([]byte(identification), 0, 1)
+	data = append(data, byte(uint16(adjustment)>>8), byte(adjustment))
+	return append(data, 16, byte(peakValue>>8), byte(peakValue))
+}
@@ -0,0 +1,122 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sineAudio generates a 48 kHz sine on every channel at a frequency, phase and level in dBFS
+func sineAudio(channels int, frequency, phase, level, seconds float64) *Audio {
+	const sampleRate = 48000
+	amplitude := math.Pow(10, level/20) * 32767
+	data := make([][]int, channels)
+	for c := range data {
+		data[c] = make([]int, int(seconds*sampleRate))
+		for i := range data[c] {
+			data[c][i] = int(math.Round(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/sampleRate+phase)))
+		}
+	}
+	return &Audio{SampleRate: sampleRate, BitDepth: 16, NumChannels: channels, Data: data}
+}
+
+func TestLoudnessSine(t *testing.T) {
+	// A full scale 1 kHz sine on one channel reads -3.01 LUFS, so a -20 dBFS sine reads -23.01
+	// LUFS on one channel and 3.01 LU more on two
+	for _, tc := range []struct {
+		channels int
+		expected float64
+	}{
+		{1, -23.01},
+		{2, -20.0},
+	} {
+		loudness := gatedLoudness(gatingBlocks(sineAudio(tc.channels, 1000, 0, -20, 5)))
+		if math.Abs(loudness-tc.expected) > 0.1 {
+			t.Errorf("Expected %.2f LUFS for %d channels, got %.2f", tc.expected, tc.channels, loudness)
+		}
+	}
+
+	if loudness := gatedLoudness(gatingBlocks(sineAudio(1, 1000, 0, -20, 0.2))); !math.IsInf(loudness, -1) {
+		t.Errorf("Expected no loudness for audio shorter than a gating block, got %.2f", loudness)
+	}
+}
+
+func TestAlbumReplayGain(t *testing.T) {
+	quiet, loud := sineAudio(2, 1000, 0, -30, 5), sineAudio(2, 1000, 0, -10, 5)
+	gains := AlbumReplayGain([]*Audio{quiet, loud})
+
+	if math.Abs(gains[0].TrackGain-12) > 0.1 || math.Abs(gains[1].TrackGain+8) > 0.1 {
+		t.Errorf("Expected track gains of +12 and -8 dB, got %+.2f and %+.2f", gains[0].TrackGain, gains[1].TrackGain)
+	}
+	// The quiet track is gated out relative to the loud one
+	if gains[0].AlbumGain != gains[1].AlbumGain || math.Abs(gains[0].AlbumGain+8) > 0.1 {
+		t.Errorf("Expected an album gain of -8 dB, got %+.2f and %+.2f", gains[0].AlbumGain, gains[1].AlbumGain)
+	}
+	if math.Abs(gains[0].AlbumPeak-gains[1].TrackPeak) > 1e-9 || math.Abs(gains[1].TrackPeak-math.Pow(10, -0.5)) > 1e-3 {
+		t.Errorf("Unexpected peaks: %+v", gains)
+	}
+
+	track := TrackReplayGain(quiet)
+	if track.TrackGain != gains[0].TrackGain || track.AlbumGain != track.TrackGain {
+		t.Errorf("Unexpected track analysis: %+v", track)
+	}
+}
+
+func TestReplayGainTags(t *testing.T) {
+	rg := ReplayGain{TrackGain: -6.234, TrackPeak: 0.98765, AlbumGain: 1.5, AlbumPeak: 1}
+	var m Metadata
+	rg.SetTags(&m)
+	if m.Get("REPLAYGAIN_TRACK_GAIN") != "-6.23 dB" || m.Get("REPLAYGAIN_ALBUM_GAIN") != "+1.50 dB" || m.Get("REPLAYGAIN_TRACK_PEAK") != "0.987650" {
+		t.Errorf("Unexpected tags: %v", m.Tags())
+	}
+
+	read, ok := ReadReplayGain(&m)
+	if !ok || read.TrackGain != -6.23 || read.TrackPeak != 0.98765 || read.AlbumGain != 1.5 || read.AlbumPeak != 1 {
+		t.Errorf("Unexpected ReplayGain read back: %+v", read)
+	}
+	if _, ok := ReadReplayGain(&Metadata{}); ok {
+		t.Errorf("Expected no ReplayGain without tags")
+	}
+}
+
+func TestReplayGainRVA2(t *testing.T) {
+	identification, gain, peak, ok := rva2Gain(buildRVA2("track", -6.5, 0.5))
+	if !ok || identification != "track" || gain != -6.5 || peak != 0.5 {
+		t.Errorf("Unexpected RVA2 frame: %q %.3f %.3f %v", identification, gain, peak, ok)
+	}
+
+	// Players that only read RVA2 frames find the gains in MP3 files
+	filename := filepath.Join(os.TempDir(), "test_output_replaygain.mp3")
+	defer os.Remove(filename)
+	raw, err := os.ReadFile(filepath.Join("data", "wilhelm.mp3"))
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+	if err := os.WriteFile(filename, raw, 0644); err != nil {
+		t.Fatalf("Failed to copy MP3 file: %v", err)
+	}
+	var m Metadata
+	ReplayGain{TrackGain: -3.25, TrackPeak: 0.75, AlbumGain: -4, AlbumPeak: 0.8}.SetTags(&m)
+	if err := WriteTags(filename, m); err != nil {
+		t.Fatalf("Failed to write tags: %v", err)
+	}
+
+	tagged, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read tagged MP3 file: %v", err)
+	}
+	var rva2 Metadata
+	frames := tagged[10:id3v2Size(tagged)]
+	for len(frames) >= 10 && frames[0] != 0 {
+		size := int(frames[4])<<21 | int(frames[5])<<14 | int(frames[6])<<7 | int(frames[7])
+		if string(frames[:4]) == "RVA2" {
+			parseID3Frame(&rva2, "RVA2", frames[10:10+size], 4)
+		}
+		frames = frames[10+size:]
+	}
+	read, ok := ReadReplayGain(&rva2)
+	if !ok || read.TrackGain != -3.25 || read.AlbumGain != -4 || math.Abs(read.TrackPeak-0.75) > 1e-4 {
+		t.Errorf("Unexpected ReplayGain from RVA2 frames: %+v", read)
+	}
+}
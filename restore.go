@@ -0,0 +1,203 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/schollz/audiomorph/filter"
+)
+
+// Restoration constants
+const (
+	dcHighPassFrequency = 5    // Hz, cutoff of the first order high pass that removes DC offset
+	clipTolerance       = 0.01 // dB below the peak of a polarity that still counts as clipped
+	clipMinRun          = 3    // consecutive samples at the peak that make a clipped run
+	clipMinLevel        = -20  // dBFS, quieter peaks repeat from quantization rather than clipping
+)
+
+// DCOffset returns the mean of each channel, 1 being full scale
+func DCOffset(audio *Audio) []float64 {
+	offsets := make([]float64, len(audio.Data))
+	for ch, samples := range audio.Data {
+		if len(samples) == 0 {
+			continue
+		}
+		var sum float64
+		for _, sample := range samples {
+			sum += float64(sample)
+		}
+		offsets[ch] = sum / float64(len(samples)) / fullScale(audio.BitDepth)
+	}
+	return offsets
+}
+
+// RemoveDCOffset removes the DC offset of every channel by subtracting its mean ("mean", the
+// default), or with a 5 Hz high pass ("highpass") for an offset that drifts
+func (a *Audio) RemoveDCOffset(method string) error {
+	switch method {
+	case "", "mean":
+		maxValue := fullScale(a.BitDepth) - 1
+		for ch, offset := range DCOffset(a) {
+			shift := offset * fullScale(a.BitDepth)
+			for i, sample := range a.Data[ch] {
+				a.Data[ch][i] = int(max(-maxValue-1, min(maxValue, math.Round(float64(sample)-shift))))
+			}
+		}
+		return nil
+	case "highpass":
+		return a.Filter(filter.Filter{Type: "highpass", Frequency: dcHighPassFrequency, Order: 1})
+	}
+	return fmt.Errorf("unsupported DC offset removal method: %s", method)
+}
+
+// clipRun is a run of clipped samples from start up to end
+type clipRun struct {
+	start, end int
+}
+
+// clippedRuns returns the runs of samples of a channel that are flat at its positive or
+// negative peak, within a hundredth of a dB, for at least 3 samples. Peaks below -20 dBFS are not
+// considered clipped.
+func clippedRuns(samples []int, bitDepth int) []clipRun {
+	var positive, negative int
+	for _, sample := range samples {
+		positive, negative = max(positive, sample), min(negative, sample)
+	}
+	tolerance := math.Pow(10, -clipTolerance/20)
+	high := int(math.Ceil(float64(positive) * tolerance))
+	low := int(math.Floor(float64(negative) * tolerance))
+	minLevel := fullScale(bitDepth) * math.Pow(10, clipMinLevel/20.0)
+	clipped := func(sample, sign int) bool {
+		if sign > 0 {
+			return float64(positive) >= minLevel && sample >= high
+		}
+		return float64(-negative) >= minLevel && sample <= low
+	}
+
+	var runs []clipRun
+	for i := 0; i < len(samples); {
+		sign := 1
+		if samples[i] < 0 {
+			sign = -1
+		}
+		j := i
+		for j < len(samples) && clipped(samples[j], sign) {
+			j++
+		}
+		if j-i >= clipMinRun {
+			runs = append(runs, clipRun{i, j})
+		}
+		i = max(j, i+1)
+	}
+	return runs
+}
+
+// DetectClipping returns the number of clipped samples of each channel: samples in runs that
+// are flat at the peak of their polarity for at least 3 samples
+func DetectClipping(audio *Audio) []int {
+	counts := make([]int, len(audio.Data))
+	for ch, samples := range audio.Data {
+		for _, run := range clippedRuns(samples, audio.BitDepth) {
+			counts[ch] += run.end - run.start
+		}
+	}
+	return counts
+}
+
+// Declip reconstructs the clipped runs of every channel by cubic interpolation through the two
+// samples on either side of each run, returning the number of samples repaired on each channel.
+// Reconstructed peaks beyond full scale are clipped again, so lower the gain first when the
+// audio clipped at full scale.
+func (a *Audio) Declip() []int {
+	maxValue := fullScale(a.BitDepth) - 1
+	counts := make([]int, len(a.Data))
+	for ch, samples := range a.Data {
+		for _, run := range clippedRuns(samples, a.BitDepth) {
+			// Runs at the ends of the audio lack the samples to interpolate from
+			if run.start < 2 || run.end+2 > len(samples) {
+				continue
+			}
+			xs := []float64{float64(run.start - 2), float64(run.start - 1), float64(run.end), float64(run.end + 1)}
+			ys := []float64{float64(samples[run.start-2]), float64(samples[run.start-1]), float64(samples[run.end]), float64(samples[run.end+1])}
+			for i := run.start; i < run.end; i++ {
+				value := lagrange(xs, ys, float64(i))
+				// A repair never makes the peak smaller than the clipped level
+				if samples[i] > 0 {
+					value = max(value, float64(samples[i]))
+				} else {
+					value = min(value, float64(samples[i]))
+				}
+				samples[i] = int(max(-maxValue-1, min(maxValue, math.Round(value))))
+			}
+			counts[ch] += run.end - run.start
+		}
+	}
+	return counts
+}
+
+// lagrange evaluates the polynomial through points at x
+func lagrange(xs, ys []float64, x float64) float64 {
+	var y float64
+	for i := range xs {
+		term := ys[i]
+		for j := range xs {
+			if j != i {
+				term *= (x - xs[j]) / (xs[i] - xs[j])
+			}
+		}
+		y += term
+	}
+	return y
+}
+
+// OptionRemoveDCOffset removes the DC offset of every channel when encoding, by subtracting its
+// mean ("mean") or with a 5 Hz high pass ("highpass")
+func OptionRemoveDCOffset(method string) Option {
+	return func(a *Audio) {
+		a.removeDC = &method
+	}
+}
+
+// OptionDeclip reconstructs clipped runs by interpolation when encoding
+func OptionDeclip() Option {
+	return func(a *Audio) {
+		a.declip = true
+	}
+}
+
+// Declipped returns the number of samples repaired on each channel by the declipping of the
+// last encode
+func (a *Audio) Declipped() []int {
+	return a.declipped
+}
+
+// restoreAudio applies the declipping and DC offset removal configured on the audio, returning
+// the coding history operations. Declipping comes first, as a high pass tilts the flat tops it
+// looks for.
+func restoreAudio(audio *Audio) ([]string, error) {
+	declip, removeDC := audio.declip, audio.removeDC
+	audio.declipped = nil
+
+	var operations []string
+	if declip {
+		audio.declipped = audio.Declip()
+		total := 0
+		for _, count := range audio.declipped {
+			total += count
+		}
+		if total > 0 {
+			operations = append(operations, fmt.Sprintf("declip %d samples", total))
+		}
+	}
+	if removeDC != nil {
+		if err := audio.RemoveDCOffset(*removeDC); err != nil {
+			return nil, err
+		}
+		method := *removeDC
+		if method == "" {
+			method = "mean"
+		}
+		operations = append(operations, fmt.Sprintf("remove DC offset (%s)", method))
+	}
+	return operations, nil
+}
@@ -0,0 +1,129 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clippedSine returns a stereo 1 kHz sine at 48 kHz with a peak of 30000, clipped at 20000 on
+// the left channel, along with the unclipped samples
+func clippedSine(n int) (*Audio, []int) {
+	audio := sineAudio(2, 1000, 0, 20*math.Log10(30000.0/32767), float64(n)/48000)
+	original := append([]int(nil), audio.Data[0]...)
+	for i, sample := range original {
+		audio.Data[0][i] = max(-20000, min(20000, sample))
+	}
+	return audio, original
+}
+
+func TestDCOffset(t *testing.T) {
+	audio, _ := clippedSine(4800)
+	for ch := range audio.Data {
+		for i := range audio.Data[ch] {
+			audio.Data[ch][i] += 1638
+		}
+	}
+	for ch, offset := range DCOffset(audio) {
+		if math.Abs(offset-0.05) > 0.001 {
+			t.Errorf("Expected a DC offset of 0.05 on channel %d, got %.4f", ch, offset)
+		}
+	}
+
+	if err := audio.RemoveDCOffset("mean"); err != nil {
+		t.Fatalf("Failed to remove DC offset: %v", err)
+	}
+	for ch, offset := range DCOffset(audio) {
+		if math.Abs(offset) > 0.0001 {
+			t.Errorf("Expected no DC offset on channel %d, got %.4f", ch, offset)
+		}
+	}
+
+	// The high pass settles within the first second
+	constant := constantAudio(5000, 96000)
+	if err := constant.RemoveDCOffset("highpass"); err != nil {
+		t.Fatalf("Failed to remove DC offset: %v", err)
+	}
+	if last := constant.Data[0][len(constant.Data[0])-1]; last < -10 || last > 10 {
+		t.Errorf("Expected the high pass to remove the offset, got %d", last)
+	}
+
+	if err := audio.RemoveDCOffset("median"); err == nil {
+		t.Errorf("Expected an error for an unsupported method")
+	}
+}
+
+func TestDeclip(t *testing.T) {
+	audio, original := clippedSine(4800)
+	clipped := DetectClipping(audio)
+	if clipped[0] < 2000 || clipped[1] != 0 {
+		t.Fatalf("Expected only the left channel to be clipped, got %v", clipped)
+	}
+
+	repaired := audio.Declip()
+	if repaired[0] != clipped[0] || repaired[1] != 0 {
+		t.Errorf("Expected %v samples repaired, got %v", clipped, repaired)
+	}
+	peak, maxError := 0, 0
+	for i, sample := range audio.Data[0] {
+		peak = max(peak, sample)
+		maxError = max(maxError, abs(sample-original[i]))
+	}
+	if peak < 28000 || maxError > 1500 {
+		t.Errorf("Expected the peaks reconstructed near 30000, got a peak of %d and an error of %d", peak, maxError)
+	}
+	if counts := DetectClipping(audio); counts[0] != 0 {
+		t.Errorf("Expected no clipping after declipping, got %v", counts)
+	}
+
+	// Quiet audio repeats samples without clipping
+	quiet := constantAudio(100, 100)
+	if counts := DetectClipping(quiet); counts[0] != 0 || counts[1] != 0 {
+		t.Errorf("Expected no clipping below -20 dBFS, got %v", counts)
+	}
+}
+
+func TestRestoreOptions(t *testing.T) {
+	audio, _ := clippedSine(4800)
+	for i := range audio.Data[1] {
+		audio.Data[1][i] += 1000
+	}
+	filename := filepath.Join(os.TempDir(), "test_output_restore.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionDeclip(), OptionRemoveDCOffset("mean")); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if counts := DetectClipping(decoded); counts[0] != 0 {
+		t.Errorf("Expected no clipping after declipping, got %v", counts)
+	}
+	if offset := DCOffset(decoded)[1]; math.Abs(offset) > 0.0001 {
+		t.Errorf("Expected no DC offset, got %.4f", offset)
+	}
+	history := decoded.History[len(decoded.History)-1]
+	if !strings.Contains(history, "declip") || !strings.Contains(history, "remove DC offset (mean)") {
+		t.Errorf("Expected declipping and DC offset removal in the coding history, got %q", history)
+	}
+
+	if declipped := audio.Declipped(); len(declipped) != 2 || declipped[0] == 0 || declipped[1] != 0 {
+		t.Errorf("Expected samples declipped on the left channel only, got %v", declipped)
+	}
+
+	// A second encode does not repeat the repairs
+	rows := len(audio.History)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if audio.Declipped() != nil || len(audio.History) != rows {
+		t.Errorf("Expected no repairs by a second encode, got %v and history %q", audio.Declipped(), audio.History[rows:])
+	}
+
+	if err := EncodeFile(audio, filename, OptionRemoveDCOffset("median")); err == nil {
+		t.Errorf("Expected an error for an unsupported method")
+	}
+}
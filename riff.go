@@ -0,0 +1,171 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// riffChunk is a single chunk of a RIFF file
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// readRIFF reads every chunk of a RIFF file and returns the form type (e.g. "WAVE").
+// Truncated chunks and data chunks with an unknown size (streamed files) are read to the end of the file.
+func readRIFF(raw []byte) (string, []riffChunk, error) {
+	if len(raw) < 12 || string(raw[0:4]) != "RIFF" {
+		return "", nil, fmt.Errorf("missing RIFF header")
+	}
+	formType := string(raw[8:12])
+
+	var chunks []riffChunk
+	pos := 12
+	for pos+8 <= len(raw) {
+		id := string(raw[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(raw[pos+4 : pos+8]))
+		pos += 8
+
+		end := pos + size
+		if size == 0xFFFFFFFF || (size == 0 && id == "data") || end > len(raw) || end < pos {
+			end = len(raw)
+		}
+		chunks = append(chunks, riffChunk{id: id, data: raw[pos:end]})
+
+		// Chunks are padded to an even number of bytes
+		pos = end
+		if size%2 == 1 {
+			pos++
+		}
+	}
+
+	return formType, chunks, nil
+}
+
+// findChunk returns the first chunk with the given id, or nil if there is none
+func findChunk(chunks []riffChunk, id string) *riffChunk {
+	for i := range chunks {
+		if chunks[i].id == id {
+			return &chunks[i]
+		}
+	}
+	return nil
+}
+
+// writeRIFF writes a RIFF file with the given form type and chunks
+func writeRIFF(w io.Writer, formType string, chunks []riffChunk) error {
+	size := 4
+	for _, chunk := range chunks {
+		size += 8 + len(chunk.data) + len(chunk.data)%2
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(size))
+	buf.WriteString(formType)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		buf.Reset()
+		buf.WriteString(chunk.id)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.data)))
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.data); err != nil {
+			return err
+		}
+		if len(chunk.data)%2 == 1 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readIFF reads every chunk of a big endian IFF "FORM" file (AIFF, AIFF-C) and returns the form type
+func readIFF(raw []byte) (string, []riffChunk, error) {
+	if len(raw) < 12 || string(raw[0:4]) != "FORM" {
+		return "", nil, fmt.Errorf("missing FORM header")
+	}
+	formType := string(raw[8:12])
+
+	var chunks []riffChunk
+	pos := 12
+	for pos+8 <= len(raw) {
+		id := string(raw[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(raw[pos+4 : pos+8]))
+		pos += 8
+
+		end := pos + size
+		if end > len(raw) || end < pos {
+			end = len(raw)
+		}
+		chunks = append(chunks, riffChunk{id: id, data: raw[pos:end]})
+
+		// Chunks are padded to an even number of bytes
+		pos = end
+		if size%2 == 1 {
+			pos++
+		}
+	}
+
+	return formType, chunks, nil
+}
+
+// writeIFF writes a big endian IFF "FORM" file with the given form type and chunks
+func writeIFF(w io.Writer, formType string, chunks []riffChunk) error {
+	size := 4
+	for _, chunk := range chunks {
+		size += 8 + len(chunk.data) + len(chunk.data)%2
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("FORM")
+	binary.Write(&buf, binary.BigEndian, uint32(size))
+	buf.WriteString(formType)
+	for _, chunk := range chunks {
+		buf.WriteString(chunk.id)
+		binary.Write(&buf, binary.BigEndian, uint32(len(chunk.data)))
+		buf.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// isListChunk reports whether a chunk is a LIST chunk of the given list type (e.g. "INFO", "adtl")
+func isListChunk(chunk riffChunk, listType string) bool {
+	return chunk.id == "LIST" && len(chunk.data) >= 4 && string(chunk.data[0:4]) == listType
+}
+
+// listChunks returns the sub-chunks of a LIST chunk
+func listChunks(chunk riffChunk) []riffChunk {
+	if len(chunk.data) < 4 {
+		return nil
+	}
+	return readChunkList(chunk.data[4:])
+}
+
+// readChunkList reads a sequence of little endian RIFF chunks without a RIFF header
+func readChunkList(data []byte) []riffChunk {
+	header := []byte("RIFF\x00\x00\x00\x00WAVE")
+	_, chunks, _ := readRIFF(append(header, data...))
+	return chunks
+}
+
+// buildListChunk builds the body of a LIST chunk of the given list type
+func buildListChunk(listType string, chunks []riffChunk) []byte {
+	var buf bytes.Buffer
+	writeRIFF(&buf, listType, chunks)
+	return buf.Bytes()[8:]
+}
@@ -0,0 +1,181 @@
+package audiomorph
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// riffInfoIDs maps RIFF LIST/INFO ids to metadata keys. The first id of a key is the one written.
+var riffInfoIDs = []struct {
+	id  string
+	key string
+}{
+	{"INAM", "TITLE"},
+	{"IART", "ARTIST"},
+	{"IPRD", "ALBUM"},
+	{"IGNR", "GENRE"},
+	{"ICRD", "DATE"},
+	{"ITRK", "TRACKNUMBER"},
+	{"IPRT", "TRACKNUMBER"},
+	{"ICMT", "COMMENT"},
+	{"IMUS", "COMPOSER"},
+	{"ICOP", "COPYRIGHT"},
+	{"ISFT", "ENCODER"},
+	{"IENG", "ENGINEER"},
+	{"ILNG", "LANGUAGE"},
+	{"IKEY", "KEYWORDS"},
+	{"ISBJ", "SUBJECT"},
+}
+
+// aiffTextChunks maps the AIFF text chunks to metadata keys
+var aiffTextChunks = []struct {
+	id  string
+	key string
+}{
+	{"NAME", "TITLE"},
+	{"AUTH", "ARTIST"},
+	{"(c) ", "COPYRIGHT"},
+	{"ANNO", "COMMENT"},
+}
+
+// infoText decodes a null terminated INFO or AIFF text value
+func infoText(data []byte) string {
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// riffMetadata reads the tags of a RIFF file from its id3 chunk and its LIST/INFO chunk,
+// the ID3 tag taking precedence
+func riffMetadata(chunks []riffChunk) Metadata {
+	var m Metadata
+	for _, chunk := range chunks {
+		if chunk.id == "id3 " || chunk.id == "ID3 " {
+			if tag, err := parseID3v2(chunk.data); err == nil {
+				m = tag
+			}
+		}
+	}
+
+	var info Metadata
+	for _, chunk := range chunks {
+		if !isListChunk(chunk, "INFO") {
+			continue
+		}
+		for _, sub := range listChunks(chunk) {
+			key := sub.id
+			for _, entry := range riffInfoIDs {
+				if entry.id == sub.id {
+					key = entry.key
+					break
+				}
+			}
+			info.add(key, infoText(sub.data))
+		}
+	}
+	m.merge(info)
+	return m
+}
+
+// buildRIFFInfo builds the body of a LIST/INFO chunk for the tags INFO can hold
+func buildRIFFInfo(m Metadata) []byte {
+	var info []riffChunk
+	written := make(map[string]bool)
+	for _, entry := range riffInfoIDs {
+		value := m.Get(entry.key)
+		if value == "" || written[entry.key] {
+			continue
+		}
+		written[entry.key] = true
+		info = append(info, riffChunk{id: entry.id, data: appendZString(nil, value)})
+	}
+	return buildListChunk("INFO", info)
+}
+
+// updateWAVMetadata replaces the LIST/INFO and id3 chunks of a WAV file
+func updateWAVMetadata(raw []byte, m Metadata) ([]byte, error) {
+	formType, chunks, err := readRIFF(raw)
+	if err != nil || formType != "WAVE" {
+		return nil, fmt.Errorf("invalid WAV file")
+	}
+
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		if isListChunk(chunk, "INFO") || chunk.id == "id3 " || chunk.id == "ID3 " {
+			continue
+		}
+		updated = append(updated, chunk)
+	}
+	if !m.IsEmpty() {
+		if info := buildRIFFInfo(m); len(info) > 4 {
+			updated = append(updated, riffChunk{id: "LIST", data: info})
+		}
+		updated = append(updated, riffChunk{id: "id3 ", data: buildID3v2(m)})
+	}
+
+	var buf bytes.Buffer
+	if err := writeRIFF(&buf, formType, updated); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// aiffMetadata reads the tags of an AIFF file from its ID3 chunk and its text chunks,
+// the ID3 tag taking precedence
+func aiffMetadata(chunks []riffChunk) Metadata {
+	var m Metadata
+	for _, chunk := range chunks {
+		if chunk.id == "ID3 " || chunk.id == "id3 " {
+			if tag, err := parseID3v2(chunk.data); err == nil {
+				m = tag
+			}
+		}
+	}
+
+	var text Metadata
+	for _, chunk := range chunks {
+		for _, entry := range aiffTextChunks {
+			if entry.id == chunk.id {
+				text.add(entry.key, infoText(chunk.data))
+			}
+		}
+	}
+	m.merge(text)
+	return m
+}
+
+// updateAIFFMetadata replaces the text and ID3 chunks of an AIFF or AIFF-C file
+func updateAIFFMetadata(raw []byte, m Metadata) ([]byte, error) {
+	formType, chunks, err := readIFF(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AIFF file")
+	}
+
+	var updated []riffChunk
+	for _, chunk := range chunks {
+		isText := false
+		for _, entry := range aiffTextChunks {
+			isText = isText || entry.id == chunk.id
+		}
+		if isText || chunk.id == "ID3 " || chunk.id == "id3 " {
+			continue
+		}
+		updated = append(updated, chunk)
+	}
+	if !m.IsEmpty() {
+		for _, entry := range aiffTextChunks {
+			if value := m.Get(entry.key); value != "" {
+				updated = append(updated, riffChunk{id: entry.id, data: []byte(value)})
+			}
+		}
+		updated = append(updated, riffChunk{id: "ID3 ", data: buildID3v2(m)})
+	}
+
+	var buf bytes.Buffer
+	if err := writeIFF(&buf, formType, updated); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,159 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// Silence trimming keeps a little of the silence around the sound and fades the cut ends
+const (
+	silenceTrimHold    = 0.01  // seconds kept before and after the sound
+	silenceFadeSeconds = 0.005 // protective fade at a cut end
+)
+
+// Silence is a silent region of audio
+type Silence struct {
+	Start int // in samples
+	End   int // in samples, exclusive
+}
+
+// Seconds returns the start and end of the region in seconds
+func (s Silence) Seconds(sampleRate int) (float64, float64) {
+	return float64(s.Start) / float64(sampleRate), float64(s.End) / float64(sampleRate)
+}
+
+// DetectSilence returns the regions where every channel stays below a threshold in dBFS for
+// at least minDuration seconds. Each region leaves hold seconds of silence next to the sound
+// around it, so quiet attacks and decays are not counted as silence.
+func DetectSilence(audio *Audio, threshold, minDuration, hold float64) []Silence {
+	level := math.Pow(10, threshold/20) * fullScale(audio.BitDepth)
+	holdSamples := audio.sampleAt(max(hold, 0))
+	minSamples := max(audio.sampleAt(minDuration), 1)
+	numSamples := audio.numSamples()
+
+	var regions []Silence
+	addRegion := func(start, end int) {
+		// Hold applies next to sound, not at the ends of the audio
+		if start > 0 {
+			start += holdSamples
+		}
+		if end < numSamples {
+			end -= holdSamples
+		}
+		if end-start >= minSamples {
+			regions = append(regions, Silence{Start: start, End: end})
+		}
+	}
+
+	quietStart := 0
+	for i := 0; i < numSamples; i++ {
+		loud := false
+		for _, samples := range audio.Data {
+			if math.Abs(float64(samples[i])) >= level {
+				loud = true
+				break
+			}
+		}
+		if loud {
+			if i > quietStart {
+				addRegion(quietStart, i)
+			}
+			quietStart = i + 1
+		}
+	}
+	if numSamples > quietStart {
+		addRegion(quietStart, numSamples)
+	}
+	return regions
+}
+
+// OptionTrimSilence removes the leading and trailing silence below a threshold in dBFS when
+// encoding (e.g. -60), fading the cut ends in and out over a few milliseconds
+func OptionTrimSilence(threshold float64) Option {
+	return func(a *Audio) {
+		a.trimSilence = &threshold
+	}
+}
+
+// trimAudioSilence removes the leading and trailing silence of the audio below the threshold of
+// OptionTrimSilence, returning the coding history operation. Audio that is silent throughout is
+// left alone.
+func trimAudioSilence(audio *Audio) (string, error) {
+	if audio.trimSilence == nil {
+		return "", nil
+	}
+	threshold := *audio.trimSilence
+
+	numSamples := audio.numSamples()
+	start, end := 0, numSamples
+	for _, region := range DetectSilence(audio, threshold, 0, silenceTrimHold) {
+		switch {
+		case region.Start == 0 && region.End == numSamples:
+			return "", nil
+		case region.Start == 0:
+			start = region.End
+		case region.End == numSamples:
+			end = region.Start
+		}
+	}
+	if start == 0 && end == numSamples {
+		return "", nil
+	}
+
+	trimmed, err := audio.Slice(start, end)
+	if err != nil {
+		return "", fmt.Errorf("failed to trim silence: %w", err)
+	}
+	fadeLength := trimmed.sampleAt(silenceFadeSeconds)
+	for _, samples := range trimmed.Data {
+		if start > 0 {
+			fadeSamples(samples, 0, fadeLength, fadeCurves["linear"], true)
+		}
+		if end < numSamples {
+			fadeSamples(samples, len(samples)-fadeLength, fadeLength, fadeCurves["linear"], false)
+		}
+	}
+	*audio = *trimmed
+	removed := float64(start+numSamples-end) / float64(audio.SampleRate)
+	return fmt.Sprintf("trim silence below %.1f dBFS (%.3f s)", threshold, removed), nil
+}
+
+// SplitOnSilence cuts audio into one Audio per sound between silences below a threshold in dBFS
+// lasting at least minGap seconds. Sounds shorter than minLength seconds are dropped, and each
+// part keeps up to padding seconds of the silence around it, at most half of each gap.
+func SplitOnSilence(audio *Audio, threshold, minGap, minLength, padding float64) ([]*Audio, error) {
+	if minGap <= 0 || minLength < 0 || padding < 0 {
+		return nil, fmt.Errorf("invalid split with a %g second gap, %g second length and %g second padding", minGap, minLength, padding)
+	}
+	numSamples := audio.numSamples()
+	silences := DetectSilence(audio, threshold, minGap, 0)
+
+	// The sounds lie between the silences, and may pad into them up to their middle
+	type sound struct{ start, end, first, last int }
+	var sounds []sound
+	start, first := 0, 0
+	for _, silence := range silences {
+		if silence.Start > start {
+			sounds = append(sounds, sound{start, silence.Start, first, (silence.Start + silence.End) / 2})
+		}
+		start, first = silence.End, (silence.Start+silence.End)/2
+	}
+	if numSamples > start {
+		sounds = append(sounds, sound{start, numSamples, first, numSamples})
+	}
+
+	minSamples := audio.sampleAt(minLength)
+	padSamples := audio.sampleAt(padding)
+	var parts []*Audio
+	for _, s := range sounds {
+		if s.end-s.start < minSamples {
+			continue
+		}
+		part, err := audio.Slice(max(s.first, s.start-padSamples), min(s.last, s.end+padSamples))
+		if err != nil {
+			return nil, fmt.Errorf("failed to split on silence: %w", err)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
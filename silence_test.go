@@ -0,0 +1,148 @@
+package audiomorph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// burstAudio returns mono 48 kHz audio of -6 dBFS tone bursts from 1 to 1.5 and 1.7 to 2.2
+// seconds, over 3.2 seconds of faint noise
+func burstAudio() *Audio {
+	data := make([]int, 153600)
+	for i := range data {
+		data[i] = i%7 - 3
+	}
+	copy(data[48000:], sineAudio(1, 1000, 0, -6, 0.5).Data[0])
+	copy(data[81600:], sineAudio(1, 1000, 0, -6, 0.5).Data[0])
+	return &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{data}, Duration: 3.2}
+}
+
+func TestDetectSilence(t *testing.T) {
+	audio := burstAudio()
+
+	// The hold keeps 10 ms of silence next to the bursts
+	expected := []Silence{{0, 47521}, {72480, 81121}, {106080, 153600}}
+	regions := DetectSilence(audio, -60, 0.1, 0.01)
+	if len(regions) != len(expected) {
+		t.Fatalf("Expected %d silent regions, got %+v", len(expected), regions)
+	}
+	for i, region := range regions {
+		if math.Abs(float64(region.Start-expected[i].Start)) > 2 || math.Abs(float64(region.End-expected[i].End)) > 2 {
+			t.Errorf("Expected silent region %+v, got %+v", expected[i], region)
+		}
+	}
+	if start, end := regions[1].Seconds(audio.SampleRate); math.Abs(start-1.51) > 0.001 || math.Abs(end-1.69) > 0.001 {
+		t.Errorf("Expected the region from 1.51 to 1.69 seconds, got %.3f to %.3f", start, end)
+	}
+
+	// The gap between the bursts is shorter than the minimum duration
+	if regions := DetectSilence(audio, -60, 0.3, 0.01); len(regions) != 2 {
+		t.Errorf("Expected 2 silent regions of at least 0.3 seconds, got %+v", regions)
+	}
+	// The noise is above a -90 dBFS threshold
+	if regions := DetectSilence(audio, -90, 0.1, 0.01); len(regions) != 0 {
+		t.Errorf("Expected no silent regions below -90 dBFS, got %+v", regions)
+	}
+
+	silent := &Audio{NumChannels: 2, SampleRate: 48000, BitDepth: 16, Data: [][]int{make([]int, 4800), make([]int, 4800)}}
+	if regions := DetectSilence(silent, -60, 0.1, 0.01); len(regions) != 1 || regions[0] != (Silence{0, 4800}) {
+		t.Errorf("Expected silent audio to be one region, got %+v", regions)
+	}
+}
+
+func TestOptionTrimSilence(t *testing.T) {
+	audio := burstAudio()
+	audio.Markers = []Marker{{ID: 1, Position: 81600, Label: "Second"}}
+	filename := filepath.Join(os.TempDir(), "test_output_trim_silence.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionTrimSilence(-60)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	trimmed, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+
+	// The bursts and the gap remain with 10 ms on either side, the ends are faded
+	if n := len(trimmed.Data[0]); math.Abs(float64(n-58560)) > 4 {
+		t.Errorf("Expected about 58560 samples, got %d", n)
+	}
+	if len(trimmed.Markers) != 1 || math.Abs(float64(trimmed.Markers[0].Position-34080)) > 2 {
+		t.Errorf("Expected the marker to move to about 34080, got %+v", trimmed.Markers)
+	}
+	data := trimmed.Data[0]
+	if data[0] != 0 || data[len(data)-1] != 0 {
+		t.Errorf("Expected faded ends, got %d and %d", data[0], data[len(data)-1])
+	}
+	if history := trimmed.History[len(trimmed.History)-1]; !strings.Contains(history, "trim silence below -60.0 dBFS") {
+		t.Errorf("Expected the trim in the coding history, got %q", history)
+	}
+
+	// Silence added after the encode is kept by the next one
+	if err := audio.Pad(0.5, 0); err != nil {
+		t.Fatalf("Failed to pad audio: %v", err)
+	}
+	padded := len(audio.Data[0])
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if len(audio.Data[0]) != padded {
+		t.Errorf("Expected a second encode to keep %d samples, got %d", padded, len(audio.Data[0]))
+	}
+
+	// Audio that is silent throughout is kept
+	silent := &Audio{NumChannels: 1, SampleRate: 48000, BitDepth: 16, Data: [][]int{make([]int, 4800)}}
+	if err := EncodeFile(silent, filename, OptionTrimSilence(-60)); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+	if trimmed, err = DecodeFile(filename); err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	if len(trimmed.Data[0]) != 4800 {
+		t.Errorf("Expected silent audio to keep its 4800 samples, got %d", len(trimmed.Data[0]))
+	}
+}
+
+func TestSplitOnSilence(t *testing.T) {
+	audio := burstAudio()
+	audio.Markers = []Marker{{ID: 1, Position: 81600, Label: "Second"}}
+	audio.Metadata.Title = "Takes"
+
+	parts, err := SplitOnSilence(audio, -60, 0.1, 0.2, 0.05)
+	if err != nil {
+		t.Fatalf("Failed to split on silence: %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if n := len(part.Data[0]); math.Abs(float64(n-28800)) > 2 || part.Metadata.Title != "Takes" {
+			t.Errorf("Expected part %d to be about 28800 samples titled Takes, got %d titled %q", i+1, n, part.Metadata.Title)
+		}
+	}
+	if len(parts[1].Markers) != 1 || math.Abs(float64(parts[1].Markers[0].Position-2400)) > 2 {
+		t.Errorf("Expected the marker at about 2400 in the second part, got %+v", parts[1].Markers)
+	}
+
+	// The padding stops halfway into the gap between the bursts
+	if parts, err = SplitOnSilence(audio, -60, 0.1, 0.2, 0.5); err != nil {
+		t.Fatalf("Failed to split on silence: %v", err)
+	}
+	if n := len(parts[0].Data[0]); math.Abs(float64(n-52800)) > 2 {
+		t.Errorf("Expected the first part to be about 52800 samples, got %d", n)
+	}
+
+	// The gap is shorter than the minimum gap, or the bursts shorter than the minimum length
+	if parts, _ = SplitOnSilence(audio, -60, 0.3, 0.2, 0.05); len(parts) != 1 {
+		t.Errorf("Expected 1 part for a 0.3 second minimum gap, got %d", len(parts))
+	}
+	if parts, _ = SplitOnSilence(audio, -60, 0.1, 0.6, 0.05); len(parts) != 0 {
+		t.Errorf("Expected no parts for a 0.6 second minimum length, got %d", len(parts))
+	}
+	if _, err := SplitOnSilence(audio, -60, 0, 0.2, 0.05); err == nil {
+		t.Errorf("Expected an error for a zero minimum gap")
+	}
+}
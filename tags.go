@@ -0,0 +1,189 @@
+package audiomorph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Chunk describes a chunk, metadata block or tag in the container of an audio file
+type Chunk struct {
+	ID   string // chunk id, LIST chunks include their list type as in "LIST/INFO"
+	Size int    // in bytes, without the chunk header
+}
+
+// flacBlockNames names the FLAC metadata block types
+var flacBlockNames = map[byte]string{
+	0: "STREAMINFO",
+	1: "PADDING",
+	2: "APPLICATION",
+	3: "SEEKTABLE",
+	4: "VORBIS_COMMENT",
+	5: "CUESHEET",
+	6: "PICTURE",
+}
+
+// ReadChunks lists the chunks of a WAV, W64 or AIFF file, the metadata blocks of a FLAC file
+// or the tags around the audio of an MP3 or WavPack file
+func ReadChunks(filename string) ([]Chunk, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var riffChunks []riffChunk
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".wav":
+		_, riffChunks, err = readRIFF(raw)
+	case ".w64":
+		riffChunks, err = readW64(raw)
+	case ".aif", ".aiff", ".aifc":
+		_, riffChunks, err = readIFF(raw)
+	case ".flac":
+		blocks, _, err := readFLACBlocks(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FLAC metadata: %w", err)
+		}
+		var chunks []Chunk
+		for _, block := range blocks {
+			name, ok := flacBlockNames[block.blockType]
+			if !ok {
+				name = fmt.Sprintf("BLOCK %d", block.blockType)
+			}
+			chunks = append(chunks, Chunk{ID: name, Size: len(block.data)})
+		}
+		return chunks, nil
+	case ".mp3", ".wv":
+		return tagChunks(raw), nil
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", filepath.Ext(filename))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+
+	chunks := make([]Chunk, len(riffChunks))
+	for i, chunk := range riffChunks {
+		id := chunk.id
+		if len(id) == 16 {
+			id = fmt.Sprintf("%X", id) // a W64 chunk without a four character id
+		}
+		if id == "LIST" && len(chunk.data) >= 4 {
+			id += "/" + string(chunk.data[0:4])
+		}
+		chunks[i] = Chunk{ID: id, Size: len(chunk.data)}
+	}
+	return chunks, nil
+}
+
+// tagChunks lists the ID3v2 tag before the audio and the APEv2 and ID3v1 tags after it
+func tagChunks(raw []byte) []Chunk {
+	var chunks []Chunk
+	start, end := id3v2Size(raw), len(raw)
+	if start > 0 {
+		chunks = append(chunks, Chunk{ID: fmt.Sprintf("ID3v2.%d", raw[3]), Size: start})
+	}
+
+	var trailer []Chunk
+	if end-start >= 128 && string(raw[end-128:end-125]) == "TAG" {
+		trailer = append(trailer, Chunk{ID: "ID3v1", Size: 128})
+		end -= 128
+	}
+	if apeStart, apeEnd := apeTagBounds(raw); apeStart >= start {
+		trailer = append([]Chunk{{ID: "APEv2", Size: apeEnd - apeStart}}, trailer...)
+		end = apeStart
+	}
+	chunks = append(chunks, Chunk{ID: "audio", Size: end - start})
+	return append(chunks, trailer...)
+}
+
+// ReadTags reads the tags of a file, without decoding its audio where the format allows it.
+// The coding history tag is left out, it is read into Audio.History by DecodeFile.
+func ReadTags(filename string) (Metadata, error) {
+	m, err := readFileTags(filename)
+	m.Set(historyTag, "")
+	return m, err
+}
+
+// readFileTags reads every tag of a file
+func readFileTags(filename string) (Metadata, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".wav", ".aif", ".aiff", ".aifc", ".mp3", ".flac", ".wv", ".ogg", ".oga", ".opus":
+	default:
+		audio, err := DecodeFile(filename)
+		if err != nil {
+			return Metadata{}, err
+		}
+		return audio.Metadata, nil
+	}
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	switch ext {
+	case ".wav":
+		_, chunks, err := readRIFF(raw)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("failed to read WAV chunks: %w", err)
+		}
+		return riffMetadata(chunks), nil
+	case ".mp3":
+		return readMP3Metadata(raw), nil
+	case ".flac":
+		blocks, _, err := readFLACBlocks(raw)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("failed to read FLAC metadata: %w", err)
+		}
+		return flacRawMetadata(blocks), nil
+	case ".wv":
+		return readAPEMetadata(raw), nil
+	case ".ogg", ".oga", ".opus":
+		m, err := readOggMetadata(raw)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("failed to read Ogg tags: %w", err)
+		}
+		return m, nil
+	default:
+		_, chunks, err := readIFF(raw)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("failed to read AIFF chunks: %w", err)
+		}
+		return aiffMetadata(chunks), nil
+	}
+}
+
+// flacRawMetadata reads the tags of the raw metadata blocks of a FLAC file
+func flacRawMetadata(blocks []flacBlock) Metadata {
+	var m Metadata
+	for _, block := range blocks {
+		switch block.blockType {
+		case flacBlockVorbisComment:
+			if comments, err := parseVorbisComment(block.data); err == nil {
+				m.merge(vorbisCommentMetadata(comments))
+			}
+		case flacBlockPicture:
+			if picture, err := parseFLACPicture(block.data); err == nil {
+				m.Pictures = append(m.Pictures, picture)
+			}
+		}
+	}
+	return m
+}
+
+// WriteTags replaces the tags of a file without re-encoding its audio. Only the tag chunks,
+// blocks or tags of the file are rewritten, keeping its coding history.
+func WriteTags(filename string, metadata Metadata) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if metadataUpdater(ext) == nil {
+		return fmt.Errorf("format has no tag container: %s", filepath.Ext(filename))
+	}
+	if metadata.Get(historyTag) == "" {
+		if existing, err := readFileTags(filename); err == nil {
+			metadata = withHistoryTag(metadata, parseHistory(existing.Get(historyTag)), ext)
+		}
+	}
+	return writeMetadata(filename, metadata)
+}
@@ -0,0 +1,113 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTags(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	for _, ext := range []string{".wav", ".aiff", ".flac", ".wv"} {
+		t.Run(ext, func(t *testing.T) {
+			filename := filepath.Join(os.TempDir(), "test_output_tags"+ext)
+			defer os.Remove(filename)
+			if err := EncodeFile(audio, filename, OptionMetadata(testMetadata())); err != nil {
+				t.Fatalf("Failed to encode %s: %v", ext, err)
+			}
+			before, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %s: %v", ext, err)
+			}
+
+			m, err := ReadTags(filename)
+			if err != nil {
+				t.Fatalf("Failed to read tags: %v", err)
+			}
+			if !reflect.DeepEqual(m.Tags(), before.Metadata.Tags()) {
+				t.Errorf("ReadTags and DecodeFile disagree:\n%v\n%v", m.Tags(), before.Metadata.Tags())
+			}
+
+			m.Set("TITLE", "Edited")
+			m.Set("MOOD", "grim")
+			m.Set("ARTIST", "")
+			m.Pictures = nil
+			if err := WriteTags(filename, m); err != nil {
+				t.Fatalf("Failed to write tags: %v", err)
+			}
+
+			after, err := DecodeFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode edited %s: %v", ext, err)
+			}
+			if after.Metadata.Title != "Edited" || after.Metadata.Get("MOOD") != "grim" || after.Metadata.Artist != "" || len(after.Metadata.Pictures) != 0 {
+				t.Errorf("Unexpected tags after editing: %v", after.Metadata.Tags())
+			}
+			assertSamplesEqual(t, before.Data, after.Data)
+		})
+	}
+}
+
+func TestWriteTagsMP3(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), "test_output_tags_edit.mp3")
+	defer os.Remove(filename)
+	raw, err := os.ReadFile(filepath.Join("data", "wilhelm.mp3"))
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+	if err := os.WriteFile(filename, raw, 0644); err != nil {
+		t.Fatalf("Failed to copy MP3 file: %v", err)
+	}
+
+	// Tagging an MP3 file leaves its frames untouched
+	if err := WriteTags(filename, Metadata{Title: "Edited", TrackNumber: 2}); err != nil {
+		t.Fatalf("Failed to write tags: %v", err)
+	}
+	tagged, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read tagged MP3 file: %v", err)
+	}
+	if string(tagged[id3v2Size(tagged):]) != string(raw[id3v2Size(raw):]) {
+		t.Errorf("The MPEG frames were changed by tagging")
+	}
+	m, err := ReadTags(filename)
+	if err != nil {
+		t.Fatalf("Failed to read tags: %v", err)
+	}
+	if !reflect.DeepEqual(m.Tags(), [][2]string{{"TITLE", "Edited"}, {"TRACKNUMBER", "2"}}) {
+		t.Errorf("Unexpected tags: %v", m.Tags())
+	}
+}
+
+func TestReadChunks(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode WAV file: %v", err)
+	}
+	filename := filepath.Join(os.TempDir(), "test_output_chunks.wav")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionMetadata(Metadata{Title: "Chunks"}), OptionMarkers(testMarkers())); err != nil {
+		t.Fatalf("Failed to encode WAV file: %v", err)
+	}
+
+	chunks, err := ReadChunks(filename)
+	if err != nil {
+		t.Fatalf("Failed to read chunks: %v", err)
+	}
+	var ids []string
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.ID)
+	}
+	expected := []string{"fmt ", "bext", "data", "cue ", "LIST/adtl", "LIST/INFO", "id3 "}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected chunks %q, got %q", expected, ids)
+	}
+
+	if err := WriteTags(filepath.Join(os.TempDir(), "test_output_chunks.w64"), Metadata{Title: "W64"}); err == nil {
+		t.Errorf("Expected an error tagging a W64 file")
+	}
+}
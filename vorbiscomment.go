@@ -0,0 +1,268 @@
+package audiomorph
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+// vorbisVendor is the vendor string written in Vorbis comments
+const vorbisVendor = "audiomorph"
+
+// FLAC metadata block types
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockApplication   = 2
+	flacBlockVorbisComment = 4
+	flacBlockCueSheet      = 5
+	flacBlockPicture       = 6
+)
+
+// vorbisCommentMetadata reads the tags of a list of Vorbis comments, including the pictures
+// stored as METADATA_BLOCK_PICTURE
+func vorbisCommentMetadata(comments [][2]string) Metadata {
+	var m Metadata
+	for _, comment := range comments {
+		if strings.EqualFold(comment[0], "METADATA_BLOCK_PICTURE") {
+			data, err := base64.StdEncoding.DecodeString(comment[1])
+			if err != nil {
+				continue
+			}
+			if picture, err := parseFLACPicture(data); err == nil {
+				m.Pictures = append(m.Pictures, picture)
+			}
+			continue
+		}
+		m.add(comment[0], comment[1])
+	}
+	return m
+}
+
+// parseVorbisComment parses a Vorbis comment header into its name/value pairs
+func parseVorbisComment(data []byte) ([][2]string, error) {
+	readString := func() (string, error) {
+		if len(data) < 4 {
+			return "", fmt.Errorf("truncated Vorbis comment")
+		}
+		size := int(binary.LittleEndian.Uint32(data[0:4]))
+		if size > len(data)-4 {
+			return "", fmt.Errorf("truncated Vorbis comment")
+		}
+		s := string(data[4 : 4+size])
+		data = data[4+size:]
+		return s, nil
+	}
+
+	// Skip the vendor string
+	if _, err := readString(); err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("truncated Vorbis comment")
+	}
+	count := int(binary.LittleEndian.Uint32(data[0:4]))
+	data = data[4:]
+
+	var comments [][2]string
+	for i := 0; i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return comments, err
+		}
+		if name, value, ok := strings.Cut(comment, "="); ok {
+			comments = append(comments, [2]string{name, value})
+		}
+	}
+	return comments, nil
+}
+
+// buildVorbisComment builds a Vorbis comment header holding the text tags
+func buildVorbisComment(m Metadata) []byte {
+	return buildVorbisCommentFields(m.Tags())
+}
+
+// buildVorbisCommentFields builds a Vorbis comment header holding name/value pairs
+func buildVorbisCommentFields(fields [][2]string) []byte {
+	appendString := func(b []byte, s string) []byte {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+
+	data := appendString(nil, vorbisVendor)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(fields)))
+	for _, field := range fields {
+		data = appendString(data, field[0]+"="+field[1])
+	}
+	return data
+}
+
+// parseFLACPicture parses the body of a FLAC PICTURE metadata block
+func parseFLACPicture(data []byte) (Picture, error) {
+	var picture Picture
+	readUint32 := func() (int, error) {
+		if len(data) < 4 {
+			return 0, fmt.Errorf("truncated FLAC picture")
+		}
+		n := int(binary.BigEndian.Uint32(data[0:4]))
+		data = data[4:]
+		return n, nil
+	}
+	readBytes := func() ([]byte, error) {
+		size, err := readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if size > len(data) {
+			return nil, fmt.Errorf("truncated FLAC picture")
+		}
+		b := data[:size]
+		data = data[size:]
+		return b, nil
+	}
+
+	var err error
+	if picture.Type, err = readUint32(); err != nil {
+		return picture, err
+	}
+	mimeType, err := readBytes()
+	if err != nil {
+		return picture, err
+	}
+	description, err := readBytes()
+	if err != nil {
+		return picture, err
+	}
+
+	// Skip the width, height, color depth and palette size
+	if len(data) < 16 {
+		return picture, fmt.Errorf("truncated FLAC picture")
+	}
+	data = data[16:]
+	pictureData, err := readBytes()
+	if err != nil {
+		return picture, err
+	}
+
+	picture.MIMEType = string(mimeType)
+	picture.Description = string(description)
+	picture.Data = append([]byte(nil), pictureData...)
+	return picture, nil
+}
+
+// buildFLACPicture builds the body of a FLAC PICTURE metadata block
+func buildFLACPicture(picture Picture) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(picture.Type))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(picture.MIMEType)))
+	data = append(data, picture.MIMEType...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(picture.Description)))
+	data = append(data, picture.Description...)
+	width, height, depth, colors := pictureDimensions(picture.Data)
+	for _, n := range []int{width, height, depth, colors} {
+		data = binary.BigEndian.AppendUint32(data, uint32(n))
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(picture.Data)))
+	return append(data, picture.Data...)
+}
+
+// flacBlockMetadata reads the tags of the metadata blocks of a parsed FLAC stream
+func flacBlockMetadata(blocks []*meta.Block) Metadata {
+	var m Metadata
+	for _, block := range blocks {
+		switch body := block.Body.(type) {
+		case *meta.VorbisComment:
+			m.merge(vorbisCommentMetadata(body.Tags))
+		case *meta.Picture:
+			m.Pictures = append(m.Pictures, Picture{
+				Type:        int(body.Type),
+				MIMEType:    body.MIME,
+				Description: body.Desc,
+				Data:        body.Data,
+			})
+		}
+	}
+	return m
+}
+
+// flacBlock is a raw FLAC metadata block
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// readFLACBlocks reads the metadata blocks of a native FLAC file and returns the offset of the first frame
+func readFLACBlocks(raw []byte) ([]flacBlock, int, error) {
+	start := id3v2Size(raw)
+	if len(raw) < start+4 || string(raw[start:start+4]) != "fLaC" {
+		return nil, 0, fmt.Errorf("missing FLAC signature")
+	}
+
+	var blocks []flacBlock
+	pos := start + 4
+	for {
+		if pos+4 > len(raw) {
+			return nil, 0, fmt.Errorf("truncated FLAC metadata")
+		}
+		header := raw[pos]
+		size := int(raw[pos+1])<<16 | int(raw[pos+2])<<8 | int(raw[pos+3])
+		if pos+4+size > len(raw) {
+			return nil, 0, fmt.Errorf("truncated FLAC metadata")
+		}
+		blocks = append(blocks, flacBlock{blockType: header & 0x7F, data: raw[pos+4 : pos+4+size]})
+		pos += 4 + size
+		if header&0x80 != 0 {
+			return blocks, pos, nil
+		}
+	}
+}
+
+// writeFLACBlocks builds a native FLAC file from its metadata blocks and frames
+func writeFLACBlocks(blocks []flacBlock, frames []byte) []byte {
+	out := []byte("fLaC")
+	for i, block := range blocks {
+		header := block.blockType
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		size := len(block.data)
+		out = append(out, header, byte(size>>16), byte(size>>8), byte(size))
+		out = append(out, block.data...)
+	}
+	return append(out, frames...)
+}
+
+// updateFLACMetadata replaces the VORBIS_COMMENT and PICTURE blocks of a FLAC file,
+// placing the new blocks after STREAMINFO
+func updateFLACMetadata(raw []byte, m Metadata) ([]byte, error) {
+	blocks, frameStart, err := readFLACBlocks(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagBlocks []flacBlock
+	if !m.IsEmpty() {
+		tagBlocks = append(tagBlocks, flacBlock{blockType: flacBlockVorbisComment, data: buildVorbisComment(m)})
+	}
+	for _, picture := range m.Pictures {
+		tagBlocks = append(tagBlocks, flacBlock{blockType: flacBlockPicture, data: buildFLACPicture(picture)})
+	}
+
+	var updated []flacBlock
+	for _, block := range blocks {
+		switch block.blockType {
+		case flacBlockVorbisComment, flacBlockPicture:
+			continue
+		}
+		updated = append(updated, block)
+		if block.blockType == flacBlockStreamInfo {
+			updated = append(updated, tagBlocks...)
+		}
+	}
+	if len(updated) == 0 || updated[0].blockType != flacBlockStreamInfo {
+		return nil, fmt.Errorf("FLAC file does not start with STREAMINFO")
+	}
+
+	return writeFLACBlocks(updated, raw[frameStart:]), nil
+}
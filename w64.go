@@ -0,0 +1,132 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Sony Wave64 identifies chunks by GUID. The standard chunks are the RIFF chunk id
+// followed by a common suffix, which lets them share the WAV chunk decoding.
+var (
+	w64RIFFGUID   = []byte{'r', 'i', 'f', 'f', 0x2E, 0x91, 0xCF, 0x11, 0xA5, 0xD6, 0x28, 0xDB, 0x04, 0xC1, 0x00, 0x00}
+	w64WAVEGUID   = []byte{'w', 'a', 'v', 'e', 0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+	w64GUIDSuffix = []byte{0xF3, 0xAC, 0xD3, 0x11, 0x8C, 0xD1, 0x00, 0xC0, 0x4F, 0x8E, 0xDB, 0x8A}
+)
+
+// readW64 reads every chunk of a Wave64 file. Chunks with a standard GUID get their
+// four character id, any other chunk keeps the full GUID as its id.
+func readW64(raw []byte) ([]riffChunk, error) {
+	if len(raw) < 40 || !bytes.Equal(raw[0:16], w64RIFFGUID) || !bytes.Equal(raw[24:40], w64WAVEGUID) {
+		return nil, fmt.Errorf("missing Wave64 header")
+	}
+
+	var chunks []riffChunk
+	pos := 40
+	for pos+24 <= len(raw) {
+		guid := raw[pos : pos+16]
+		id := string(guid)
+		if bytes.Equal(guid[4:], w64GUIDSuffix) {
+			id = string(guid[0:4])
+		}
+
+		// Chunk sizes include the 24 byte header
+		size := binary.LittleEndian.Uint64(raw[pos+16 : pos+24])
+		if size < 24 {
+			return nil, fmt.Errorf("invalid Wave64 chunk size: %d", size)
+		}
+		start := pos + 24
+		end := len(raw)
+		if size-24 < uint64(len(raw)-start) {
+			end = start + int(size-24)
+		}
+		chunks = append(chunks, riffChunk{id: id, data: raw[start:end]})
+
+		// Chunks are aligned to 8 bytes
+		pos = end + (8-(end-pos)%8)%8
+	}
+
+	return chunks, nil
+}
+
+// writeW64 writes a Wave64 file with the given chunks, identified by a four character id
+// of a standard chunk or a full GUID
+func writeW64(w io.Writer, chunks []riffChunk) error {
+	var buf bytes.Buffer
+	buf.Write(w64RIFFGUID)
+	binary.Write(&buf, binary.LittleEndian, uint64(0)) // file size, patched below
+	buf.Write(w64WAVEGUID)
+	for _, chunk := range chunks {
+		buf.WriteString(chunk.id)
+		if len(chunk.id) == 4 {
+			buf.Write(w64GUIDSuffix)
+		}
+		binary.Write(&buf, binary.LittleEndian, uint64(24+len(chunk.data)))
+		buf.Write(chunk.data)
+		if pad := (8 - len(chunk.data)%8) % 8; pad > 0 {
+			buf.Write(make([]byte, pad))
+		}
+	}
+
+	out := buf.Bytes()
+	binary.LittleEndian.PutUint64(out[16:24], uint64(len(out)))
+	_, err := w.Write(out)
+	return err
+}
+
+// decodeW64 decodes a Sony Wave64 file
+func decodeW64(filename string) (*Audio, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open W64 file: %w", err)
+	}
+
+	chunks, err := readW64(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid W64 file: %w", err)
+	}
+	fmtChunk := findChunk(chunks, "fmt ")
+	if fmtChunk == nil {
+		return nil, fmt.Errorf("invalid W64 file: missing fmt chunk")
+	}
+	format, err := parseWAVFormat(fmtChunk.data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid W64 file: %w", err)
+	}
+
+	audio, err := decodeWAVChunks(format, chunks)
+	if err != nil {
+		return nil, err
+	}
+	audio.Markers = wavMarkers(chunks)
+	audio.Instrument = wavInstrument(chunks)
+	audio.LoopInfo = wavLoopInfo(chunks)
+	readBroadcastChunks(audio, chunks)
+	return audio, nil
+}
+
+// encodeW64 encodes audio data to a Sony Wave64 file using the codec from OptionWAVCodec
+func encodeW64(audio *Audio, filename string) error {
+	tag, err := wavCodecTag(audio)
+	if err != nil {
+		return err
+	}
+	chunks, err := wavChunks(audio, tag)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create W64 file: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeW64(f, chunks); err != nil {
+		return fmt.Errorf("failed to write W64 data: %w", err)
+	}
+
+	return nil
+}
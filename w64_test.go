@@ -0,0 +1,71 @@
+package audiomorph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeW64(t *testing.T) {
+	srcFilename := filepath.Join("data", "wilhelm.wav")
+
+	testCases := []struct {
+		name     string
+		options  []Option
+		bitDepth int
+	}{
+		{"pcm16", nil, 16},
+		{"pcm24", []Option{OptionBitDepth(24)}, 24},
+		{"float", []Option{OptionWAVCodec("float")}, 32},
+		{"ulaw", []Option{OptionWAVCodec("ulaw")}, 16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			audio, err := DecodeFile(srcFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode source file: %v", err)
+			}
+
+			dstFilename := filepath.Join(os.TempDir(), "test_output_"+tc.name+".w64")
+			defer os.Remove(dstFilename)
+
+			err = EncodeFile(audio, dstFilename, tc.options...)
+			if err != nil {
+				t.Fatalf("Failed to encode W64 file: %v", err)
+			}
+
+			decodedAudio, err := DecodeFile(dstFilename)
+			if err != nil {
+				t.Fatalf("Failed to decode W64 file: %v", err)
+			}
+
+			// Verify basic properties match
+			if decodedAudio.NumChannels != audio.NumChannels {
+				t.Errorf("NumChannels mismatch: expected %d, got %d", audio.NumChannels, decodedAudio.NumChannels)
+			}
+			if decodedAudio.SampleRate != audio.SampleRate {
+				t.Errorf("SampleRate mismatch: expected %d, got %d", audio.SampleRate, decodedAudio.SampleRate)
+			}
+			if decodedAudio.BitDepth != tc.bitDepth {
+				t.Errorf("BitDepth mismatch: expected %d, got %d", tc.bitDepth, decodedAudio.BitDepth)
+			}
+			if len(decodedAudio.Data[0]) != len(audio.Data[0]) {
+				t.Fatalf("Sample count mismatch: expected %d, got %d", len(audio.Data[0]), len(decodedAudio.Data[0]))
+			}
+
+			// PCM must survive unchanged
+			if tc.name == "pcm16" || tc.name == "pcm24" {
+				for ch := 0; ch < audio.NumChannels; ch++ {
+					for i, sample := range audio.Data[ch] {
+						if decodedAudio.Data[ch][i] != sample {
+							t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, sample, decodedAudio.Data[ch][i])
+						}
+					}
+				}
+			}
+		})
+	}
+
+	t.Logf("W64 Encode/Decode test passed")
+}
@@ -0,0 +1,326 @@
+package audiomorph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WAV format tags
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatMSADPCM    = 0x0002
+	wavFormatIEEEFloat  = 0x0003
+	wavFormatALaw       = 0x0006
+	wavFormatULaw       = 0x0007
+	wavFormatIMAADPCM   = 0x0011
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavCodecTags maps the codec names accepted by OptionWAVCodec to WAV format tags
+var wavCodecTags = map[string]uint16{
+	"pcm":       wavFormatPCM,
+	"float":     wavFormatIEEEFloat,
+	"ulaw":      wavFormatULaw,
+	"alaw":      wavFormatALaw,
+	"ima-adpcm": wavFormatIMAADPCM,
+	"ms-adpcm":  wavFormatMSADPCM,
+}
+
+// OptionWAVCodec specifies the sample encoding used when writing WAV files.
+// Valid codecs are: "pcm" (default), "float", "ulaw", "alaw", "ima-adpcm", "ms-adpcm".
+// The G.711 and ADPCM codecs always encode 16-bit audio.
+func OptionWAVCodec(codec string) Option {
+	return func(a *Audio) {
+		a.wavCodec = codec
+	}
+}
+
+// wavCodecTag returns the WAV format tag for the codec configured on an Audio
+func wavCodecTag(a *Audio) (uint16, error) {
+	if a.wavCodec == "" {
+		return wavFormatPCM, nil
+	}
+	tag, ok := wavCodecTags[strings.ToLower(a.wavCodec)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported WAV codec: %s", a.wavCodec)
+	}
+	return tag, nil
+}
+
+// wavFormat holds the contents of a WAV fmt chunk
+type wavFormat struct {
+	formatTag       uint16
+	numChannels     int
+	sampleRate      int
+	blockAlign      int
+	bitsPerSample   int
+	samplesPerBlock int
+	coefficients    [][2]int
+}
+
+// parseWAVFormat parses a WAV fmt chunk, resolving WAVE_FORMAT_EXTENSIBLE to its sub-format
+func parseWAVFormat(data []byte) (wavFormat, error) {
+	var format wavFormat
+	if len(data) < 16 {
+		return format, fmt.Errorf("fmt chunk too short")
+	}
+	format.formatTag = binary.LittleEndian.Uint16(data[0:2])
+	format.numChannels = int(binary.LittleEndian.Uint16(data[2:4]))
+	format.sampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+	format.blockAlign = int(binary.LittleEndian.Uint16(data[12:14]))
+	format.bitsPerSample = int(binary.LittleEndian.Uint16(data[14:16]))
+
+	var extra []byte
+	if len(data) >= 18 {
+		size := int(binary.LittleEndian.Uint16(data[16:18]))
+		extra = data[18:]
+		if size < len(extra) {
+			extra = extra[:size]
+		}
+	}
+
+	switch format.formatTag {
+	case wavFormatExtensible:
+		// Valid bits, channel mask, then the sub-format GUID whose first two bytes are the format tag
+		if len(extra) < 22 {
+			return format, fmt.Errorf("WAVE_FORMAT_EXTENSIBLE fmt chunk too short")
+		}
+		format.formatTag = binary.LittleEndian.Uint16(extra[6:8])
+	case wavFormatIMAADPCM:
+		if len(extra) >= 2 {
+			format.samplesPerBlock = int(binary.LittleEndian.Uint16(extra[0:2]))
+		}
+	case wavFormatMSADPCM:
+		if len(extra) >= 4 {
+			format.samplesPerBlock = int(binary.LittleEndian.Uint16(extra[0:2]))
+			numCoef := int(binary.LittleEndian.Uint16(extra[2:4]))
+			for i := 0; i < numCoef && 4+i*4+4 <= len(extra); i++ {
+				c1 := int(int16(binary.LittleEndian.Uint16(extra[4+i*4:])))
+				c2 := int(int16(binary.LittleEndian.Uint16(extra[6+i*4:])))
+				format.coefficients = append(format.coefficients, [2]int{c1, c2})
+			}
+		}
+	}
+
+	if format.numChannels <= 0 || format.sampleRate <= 0 {
+		return format, fmt.Errorf("invalid WAV format: %d channels at %d Hz", format.numChannels, format.sampleRate)
+	}
+
+	return format, nil
+}
+
+// decodeWAVChunks decodes the data chunk of a WAV or Wave64 file from its parsed chunks
+func decodeWAVChunks(format wavFormat, chunks []riffChunk) (*Audio, error) {
+	dataChunk := findChunk(chunks, "data")
+	if dataChunk == nil {
+		return nil, fmt.Errorf("WAV file has no data chunk")
+	}
+	data := dataChunk.data
+	numChannels := format.numChannels
+
+	var samples []int
+	var err error
+	bitDepth := 16
+	switch format.formatTag {
+	case wavFormatPCM:
+		// 8-bit WAV samples are unsigned, wider samples are signed little endian
+		bitDepth = format.bitsPerSample
+		if bitDepth != 8 && bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+			return nil, fmt.Errorf("unsupported PCM bit depth: %d", bitDepth)
+		}
+		samples = decodeSamples(data, rawSpec{bits: bitDepth, unsigned: bitDepth == 8})
+	case wavFormatULaw, wavFormatALaw:
+		expand := uLawToLinear
+		if format.formatTag == wavFormatALaw {
+			expand = aLawToLinear
+		}
+		samples = make([]int, len(data))
+		for i, code := range data {
+			samples[i] = expand(code)
+		}
+	case wavFormatIMAADPCM:
+		samples, err = decodeIMAADPCM(data, numChannels, format.blockAlign)
+	case wavFormatMSADPCM:
+		samples, err = decodeMSADPCM(data, numChannels, format.blockAlign, format.coefficients)
+	case wavFormatIEEEFloat:
+		// Float samples are scaled to 32-bit integers
+		if format.bitsPerSample != 32 && format.bitsPerSample != 64 {
+			return nil, fmt.Errorf("unsupported float sample size: %d bits", format.bitsPerSample)
+		}
+		bitDepth = 32
+		samples = decodeSamples(data, rawSpec{bits: format.bitsPerSample, float: true})
+	default:
+		return nil, fmt.Errorf("unsupported WAV format tag: %#04x", format.formatTag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WAV data: %w", err)
+	}
+
+	// The fact chunk holds the true sample count of block based codecs
+	numSamples := len(samples) / numChannels
+	if fact := findChunk(chunks, "fact"); fact != nil && len(fact.data) >= 4 {
+		if n := int(binary.LittleEndian.Uint32(fact.data)); n < numSamples {
+			numSamples = n
+		}
+	}
+
+	channelData := deinterlace(samples[:numSamples*numChannels], numChannels)
+	return &Audio{
+		NumChannels: numChannels,
+		SampleRate:  format.sampleRate,
+		BitDepth:    bitDepth,
+		Data:        channelData,
+		Duration:    float64(numSamples) / float64(format.sampleRate),
+	}, nil
+}
+
+// deinterlace splits interleaved samples into per-channel slices
+func deinterlace(samples []int, numChannels int) [][]int {
+	numSamples := len(samples) / numChannels
+	data := make([][]int, numChannels)
+	for ch := 0; ch < numChannels; ch++ {
+		data[ch] = make([]int, numSamples)
+	}
+	for i := 0; i < numSamples*numChannels; i++ {
+		data[i%numChannels][i/numChannels] = samples[i]
+	}
+	return data
+}
+
+// interlace returns the interleaved samples of the channels selected for encoding, and their count
+func interlace(audio *Audio) ([]int, int) {
+	// Determine number of channels (mono conversion if requested)
+	numChannels := audio.NumChannels
+	useChannels := audio.useChannels
+	if len(useChannels) > 0 {
+		numChannels = len(useChannels)
+	}
+
+	numSamples := len(audio.Data[0])
+	interlacedData := make([]int, numSamples*numChannels)
+	for i := 0; i < numSamples; i++ {
+		for ch := 0; ch < numChannels; ch++ {
+			// Use the specified channel from useChannels, or original channel if not specified
+			sourceChannel := ch
+			if len(useChannels) > 0 {
+				sourceChannel = useChannels[ch]
+			}
+			interlacedData[i*numChannels+ch] = audio.Data[sourceChannel][i]
+		}
+	}
+	return interlacedData, numChannels
+}
+
+// adpcmBlockAlign returns the conventional ADPCM block size for a sample rate and channel count
+func adpcmBlockAlign(sampleRate, numChannels int) int {
+	blockAlign := 256 * numChannels
+	if sampleRate > 11025 {
+		blockAlign *= sampleRate / 11025
+	}
+	return blockAlign
+}
+
+// encodeWAVCodec encodes audio data to a WAV file with a non-PCM codec
+func encodeWAVCodec(audio *Audio, filename string, tag uint16) error {
+	chunks, err := wavChunks(audio, tag)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create WAV file: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeRIFF(f, "WAVE", chunks); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+
+	return nil
+}
+
+// wavChunks builds the fmt, fact and data chunks of a WAV or Wave64 file with the given format tag
+func wavChunks(audio *Audio, tag uint16) ([]riffChunk, error) {
+	samples, numChannels := interlace(audio)
+	numSamples := len(samples) / numChannels
+
+	var data, extra []byte
+	bitsPerSample := 16
+	blockAlign := numChannels
+	byteRate := audio.SampleRate * numChannels
+	switch tag {
+	case wavFormatPCM:
+		bitsPerSample = audio.BitDepth
+		blockAlign = numChannels * bitsPerSample / 8
+		byteRate = audio.SampleRate * blockAlign
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: bitsPerSample, unsigned: bitsPerSample == 8})
+	case wavFormatULaw, wavFormatALaw:
+		compress := linearToULaw
+		if tag == wavFormatALaw {
+			compress = linearToALaw
+		}
+		data = make([]byte, len(samples))
+		for i, sample := range samples {
+			data[i] = compress(sample)
+		}
+		bitsPerSample = 8
+	case wavFormatIEEEFloat:
+		data = encodeSamples(samples, audio.BitDepth, rawSpec{bits: 32, float: true})
+		bitsPerSample = 32
+		blockAlign = 4 * numChannels
+		byteRate = audio.SampleRate * blockAlign
+	case wavFormatIMAADPCM:
+		blockAlign = adpcmBlockAlign(audio.SampleRate, numChannels)
+		samplesPerBlock := imaSamplesPerBlock(blockAlign, numChannels)
+		data = encodeIMAADPCM(samples, numChannels, blockAlign)
+		bitsPerSample = 4
+		byteRate = audio.SampleRate * blockAlign / samplesPerBlock
+		extra = binary.LittleEndian.AppendUint16(extra, uint16(samplesPerBlock))
+	case wavFormatMSADPCM:
+		if numChannels > 2 {
+			return nil, fmt.Errorf("MS ADPCM supports at most 2 channels, got %d", numChannels)
+		}
+		blockAlign = adpcmBlockAlign(audio.SampleRate, numChannels)
+		samplesPerBlock := msSamplesPerBlock(blockAlign, numChannels)
+		data = encodeMSADPCM(samples, numChannels, blockAlign)
+		bitsPerSample = 4
+		byteRate = audio.SampleRate * blockAlign / samplesPerBlock
+		extra = binary.LittleEndian.AppendUint16(extra, uint16(samplesPerBlock))
+		extra = binary.LittleEndian.AppendUint16(extra, uint16(len(msCoefficients)))
+		for _, coef := range msCoefficients {
+			extra = binary.LittleEndian.AppendUint16(extra, uint16(int16(coef[0])))
+			extra = binary.LittleEndian.AppendUint16(extra, uint16(int16(coef[1])))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported WAV format tag: %#04x", tag)
+	}
+
+	fmtData := make([]byte, 0, 18+len(extra))
+	fmtData = binary.LittleEndian.AppendUint16(fmtData, tag)
+	fmtData = binary.LittleEndian.AppendUint16(fmtData, uint16(numChannels))
+	fmtData = binary.LittleEndian.AppendUint32(fmtData, uint32(audio.SampleRate))
+	fmtData = binary.LittleEndian.AppendUint32(fmtData, uint32(byteRate))
+	fmtData = binary.LittleEndian.AppendUint16(fmtData, uint16(blockAlign))
+	fmtData = binary.LittleEndian.AppendUint16(fmtData, uint16(bitsPerSample))
+
+	// PCM uses the plain 16 byte fmt chunk, every other format carries a cbSize field and a fact chunk
+	if tag == wavFormatPCM {
+		return []riffChunk{
+			{id: "fmt ", data: fmtData},
+			{id: "data", data: data},
+		}, nil
+	}
+	fmtData = binary.LittleEndian.AppendUint16(fmtData, uint16(len(extra)))
+	fmtData = append(fmtData, extra...)
+
+	fact := binary.LittleEndian.AppendUint32(nil, uint32(numSamples))
+
+	return []riffChunk{
+		{id: "fmt ", data: fmtData},
+		{id: "fact", data: fact},
+		{id: "data", data: data},
+	}, nil
+}
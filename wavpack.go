@@ -0,0 +1,1075 @@
+package audiomorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// WavPack block header flags
+const (
+	wvFlagBytesStored   = 0x3
+	wvFlagMono          = 0x4
+	wvFlagHybrid        = 0x8
+	wvFlagJointStereo   = 0x10
+	wvFlagCrossDecorr   = 0x20
+	wvFlagFloat         = 0x80
+	wvFlagInt32         = 0x100
+	wvFlagHybridBitrate = 0x200
+	wvFlagHybridBalance = 0x400
+	wvFlagInitialBlock  = 0x800
+	wvFlagFinalBlock    = 0x1000
+	wvFlagFalseStereo   = 0x40000000
+	wvFlagDSD           = 0x80000000
+
+	wvShiftLSB = 13
+	wvMagLSB   = 18
+	wvSRateLSB = 23
+)
+
+// WavPack metadata sub-block ids
+const (
+	wvIDDecorrTerms   = 0x2
+	wvIDDecorrWeights = 0x3
+	wvIDDecorrSamples = 0x4
+	wvIDEntropyVars   = 0x5
+	wvIDHybridProfile = 0x6
+	wvIDFloatInfo     = 0x8
+	wvIDInt32Info     = 0x9
+	wvIDBitstream     = 0xA
+	wvIDExtraBits     = 0xC
+	wvIDChannelInfo   = 0xD
+	wvIDSampleRate    = 0x27
+
+	wvIDFunction = 0x3F
+	wvIDOddSize  = 0x40
+	wvIDLarge    = 0x80
+)
+
+// Float info flags describing how the bits lost when normalizing floats are restored
+const (
+	wvFloatShiftOnes = 0x1
+	wvFloatShiftSame = 0x2
+	wvFloatShiftSent = 0x4
+	wvFloatZeroSent  = 0x8
+	wvFloatZeroSign  = 0x10
+)
+
+// wvVersion is the stream version written to each block
+const wvVersion = 0x407
+
+// wvBlockSamples is the number of samples per channel written in each block
+const wvBlockSamples = 22050
+
+// wvSampleRates are the sample rates with an index in the block header
+var wvSampleRates = []int{6000, 8000, 9600, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000, 64000, 88200, 96000, 192000}
+
+// wvDefaultTerms are the decorrelation terms used by the encoder, in encoding order
+var wvDefaultTerms = []int{18, 18, 2, 3, -2}
+
+// wvDefaultBitrate is the hybrid mode bitrate in bits per sample
+const wvDefaultBitrate = 4.0
+
+// OptionWavPackMode specifies how WavPack (.wv) files are written.
+// Valid modes are: "lossless" (default, integer samples), "float" (lossless 32-bit float samples),
+// "hybrid" (lossy, at the bitrate from OptionWavPackBitrate).
+func OptionWavPackMode(mode string) Option {
+	return func(a *Audio) {
+		a.wavpackMode = mode
+	}
+}
+
+// OptionWavPackBitrate specifies the bitrate of hybrid WavPack files in bits per sample (default 4)
+func OptionWavPackBitrate(bitsPerSample float64) Option {
+	return func(a *Audio) {
+		a.wavpackBitrate = bitsPerSample
+	}
+}
+
+// wavpackModeName returns the canonical WavPack mode configured on an Audio
+func wavpackModeName(a *Audio) (string, error) {
+	mode := strings.ToLower(a.wavpackMode)
+	switch mode {
+	case "":
+		return "lossless", nil
+	case "lossless", "float", "hybrid":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported WavPack mode: %s", a.wavpackMode)
+	}
+}
+
+// wvHeader is the fixed 32 byte header of a WavPack block
+type wvHeader struct {
+	blockSize    int
+	version      int
+	totalSamples int
+	blockIndex   int
+	blockSamples int
+	flags        uint32
+	crc          uint32
+}
+
+// parseWvHeader parses a block header
+func parseWvHeader(b []byte) (wvHeader, error) {
+	if len(b) < 32 || string(b[0:4]) != "wvpk" {
+		return wvHeader{}, fmt.Errorf("missing WavPack block header")
+	}
+	h := wvHeader{
+		blockSize:    int(binary.LittleEndian.Uint32(b[4:8])) + 8,
+		version:      int(binary.LittleEndian.Uint16(b[8:10])),
+		totalSamples: int(binary.LittleEndian.Uint32(b[12:16])) | int(b[11])<<32,
+		blockIndex:   int(binary.LittleEndian.Uint32(b[16:20])) | int(b[10])<<32,
+		blockSamples: int(binary.LittleEndian.Uint32(b[20:24])),
+		flags:        binary.LittleEndian.Uint32(b[24:28]),
+		crc:          binary.LittleEndian.Uint32(b[28:32]),
+	}
+	if h.version < 0x402 || h.version > 0x410 {
+		return h, fmt.Errorf("unsupported WavPack version: 0x%x", h.version)
+	}
+	if h.blockSize < 32 {
+		return h, fmt.Errorf("invalid WavPack block size: %d", h.blockSize)
+	}
+	return h, nil
+}
+
+// appendWvHeader appends a block header, the block size is patched once the block is complete
+func appendWvHeader(b []byte, h wvHeader) []byte {
+	b = append(b, "wvpk"...)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, uint16(h.version))
+	b = append(b, byte(h.blockIndex>>32), byte(h.totalSamples>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.totalSamples))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.blockIndex))
+	b = binary.LittleEndian.AppendUint32(b, uint32(h.blockSamples))
+	b = binary.LittleEndian.AppendUint32(b, h.flags)
+	return binary.LittleEndian.AppendUint32(b, h.crc)
+}
+
+// wvSubBlock is a metadata sub-block of a WavPack block
+type wvSubBlock struct {
+	id   byte
+	data []byte
+}
+
+// readWvSubBlocks reads the metadata sub-blocks following a block header
+func readWvSubBlocks(block []byte) ([]wvSubBlock, error) {
+	var subBlocks []wvSubBlock
+	pos := 32
+	for pos+2 <= len(block) {
+		id := block[pos]
+		words := int(block[pos+1])
+		pos += 2
+		if id&wvIDLarge != 0 {
+			if pos+2 > len(block) {
+				return nil, fmt.Errorf("truncated WavPack metadata")
+			}
+			words |= int(block[pos])<<8 | int(block[pos+1])<<16
+			pos += 2
+		}
+		size := words * 2
+		if pos+size > len(block) {
+			return nil, fmt.Errorf("truncated WavPack metadata")
+		}
+		data := block[pos : pos+size]
+		if id&wvIDOddSize != 0 && size > 0 {
+			data = data[:size-1]
+		}
+		subBlocks = append(subBlocks, wvSubBlock{id: id & wvIDFunction, data: data})
+		pos += size
+	}
+	return subBlocks, nil
+}
+
+// appendWvSubBlock appends a metadata sub-block, padded to a whole number of 16-bit words
+func appendWvSubBlock(b []byte, id byte, data []byte) []byte {
+	words := (len(data) + 1) / 2
+	if len(data)%2 == 1 {
+		id |= wvIDOddSize
+	}
+	if words > 0xFF {
+		b = append(b, id|wvIDLarge, byte(words), byte(words>>8), byte(words>>16))
+	} else {
+		b = append(b, id, byte(words))
+	}
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// wvBlock is the decoded content of one block: one or two channels of samples at the block's bit depth
+type wvBlock struct {
+	channels   [][]int
+	bitDepth   int
+	sampleRate int
+}
+
+// decodeWavPackBlock decodes the samples of one block
+func decodeWavPackBlock(block []byte, h wvHeader) (*wvBlock, error) {
+	flags := h.flags
+	if flags&wvFlagDSD != 0 {
+		return nil, fmt.Errorf("unsupported WavPack DSD audio")
+	}
+	bytesStored := int(flags&wvFlagBytesStored) + 1
+	isFloat := flags&wvFlagFloat != 0
+	hybrid := flags&wvFlagHybrid != 0
+
+	s := &wvStream{
+		stereo: flags&(wvFlagMono|wvFlagFalseStereo) == 0,
+		joint:  flags&wvFlagJointStereo != 0,
+	}
+	s.words.stereo = s.stereo
+	s.words.hybrid = hybrid
+	s.words.hybridBitrate = flags&wvFlagHybridBitrate != 0
+	s.words.hybridBalance = flags&wvFlagHybridBalance != 0
+
+	out := &wvBlock{bitDepth: bytesStored * 8}
+	if isFloat {
+		out.bitDepth = 32
+	}
+	if index := int(flags>>wvSRateLSB) & 0xF; index < len(wvSampleRates) {
+		out.sampleRate = wvSampleRates[index]
+	}
+
+	subBlocks, err := readWvSubBlocks(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var bitstream, extraBits []byte
+	var floatFlags, floatShift, floatMaxExp int
+	var int32Extra, int32Shift, int32And, int32Or int
+	var crcExtra uint32
+	for _, sb := range subBlocks {
+		data := sb.data
+		switch sb.id {
+		case wvIDDecorrTerms:
+			s.decorr = make([]wvDecorr, len(data))
+			for i, b := range data {
+				d := &s.decorr[len(data)-i-1]
+				d.term = int(b&0x1F) - 5
+				d.delta = int(b>>5) & 7
+				if d.term == 0 || d.term < -3 || (d.term > 8 && d.term < 17) || d.term > 18 || (d.term < 0 && !s.stereo) {
+					return nil, fmt.Errorf("invalid WavPack decorrelation term: %d", d.term)
+				}
+			}
+		case wvIDDecorrWeights:
+			count := len(data)
+			if s.stereo {
+				count /= 2
+			}
+			if count > len(s.decorr) {
+				return nil, fmt.Errorf("invalid WavPack decorrelation weights")
+			}
+			for i := 0; i < count; i++ {
+				d := &s.decorr[len(s.decorr)-i-1]
+				if s.stereo {
+					d.weightA = wvRestoreWeight(int(int8(data[2*i])))
+					d.weightB = wvRestoreWeight(int(int8(data[2*i+1])))
+				} else {
+					d.weightA = wvRestoreWeight(int(int8(data[i])))
+				}
+			}
+		case wvIDDecorrSamples:
+			pos := 0
+			next := func() int {
+				if pos+2 > len(data) {
+					pos += 2
+					return 0
+				}
+				value := wvExp2(int(int16(binary.LittleEndian.Uint16(data[pos:]))))
+				pos += 2
+				return value
+			}
+			for i := len(s.decorr) - 1; i >= 0 && pos < len(data); i-- {
+				d := &s.decorr[i]
+				switch {
+				case d.term > 8:
+					d.samplesA[0], d.samplesA[1] = next(), next()
+					if s.stereo {
+						d.samplesB[0], d.samplesB[1] = next(), next()
+					}
+				case d.term < 0:
+					d.samplesA[0], d.samplesB[0] = next(), next()
+				default:
+					for j := 0; j < d.term; j++ {
+						d.samplesA[j] = next()
+						if s.stereo {
+							d.samplesB[j] = next()
+						}
+					}
+				}
+			}
+		case wvIDEntropyVars:
+			numChannels := 1
+			if s.stereo {
+				numChannels = 2
+			}
+			if len(data) < 6*numChannels {
+				return nil, fmt.Errorf("invalid WavPack entropy variables")
+			}
+			for ch := 0; ch < numChannels; ch++ {
+				for i := 0; i < 3; i++ {
+					s.words.ch[ch].median[i] = uint32(wvExp2(int(int16(binary.LittleEndian.Uint16(data[6*ch+2*i:])))))
+				}
+			}
+		case wvIDHybridProfile:
+			numChannels := 1
+			if s.stereo {
+				numChannels = 2
+			}
+			pos := 0
+			if s.words.hybridBitrate {
+				for ch := 0; ch < numChannels && pos+2 <= len(data); ch++ {
+					s.words.ch[ch].slowLevel = wvExp2(int(int16(binary.LittleEndian.Uint16(data[pos:]))))
+					pos += 2
+				}
+			}
+			for ch := 0; ch < numChannels && pos+2 <= len(data); ch++ {
+				s.words.ch[ch].bitrateAcc = uint32(binary.LittleEndian.Uint16(data[pos:])) << 16
+				pos += 2
+			}
+			for ch := 0; ch < numChannels && pos+2 <= len(data); ch++ {
+				s.words.ch[ch].bitrateDelta = uint32(wvExp2(int(int16(binary.LittleEndian.Uint16(data[pos:])))))
+				pos += 2
+			}
+		case wvIDFloatInfo:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("invalid WavPack float info")
+			}
+			floatFlags, floatShift, floatMaxExp = int(data[0]), int(data[1]), int(data[2])
+		case wvIDInt32Info:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("invalid WavPack int32 info")
+			}
+			switch {
+			case data[0] != 0:
+				int32Extra = int(data[0])
+			case data[1] != 0:
+				int32Shift = int(data[1])
+			case data[2] != 0:
+				int32And, int32Or, int32Shift = 1, 1, int(data[2])
+			case data[3] != 0:
+				int32And, int32Shift = 1, int(data[3])
+			}
+			if int32Extra > 30 || int32Shift > 31 {
+				return nil, fmt.Errorf("invalid WavPack int32 info")
+			}
+		case wvIDSampleRate:
+			if len(data) >= 3 {
+				out.sampleRate = int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+			}
+		case wvIDBitstream:
+			bitstream = data
+		case wvIDExtraBits:
+			if len(data) > 4 {
+				crcExtra = binary.LittleEndian.Uint32(data[0:4])
+				extraBits = data[4:]
+			}
+		}
+	}
+	if out.sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid WavPack sample rate")
+	}
+	if bitstream == nil {
+		return nil, fmt.Errorf("invalid WavPack block: missing bitstream")
+	}
+
+	r := &wvBitReader{data: bitstream}
+	var extra *wvBitReader
+	if extraBits != nil {
+		extra = &wvBitReader{data: extraBits}
+	}
+
+	numChannels := 1
+	if s.stereo {
+		numChannels = 2
+	}
+	values := make([][]int, numChannels)
+	for ch := range values {
+		values[ch] = make([]int, h.blockSamples)
+	}
+
+	crc := uint32(0xFFFFFFFF)
+	for i := 0; i < h.blockSamples; i++ {
+		if s.stereo {
+			l, err := s.words.getWord(r, 0)
+			if err != nil {
+				return nil, err
+			}
+			rr, err := s.words.getWord(r, 1)
+			if err != nil {
+				return nil, err
+			}
+			l, rr = s.unpackStereo(l, rr)
+			if s.joint {
+				rr -= l >> 1
+				l += rr
+			}
+			crc = (crc*3+uint32(l))*3 + uint32(rr)
+			values[0][i], values[1][i] = l, rr
+		} else {
+			value, err := s.words.getWord(r, 0)
+			if err != nil {
+				return nil, err
+			}
+			value = s.unpackMono(value)
+			crc = crc*3 + uint32(value)
+			values[0][i] = value
+		}
+	}
+	if crc != h.crc {
+		return nil, fmt.Errorf("WavPack CRC mismatch")
+	}
+
+	// Restore the bits that were shifted out or sent separately
+	extraCRC := uint32(0xFFFFFFFF)
+	shift := int(flags>>wvShiftLSB) & 0x1F
+	for i := 0; i < h.blockSamples; i++ {
+		for ch := 0; ch < numChannels; ch++ {
+			value := values[ch][i]
+			if isFloat {
+				f := wvFloatValue(value, floatFlags, floatShift, floatMaxExp, extra, &extraCRC)
+				values[ch][i] = clampSample(float64(f)*float64(int64(1)<<31), 32)
+				continue
+			}
+			if int32Extra > 0 {
+				value <<= uint(int32Extra)
+				if extra != nil {
+					value |= int(extra.bits(int32Extra))
+					u := uint32(value)
+					extraCRC = extraCRC*9 + (u&0xFFFF)*3 + u>>16
+				}
+			}
+			if int32Shift > 0 {
+				bit := value&int32And | int32Or
+				value = (value+bit)<<uint(int32Shift) - bit
+			}
+			value <<= uint(shift)
+			if hybrid {
+				value = clampSample(float64(value), out.bitDepth)
+			}
+			values[ch][i] = value
+		}
+	}
+	if extra != nil && extraCRC != crcExtra {
+		return nil, fmt.Errorf("WavPack extra bits CRC mismatch")
+	}
+
+	// A false stereo block codes both channels once
+	if flags&wvFlagMono == 0 && !s.stereo {
+		values = append(values, append([]int(nil), values[0]...))
+	}
+	out.channels = values
+	return out, nil
+}
+
+// wvFloatValue rebuilds a float from its integer part and the extra bits lost when it was normalized
+func wvFloatValue(value, floatFlags, floatShift, maxExp int, extra *wvBitReader, crc *uint32) float32 {
+	var sign, exp, mantissa uint32
+	if value != 0 {
+		value <<= uint(floatShift)
+		if value < 0 {
+			sign = 1
+			value = -value
+		}
+		s := uint32(value)
+		switch {
+		case s >= 0x1000000:
+			s = 0
+			if extra != nil && extra.bit() == 1 {
+				s = extra.bits(23)
+			}
+			exp = 255
+		case maxExp != 0:
+			shift := 23 - (bits.Len32(s) - 1)
+			e := maxExp
+			if e <= shift {
+				e--
+				shift = e
+			}
+			exp = uint32(e - shift)
+			if shift > 0 {
+				s <<= uint(shift)
+				switch {
+				case floatFlags&wvFloatShiftOnes != 0:
+					s |= 1<<uint(shift) - 1
+				case extra != nil && floatFlags&wvFloatShiftSame != 0:
+					if extra.bit() == 1 {
+						s |= 1<<uint(shift) - 1
+					}
+				case extra != nil && floatFlags&wvFloatShiftSent != 0:
+					s |= extra.bits(shift)
+				}
+			}
+		default:
+			exp = uint32(maxExp)
+		}
+		mantissa = s & 0x7FFFFF
+	} else if extra != nil && floatFlags&wvFloatZeroSent != 0 {
+		if extra.bit() == 1 {
+			mantissa = extra.bits(23)
+			if maxExp >= 25 {
+				exp = extra.bits(8)
+			}
+			sign = extra.bit()
+		} else if floatFlags&wvFloatZeroSign != 0 {
+			sign = extra.bit()
+		}
+	}
+
+	*crc = *crc*27 + mantissa*9 + exp*3 + sign
+	return math.Float32frombits(sign<<31 | exp<<23 | mantissa)
+}
+
+// decodeWavPack decodes a WavPack (.wv) file
+func decodeWavPack(filename string) (*Audio, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WavPack file: %w", err)
+	}
+
+	var data [][]int
+	bitDepth, sampleRate := 0, 0
+	channel := 0
+	pos := 0
+	for {
+		// Skip anything between blocks, such as a leading ID3 tag
+		next := bytes.Index(raw[pos:], []byte("wvpk"))
+		if next < 0 {
+			break
+		}
+		pos += next
+		h, err := parseWvHeader(raw[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid WavPack file: %w", err)
+		}
+		if pos+h.blockSize > len(raw) {
+			return nil, fmt.Errorf("invalid WavPack file: truncated block")
+		}
+		block := raw[pos : pos+h.blockSize]
+		pos += h.blockSize
+		if h.blockSamples == 0 {
+			continue
+		}
+
+		decoded, err := decodeWavPackBlock(block, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WavPack block: %w", err)
+		}
+
+		// Multichannel audio is split over several blocks with the same index
+		if h.flags&wvFlagInitialBlock != 0 {
+			channel = 0
+		}
+		if bitDepth == 0 {
+			bitDepth, sampleRate = decoded.bitDepth, decoded.sampleRate
+		}
+		for _, samples := range decoded.channels {
+			if channel == len(data) {
+				data = append(data, nil)
+			}
+			data[channel] = append(data[channel], samples...)
+			channel++
+		}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid WavPack file: no audio blocks")
+	}
+
+	numSamples := len(data[0])
+	for ch := range data {
+		if len(data[ch]) < numSamples {
+			numSamples = len(data[ch])
+		}
+	}
+	for ch := range data {
+		data[ch] = data[ch][:numSamples]
+	}
+
+	return &Audio{
+		NumChannels: len(data),
+		SampleRate:  sampleRate,
+		BitDepth:    bitDepth,
+		Data:        data,
+		Duration:    float64(numSamples) / float64(sampleRate),
+		Metadata:    readAPEMetadata(raw),
+	}, nil
+}
+
+// encodeWavPack encodes audio data to a WavPack file with the mode from OptionWavPackMode
+func encodeWavPack(audio *Audio, filename string) error {
+	mode, err := wavpackModeName(audio)
+	if err != nil {
+		return err
+	}
+	bitrate := audio.wavpackBitrate
+	if bitrate == 0 {
+		bitrate = wvDefaultBitrate
+	}
+	if mode == "hybrid" && (bitrate < 1 || bitrate > 24) {
+		return fmt.Errorf("unsupported WavPack bitrate: %g bits per sample", bitrate)
+	}
+
+	samples, numChannels := interlace(audio)
+	channels := deinterlace(samples, numChannels)
+	numSamples := len(channels[0])
+
+	// Channels are coded in stereo pairs, an odd channel count ends with a mono stream
+	var streams []*wvStream
+	for ch := 0; ch < numChannels; ch += 2 {
+		streams = append(streams, newWvStream(ch+1 < numChannels, mode))
+	}
+
+	enc := &wvEncoder{
+		mode:         mode,
+		bitrate:      int(math.Round(bitrate * 256)),
+		bitDepth:     audio.BitDepth,
+		sampleRate:   audio.SampleRate,
+		numChannels:  numChannels,
+		totalSamples: numSamples,
+	}
+
+	var out []byte
+	for start := 0; start < numSamples; start += wvBlockSamples {
+		end := start + wvBlockSamples
+		if end > numSamples {
+			end = numSamples
+		}
+		for i, s := range streams {
+			var flags uint32
+			if i == 0 {
+				flags |= wvFlagInitialBlock
+			}
+			if i == len(streams)-1 {
+				flags |= wvFlagFinalBlock
+			}
+			block := [][]int{channels[2*i][start:end]}
+			if s.stereo {
+				block = append(block, channels[2*i+1][start:end])
+			}
+			out, err = enc.encodeBlock(out, s, block, start, flags)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.WriteFile(filename, out, 0644); err != nil {
+		return fmt.Errorf("failed to write WavPack file: %w", err)
+	}
+	return nil
+}
+
+// newWvStream creates the encoder state of a mono or stereo stream
+func newWvStream(stereo bool, mode string) *wvStream {
+	s := &wvStream{stereo: stereo, joint: stereo}
+	for i := len(wvDefaultTerms) - 1; i >= 0; i-- {
+		term := wvDefaultTerms[i]
+		if term < 0 && !stereo {
+			continue
+		}
+		s.decorr = append(s.decorr, wvDecorr{term: term, delta: 2})
+	}
+	s.words.stereo = stereo
+	if mode == "hybrid" {
+		s.words.hybrid = true
+		s.words.hybridBitrate = true
+		s.words.hybridBalance = stereo
+	}
+	return s
+}
+
+// wvEncoder holds the settings shared by every block of a file
+type wvEncoder struct {
+	mode         string
+	bitrate      int
+	bitDepth     int
+	sampleRate   int
+	numChannels  int
+	totalSamples int
+}
+
+// encodeBlock appends one block holding the samples of a mono or stereo stream
+func (e *wvEncoder) encodeBlock(out []byte, s *wvStream, channels [][]int, index int, flags uint32) ([]byte, error) {
+	n := len(channels[0])
+	bytesStored := e.bitDepth / 8
+	if e.mode == "float" {
+		bytesStored = 4
+		flags |= wvFlagFloat
+	}
+	flags |= uint32(bytesStored - 1)
+	if !s.stereo {
+		flags |= wvFlagMono
+	}
+	if s.joint {
+		flags |= wvFlagJointStereo
+	}
+	if s.words.hybrid {
+		flags |= wvFlagHybrid | wvFlagHybridBitrate
+		if s.words.hybridBalance {
+			flags |= wvFlagHybridBalance
+		}
+	}
+	for _, d := range s.decorr {
+		if d.term < 0 {
+			flags |= wvFlagCrossDecorr
+		}
+	}
+
+	// Split the samples into the integers that are coded and the bits sent separately
+	values := make([][]int, len(channels))
+	for ch := range channels {
+		values[ch] = make([]int, n)
+	}
+	var extra wvBitWriter
+	extraCRC := uint32(0xFFFFFFFF)
+	var info []byte
+	var infoID byte
+	if e.mode == "float" {
+		floatFlags, maxExp := e.splitFloats(channels, values, &extra, &extraCRC)
+		infoID = wvIDFloatInfo
+		info = []byte{byte(floatFlags), 0, byte(maxExp), 127}
+		if floatFlags == 0 {
+			extra.reset()
+		}
+	} else if e.bitDepth == 32 {
+		extraBits, shift := e.splitInts(channels, values, &extra, &extraCRC)
+		if extraBits > 0 || shift > 0 {
+			infoID = wvIDInt32Info
+			info = []byte{byte(extraBits), byte(shift), 0, 0}
+			flags |= wvFlagInt32
+		}
+	} else {
+		for ch := range channels {
+			copy(values[ch], channels[ch])
+		}
+	}
+
+	magnitude := 0
+	for ch := range values {
+		for _, value := range values[ch] {
+			if value < 0 {
+				value = ^value
+			}
+			magnitude |= value
+		}
+	}
+	flags |= uint32(bits.Len(uint(magnitude))) << wvMagLSB
+
+	rateIndex := 15
+	for i, rate := range wvSampleRates {
+		if rate == e.sampleRate {
+			rateIndex = i
+		}
+	}
+	flags |= uint32(rateIndex) << wvSRateLSB
+
+	// Metadata describing the state the decoder starts the block from
+	blockStart := len(out)
+	out = appendWvHeader(out, wvHeader{
+		version:      wvVersion,
+		totalSamples: e.totalSamples,
+		blockIndex:   index,
+		blockSamples: n,
+		flags:        flags,
+	})
+	out = appendWvSubBlock(out, wvIDDecorrTerms, s.storeTerms())
+	out = appendWvSubBlock(out, wvIDDecorrWeights, s.storeWeights())
+	out = appendWvSubBlock(out, wvIDDecorrSamples, s.storeSamples())
+	out = appendWvSubBlock(out, wvIDEntropyVars, s.storeEntropy())
+	if s.words.hybrid {
+		out = appendWvSubBlock(out, wvIDHybridProfile, s.storeHybridProfile(e.bitrate))
+	}
+	if info != nil {
+		out = appendWvSubBlock(out, infoID, info)
+	}
+	if flags&wvFlagInitialBlock != 0 && e.numChannels > 2 {
+		mask := uint32(1)<<uint(e.numChannels) - 1
+		out = appendWvSubBlock(out, wvIDChannelInfo, []byte{byte(e.numChannels), byte(mask), byte(mask >> 8), byte(mask >> 16)})
+	}
+	if rateIndex == 15 {
+		out = appendWvSubBlock(out, wvIDSampleRate, []byte{byte(e.sampleRate), byte(e.sampleRate >> 8), byte(e.sampleRate >> 16)})
+	}
+
+	// Code the residuals, running the decoder alongside so both sides keep the same state
+	s.words.reset()
+	var bitstream wvBitWriter
+	crc := uint32(0xFFFFFFFF)
+	for i := 0; i < n; i++ {
+		if s.stereo {
+			l, r := values[0][i], values[1][i]
+			if s.joint {
+				l, r = l-r, r+(l-r)>>1
+			}
+			rl, rr := s.residualStereo(l, r)
+			rl = s.words.putWord(&bitstream, rl, 0)
+			rr = s.words.putWord(&bitstream, rr, 1)
+			l, r = s.unpackStereo(rl, rr)
+			if s.joint {
+				r -= l >> 1
+				l += r
+			}
+			if !s.words.hybrid && (l != values[0][i] || r != values[1][i]) {
+				return nil, fmt.Errorf("WavPack encoder lost samples")
+			}
+			crc = (crc*3+uint32(l))*3 + uint32(r)
+		} else {
+			value := s.words.putWord(&bitstream, s.residualMono(values[0][i]), 0)
+			value = s.unpackMono(value)
+			if !s.words.hybrid && value != values[0][i] {
+				return nil, fmt.Errorf("WavPack encoder lost samples")
+			}
+			crc = crc*3 + uint32(value)
+		}
+	}
+	s.words.flush(&bitstream)
+
+	out = appendWvSubBlock(out, wvIDBitstream, bitstream.bytes())
+	if extra.n > 0 {
+		out = appendWvSubBlock(out, wvIDExtraBits, append(binary.LittleEndian.AppendUint32(nil, extraCRC), extra.bytes()...))
+	}
+
+	binary.LittleEndian.PutUint32(out[blockStart+4:], uint32(len(out)-blockStart-8))
+	binary.LittleEndian.PutUint32(out[blockStart+28:], crc)
+	return out, nil
+}
+
+// splitFloats converts samples to floats and splits them into integers relative to the largest exponent
+// and the low mantissa bits that don't fit, returning the float flags and the largest exponent
+func (e *wvEncoder) splitFloats(channels, values [][]int, extra *wvBitWriter, crc *uint32) (int, int) {
+	fullScale := float64(int64(1) << uint(e.bitDepth-1))
+	toFloat := func(sample int) uint32 {
+		return math.Float32bits(float32(float64(sample) / fullScale))
+	}
+
+	maxExp := 0
+	for ch := range channels {
+		for _, sample := range channels[ch] {
+			f := toFloat(sample)
+			if exp := int(f>>23) & 0xFF; f&0x7FFFFFFF != 0 && exp > maxExp {
+				maxExp = exp
+			}
+		}
+	}
+	if maxExp == 0 {
+		maxExp = 1
+	}
+
+	needed := false
+	for i := range channels[0] {
+		for ch := range channels {
+			f := toFloat(channels[ch][i])
+			sign := f >> 31
+			exp := int(f>>23) & 0xFF
+			mantissa := f & 0x7FFFFF
+			if f&0x7FFFFFFF == 0 {
+				// Zero, the decoder reads a single bit to learn it is not a tiny value
+				values[ch][i] = 0
+				extra.bit(0)
+				*crc = *crc*27 + 0
+				continue
+			}
+
+			full := mantissa
+			if exp > 0 {
+				full |= 0x800000
+			} else {
+				exp = 1
+			}
+			shift := maxExp - exp
+			var value uint32
+			if shift < 24 {
+				value = full >> uint(shift)
+			}
+			if value == 0 {
+				// Too small to be relative to the largest exponent, send the whole float
+				extra.bit(1)
+				extra.bits(mantissa, 23)
+				if maxExp >= 25 {
+					extra.bits(f>>23&0xFF, 8)
+				}
+				extra.bit(sign)
+				needed = true
+			} else if shift > 0 {
+				extra.bits(full, shift)
+				if full&(1<<uint(shift)-1) != 0 {
+					needed = true
+				}
+			}
+			*crc = *crc*27 + mantissa*9 + (f>>23&0xFF)*3 + sign
+
+			values[ch][i] = int(value)
+			if sign == 1 {
+				values[ch][i] = -int(value)
+			}
+		}
+	}
+
+	if !needed {
+		return 0, maxExp
+	}
+	return wvFloatShiftSent | wvFloatZeroSent, maxExp
+}
+
+// splitInts reduces 32-bit samples to the 24 bits WavPack codes. Samples with unused low bits are shifted,
+// otherwise the low bits are sent separately in lossless mode and dropped in hybrid mode.
+func (e *wvEncoder) splitInts(channels, values [][]int, extra *wvBitWriter, crc *uint32) (int, int) {
+	var all, minValue, maxValue int
+	for ch := range channels {
+		for _, sample := range channels[ch] {
+			all |= sample
+			minValue = min(minValue, sample)
+			maxValue = max(maxValue, sample)
+		}
+	}
+	reduce := 0
+	for minValue>>uint(reduce) < -(1<<23) || maxValue>>uint(reduce) >= 1<<23 {
+		reduce++
+	}
+	if reduce == 0 {
+		for ch := range channels {
+			copy(values[ch], channels[ch])
+		}
+		return 0, 0
+	}
+
+	shift := 0
+	if all != 0 {
+		shift = bits.TrailingZeros(uint(all))
+	}
+	if shift >= reduce {
+		for ch := range channels {
+			for i, sample := range channels[ch] {
+				values[ch][i] = sample >> uint(reduce)
+			}
+		}
+		return 0, reduce
+	}
+
+	for i := range channels[0] {
+		for ch := range channels {
+			sample := channels[ch][i]
+			values[ch][i] = sample >> uint(reduce)
+			if e.mode != "hybrid" {
+				extra.bits(uint32(sample), reduce)
+				u := uint32(sample)
+				*crc = *crc*9 + (u&0xFFFF)*3 + u>>16
+			}
+		}
+	}
+	return reduce, 0
+}
+
+// storeTerms returns the decorrelation terms in the order they are stored
+func (s *wvStream) storeTerms() []byte {
+	data := make([]byte, 0, len(s.decorr))
+	for i := len(s.decorr) - 1; i >= 0; i-- {
+		d := s.decorr[i]
+		data = append(data, byte((d.term+5)&0x1F|(d.delta<<5)&0xE0))
+	}
+	return data
+}
+
+// storeWeights returns the decorrelation weights, rounding the encoder's weights to the stored precision
+func (s *wvStream) storeWeights() []byte {
+	var data []byte
+	for i := len(s.decorr) - 1; i >= 0; i-- {
+		d := &s.decorr[i]
+		stored := wvStoreWeight(d.weightA)
+		d.weightA = wvRestoreWeight(stored)
+		data = append(data, byte(int8(stored)))
+		if s.stereo {
+			stored = wvStoreWeight(d.weightB)
+			d.weightB = wvRestoreWeight(stored)
+			data = append(data, byte(int8(stored)))
+		}
+	}
+	return data
+}
+
+// storeSamples returns the decorrelation history as logarithms. The encoder's history is rounded the same
+// way and rotated so the block starts at position zero, like the decoder's.
+func (s *wvStream) storeSamples() []byte {
+	var data []byte
+	put := func(value *int) {
+		stored := wvLog2s(*value)
+		*value = wvExp2(stored)
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(stored)))
+	}
+	for i := len(s.decorr) - 1; i >= 0; i-- {
+		d := &s.decorr[i]
+		switch {
+		case d.term > 8:
+			put(&d.samplesA[0])
+			put(&d.samplesA[1])
+			if s.stereo {
+				put(&d.samplesB[0])
+				put(&d.samplesB[1])
+			}
+		case d.term < 0:
+			put(&d.samplesA[0])
+			put(&d.samplesB[0])
+		default:
+			var a, b [8]int
+			for j := range a {
+				a[j] = d.samplesA[(s.pos+j)&7]
+				b[j] = d.samplesB[(s.pos+j)&7]
+			}
+			d.samplesA, d.samplesB = a, b
+			for j := 0; j < d.term; j++ {
+				put(&d.samplesA[j])
+				if s.stereo {
+					put(&d.samplesB[j])
+				}
+			}
+		}
+	}
+	s.pos = 0
+	return data
+}
+
+// storeEntropy returns the medians of each channel as logarithms, rounding the encoder's medians the same way
+func (s *wvStream) storeEntropy() []byte {
+	var data []byte
+	numChannels := 1
+	if s.stereo {
+		numChannels = 2
+	}
+	for ch := 0; ch < numChannels; ch++ {
+		for i := range s.words.ch[ch].median {
+			stored := wvLog2(s.words.ch[ch].median[i])
+			s.words.ch[ch].median[i] = uint32(wvExp2(stored))
+			data = binary.LittleEndian.AppendUint16(data, uint16(stored))
+		}
+	}
+	return data
+}
+
+// storeHybridProfile returns the slow levels and bitrate of each channel
+func (s *wvStream) storeHybridProfile(bitrate int) []byte {
+	var data []byte
+	numChannels := 1
+	if s.stereo {
+		numChannels = 2
+	}
+	for ch := 0; ch < numChannels; ch++ {
+		c := &s.words.ch[ch]
+		stored := wvLog2s(c.slowLevel)
+		c.slowLevel = wvExp2(stored)
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(stored)))
+	}
+	for ch := 0; ch < numChannels; ch++ {
+		c := &s.words.ch[ch]
+		c.bitrateAcc = uint32(bitrate) << 16
+		c.bitrateDelta = 0
+		data = binary.LittleEndian.AppendUint16(data, uint16(bitrate))
+	}
+	return data
+}
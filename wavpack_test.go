@@ -0,0 +1,257 @@
+package audiomorph
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSignal returns channels of a sine with noise and a silent gap, scaled to a bit depth
+func testSignal(numChannels, numSamples, bitDepth int) [][]int {
+	rng := rand.New(rand.NewSource(1))
+	scale := float64(int64(1)<<uint(bitDepth-1)) * 0.8
+	data := make([][]int, numChannels)
+	for ch := range data {
+		data[ch] = make([]int, numSamples)
+		for i := range data[ch] {
+			if i > numSamples/3 && i < numSamples/2 {
+				continue
+			}
+			value := math.Sin(2*math.Pi*float64(i)*float64(ch+1)*220/44100)*0.9 + rng.NormFloat64()*0.01
+			data[ch][i] = clampSample(value*scale, bitDepth)
+		}
+	}
+	return data
+}
+
+func TestWavPackRoundTrip(t *testing.T) {
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		for _, numChannels := range []int{1, 2, 3} {
+			audio := &Audio{
+				NumChannels: numChannels,
+				SampleRate:  44100,
+				BitDepth:    bitDepth,
+				Data:        testSignal(numChannels, 50000, bitDepth),
+			}
+
+			filename := filepath.Join(os.TempDir(), "test_output_wavpack.wv")
+			if err := EncodeFile(audio, filename); err != nil {
+				t.Fatalf("Failed to encode %d-bit %d channel WavPack file: %v", bitDepth, numChannels, err)
+			}
+			decoded, err := DecodeFile(filename)
+			os.Remove(filename)
+			if err != nil {
+				t.Fatalf("Failed to decode %d-bit %d channel WavPack file: %v", bitDepth, numChannels, err)
+			}
+
+			if decoded.NumChannels != numChannels || decoded.BitDepth != bitDepth || decoded.SampleRate != 44100 {
+				t.Fatalf("Format mismatch: got %d channels, %d bits, %d Hz", decoded.NumChannels, decoded.BitDepth, decoded.SampleRate)
+			}
+			assertSamplesEqual(t, audio.Data, decoded.Data)
+		}
+	}
+}
+
+func TestWavPackFloat(t *testing.T) {
+	// Samples decoded from float files are scaled float32 values, including tiny values and full scale
+	values := []float32{0, 1, -1, 0.5, -0.25, 1e-3, -1e-5, 1e-9, 3e-10, 0.999999}
+	rng := rand.New(rand.NewSource(2))
+	data := [][]int{make([]int, 30000), make([]int, 30000)}
+	for ch := range data {
+		for i := range data[ch] {
+			f := float32(rng.NormFloat64() * 0.2 * math.Exp(-float64(i)/3000))
+			if i < len(values) {
+				f = values[i]
+			}
+			data[ch][i] = clampSample(float64(f)*float64(int64(1)<<31), 32)
+		}
+	}
+	audio := &Audio{NumChannels: 2, SampleRate: 96000, BitDepth: 32, Data: data}
+
+	filename := filepath.Join(os.TempDir(), "test_output_float.wv")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionWavPackMode("float")); err != nil {
+		t.Fatalf("Failed to encode float WavPack file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode float WavPack file: %v", err)
+	}
+	if decoded.BitDepth != 32 || decoded.SampleRate != 96000 {
+		t.Fatalf("Format mismatch: got %d bits, %d Hz", decoded.BitDepth, decoded.SampleRate)
+	}
+	assertSamplesEqual(t, audio.Data, decoded.Data)
+}
+
+func TestWavPackFile(t *testing.T) {
+	audio, err := DecodeFile(filepath.Join("data", "wilhelm.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode source file: %v", err)
+	}
+
+	filename := filepath.Join(os.TempDir(), "test_output_wilhelm.wv")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionSampleRate(22222)); err != nil {
+		t.Fatalf("Failed to encode WavPack file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode WavPack file: %v", err)
+	}
+	if decoded.SampleRate != 22222 {
+		t.Errorf("SampleRate mismatch: expected 22222, got %d", decoded.SampleRate)
+	}
+	assertSamplesEqual(t, audio.Data, decoded.Data)
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat WavPack file: %v", err)
+	}
+	pcmSize := len(audio.Data) * len(audio.Data[0]) * audio.BitDepth / 8
+	t.Logf("WavPack file is %d bytes, %.1f%% of the PCM size", info.Size(), 100*float64(info.Size())/float64(pcmSize))
+	if int(info.Size()) >= pcmSize {
+		t.Errorf("WavPack file is not smaller than the PCM data")
+	}
+}
+
+func TestWavPackHybrid(t *testing.T) {
+	audio := &Audio{NumChannels: 2, SampleRate: 44100, BitDepth: 16, Data: testSignal(2, 44100, 16)}
+	original := [][]int{append([]int(nil), audio.Data[0]...), append([]int(nil), audio.Data[1]...)}
+
+	filename := filepath.Join(os.TempDir(), "test_output_hybrid.wv")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionWavPackMode("hybrid"), OptionWavPackBitrate(3)); err != nil {
+		t.Fatalf("Failed to encode hybrid WavPack file: %v", err)
+	}
+	decoded, err := DecodeFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to decode hybrid WavPack file: %v", err)
+	}
+
+	losslessFilename := filepath.Join(os.TempDir(), "test_output_lossless.wv")
+	defer os.Remove(losslessFilename)
+	if err := EncodeFile(&Audio{NumChannels: 2, SampleRate: 44100, BitDepth: 16, Data: original}, losslessFilename); err != nil {
+		t.Fatalf("Failed to encode lossless WavPack file: %v", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat WavPack file: %v", err)
+	}
+	losslessInfo, err := os.Stat(losslessFilename)
+	if err != nil {
+		t.Fatalf("Failed to stat WavPack file: %v", err)
+	}
+	bitsPerSample := float64(info.Size()*8) / float64(2*len(original[0]))
+	if info.Size() >= losslessInfo.Size()*3/4 {
+		t.Errorf("Hybrid file is %d bytes, expected well below the lossless %d bytes", info.Size(), losslessInfo.Size())
+	}
+
+	var signal, noise float64
+	for ch := range original {
+		for i, sample := range original[ch] {
+			diff := float64(decoded.Data[ch][i] - sample)
+			signal += float64(sample) * float64(sample)
+			noise += diff * diff
+		}
+	}
+	snr := 10 * math.Log10(signal/noise)
+	t.Logf("Hybrid WavPack: %.2f bits per sample, SNR %.1f dB", bitsPerSample, snr)
+	if snr < 10 {
+		t.Errorf("Hybrid SNR too low: %.1f dB", snr)
+	}
+}
+
+func TestWavPackReferenceFiles(t *testing.T) {
+	// The files were encoded by FFmpeg's WavPack encoder from testSignal(channels, 4410, bitDepth),
+	// the float file from that signal divided by 2^31
+	tests := []struct {
+		filename    string
+		numChannels int
+		bitDepth    int
+	}{
+		{"wavpack_int16.wv", 2, 16},
+		{"wavpack_int24_6ch.wv", 6, 24},
+		{"wavpack_float.wv", 2, 32},
+	}
+	for _, tt := range tests {
+		decoded, err := DecodeFile(filepath.Join("data", tt.filename))
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", tt.filename, err)
+		}
+		if decoded.NumChannels != tt.numChannels || decoded.BitDepth != tt.bitDepth || decoded.SampleRate != 44100 {
+			t.Fatalf("Format mismatch in %s: got %d channels, %d bits, %d Hz", tt.filename, decoded.NumChannels, decoded.BitDepth, decoded.SampleRate)
+		}
+		expected := testSignal(tt.numChannels, 4410, tt.bitDepth)
+		if tt.bitDepth == 32 {
+			for ch := range expected {
+				for i, sample := range expected[ch] {
+					f := float32(float64(sample) / float64(int64(1)<<31))
+					expected[ch][i] = clampSample(float64(f)*float64(int64(1)<<31), 32)
+				}
+			}
+		}
+		assertSamplesEqual(t, expected, decoded.Data)
+	}
+
+	// The hybrid file holds testSignal(2, 4410, 16) at 3 bits per sample, and the WAV file its
+	// samples as decoded by FFmpeg
+	decoded, err := DecodeFile(filepath.Join("data", "wavpack_hybrid.wv"))
+	if err != nil {
+		t.Fatalf("Failed to decode hybrid WavPack file: %v", err)
+	}
+	reference, err := DecodeFile(filepath.Join("data", "wavpack_hybrid.wav"))
+	if err != nil {
+		t.Fatalf("Failed to decode reference WAV file: %v", err)
+	}
+	assertSamplesEqual(t, reference.Data, decoded.Data)
+}
+
+func TestWavPackCRC(t *testing.T) {
+	audio := &Audio{NumChannels: 1, SampleRate: 44100, BitDepth: 16, Data: testSignal(1, 1000, 16)}
+	filename := filepath.Join(os.TempDir(), "test_output_crc.wv")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename); err != nil {
+		t.Fatalf("Failed to encode WavPack file: %v", err)
+	}
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read WavPack file: %v", err)
+	}
+	raw[28] ^= 0xFF
+	if err := os.WriteFile(filename, raw, 0644); err != nil {
+		t.Fatalf("Failed to write WavPack file: %v", err)
+	}
+	if _, err := DecodeFile(filename); err == nil {
+		t.Errorf("Expected a CRC error for a corrupted block")
+	}
+}
+
+func TestInvalidWavPackMode(t *testing.T) {
+	audio := &Audio{NumChannels: 1, SampleRate: 44100, BitDepth: 16, Data: [][]int{{0, 1, 2}}}
+	filename := filepath.Join(os.TempDir(), "test_output_invalid.wv")
+	defer os.Remove(filename)
+	if err := EncodeFile(audio, filename, OptionWavPackMode("dsd")); err == nil {
+		t.Errorf("Expected an error for an unsupported WavPack mode")
+	}
+}
+
+// assertSamplesEqual fails the test at the first differing sample
+func assertSamplesEqual(t *testing.T, expected, actual [][]int) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("Channel count mismatch: expected %d, got %d", len(expected), len(actual))
+	}
+	for ch := range expected {
+		if len(actual[ch]) != len(expected[ch]) {
+			t.Fatalf("Sample count mismatch on channel %d: expected %d, got %d", ch, len(expected[ch]), len(actual[ch]))
+		}
+		for i, sample := range expected[ch] {
+			if actual[ch][i] != sample {
+				t.Fatalf("Sample mismatch at channel %d index %d: expected %d, got %d", ch, i, sample, actual[ch][i])
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package audiomorph
+
+// wvDecorr is one WavPack decorrelation pass. Positive terms predict a channel from its own
+// earlier samples (17 and 18 extrapolate the last two), negative terms predict each stereo channel from the other.
+type wvDecorr struct {
+	term, delta        int
+	weightA, weightB   int
+	samplesA, samplesB [8]int
+}
+
+// wvApplyWeight scales a sample by a weight with 10 fractional bits
+func wvApplyWeight(weight, sample int) int {
+	return (weight*sample + 512) >> 10
+}
+
+// wvUpdateWeight moves a weight towards the correlation of a source sample and the residual it predicted
+func wvUpdateWeight(weight *int, delta, source, result int) {
+	if source == 0 || result == 0 {
+		return
+	}
+	if source^result < 0 {
+		*weight -= delta
+	} else {
+		*weight += delta
+	}
+}
+
+// wvUpdateWeightClip updates the weight of a cross channel pass, which is limited to +/-1024
+func wvUpdateWeightClip(weight *int, delta, source, result int) {
+	wvUpdateWeight(weight, delta, source, result)
+	if *weight > 1024 {
+		*weight = 1024
+	} else if *weight < -1024 {
+		*weight = -1024
+	}
+}
+
+// source returns the sample a positive term predicts from
+func (d *wvDecorr) source(samples *[8]int, pos int) int {
+	switch {
+	case d.term > 8 && d.term&1 == 1:
+		return 2*samples[0] - samples[1]
+	case d.term > 8:
+		return (3*samples[0] - samples[1]) >> 1
+	default:
+		return samples[pos]
+	}
+}
+
+// store records the output of a positive term in its history
+func (d *wvDecorr) store(samples *[8]int, pos, value int) {
+	if d.term > 8 {
+		samples[1] = samples[0]
+		samples[0] = value
+		return
+	}
+	samples[(pos+d.term)&7] = value
+}
+
+// wvStream is the state of a mono or stereo WavPack stream. Decorrelation passes are kept in decoding order.
+type wvStream struct {
+	stereo bool
+	joint  bool
+	decorr []wvDecorr
+	pos    int
+	words  wvWords
+}
+
+// unpackMono runs the decorrelation passes over a decoded residual and returns the sample
+func (s *wvStream) unpackMono(value int) int {
+	for i := range s.decorr {
+		d := &s.decorr[i]
+		a := d.source(&d.samplesA, s.pos)
+		out := value + wvApplyWeight(d.weightA, a)
+		wvUpdateWeight(&d.weightA, d.delta, a, value)
+		d.store(&d.samplesA, s.pos, out)
+		value = out
+	}
+	s.pos = (s.pos + 1) & 7
+	return value
+}
+
+// unpackStereo runs the decorrelation passes over a pair of decoded residuals and returns the samples
+func (s *wvStream) unpackStereo(l, r int) (int, int) {
+	for i := range s.decorr {
+		d := &s.decorr[i]
+		switch d.term {
+		case -1:
+			l2 := l + wvApplyWeight(d.weightA, d.samplesA[0])
+			wvUpdateWeightClip(&d.weightA, d.delta, d.samplesA[0], l)
+			l = l2
+			r2 := r + wvApplyWeight(d.weightB, l2)
+			wvUpdateWeightClip(&d.weightB, d.delta, l2, r)
+			r = r2
+			d.samplesA[0] = r
+		case -2:
+			r2 := r + wvApplyWeight(d.weightB, d.samplesB[0])
+			wvUpdateWeightClip(&d.weightB, d.delta, d.samplesB[0], r)
+			r = r2
+			l2 := l + wvApplyWeight(d.weightA, r2)
+			wvUpdateWeightClip(&d.weightA, d.delta, r2, l)
+			l = l2
+			d.samplesB[0] = l
+		case -3:
+			r2 := r + wvApplyWeight(d.weightB, d.samplesB[0])
+			wvUpdateWeightClip(&d.weightB, d.delta, d.samplesB[0], r)
+			r = r2
+			previous := d.samplesA[0]
+			d.samplesA[0] = r
+			l2 := l + wvApplyWeight(d.weightA, previous)
+			wvUpdateWeightClip(&d.weightA, d.delta, previous, l)
+			l = l2
+			d.samplesB[0] = l
+		default:
+			a := d.source(&d.samplesA, s.pos)
+			b := d.source(&d.samplesB, s.pos)
+			l2 := l + wvApplyWeight(d.weightA, a)
+			r2 := r + wvApplyWeight(d.weightB, b)
+			wvUpdateWeight(&d.weightA, d.delta, a, l)
+			wvUpdateWeight(&d.weightB, d.delta, b, r)
+			d.store(&d.samplesA, s.pos, l2)
+			d.store(&d.samplesB, s.pos, r2)
+			l, r = l2, r2
+		}
+	}
+	s.pos = (s.pos + 1) & 7
+	return l, r
+}
+
+// residualMono returns the residual that unpackMono turns back into a sample, without changing any state
+func (s *wvStream) residualMono(value int) int {
+	for i := len(s.decorr) - 1; i >= 0; i-- {
+		d := &s.decorr[i]
+		value -= wvApplyWeight(d.weightA, d.source(&d.samplesA, s.pos))
+	}
+	return value
+}
+
+// residualStereo returns the residuals that unpackStereo turns back into samples, without changing any state
+func (s *wvStream) residualStereo(l, r int) (int, int) {
+	for i := len(s.decorr) - 1; i >= 0; i-- {
+		d := &s.decorr[i]
+		switch d.term {
+		case -1:
+			r -= wvApplyWeight(d.weightB, l)
+			l -= wvApplyWeight(d.weightA, d.samplesA[0])
+		case -2:
+			l -= wvApplyWeight(d.weightA, r)
+			r -= wvApplyWeight(d.weightB, d.samplesB[0])
+		case -3:
+			r -= wvApplyWeight(d.weightB, d.samplesB[0])
+			l -= wvApplyWeight(d.weightA, d.samplesA[0])
+		default:
+			l -= wvApplyWeight(d.weightA, d.source(&d.samplesA, s.pos))
+			r -= wvApplyWeight(d.weightB, d.source(&d.samplesB, s.pos))
+		}
+	}
+	return l, r
+}
+
+// wvStoreWeight quantizes a weight to the signed byte stored in a block
+func wvStoreWeight(weight int) int {
+	if weight > 1024 {
+		weight = 1024
+	} else if weight < -1024 {
+		weight = -1024
+	}
+	if weight > 0 {
+		weight -= (weight + 64) >> 7
+	}
+	return (weight + 4) >> 3
+}
+
+// wvRestoreWeight expands a stored weight
+func wvRestoreWeight(stored int) int {
+	weight := stored << 3
+	if weight > 0 {
+		weight += (weight + 64) >> 7
+	}
+	return weight
+}
@@ -0,0 +1,583 @@
+package audiomorph
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// WavPack stores entropy and decorrelation state as 8.8 fixed point base 2 logarithms.
+// These are the fractional parts of 2^x and log2(1+x) used by the reference implementation.
+var wvExp2Table = [256]byte{
+	0x00, 0x01, 0x01, 0x02, 0x03, 0x03, 0x04, 0x05, 0x06, 0x06, 0x07, 0x08, 0x08, 0x09, 0x0a, 0x0b,
+	0x0b, 0x0c, 0x0d, 0x0e, 0x0e, 0x0f, 0x10, 0x10, 0x11, 0x12, 0x13, 0x13, 0x14, 0x15, 0x16, 0x16,
+	0x17, 0x18, 0x19, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1d, 0x1e, 0x1f, 0x20, 0x20, 0x21, 0x22, 0x23,
+	0x24, 0x24, 0x25, 0x26, 0x27, 0x28, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2c, 0x2d, 0x2e, 0x2f, 0x30,
+	0x30, 0x31, 0x32, 0x33, 0x34, 0x35, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3a, 0x3b, 0x3c, 0x3d,
+	0x3e, 0x3f, 0x40, 0x41, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x48, 0x49, 0x4a, 0x4b,
+	0x4c, 0x4d, 0x4e, 0x4f, 0x50, 0x51, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a,
+	0x5b, 0x5c, 0x5d, 0x5e, 0x5e, 0x5f, 0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+	0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+	0x7a, 0x7b, 0x7c, 0x7d, 0x7e, 0x7f, 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x87, 0x88, 0x89, 0x8a,
+	0x8b, 0x8c, 0x8d, 0x8e, 0x8f, 0x90, 0x91, 0x92, 0x93, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0x9b,
+	0x9c, 0x9d, 0x9f, 0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad,
+	0xaf, 0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xbc, 0xbd, 0xbe, 0xbf, 0xc0,
+	0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc8, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf, 0xd0, 0xd2, 0xd3, 0xd4,
+	0xd6, 0xd7, 0xd8, 0xd9, 0xdb, 0xdc, 0xdd, 0xde, 0xe0, 0xe1, 0xe2, 0xe4, 0xe5, 0xe6, 0xe8, 0xe9,
+	0xea, 0xec, 0xed, 0xee, 0xf0, 0xf1, 0xf2, 0xf4, 0xf5, 0xf6, 0xf8, 0xf9, 0xfa, 0xfc, 0xfd, 0xff,
+}
+var wvLog2Table = [256]byte{
+	0x00, 0x01, 0x03, 0x04, 0x06, 0x07, 0x09, 0x0a, 0x0b, 0x0d, 0x0e, 0x10, 0x11, 0x12, 0x14, 0x15,
+	0x16, 0x18, 0x19, 0x1a, 0x1c, 0x1d, 0x1e, 0x20, 0x21, 0x22, 0x24, 0x25, 0x26, 0x28, 0x29, 0x2a,
+	0x2c, 0x2d, 0x2e, 0x2f, 0x31, 0x32, 0x33, 0x34, 0x36, 0x37, 0x38, 0x39, 0x3b, 0x3c, 0x3d, 0x3e,
+	0x3f, 0x41, 0x42, 0x43, 0x44, 0x45, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4d, 0x4e, 0x4f, 0x50, 0x51,
+	0x52, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x5c, 0x5d, 0x5e, 0x5f, 0x60, 0x61, 0x62, 0x63,
+	0x64, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72, 0x74, 0x75,
+	0x76, 0x77, 0x78, 0x79, 0x7a, 0x7b, 0x7c, 0x7d, 0x7e, 0x7f, 0x80, 0x81, 0x82, 0x83, 0x84, 0x85,
+	0x86, 0x87, 0x88, 0x89, 0x8a, 0x8b, 0x8c, 0x8d, 0x8e, 0x8f, 0x90, 0x91, 0x92, 0x93, 0x94, 0x95,
+	0x96, 0x97, 0x98, 0x99, 0x9a, 0x9b, 0x9b, 0x9c, 0x9d, 0x9e, 0x9f, 0xa0, 0xa1, 0xa2, 0xa3, 0xa4,
+	0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf, 0xb0, 0xb1, 0xb2, 0xb2,
+	0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf, 0xc0, 0xc0,
+	0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xcb, 0xcb, 0xcc, 0xcd, 0xce,
+	0xcf, 0xd0, 0xd0, 0xd1, 0xd2, 0xd3, 0xd4, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd8, 0xd9, 0xda, 0xdb,
+	0xdc, 0xdc, 0xdd, 0xde, 0xdf, 0xe0, 0xe0, 0xe1, 0xe2, 0xe3, 0xe4, 0xe4, 0xe5, 0xe6, 0xe7, 0xe7,
+	0xe8, 0xe9, 0xea, 0xea, 0xeb, 0xec, 0xed, 0xee, 0xee, 0xef, 0xf0, 0xf1, 0xf1, 0xf2, 0xf3, 0xf4,
+	0xf4, 0xf5, 0xf6, 0xf7, 0xf7, 0xf8, 0xf9, 0xf9, 0xfa, 0xfb, 0xfc, 0xfc, 0xfd, 0xfe, 0xff, 0xff,
+}
+
+// wvExp2 returns 2^(log/256) for a signed 8.8 fixed point logarithm
+func wvExp2(log int) int {
+	if log < 0 {
+		return -wvExp2(-log)
+	}
+	value := int(wvExp2Table[log&0xFF]) | 0x100
+	log >>= 8
+	if log <= 9 {
+		return value >> uint(9-log)
+	}
+	return value << uint(log-9)
+}
+
+// wvLog2 returns the 8.8 fixed point base 2 logarithm of value+1, rounded the way WavPack does
+func wvLog2(value uint32) int {
+	value += value >> 9
+	dbits := bits.Len32(value)
+	if dbits < 9 {
+		return dbits<<8 + int(wvLog2Table[(value<<uint(9-dbits))&0xFF])
+	}
+	return dbits<<8 + int(wvLog2Table[(value>>uint(dbits-9))&0xFF])
+}
+
+// wvLog2s returns the signed logarithm of value
+func wvLog2s(value int) int {
+	if value < 0 {
+		return -wvLog2(uint32(-value))
+	}
+	return wvLog2(uint32(value))
+}
+
+// wvBitReader reads a WavPack bitstream, least significant bit first
+type wvBitReader struct {
+	data []byte
+	pos  int
+}
+
+// bit reads a single bit. Reading past the end returns zeros, which callers detect with left.
+func (r *wvBitReader) bit() uint32 {
+	if r.pos >= len(r.data)*8 {
+		r.pos++
+		return 0
+	}
+	b := uint32(r.data[r.pos>>3]>>uint(r.pos&7)) & 1
+	r.pos++
+	return b
+}
+
+// bits reads n bits into an integer, first bit in the least significant position
+func (r *wvBitReader) bits(n int) uint32 {
+	var value uint32
+	for i := 0; i < n; i++ {
+		value |= r.bit() << uint(i)
+	}
+	return value
+}
+
+// left returns the number of unread bits
+func (r *wvBitReader) left() int {
+	return len(r.data)*8 - r.pos
+}
+
+// escape reads a count stored as a unary bit length followed by the remaining bits
+func (r *wvBitReader) escape() (int, error) {
+	cbits := 0
+	for cbits < 33 && r.bit() == 1 {
+		cbits++
+	}
+	if cbits == 33 || r.left() < 0 {
+		return 0, fmt.Errorf("invalid WavPack bitstream")
+	}
+	if cbits < 2 {
+		return cbits, nil
+	}
+	return int(r.bits(cbits-1) | 1<<uint(cbits-1)), nil
+}
+
+// code reads a value in the range 0 to maxCode using a truncated binary code
+func (r *wvBitReader) code(maxCode uint32) uint32 {
+	if maxCode == 0 {
+		return 0
+	}
+	bitCount := bits.Len32(maxCode)
+	extras := uint32(1)<<uint(bitCount) - maxCode - 1
+	code := r.bits(bitCount - 1)
+	if code >= extras {
+		code = code<<1 - extras + r.bit()
+	}
+	return code
+}
+
+// wvBitWriter writes a WavPack bitstream, least significant bit first
+type wvBitWriter struct {
+	data []byte
+	n    int
+}
+
+// bit writes a single bit
+func (w *wvBitWriter) bit(b uint32) {
+	if w.n&7 == 0 {
+		w.data = append(w.data, 0)
+	}
+	w.data[w.n>>3] |= byte(b&1) << uint(w.n&7)
+	w.n++
+}
+
+// bits writes the low n bits of value, least significant first
+func (w *wvBitWriter) bits(value uint32, n int) {
+	for i := 0; i < n; i++ {
+		w.bit(value >> uint(i))
+	}
+}
+
+// append writes every bit of another writer
+func (w *wvBitWriter) append(other *wvBitWriter) {
+	for i := 0; i < other.n; i++ {
+		w.bit(uint32(other.data[i>>3] >> uint(i&7)))
+	}
+}
+
+// reset empties the writer for reuse
+func (w *wvBitWriter) reset() {
+	w.data = w.data[:0]
+	w.n = 0
+}
+
+// escape writes a count read back by wvBitReader.escape
+func (w *wvBitWriter) escape(count int) {
+	if count < 2 {
+		w.bits(1, count)
+		w.bit(0)
+		return
+	}
+	cbits := bits.Len(uint(count))
+	w.bits(1<<uint(cbits)-1, cbits)
+	w.bit(0)
+	w.bits(uint32(count), cbits-1)
+}
+
+// code writes a value in the range 0 to maxCode using a truncated binary code
+func (w *wvBitWriter) code(code, maxCode uint32) {
+	if maxCode == 0 {
+		return
+	}
+	bitCount := bits.Len32(maxCode)
+	extras := uint32(1)<<uint(bitCount) - maxCode - 1
+	if code < extras {
+		w.bits(code, bitCount-1)
+		return
+	}
+	w.bits((code+extras)>>1, bitCount-1)
+	w.bit((code + extras) & 1)
+}
+
+// bytes returns the written bitstream padded to a whole number of 16-bit words
+func (w *wvBitWriter) bytes() []byte {
+	if len(w.data)%2 == 1 {
+		return append(w.data, 0)
+	}
+	return w.data
+}
+
+// wvLimitOnes is the longest run of ones before a unary count switches to an escape code
+const wvLimitOnes = 16
+
+// wvChannel is the adaptive entropy state of one channel
+type wvChannel struct {
+	median       [3]uint32
+	slowLevel    int
+	errorLimit   int
+	bitrateAcc   uint32
+	bitrateDelta uint32
+}
+
+// getMed returns the current step size of a median
+func (c *wvChannel) getMed(n int) uint32 {
+	return c.median[n]>>4 + 1
+}
+
+// incMed moves a median up after a value above it
+func (c *wvChannel) incMed(n int) {
+	div := uint32(128 >> uint(n))
+	c.median[n] += (c.median[n] + div) / div * 5
+}
+
+// decMed moves a median down after a value below it
+func (c *wvChannel) decMed(n int) {
+	div := uint32(128 >> uint(n))
+	c.median[n] -= (c.median[n] + div - 2) / div * 2
+}
+
+// levelDecay returns the amount a slow level decays by for each sample
+func levelDecay(level int) int {
+	return (level + 0x80) >> 8
+}
+
+// wvWords is the entropy coder shared by the WavPack decoder and encoder.
+// Values are coded against three running medians; runs of zeros in quiet passages are run length coded.
+type wvWords struct {
+	ch            [2]wvChannel
+	stereo        bool
+	hybrid        bool
+	hybridBitrate bool
+	hybridBalance bool
+	holdingZero   bool
+	holdingOne    bool
+	zeroRun       int
+	pending       bool
+	pendingOnes   int
+	pendingBits   wvBitWriter
+}
+
+// reset clears the per block state, keeping the medians and hybrid levels read from the block metadata
+func (w *wvWords) reset() {
+	w.holdingZero = false
+	w.holdingOne = false
+	w.zeroRun = 0
+	w.pending = false
+	w.pendingBits.reset()
+	for i := range w.ch {
+		w.ch[i].errorLimit = 0
+	}
+}
+
+// inQuietPassage reports whether the next value is preceded by a zero run count
+func (w *wvWords) inQuietPassage() bool {
+	return w.ch[0].median[0] < 2 && w.ch[1].median[0] < 2 && !w.holdingZero && !w.holdingOne
+}
+
+// clearMedians resets both channels at the start of a zero run
+func (w *wvWords) clearMedians() {
+	w.ch[0].median = [3]uint32{}
+	w.ch[1].median = [3]uint32{}
+}
+
+// updateErrorLimit sets the largest error each channel may have in hybrid mode
+func (w *wvWords) updateErrorLimit() {
+	numChannels := 1
+	if w.stereo {
+		numChannels = 2
+	}
+
+	var bitrate, slowLog [2]int
+	for i := 0; i < numChannels; i++ {
+		w.ch[i].bitrateAcc += w.ch[i].bitrateDelta
+		bitrate[i] = int(w.ch[i].bitrateAcc >> 16)
+		slowLog[i] = levelDecay(w.ch[i].slowLevel)
+	}
+	if !w.hybridBitrate {
+		for i := 0; i < numChannels; i++ {
+			w.ch[i].errorLimit = wvExp2(bitrate[i])
+		}
+		return
+	}
+
+	// Balanced stereo moves bits towards the louder channel
+	if w.stereo && w.hybridBalance {
+		balance := (slowLog[1] - slowLog[0] + bitrate[1] + 1) >> 1
+		switch {
+		case balance > bitrate[0]:
+			bitrate[1] = bitrate[0] * 2
+			bitrate[0] = 0
+		case -balance > bitrate[0]:
+			bitrate[0] *= 2
+			bitrate[1] = 0
+		default:
+			bitrate[1] = bitrate[0] + balance
+			bitrate[0] -= balance
+		}
+	}
+	for i := 0; i < numChannels; i++ {
+		if slowLog[i]-bitrate[i] > -0x100 {
+			w.ch[i].errorLimit = wvExp2(slowLog[i] - bitrate[i] + 0x100)
+		} else {
+			w.ch[i].errorLimit = 0
+		}
+	}
+}
+
+// bucket returns the median bucket of a magnitude with its lower and upper bounds, and adapts the medians
+func (c *wvChannel) bucket(mag uint32) (int, uint32, uint32) {
+	if mag < c.getMed(0) {
+		high := c.getMed(0) - 1
+		c.decMed(0)
+		return 0, 0, high
+	}
+	low := c.getMed(0)
+	c.incMed(0)
+	if mag-low < c.getMed(1) {
+		high := low + c.getMed(1) - 1
+		c.decMed(1)
+		return 1, low, high
+	}
+	low += c.getMed(1)
+	c.incMed(1)
+	if mag-low < c.getMed(2) {
+		high := low + c.getMed(2) - 1
+		c.decMed(2)
+		return 2, low, high
+	}
+	t := 2 + int((mag-low)/c.getMed(2))
+	low += uint32(t-2) * c.getMed(2)
+	high := low + c.getMed(2) - 1
+	c.incMed(2)
+	return t, low, high
+}
+
+// bounds returns the lower and upper bounds of a median bucket, and adapts the medians
+func (c *wvChannel) bounds(t int) (uint32, uint32) {
+	switch t {
+	case 0:
+		high := c.getMed(0) - 1
+		c.decMed(0)
+		return 0, high
+	case 1:
+		low := c.getMed(0)
+		high := low + c.getMed(1) - 1
+		c.incMed(0)
+		c.decMed(1)
+		return low, high
+	case 2:
+		low := c.getMed(0) + c.getMed(1)
+		high := low + c.getMed(2) - 1
+		c.incMed(0)
+		c.incMed(1)
+		c.decMed(2)
+		return low, high
+	default:
+		low := c.getMed(0) + c.getMed(1) + uint32(t-2)*c.getMed(2)
+		high := low + c.getMed(2) - 1
+		c.incMed(0)
+		c.incMed(1)
+		c.incMed(2)
+		return low, high
+	}
+}
+
+// getWord decodes the next residual of a channel
+func (w *wvWords) getWord(r *wvBitReader, channel int) (int, error) {
+	c := &w.ch[channel]
+
+	if w.inQuietPassage() {
+		if w.zeroRun > 0 {
+			w.zeroRun--
+			if w.zeroRun > 0 {
+				c.slowLevel -= levelDecay(c.slowLevel)
+				return 0, nil
+			}
+		} else {
+			count, err := r.escape()
+			if err != nil {
+				return 0, err
+			}
+			w.zeroRun = count
+			if count > 0 {
+				w.clearMedians()
+				c.slowLevel -= levelDecay(c.slowLevel)
+				return 0, nil
+			}
+		}
+	}
+
+	t := 0
+	if w.holdingZero {
+		w.holdingZero = false
+	} else {
+		// A run of ones is ended by a zero, a run of the limit is followed by an escape code
+		ones := 0
+		for ones <= wvLimitOnes && r.bit() == 1 {
+			ones++
+		}
+		if ones > wvLimitOnes {
+			return 0, fmt.Errorf("invalid WavPack bitstream")
+		}
+		if ones == wvLimitOnes {
+			extra, err := r.escape()
+			if err != nil {
+				return 0, err
+			}
+			ones += extra
+		}
+
+		// The low bit says whether the next value is above the first median
+		if w.holdingOne {
+			t = ones>>1 + 1
+		} else {
+			t = ones >> 1
+		}
+		w.holdingOne = ones&1 == 1
+		w.holdingZero = !w.holdingOne
+	}
+
+	if w.hybrid && channel == 0 {
+		w.updateErrorLimit()
+	}
+
+	low, high := c.bounds(t)
+	var mag uint32
+	if c.errorLimit == 0 {
+		mag = low + r.code(high-low)
+	} else {
+		// Hybrid mode narrows the bucket down to the error limit, the midpoint is the value
+		mid := (high + low + 1) >> 1
+		for high-low > uint32(c.errorLimit) {
+			if r.bit() == 1 {
+				low = mid
+			} else {
+				high = mid - 1
+			}
+			mid = (high + low + 1) >> 1
+		}
+		mag = mid
+	}
+	sign := r.bit()
+	if r.left() < 0 {
+		return 0, fmt.Errorf("truncated WavPack bitstream")
+	}
+
+	if w.hybridBitrate {
+		c.slowLevel += wvLog2(mag) - levelDecay(c.slowLevel)
+	}
+	if sign == 1 {
+		return ^int(mag), nil
+	}
+	return int(mag), nil
+}
+
+// putWord encodes a residual of a channel and returns the value the decoder will see.
+// Each unary count also tells whether the next value is above the first median,
+// so the bits of a value are held back until the next value is known.
+func (w *wvWords) putWord(out *wvBitWriter, value, channel int) int {
+	c := &w.ch[channel]
+
+	if !w.pending && w.inQuietPassage() {
+		if w.zeroRun > 0 {
+			if value == 0 {
+				w.zeroRun++
+				c.slowLevel -= levelDecay(c.slowLevel)
+				return 0
+			}
+			out.escape(w.zeroRun)
+			w.zeroRun = 0
+		} else if value == 0 {
+			w.clearMedians()
+			w.zeroRun = 1
+			c.slowLevel -= levelDecay(c.slowLevel)
+			return 0
+		} else {
+			out.bit(0)
+		}
+	}
+
+	if w.hybrid && channel == 0 {
+		w.updateErrorLimit()
+	}
+
+	mag := uint32(value)
+	sign := uint32(0)
+	if value < 0 {
+		mag = uint32(^value)
+		sign = 1
+	}
+	t, low, high := c.bucket(mag)
+
+	if w.pending {
+		w.flushPending(out, t > 0)
+	}
+	dst := out
+	if w.holdingZero {
+		w.holdingZero = false
+	} else {
+		w.pending = true
+		w.pendingOnes = 2 * t
+		if w.holdingOne {
+			w.pendingOnes -= 2
+		}
+		w.pendingBits.reset()
+		dst = &w.pendingBits
+	}
+
+	if c.errorLimit == 0 {
+		dst.code(mag-low, high-low)
+	} else {
+		mid := (high + low + 1) >> 1
+		for high-low > uint32(c.errorLimit) {
+			if mag < mid {
+				high = mid - 1
+				dst.bit(0)
+			} else {
+				low = mid
+				dst.bit(1)
+			}
+			mid = (high + low + 1) >> 1
+		}
+		mag = mid
+	}
+	dst.bit(sign)
+
+	if w.hybridBitrate {
+		c.slowLevel += wvLog2(mag) - levelDecay(c.slowLevel)
+	}
+	if sign == 1 {
+		return ^int(mag)
+	}
+	return int(mag)
+}
+
+// flushPending writes the held back value once it is known whether the next value is above the first median
+func (w *wvWords) flushPending(out *wvBitWriter, nextAboveMedian bool) {
+	ones := w.pendingOnes
+	if nextAboveMedian {
+		ones++
+	}
+	if ones < wvLimitOnes {
+		out.bits(1<<uint(ones)-1, ones)
+		out.bit(0)
+	} else {
+		out.bits(1<<wvLimitOnes-1, wvLimitOnes+1)
+		out.escape(ones - wvLimitOnes)
+	}
+	out.append(&w.pendingBits)
+
+	w.pending = false
+	w.holdingOne = nextAboveMedian
+	w.holdingZero = !nextAboveMedian
+}
+
+// flush writes any held back value or zero run at the end of a block
+func (w *wvWords) flush(out *wvBitWriter) {
+	if w.zeroRun > 0 {
+		out.escape(w.zeroRun)
+		w.zeroRun = 0
+	}
+	if w.pending {
+		w.flushPending(out, false)
+	}
+}